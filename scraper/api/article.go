@@ -3,20 +3,61 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/danglnh07/newsaggr/scraper/db"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // Article response struct for GET actions
 type ArticleResponse struct {
-	ID            uint    `json:"id"`
-	Title         string  `json:"title"`
-	Url           string  `json:"url"`
-	Image         *string `json:"image"`
-	PublishedDate string  `json:"published_date"`
-	Category      string  `json:"category"`
+	ID            uint                    `json:"id"`
+	SourceID      uint                    `json:"source_id"` // Source the article was first stored from
+	Title         string                  `json:"title"`
+	Url           string                  `json:"url"`
+	CanonicalURL  string                  `json:"canonical_url"` // Link the publisher gives for the article, else its URL
+	Image         *string                 `json:"image"`
+	PublishedDate string                  `json:"published_date"`
+	Category      string                  `json:"category"`
+	Starred       bool                    `json:"starred"`
+	Sources       []ArticleSourceResponse `json:"sources"` // Other sources that carried the article
+}
+
+// Another source that carried an article, under its own URL
+type ArticleSourceResponse struct {
+	SourceID uint   `json:"source_id"`
+	Url      string `json:"url"`
+}
+
+// Helper function: convert an article model into its response struct
+func NewArticleResponse(article db.Article) ArticleResponse {
+	var image *string = nil
+	if article.Image.Valid {
+		image = &article.Image.String
+	}
+
+	canonical := article.Url
+	if article.CanonicalURL != nil {
+		canonical = *article.CanonicalURL
+	}
+
+	sources := make([]ArticleSourceResponse, len(article.Sources))
+	for i, source := range article.Sources {
+		sources[i] = ArticleSourceResponse{SourceID: source.SourceID, Url: source.Url}
+	}
+
+	return ArticleResponse{
+		ID:            article.ID,
+		SourceID:      article.SourceID,
+		Title:         article.Title,
+		Url:           article.Url,
+		CanonicalURL:  canonical,
+		Image:         image,
+		PublishedDate: article.PublishedDate,
+		Category:      article.Source.Category,
+		Starred:       article.Starred,
+		Sources:       sources,
+	}
 }
 
 // GetArticle godoc
@@ -27,43 +68,36 @@ type ArticleResponse struct {
 // @Produce      json
 // @Param        id   path      int  true  "Article ID"
 // @Success      200  {object}  ArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
 // @Failure      404  {object}  ErrorResponse  "Article not found"
 // @Failure      500  {object}  ErrorResponse  "Failed to get article"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/articles/{id} [get]
 func (server *Server) GetArticle(ctx *gin.Context) {
 	// Get ID from path parameter
-	id := ctx.Param("id")
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
 
 	// Fetch article from database
-	var article db.Article
-	result := server.queries.DB.Preload("Source").First(&article, id)
-	if result.Error != nil {
+	article, err := server.articles.GetArticle(ctx.Request.Context(), id)
+	if err != nil {
 		// If ID not match any record
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Article not found"})
 			return
 		}
 
 		// Other database error
-		server.logger.Error("GET /api/articles/:id: Failed to get article", "error", result.Error)
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/articles/:id: Failed to get article", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get article"})
 		return
 	}
 
-	var image *string = nil
-	if article.Image.Valid {
-		image = &article.Image.String
-	}
-
 	// Return article back to client
-	ctx.JSON(http.StatusOK, ArticleResponse{
-		ID:            article.ID,
-		Title:         article.Title,
-		Url:           article.Url,
-		Image:         image,
-		PublishedDate: article.PublishedDate,
-		Category:      article.Source.Category,
-	})
+	ctx.JSON(http.StatusOK, NewArticleResponse(article))
 }
 
 // ListArticles godoc
@@ -72,10 +106,15 @@ func (server *Server) GetArticle(ctx *gin.Context) {
 // @Tags         articles
 // @Accept       json
 // @Produce      json
-// @Param        page_id    query     int  true   "Page number"
-// @Param        page_size  query     int  true   "Number of items per page"
+// @Param        page_id    query     int     true   "Page number"
+// @Param        page_size  query     int     true   "Number of items per page"
+// @Param        source_id  query     int     false  "Only articles from this source, or carried by it too"
+// @Param        category   query     string  false  "Only articles whose source has this category"
+// @Param        q          query     string  false  "Full text search on the article title"
 // @Success      200  {array}   ArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid query parameter"
 // @Failure      500  {object}  ErrorResponse  "Failed to list articles"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/articles [get]
 func (server *Server) ListArticles(ctx *gin.Context) {
 	// Get pagination parameters
@@ -85,31 +124,105 @@ func (server *Server) ListArticles(ctx *gin.Context) {
 		return
 	}
 
+	// Get filter parameters
+	filter := db.ArticleFilter{
+		Category: ctx.Query("category"),
+		Search:   ctx.Query("q"),
+		Limit:    pageSize,
+		Offset:   (pageID - 1) * pageSize,
+	}
+
+	if sourceID := ctx.Query("source_id"); sourceID != "" {
+		id, err := strconv.ParseUint(sourceID, 10, 0)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source_id parameter"})
+			return
+		}
+		filter.SourceID = uint(id)
+	}
+
 	// Fetch articles from database with pagination
-	var articles []db.Article
-	result := server.queries.DB.Preload("Source").Limit(int(pageSize)).Offset(int((pageID - 1) * pageSize)).Find(&articles)
-	if result.Error != nil {
-		server.logger.Error("GET /api/articles: Failed to list articles", "error", result.Error)
+	articles, err := server.articles.ListArticles(ctx.Request.Context(), filter)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/articles: Failed to list articles", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list articles"})
 		return
 	}
 
 	resp := make([]ArticleResponse, len(articles))
 	for i, article := range articles {
-		var image *string = nil
-		if article.Image.Valid {
-			image = &article.Image.String
-		}
-
-		resp[i] = ArticleResponse{
-			ID:            article.ID,
-			Title:         article.Title,
-			Url:           article.Url,
-			Image:         image,
-			PublishedDate: article.PublishedDate,
-		}
+		resp[i] = NewArticleResponse(article)
 	}
 
 	// Return the result back to client
 	ctx.JSON(http.StatusOK, resp)
 }
+
+// StarArticle godoc
+// @Summary      Star an article
+// @Description  Mark an article as starred, starred articles are exempt from retention
+// @Tags         articles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Article ID"
+// @Success      200  {object}  ArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Article not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to update article"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/articles/{id}/star [put]
+func (server *Server) StarArticle(ctx *gin.Context) {
+	server.setArticleStarred(ctx, true)
+}
+
+// UnstarArticle godoc
+// @Summary      Unstar an article
+// @Description  Remove the star of an article, making it subject to retention again
+// @Tags         articles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Article ID"
+// @Success      200  {object}  ArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Article not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to update article"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/articles/{id}/star [delete]
+func (server *Server) UnstarArticle(ctx *gin.Context) {
+	server.setArticleStarred(ctx, false)
+}
+
+// Helper method: shared implementation of StarArticle and UnstarArticle
+func (server *Server) setArticleStarred(ctx *gin.Context, starred bool) {
+	// Get ID from path parameter
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	article, err := server.articles.GetArticle(ctx.Request.Context(), id)
+	if err != nil {
+		// If ID not match any record
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Article not found"})
+			return
+		}
+
+		// Other database error
+		server.logger.ErrorContext(ctx.Request.Context(), ctx.Request.Method+" /api/articles/:id/star: Failed to get article", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get article"})
+		return
+	}
+
+	article.Starred = starred
+	if err := server.articles.UpdateArticle(ctx.Request.Context(), &article); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), ctx.Request.Method+" /api/articles/:id/star: Failed to update article", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update article"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewArticleResponse(article))
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Key of the authenticated API key in the gin context
+const apiKeyContextKey = "api_key"
+
+// Helper function: extract the API key from the Authorization or X-API-Key header
+func requestAPIKey(ctx *gin.Context) string {
+	if header := ctx.GetHeader("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ctx.GetHeader("X-API-Key")
+}
+
+// Middleware: authenticate the API key of the request and make sure its role
+// allows at least the required one, then apply the rate limit of the client.
+// Reader routes stay public when anonymous read is allowed, but a key that is
+// sent must still be valid.
+func (server *Server) RequireRole(required string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		plain := requestAPIKey(ctx)
+		if plain == "" {
+			if required == db.RoleReader && server.config.Server.AllowAnonymousRead {
+				// Anonymous clients are told apart by IP
+				if server.rateLimit(ctx, "ip:"+ctx.ClientIP(), 0) {
+					ctx.Next()
+				}
+				return
+			}
+
+			ctx.Header("WWW-Authenticate", "Bearer")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Message: "Missing API key"})
+			return
+		}
+
+		key, err := server.apiKeys.GetAPIKeyByHash(ctx.Request.Context(), service.HashAPIKey(plain))
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				ctx.Header("WWW-Authenticate", "Bearer")
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Message: "Invalid API key"})
+				return
+			}
+
+			server.logger.ErrorContext(ctx.Request.Context(), "Auth middleware: Failed to get API key", "error", err)
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to authenticate"})
+			return
+		}
+
+		if !db.RoleAllows(key.Role, required) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Message: "Insufficient role"})
+			return
+		}
+
+		ctx.Set(apiKeyContextKey, key)
+		if server.rateLimit(ctx, fmt.Sprintf("key:%d", key.ID), key.DailyQuota) {
+			ctx.Next()
+		}
+	}
+}
+
+// Response struct for API key. The plain key is only set right after creation.
+type APIKeyResponse struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	Role       string    `json:"role"`
+	DailyQuota int       `json:"daily_quota"`
+	CreatedAt  time.Time `json:"created_at"`
+	Key        string    `json:"key,omitempty"`
+}
+
+// Helper function: convert an API key model into its response struct
+func NewAPIKeyResponse(key db.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Role:       key.Role,
+		DailyQuota: key.DailyQuota,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  Retrieve every active API key, without their values
+// @Tags         keys
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {array}   APIKeyResponse
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      500  {object}  ErrorResponse  "Failed to list API keys"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/keys [get]
+func (server *Server) ListAPIKeys(ctx *gin.Context) {
+	keys, err := server.apiKeys.ListAPIKeys(ctx.Request.Context())
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/keys: Failed to list API keys", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list API keys"})
+		return
+	}
+
+	resp := make([]APIKeyResponse, len(keys))
+	for i, key := range keys {
+		resp[i] = NewAPIKeyResponse(key)
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// Request struct for create API key action
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"required,oneof=reader editor admin"`
+
+	// Requests allowed per UTC day, 0 uses the server default
+	DailyQuota int `json:"daily_quota" binding:"min=0"`
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Generate a new API key. Its value is only returned in this response.
+// @Tags         keys
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        key  body      CreateAPIKeyRequest  true  "Key details"
+// @Success      201  {object}  APIKeyResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      500  {object}  ErrorResponse  "Failed to create API key"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/keys [post]
+func (server *Server) CreateAPIKey(ctx *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/keys: Invalid request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
+		return
+	}
+
+	key, plain, err := service.CreateAPIKey(ctx.Request.Context(), server.apiKeys, req.Name, req.Role, req.DailyQuota)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/keys: Failed to create API key", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create API key"})
+		return
+	}
+
+	resp := NewAPIKeyResponse(key)
+	resp.Key = plain
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Revoke an API key by ID, requests using it are rejected from now on
+// @Tags         keys
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "API key ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      404  {object}  ErrorResponse  "API key not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to revoke API key"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/keys/{id} [delete]
+func (server *Server) RevokeAPIKey(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	if err := server.apiKeys.RevokeAPIKey(ctx.Request.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "API key not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "DELETE /api/keys/:id: Failed to revoke API key", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to revoke API key"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
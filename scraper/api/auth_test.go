@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Test API key authentication and the role required by each kind of route
+func TestAuth(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	_, reader, err := service.CreateAPIKey(ctx, store, "reader", "reader", 0)
+	require.NoError(t, err)
+	_, editor, err := service.CreateAPIKey(ctx, store, "editor", "editor", 0)
+	require.NoError(t, err)
+
+	source := CreateSourceRequest{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+
+	testCases := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{name: "AnonymousRead", method: http.MethodGet, path: "/api/sources?page_id=1&page_size=5", status: http.StatusOK},
+		{name: "InvalidKeyRead", key: "nak_unknown", method: http.MethodGet, path: "/api/sources?page_id=1&page_size=5", status: http.StatusUnauthorized},
+		{name: "AnonymousWrite", method: http.MethodPost, path: "/api/sources", body: source, status: http.StatusUnauthorized},
+		{name: "ReaderWrite", key: reader, method: http.MethodPost, path: "/api/sources", body: source, status: http.StatusForbidden},
+		{name: "EditorWrite", key: editor, method: http.MethodPost, path: "/api/sources", body: source, status: http.StatusCreated},
+		{name: "EditorAdmin", key: editor, method: http.MethodGet, path: "/api/keys", status: http.StatusForbidden},
+		{name: "AdminAdmin", key: testAdminKey, method: http.MethodGet, path: "/api/keys", status: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := doRequestWithKey(t, server, tc.key, tc.method, tc.path, tc.body)
+			require.Equal(t, tc.status, recorder.Code)
+		})
+	}
+
+	// Bearer scheme is accepted too
+	req := httptest.NewRequest(http.MethodGet, "/api/keys", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// Anonymous read can be turned off
+	server.config.Server.AllowAnonymousRead = false
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder = doRequestWithKey(t, server, reader, http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// Test creating, listing and revoking API keys
+func TestAPIKeyHandlers(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	recorder := doRequest(t, server, http.MethodPost, "/api/keys", CreateAPIKeyRequest{Name: "ci", Role: "editor"})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var created APIKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Contains(t, created.Key, service.APIKeyPrefix)
+	require.Equal(t, created.Key[:len(created.Prefix)], created.Prefix)
+
+	recorder = doRequest(t, server, http.MethodPost, "/api/keys", CreateAPIKeyRequest{Name: "ci", Role: "owner"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// The value is never listed
+	recorder = doRequest(t, server, http.MethodGet, "/api/keys", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var list []APIKeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	for _, key := range list {
+		require.Empty(t, key.Key)
+	}
+
+	// The new key works until it is revoked
+	recorder = doRequestWithKey(t, server, created.Key, http.MethodPut, "/api/articles/1/star", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = doRequest(t, server, http.MethodDelete, "/api/keys/2", nil)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = doRequestWithKey(t, server, created.Key, http.MethodPut, "/api/articles/1/star", nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = doRequest(t, server, http.MethodDelete, "/api/keys/2", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Backfill the history of the feed sources, on demand or when they are added
+func (server *Server) SetBackfills(backfiller *service.Backfills) {
+	server.backfiller = backfiller
+}
+
+// Request struct for backfilling a source, every field is optional
+type BackfillRequest struct {
+	MaxPages int        `json:"max_pages" binding:"omitempty,min=1"` // Older pages to fetch, at most the configured maximum
+	Since    *time.Time `json:"since"`                               // Leave out the items published before
+}
+
+// Response struct for backfill
+type BackfillResponse struct {
+	ID            uint       `json:"id"`
+	SourceID      uint       `json:"source_id"`
+	Status        string     `json:"status" enums:"pending,succeeded,failed"`
+	MaxPages      int        `json:"max_pages"`
+	Since         *time.Time `json:"since"`
+	Paging        string     `json:"paging" enums:"archive,next,paged"` // Empty until the feed is fetched
+	Pages         int        `json:"pages"`                             // Older pages fetched so far
+	NewArticles   int        `json:"new_articles"`
+	Attempts      int        `json:"attempts"` // Failed attempts of the next page
+	Error         string     `json:"error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"` // Only while pending
+	CreatedAt     time.Time  `json:"created_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// Helper function: convert a backfill model into its response struct
+func NewBackfillResponse(backfill db.Backfill) BackfillResponse {
+	resp := BackfillResponse{
+		ID:          backfill.ID,
+		SourceID:    backfill.SourceID,
+		Status:      backfill.Status,
+		MaxPages:    backfill.MaxPages,
+		Since:       backfill.Since,
+		Paging:      backfill.Paging,
+		Pages:       backfill.Pages,
+		NewArticles: backfill.NewArticles,
+		Attempts:    backfill.Attempts,
+		Error:       backfill.Error,
+		CreatedAt:   backfill.CreatedAt,
+		FinishedAt:  backfill.FinishedAt,
+	}
+
+	if backfill.Status == db.BackfillPending {
+		resp.NextAttemptAt = &backfill.NextAttemptAt
+	}
+
+	return resp
+}
+
+// BackfillSource godoc
+// @Summary      Backfill the history of a feed source
+// @Description  Enqueue a backfill of the older items of a feed source, following the RFC 5005 prev-archive or next links of its feed,
+// @Description  or else the ?paged=N pages of WordPress feeds. It stops after max_pages older pages (at most the configured maximum),
+// @Description  at the first item published before since, or at the oldest page. If one is already in progress, that backfill is returned instead.
+// @Tags         backfills
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id        path      int              true   "Source ID"
+// @Param        backfill  body      BackfillRequest  false  "Depth of the backfill"
+// @Success      202  {object}  BackfillResponse  "Backfill enqueued"
+// @Success      200  {object}  BackfillResponse  "Backfill already in progress"
+// @Failure      400  {object}  ErrorResponse     "Invalid id parameter or request body, or not a feed source"
+// @Failure      404  {object}  ErrorResponse     "Source not found"
+// @Failure      500  {object}  ErrorResponse     "Failed to enqueue backfill"
+// @Failure      429  {object}  ErrorResponse     "Rate limit or daily quota exceeded"
+// @Router       /api/sources/{id}/backfill [post]
+func (server *Server) BackfillSource(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	// The body is optional
+	var req BackfillRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources/:id/backfill: Invalid request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
+		return
+	}
+
+	backfill, created, err := server.backfiller.Enqueue(ctx.Request.Context(), id, service.BackfillRequest{
+		MaxPages: req.MaxPages,
+		Since:    req.Since,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
+		case errors.Is(err, service.ErrBackfillUnsupported):
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Only feed sources can be backfilled"})
+		default:
+			server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources/:id/backfill: Failed to enqueue backfill", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to enqueue backfill"})
+		}
+		return
+	}
+
+	ctx.Header("Location", "/api/backfills/"+strconv.FormatUint(uint64(backfill.ID), 10))
+	if created {
+		ctx.JSON(http.StatusAccepted, NewBackfillResponse(backfill))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewBackfillResponse(backfill))
+}
+
+// ListBackfills godoc
+// @Summary      List the backfills of a source
+// @Description  Retrieve a paginated list of the backfills of a source, most recent first
+// @Tags         backfills
+// @Accept       json
+// @Produce      json
+// @Param        id         path      int  true  "Source ID"
+// @Param        page_id    query     int  true  "Page number"
+// @Param        page_size  query     int  true  "Number of items per page"
+// @Success      200  {array}   BackfillResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id or query parameter"
+// @Failure      500  {object}  ErrorResponse  "Failed to list backfills"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/sources/{id}/backfills [get]
+func (server *Server) ListBackfills(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	pageID, pageSize := server.GetPagingParams(ctx)
+	if pageID == 0 || pageSize == 0 {
+		// Error already handled in GetPagingParams
+		return
+	}
+
+	backfills, err := server.backfills.ListBackfills(ctx.Request.Context(), id, pageSize, (pageID-1)*pageSize)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/sources/:id/backfills: Failed to list backfills", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list backfills"})
+		return
+	}
+
+	resp := make([]BackfillResponse, len(backfills))
+	for i, backfill := range backfills {
+		resp[i] = NewBackfillResponse(backfill)
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// GetBackfill godoc
+// @Summary      Get a backfill
+// @Description  Report the progress of a backfill: the older pages fetched and the articles they added
+// @Tags         backfills
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Backfill ID"
+// @Success      200  {object}  BackfillResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Backfill not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to get backfill"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/backfills/{id} [get]
+func (server *Server) GetBackfill(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	backfill, err := server.backfills.GetBackfill(ctx.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Backfill not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/backfills/:id: Failed to get backfill", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get backfill"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewBackfillResponse(backfill))
+}
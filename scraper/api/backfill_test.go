@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Test enqueuing the backfills of a source and reporting their progress
+func TestBackfillHandlers(t *testing.T) {
+	server, store := newTestServerWith(t, func(server *Server, store *db.MemoryStore) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		server.SetBackfills(service.NewBackfills(store, store, server.scraper, service.BackfillOptions{
+			MaxPages:     10,
+			PollInterval: time.Hour,
+		}, logger))
+	})
+	ctx := context.Background()
+
+	feed := db.Source{Link: "https://example.com/feed.xml", Provider: "example.com", Category: "tech"}
+	require.NoError(t, store.CreateSource(ctx, &feed))
+	page := db.Source{
+		Link:     "https://example.com/blog",
+		Provider: "example.com",
+		Category: "tech",
+		Type:     db.SourceTypeHTML,
+		HTML:     &db.HTMLSelectors{Item: "article", Title: "h2"},
+	}
+	require.NoError(t, store.CreateSource(ctx, &page))
+
+	// Enqueued once, then the backfill in progress is returned
+	path := fmt.Sprintf("/api/sources/%d/backfill", feed.ID)
+	recorder := doRequest(t, server, http.MethodPost, path, BackfillRequest{MaxPages: 3})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	var created BackfillResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Equal(t, db.BackfillPending, created.Status)
+	require.Equal(t, 3, created.MaxPages)
+	require.NotNil(t, created.NextAttemptAt)
+	require.Equal(t, fmt.Sprintf("/api/backfills/%d", created.ID), recorder.Header().Get("Location"))
+
+	recorder = doRequest(t, server, http.MethodPost, path, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var existing BackfillResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &existing))
+	require.Equal(t, created.ID, existing.ID)
+
+	tests := []struct {
+		name string
+		path string
+		body any
+		code int
+	}{
+		{"invalid depth", path, map[string]int{"max_pages": -1}, http.StatusBadRequest},
+		{"not a feed", fmt.Sprintf("/api/sources/%d/backfill", page.ID), nil, http.StatusBadRequest},
+		{"unknown source", "/api/sources/99/backfill", nil, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, server, http.MethodPost, test.path, test.body)
+			require.Equal(t, test.code, recorder.Code)
+		})
+	}
+
+	// Progress
+	recorder = doRequest(t, server, http.MethodGet, fmt.Sprintf("/api/backfills/%d", created.ID), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doRequest(t, server, http.MethodGet, "/api/backfills/99", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = doRequest(t, server, http.MethodGet, fmt.Sprintf("/api/sources/%d/backfills?page_id=1&page_size=10", feed.ID), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var listed []BackfillResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+
+	// Backfilled once added, only for feeds
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder = doRequest(t, server, http.MethodPost, "/api/sources", CreateSourceRequest{
+		Link:     "https://example.com/news.xml",
+		Provider: "example.com",
+		Category: "news",
+		Backfill: &BackfillRequest{Since: &since},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	var source SourceResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &source))
+	backfills, err := store.ListBackfills(ctx, source.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, backfills, 1)
+	require.Equal(t, 10, backfills[0].MaxPages)
+	require.True(t, since.Equal(*backfills[0].Since))
+
+	recorder = doRequest(t, server, http.MethodPost, "/api/sources", CreateSourceRequest{
+		Link:     "https://example.com/posts",
+		Provider: "example.com",
+		Category: "news",
+		Type:     db.SourceTypeHTML,
+		HTML:     &db.HTMLSelectors{Item: "article", Title: "h2"},
+		Backfill: &BackfillRequest{},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// No backfill routes without backfills
+	disabled, _ := newTestServer(t)
+	recorder = doRequest(t, disabled, http.MethodPost, path, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware: allow the configured origins to call the API from a browser and
+// answer their preflight requests. Does nothing when no origin is configured.
+func (server *Server) corsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origins := server.config.CORS.AllowedOrigins
+		origin := ctx.GetHeader("Origin")
+		if len(origins) == 0 || origin == "" {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Vary", "Origin")
+		if !slices.Contains(origins, "*") && !slices.Contains(origins, origin) {
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		ctx.Header("Access-Control-Expose-Headers", strings.Join([]string{
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+			"X-Quota-Limit", "X-Quota-Remaining",
+		}, ", "))
+
+		// Preflight request
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			ctx.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			ctx.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID, X-API-Key")
+			ctx.Header("Access-Control-Max-Age", "600")
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A readiness check, returning an error while its dependency is not usable
+type HealthCheck func(ctx context.Context) error
+
+// Time given to the readiness checks
+const readinessTimeout = 2 * time.Second
+
+// Response struct for health and readiness probes, with the error of each failing check
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Register a check that must pass for the server to be ready
+func (server *Server) AddReadinessCheck(name string, check HealthCheck) {
+	server.checks[name] = check
+}
+
+// Healthz godoc
+// @Summary      Liveness probe
+// @Description  Report that the process is up and serving requests
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  HealthResponse
+// @Router       /healthz [get]
+func (server *Server) Healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Run the readiness checks (database, scheduler, last scraping run), failing while shutting down
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  HealthResponse
+// @Failure      503  {object}  HealthResponse
+// @Router       /readyz [get]
+func (server *Server) Readyz(ctx *gin.Context) {
+	if server.shuttingDown.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "shutting down"})
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	// Run the checks concurrently, a slow dependency should not hide the others
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]string, len(server.checks))
+		failed  = false
+	)
+	for name, check := range server.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := "ok"
+			if err := check(checkCtx); err != nil {
+				result = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			failed = failed || result != "ok"
+		}()
+	}
+	wg.Wait()
+
+	if failed {
+		server.logger.WarnContext(ctx.Request.Context(), "GET /readyz: Not ready", "checks", results)
+		ctx.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: results})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, HealthResponse{Status: "ok", Checks: results})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test the liveness and readiness probes
+func TestHealth(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	recorder := doRequestWithKey(t, server, "", http.MethodGet, "/healthz", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// Ready while every check passes
+	var dbErr error
+	server.AddReadinessCheck("database", func(ctx context.Context) error { return dbErr })
+	server.AddReadinessCheck("scheduler", func(ctx context.Context) error { return nil })
+
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/readyz", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// A failing check is reported
+	dbErr = errors.New("connection refused")
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/readyz", nil)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var resp HealthResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Equal(t, "connection refused", resp.Checks["database"])
+	require.Equal(t, "ok", resp.Checks["scheduler"])
+
+	// Not ready once shutting down, still alive for the requests being drained
+	dbErr = nil
+	require.NoError(t, server.Shutdown(context.Background()))
+
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/readyz", nil)
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/healthz", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Response struct for the result of scraping a source in a job
+type JobSourceResultResponse struct {
+	SourceID    uint      `json:"source_id"`
+	Link        string    `json:"link"`
+	NewArticles int       `json:"new_articles"`
+	Skipped     bool      `json:"skipped"` // Another instance was scraping the source
+	Error       string    `json:"error,omitempty"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// Response struct for scraping job
+type JobResponse struct {
+	ID          string                    `json:"id"`
+	SourceID    *uint                     `json:"source_id"` // Null when scraping every source
+	Status      string                    `json:"status" enums:"queued,running,succeeded,failed"`
+	Total       int                       `json:"total"`
+	Done        int                       `json:"done"`
+	NewArticles int                       `json:"new_articles"`
+	Results     []JobSourceResultResponse `json:"results"`
+	Error       string                    `json:"error,omitempty"`
+	CreatedAt   time.Time                 `json:"created_at"`
+	StartedAt   *time.Time                `json:"started_at,omitempty"`
+	FinishedAt  *time.Time                `json:"finished_at,omitempty"`
+}
+
+// Helper function: convert a job into its response struct
+func NewJobResponse(job service.Job) JobResponse {
+	resp := JobResponse{
+		ID:          job.ID,
+		Status:      job.Status,
+		Total:       job.Total,
+		Done:        job.Done,
+		NewArticles: job.NewArticles,
+		Results:     make([]JobSourceResultResponse, len(job.Results)),
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+	}
+
+	if job.SourceID != 0 {
+		resp.SourceID = &job.SourceID
+	}
+	if !job.StartedAt.IsZero() {
+		resp.StartedAt = &job.StartedAt
+	}
+	if !job.FinishedAt.IsZero() {
+		resp.FinishedAt = &job.FinishedAt
+	}
+
+	for i, result := range job.Results {
+		resp.Results[i] = JobSourceResultResponse{
+			SourceID:    result.SourceID,
+			Link:        result.Link,
+			NewArticles: result.NewArticles,
+			Skipped:     result.Skipped,
+			Error:       result.Error,
+			FinishedAt:  result.FinishedAt,
+		}
+	}
+
+	return resp
+}
+
+// Helper method: answer with the enqueued job, 202 if it was created and 200 if
+// it was already in progress
+func (server *Server) respondJob(ctx *gin.Context, job service.Job, created bool) {
+	ctx.Header("Location", "/api/jobs/"+job.ID)
+	if created {
+		ctx.JSON(http.StatusAccepted, NewJobResponse(job))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewJobResponse(job))
+}
+
+// ScrapeSource godoc
+// @Summary      Scrape a news source now
+// @Description  Enqueue an immediate scrape of a source. If one is already in progress, that job is returned instead.
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Source ID"
+// @Success      202  {object}  JobResponse    "Job enqueued"
+// @Success      200  {object}  JobResponse    "Job already in progress"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Source not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to enqueue scraping job"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/sources/{id}/scrape [post]
+func (server *Server) ScrapeSource(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	job, created, err := server.jobs.EnqueueScrape(ctx.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources/:id/scrape: Failed to enqueue scraping job", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to enqueue scraping job"})
+		return
+	}
+
+	server.respondJob(ctx, job, created)
+}
+
+// ScrapeAll godoc
+// @Summary      Scrape every news source now
+// @Description  Enqueue an immediate scrape of every source. If one is already in progress, that job is returned instead.
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      202  {object}  JobResponse    "Job enqueued"
+// @Success      200  {object}  JobResponse    "Job already in progress"
+// @Failure      500  {object}  ErrorResponse  "Failed to enqueue scraping job"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/scrape [post]
+func (server *Server) ScrapeAll(ctx *gin.Context) {
+	job, created, err := server.jobs.EnqueueScrape(ctx.Request.Context(), 0)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/scrape: Failed to enqueue scraping job", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to enqueue scraping job"})
+		return
+	}
+
+	server.respondJob(ctx, job, created)
+}
+
+// GetJob godoc
+// @Summary      Get a scraping job
+// @Description  Report the progress of a scraping job, with the result of each scraped source. Finished jobs are kept for an hour.
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Job ID"
+// @Success      200  {object}  JobResponse
+// @Failure      404  {object}  ErrorResponse  "Job not found"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/jobs/{id} [get]
+func (server *Server) GetJob(ctx *gin.Context) {
+	job, err := server.jobs.Get(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Job not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewJobResponse(job))
+}
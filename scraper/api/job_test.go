@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Feed with two items, served to the scraping jobs
+const testFeed = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>First</title><link>https://example.com/first</link></item>
+<item><title>Second</title><link>https://example.com/second</link></item>
+</channel></rss>`
+
+// Test enqueueing scraping jobs and following their progress
+func TestJobHandlers(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, testFeed)
+	}))
+	t.Cleanup(feed.Close)
+
+	server, store := newTestServer(t)
+	source := db.Source{Link: feed.URL, Provider: "test", Category: "test"}
+	require.NoError(t, store.CreateSource(context.Background(), &source))
+
+	// Helper function: poll a job until it is finished
+	waitJob := func(id string) JobResponse {
+		var job JobResponse
+		require.Eventually(t, func() bool {
+			recorder := doRequest(t, server, http.MethodGet, "/api/jobs/"+id, nil)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+			return job.Status == service.JobSucceeded || job.Status == service.JobFailed
+		}, 3*time.Second, 10*time.Millisecond)
+		return job
+	}
+
+	// Scrape a single source
+	recorder := doRequest(t, server, http.MethodPost, fmt.Sprintf("/api/sources/%d/scrape", source.ID), nil)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var job JobResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Equal(t, "/api/jobs/"+job.ID, recorder.Header().Get("Location"))
+	require.Equal(t, source.ID, *job.SourceID)
+
+	job = waitJob(job.ID)
+	require.Equal(t, service.JobSucceeded, job.Status)
+	require.Equal(t, 2, job.NewArticles)
+	require.Len(t, job.Results, 1)
+	require.Equal(t, source.ID, job.Results[0].SourceID)
+	require.NotNil(t, job.FinishedAt)
+
+	// Scrape every source, nothing new this time
+	recorder = doRequest(t, server, http.MethodPost, "/api/scrape", nil)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Nil(t, job.SourceID)
+
+	job = waitJob(job.ID)
+	require.Equal(t, service.JobSucceeded, job.Status)
+	require.Equal(t, 1, job.Total)
+	require.Zero(t, job.NewArticles)
+
+	// Errors
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+	}{
+		{name: "UnknownSource", method: http.MethodPost, path: "/api/sources/100/scrape", key: testAdminKey, status: http.StatusNotFound},
+		{name: "InvalidSourceID", method: http.MethodPost, path: "/api/sources/abc/scrape", key: testAdminKey, status: http.StatusBadRequest},
+		{name: "UnknownJob", method: http.MethodGet, path: "/api/jobs/unknown", key: testAdminKey, status: http.StatusNotFound},
+		{name: "Anonymous", method: http.MethodPost, path: "/api/scrape", status: http.StatusUnauthorized},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			recorder := doRequestWithKey(t, server, testCase.key, testCase.method, testCase.path, nil)
+			require.Equal(t, testCase.status, recorder.Code)
+		})
+	}
+}
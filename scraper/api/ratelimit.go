@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits applied to a client: a token bucket refilled at Rate tokens per second
+// holding at most Burst tokens, and an optional number of requests per UTC day
+type RateLimit struct {
+	Rate       float64
+	Burst      int
+	DailyQuota int // 0 means no quota
+}
+
+// Outcome of a request against the limits of its client
+type RateLimitResult struct {
+	Allowed        bool
+	Remaining      int           // Tokens left in the bucket
+	Reset          time.Duration // Until the bucket is full again
+	RetryAfter     time.Duration // Until the next request is allowed, when rejected
+	QuotaRemaining int           // Requests left today, when a quota applies
+	QuotaExceeded  bool
+}
+
+// Storage of the limiter state of every client. The in-memory store works for a
+// single instance, several instances need a shared implementation.
+type LimiterStore interface {
+	Take(ctx context.Context, client string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// State of a single client
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	day     string // UTC day the usage counts for
+	used    int
+}
+
+// In-memory implementation of LimiterStore
+type MemoryLimiterStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+// Constructor method for MemoryLimiterStore
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{buckets: make(map[string]*bucket)}
+}
+
+// Take a token from the bucket of the client and count the request in its daily usage
+func (store *MemoryLimiterStore) Take(
+	ctx context.Context,
+	client string,
+	limit RateLimit,
+	now time.Time,
+) (RateLimitResult, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.prune(now)
+
+	today := now.UTC().Format(time.DateOnly)
+	b, ok := store.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, day: today}
+		store.buckets[client] = b
+	}
+
+	// Refill the bucket for the time elapsed, and start a new day of usage
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	if b.day != today {
+		b.day = today
+		b.used = 0
+	}
+
+	result := RateLimitResult{Allowed: true}
+	switch {
+	case limit.DailyQuota > 0 && b.used >= limit.DailyQuota:
+		result.Allowed = false
+		result.QuotaExceeded = true
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		result.RetryAfter = midnight.Sub(now)
+	case b.tokens < 1:
+		result.Allowed = false
+		result.RetryAfter = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	default:
+		b.tokens--
+		b.used++
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second))
+	if limit.DailyQuota > 0 {
+		result.QuotaRemaining = max(limit.DailyQuota-b.used, 0)
+	}
+
+	return result, nil
+}
+
+// Helper method: drop the state of clients idle since yesterday, at most once per hour
+func (store *MemoryLimiterStore) prune(now time.Time) {
+	if now.Sub(store.pruned) < time.Hour {
+		return
+	}
+	store.pruned = now
+
+	today := now.UTC().Format(time.DateOnly)
+	for client, b := range store.buckets {
+		if b.day != today {
+			delete(store.buckets, client)
+		}
+	}
+}
+
+// Helper function: format a duration in whole seconds, rounded up
+func headerSeconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
+
+// Helper method: apply the rate limit of the client and set the RateLimit-* headers.
+// Returns false if the request was rejected, the response is already written then.
+// A zero quota falls back to the default daily quota of the config.
+func (server *Server) rateLimit(ctx *gin.Context, client string, quota int) bool {
+	if server.config.RateLimit.Rate <= 0 {
+		return true
+	}
+
+	if quota == 0 {
+		quota = server.config.RateLimit.DailyQuota
+	}
+
+	limit := RateLimit{
+		Rate:       server.config.RateLimit.Rate,
+		Burst:      max(server.config.RateLimit.Burst, 1),
+		DailyQuota: quota,
+	}
+
+	result, err := server.limiter.Take(ctx.Request.Context(), client, limit, time.Now())
+	if err != nil {
+		// Don't take the API down with the limiter store
+		server.logger.WarnContext(ctx.Request.Context(), "Rate limit: Failed to take token, request allowed", "client", client, "error", err)
+		return true
+	}
+
+	ctx.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.Header("RateLimit-Reset", headerSeconds(result.Reset))
+	if limit.DailyQuota > 0 {
+		ctx.Header("X-Quota-Limit", strconv.Itoa(limit.DailyQuota))
+		ctx.Header("X-Quota-Remaining", strconv.Itoa(result.QuotaRemaining))
+	}
+
+	if !result.Allowed {
+		message := "Rate limit exceeded"
+		if result.QuotaExceeded {
+			message = "Daily quota exceeded"
+		}
+
+		ctx.Header("Retry-After", headerSeconds(result.RetryAfter))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Message: message})
+		return false
+	}
+
+	return true
+}
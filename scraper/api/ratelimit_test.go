@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the token bucket and daily quota of the in-memory limiter store
+func TestMemoryLimiterStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLimiterStore()
+	limit := RateLimit{Rate: 1, Burst: 2, DailyQuota: 4}
+	now := time.Date(2025, 6, 1, 23, 59, 0, 0, time.UTC)
+
+	take := func(at time.Time) RateLimitResult {
+		result, err := store.Take(ctx, "client", limit, at)
+		require.NoError(t, err)
+		return result
+	}
+
+	// The burst is spent, then the next token comes one second later
+	require.True(t, take(now).Allowed)
+	result := take(now)
+	require.True(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+	require.Equal(t, 2*time.Second, result.Reset)
+
+	result = take(now.Add(500 * time.Millisecond))
+	require.False(t, result.Allowed)
+	require.False(t, result.QuotaExceeded)
+	require.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	// Other clients have their own bucket
+	other, err := store.Take(ctx, "other", limit, now)
+	require.NoError(t, err)
+	require.True(t, other.Allowed)
+
+	// The daily quota is spent even though the bucket refills
+	require.True(t, take(now.Add(10*time.Second)).Allowed)
+	result = take(now.Add(20 * time.Second))
+	require.True(t, result.Allowed)
+	require.Zero(t, result.QuotaRemaining)
+
+	result = take(now.Add(30 * time.Second))
+	require.False(t, result.Allowed)
+	require.True(t, result.QuotaExceeded)
+	require.Equal(t, 30*time.Second, result.RetryAfter)
+
+	// A new day starts a new quota
+	require.True(t, take(now.Add(time.Minute)).Allowed)
+}
+
+// Test the rate limit headers and rejections of the API
+func TestRateLimit(t *testing.T) {
+	server, store := newTestServer(t)
+	server.config.RateLimit.Rate = 0.001
+	server.config.RateLimit.Burst = 2
+
+	// Anonymous clients share the bucket of their IP
+	for range 2 {
+		recorder := doRequestWithKey(t, server, "", http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	}
+
+	recorder := doRequestWithKey(t, server, "", http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	// A key has its own bucket and its own quota
+	_, key, err := service.CreateAPIKey(context.Background(), store, "partner", "reader", 1)
+	require.NoError(t, err)
+
+	recorder = doRequestWithKey(t, server, key, http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "1", recorder.Header().Get("X-Quota-Limit"))
+	require.Equal(t, "0", recorder.Header().Get("X-Quota-Remaining"))
+
+	recorder = doRequestWithKey(t, server, key, http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "Daily quota exceeded")
+
+	// Disabled when the rate is zero
+	server.config.RateLimit.Rate = 0
+	recorder = doRequestWithKey(t, server, key, http.MethodGet, "/api/sources?page_id=1&page_size=5", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+}
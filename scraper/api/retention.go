@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Response struct for retention policy
+type RetentionPolicyResponse struct {
+	ID         uint   `json:"id"`
+	SourceID   *uint  `json:"source_id"`
+	Category   string `json:"category"`
+	MaxAgeDays int    `json:"max_age_days"`
+	KeepLast   int    `json:"keep_last"`
+	Archive    bool   `json:"archive"`
+}
+
+// Helper function: convert a retention policy model into its response struct
+func NewRetentionPolicyResponse(policy db.RetentionPolicy) RetentionPolicyResponse {
+	return RetentionPolicyResponse{
+		ID:         policy.ID,
+		SourceID:   policy.SourceID,
+		Category:   policy.Category,
+		MaxAgeDays: policy.MaxAgeDays,
+		KeepLast:   policy.KeepLast,
+		Archive:    policy.Archive,
+	}
+}
+
+// ListRetentionPolicies godoc
+// @Summary      List retention policies
+// @Description  Retrieve every retention policy
+// @Tags         retention
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {array}   RetentionPolicyResponse
+// @Failure      500  {object}  ErrorResponse  "Failed to list retention policies"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/retention/policies [get]
+func (server *Server) ListRetentionPolicies(ctx *gin.Context) {
+	policies, err := server.retention.ListRetentionPolicies(ctx.Request.Context())
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/retention/policies: Failed to list retention policies", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list retention policies"})
+		return
+	}
+
+	resp := make([]RetentionPolicyResponse, len(policies))
+	for i, policy := range policies {
+		resp[i] = NewRetentionPolicyResponse(policy)
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// Request struct for create retention policy action. Leave both source_id and
+// category empty for a policy that applies to every source.
+type CreateRetentionPolicyRequest struct {
+	SourceID   *uint  `json:"source_id"`
+	Category   string `json:"category"`
+	MaxAgeDays int    `json:"max_age_days" binding:"min=0"`
+	KeepLast   int    `json:"keep_last" binding:"min=0"`
+	Archive    bool   `json:"archive"`
+}
+
+// CreateRetentionPolicy godoc
+// @Summary      Create a retention policy
+// @Description  Add a retention policy for a source, a category or every source
+// @Tags         retention
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        policy  body      CreateRetentionPolicyRequest  true  "Policy details"
+// @Success      201  {object}  RetentionPolicyResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      404  {object}  ErrorResponse  "Source not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to create retention policy"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/retention/policies [post]
+func (server *Server) CreateRetentionPolicy(ctx *gin.Context) {
+	var req CreateRetentionPolicyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/retention/policies: Invalid request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
+		return
+	}
+
+	if req.MaxAgeDays == 0 && req.KeepLast == 0 {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Either max_age_days or keep_last is required"})
+		return
+	}
+
+	if req.SourceID != nil && req.Category != "" {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Only one of source_id and category can be set"})
+		return
+	}
+
+	// Make sure the source exists
+	if req.SourceID != nil {
+		if _, err := server.sources.GetSource(ctx.Request.Context(), *req.SourceID); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
+				return
+			}
+
+			server.logger.ErrorContext(ctx.Request.Context(), "POST /api/retention/policies: Failed to get source", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get source"})
+			return
+		}
+	}
+
+	policy := db.RetentionPolicy{
+		SourceID:   req.SourceID,
+		Category:   req.Category,
+		MaxAgeDays: req.MaxAgeDays,
+		KeepLast:   req.KeepLast,
+		Archive:    req.Archive,
+	}
+	if err := server.retention.CreateRetentionPolicy(ctx.Request.Context(), &policy); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/retention/policies: Failed to create retention policy", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create retention policy"})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, NewRetentionPolicyResponse(policy))
+}
+
+// DeleteRetentionPolicy godoc
+// @Summary      Delete a retention policy
+// @Description  Remove an existing retention policy by ID
+// @Tags         retention
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Policy ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Retention policy not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to delete retention policy"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/retention/policies/{id} [delete]
+func (server *Server) DeleteRetentionPolicy(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	if err := server.retention.DeleteRetentionPolicy(ctx.Request.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Retention policy not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "DELETE /api/retention/policies/:id: Failed to delete retention policy", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to delete retention policy"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Response struct for retention run
+type RetentionRunResponse struct {
+	ID          uint                      `json:"id"`
+	StartedAt   time.Time                 `json:"started_at"`
+	FinishedAt  time.Time                 `json:"finished_at"`
+	Deleted     int                       `json:"deleted"`
+	Archived    int                       `json:"archived"`
+	ArchiveFile string                    `json:"archive_file"`
+	Report      []service.RetentionReport `json:"report"`
+	Error       string                    `json:"error"`
+}
+
+// ListRetentionRuns godoc
+// @Summary      List retention runs
+// @Description  Retrieve a paginated history of retention runs with what each one purged, most recent first
+// @Tags         retention
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        page_id    query     int  true   "Page number"
+// @Param        page_size  query     int  true   "Number of items per page"
+// @Success      200  {array}   RetentionRunResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid query parameter"
+// @Failure      500  {object}  ErrorResponse  "Failed to list retention runs"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/retention/runs [get]
+func (server *Server) ListRetentionRuns(ctx *gin.Context) {
+	// Get pagination parameters
+	pageID, pageSize := server.GetPagingParams(ctx)
+	if pageID == 0 || pageSize == 0 {
+		// Error already handled in GetPagingParams
+		return
+	}
+
+	runs, err := server.retention.ListRetentionRuns(ctx.Request.Context(), pageSize, (pageID-1)*pageSize)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/retention/runs: Failed to list retention runs", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list retention runs"})
+		return
+	}
+
+	resp := make([]RetentionRunResponse, len(runs))
+	for i, run := range runs {
+		report := make([]service.RetentionReport, 0)
+		if run.Report != "" {
+			if err := json.Unmarshal([]byte(run.Report), &report); err != nil {
+				server.logger.WarnContext(ctx.Request.Context(), "GET /api/retention/runs: Invalid report in retention run", "id", run.ID, "error", err)
+			}
+		}
+
+		resp[i] = RetentionRunResponse{
+			ID:          run.ID,
+			StartedAt:   run.StartedAt,
+			FinishedAt:  run.FinishedAt,
+			Deleted:     run.Deleted,
+			Archived:    run.Archived,
+			ArchiveFile: run.ArchiveFile,
+			Report:      report,
+			Error:       run.Error,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/danglnh07/newsaggr/scraper/db"
 	_ "github.com/danglnh07/newsaggr/scraper/docs"
+	"github.com/danglnh07/newsaggr/scraper/service"
 	"github.com/danglnh07/newsaggr/scraper/util"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -16,41 +22,148 @@ import (
 
 // Server struct
 type Server struct {
-	mux     *gin.Engine
-	queries *db.Queries
-	config  *util.Config
-	logger  *slog.Logger
+	mux        *gin.Engine
+	sources    db.SourceStore
+	articles   db.ArticleStore
+	retention  db.RetentionStore
+	apiKeys    db.APIKeyStore
+	webhooks   db.WebhookStore
+	backfills  db.BackfillStore
+	scraper    *service.RssScraper
+	jobs       *service.Jobs
+	dispatcher *service.Webhooks
+	stream     *service.ArticleStream
+	websub     *service.WebSub    // Only when WebSub is enabled
+	backfiller *service.Backfills // Only when backfills are run
+	limiter    LimiterStore
+	config     *util.Config
+	logger     *slog.Logger
+
+	httpServer   *http.Server
+	checks       map[string]HealthCheck
+	shuttingDown atomic.Bool
 }
 
 // Constructor method for Server
-func NewServer(queries *db.Queries, config *util.Config, logger *slog.Logger) *Server {
+func NewServer(store db.Store, scraper *service.RssScraper, jobs *service.Jobs, webhooks *service.Webhooks, stream *service.ArticleStream, config *util.Config, logger *slog.Logger) *Server {
+	mux := gin.Default()
 	return &Server{
-		mux:     gin.Default(),
-		queries: queries,
-		config:  config,
-		logger:  logger,
+		mux:        mux,
+		sources:    store,
+		articles:   store,
+		retention:  store,
+		apiKeys:    store,
+		webhooks:   store,
+		backfills:  store,
+		scraper:    scraper,
+		jobs:       jobs,
+		dispatcher: webhooks,
+		stream:     stream,
+		limiter:    NewMemoryLimiterStore(),
+		config:     config,
+		logger:     logger,
+
+		httpServer: &http.Server{Addr: config.Server.Addr, Handler: mux},
+		checks:     make(map[string]HealthCheck),
 	}
 }
 
-// Method to register handler
+// Replace the in-memory rate limiter store, e.g. with one shared by several instances
+func (server *Server) SetLimiterStore(limiter LimiterStore) {
+	server.limiter = limiter
+}
+
+// Method to register handler. Reads need the reader role (or nothing when anonymous
+// read is allowed), source changes and scraping the editor role and administration the admin role.
 func (server *Server) RegisterHandler() {
+	reader := server.RequireRole(db.RoleReader)
+	editor := server.RequireRole(db.RoleEditor)
+	admin := server.RequireRole(db.RoleAdmin)
+
+	// Tracing, Prometheus metrics and CORS, for every route
+	server.mux.Use(otelgin.Middleware(util.ServiceName), metricsMiddleware(), server.corsMiddleware())
+	server.mux.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Probes
+	server.mux.GET("/healthz", server.Healthz)
+	server.mux.GET("/readyz", server.Readyz)
+
+	// WebSub callbacks, for the hubs rather than the API clients
+	if server.websub != nil {
+		server.mux.GET("/websub/:id", server.VerifyWebSub)
+		server.mux.POST("/websub/:id", server.ReceiveWebSub)
+	}
+
 	api := server.mux.Group("/api")
 	{
 		// Article's routes
 		articles := api.Group("/articles")
 		{
-			articles.GET("/:id", server.GetArticle)
-			articles.GET("", server.ListArticles)
+			articles.GET("/:id", reader, server.GetArticle)
+			articles.GET("", reader, server.ListArticles)
+			articles.PUT("/:id/star", editor, server.StarArticle)
+			articles.DELETE("/:id/star", editor, server.UnstarArticle)
 		}
 
 		// Source's routes
 		sources := api.Group("/sources")
 		{
-			sources.GET("/:id", server.GetSource)
-			sources.GET("", server.ListSources)
-			sources.POST("", server.CreateSource)
-			sources.PUT("/:id", server.UpdateSource)
-			sources.DELETE("/:id", server.DeleteSource)
+			sources.GET("/:id", reader, server.GetSource)
+			sources.GET("", reader, server.ListSources)
+			sources.POST("", editor, server.CreateSource)
+			sources.POST("/preview", editor, server.PreviewSource)
+			sources.PUT("/:id", editor, server.UpdateSource)
+			sources.DELETE("/:id", editor, server.DeleteSource)
+			sources.POST("/:id/restore", editor, server.RestoreSource)
+			sources.POST("/:id/scrape", editor, server.ScrapeSource)
+			if server.backfiller != nil {
+				sources.POST("/:id/backfill", editor, server.BackfillSource)
+				sources.GET("/:id/backfills", reader, server.ListBackfills)
+			}
+		}
+
+		// Live stream's routes
+		stream := api.Group("/stream", reader)
+		{
+			stream.GET("/articles", server.StreamArticles)
+			stream.GET("/articles/ws", server.StreamArticlesWebSocket)
+		}
+
+		// Scraping job's routes
+		api.POST("/scrape", editor, server.ScrapeAll)
+		api.GET("/jobs/:id", reader, server.GetJob)
+
+		// Backfill's routes
+		if server.backfiller != nil {
+			api.GET("/backfills/:id", reader, server.GetBackfill)
+		}
+
+		// Retention's routes
+		retention := api.Group("/retention", admin)
+		{
+			retention.GET("/policies", server.ListRetentionPolicies)
+			retention.POST("/policies", server.CreateRetentionPolicy)
+			retention.DELETE("/policies/:id", server.DeleteRetentionPolicy)
+			retention.GET("/runs", server.ListRetentionRuns)
+		}
+
+		// API key's routes
+		keys := api.Group("/keys", admin)
+		{
+			keys.GET("", server.ListAPIKeys)
+			keys.POST("", server.CreateAPIKey)
+			keys.DELETE("/:id", server.RevokeAPIKey)
+		}
+
+		// Webhook's routes
+		webhooks := api.Group("/webhooks", admin)
+		{
+			webhooks.GET("", server.ListWebhooks)
+			webhooks.POST("", server.CreateWebhook)
+			webhooks.GET("/:id", server.GetWebhook)
+			webhooks.DELETE("/:id", server.DeleteWebhook)
+			webhooks.GET("/:id/deliveries", server.ListWebhookDeliveries)
+			webhooks.POST("/:id/deliveries/:delivery_id/redeliver", server.RedeliverWebhook)
 		}
 
 		// Swagger route
@@ -58,10 +171,36 @@ func (server *Server) RegisterHandler() {
 	}
 }
 
-// Method to start the server
+// Expose the HTTP handler, mainly used for tests
+func (server *Server) Handler() http.Handler {
+	return server.mux
+}
+
+// Method to start the server, blocks until the server is shut down
 func (server *Server) Start() error {
 	server.RegisterHandler()
-	return server.mux.Run(":8080")
+
+	var err error
+	if server.config.Server.TLSCertFile != "" {
+		err = server.httpServer.ListenAndServeTLS(server.config.Server.TLSCertFile, server.config.Server.TLSKeyFile)
+	} else {
+		err = server.httpServer.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Stop accepting requests and wait for the ones in flight until the context is done.
+// Readiness fails from now on, so load balancers stop routing to this instance. The
+// streams are closed, their clients reconnect to another instance.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.shuttingDown.Store(true)
+	server.stream.Close()
+	return server.httpServer.Shutdown(ctx)
 }
 
 // General error response
@@ -91,3 +230,14 @@ func (server *Server) GetPagingParams(ctx *gin.Context) (int, int) {
 
 	return pageID, pageSize
 }
+
+// Helper method: extract the ID path parameter
+func (server *Server) GetIDParam(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 0)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid id parameter"})
+		return 0, false
+	}
+
+	return uint(id), true
+}
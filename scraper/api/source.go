@@ -2,19 +2,297 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // Response struct for resource
 type SourceResponse struct {
-	ID       uint   `json:"id"`
-	Link     string `json:"link"`
-	Provider string `json:"provider"`
-	Category string `json:"category"`
+	ID        uint                   `json:"id"`
+	Link      string                 `json:"link"`
+	Provider  string                 `json:"provider"`
+	Category  string                 `json:"category"`
+	Type      string                 `json:"type"`
+	HTML      *db.HTMLSelectors      `json:"html,omitempty"`
+	JSON      *JSONSourceResponse    `json:"json,omitempty"`
+	Sitemap   *db.SitemapOptions     `json:"sitemap,omitempty"`
+	Fetch     *FetchSettingsResponse `json:"fetch,omitempty"`
+	FetchedAt *time.Time             `json:"fetched_at,omitempty"` // Start of the last successful scrape
+	DeletedAt *time.Time             `json:"deleted_at,omitempty"`
+}
+
+// Response struct for the request and mapping of a JSON source, without the values of
+// its headers
+type JSONSourceResponse struct {
+	Request JSONRequestResponse `json:"request"`
+	Mapping db.JSONMapping      `json:"mapping"`
+}
+
+// Response struct for the request of a JSON source
+type JSONRequestResponse struct {
+	URL     string   `json:"url,omitempty"`
+	Headers []string `json:"headers,omitempty"` // Names of the headers, their values are never returned
+}
+
+// Helper function: convert the request and mapping of a JSON source into their response struct
+func NewJSONSourceResponse(settings *db.JSONSource) *JSONSourceResponse {
+	if settings == nil {
+		return nil
+	}
+
+	return &JSONSourceResponse{
+		Request: JSONRequestResponse{URL: settings.Request.URL, Headers: headerNames(settings.Request.Headers)},
+		Mapping: settings.Mapping,
+	}
+}
+
+// Response struct for the fetch settings of a source, without its credentials
+type FetchSettingsResponse struct {
+	Headers            []string `json:"headers,omitempty"` // Names of the custom headers, their values are never returned
+	Auth               string   `json:"auth,omitempty" enums:"basic,bearer,cookie"`
+	Username           string   `json:"username,omitempty"`
+	HasCredential      bool     `json:"has_credential"`  // Whether the password, token or cookies are set
+	Proxy              string   `json:"proxy,omitempty"` // Without its password
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+	Timeout            string   `json:"timeout,omitempty" example:"30s"`
+}
+
+// Helper function: convert the fetch settings of a source into their response struct
+func NewFetchSettingsResponse(settings *db.FetchSettings) *FetchSettingsResponse {
+	if settings == nil {
+		return nil
+	}
+
+	resp := &FetchSettingsResponse{
+		Headers:            headerNames(settings.Headers),
+		Auth:               settings.Auth,
+		Username:           settings.Username,
+		HasCredential:      settings.Credential != "",
+		Proxy:              settings.Proxy,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	if settings.Timeout > 0 {
+		resp.Timeout = settings.Timeout.String()
+	}
+	return resp
+}
+
+// Helper function: the sorted names of custom headers
+func headerNames(headers map[string]string) []string {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Request struct for the fetch settings of a source. The header values, password, token,
+// cookies and proxy password are encrypted before being stored, and never returned.
+type FetchSettingsRequest struct {
+	Headers            map[string]string `json:"headers"`                                                                                  // Sent to the hosts of the source, kept if not given again, {} removes them
+	Auth               string            `json:"auth" binding:"omitempty,oneof=none basic bearer cookie" enums:"none,basic,bearer,cookie"` // none by default
+	Username           string            `json:"username"`                                                                                 // For basic auth
+	Password           string            `json:"password"`                                                                                 // For basic auth, kept if empty and the auth is unchanged
+	Token              string            `json:"token"`                                                                                    // For bearer auth, kept if empty and the auth is unchanged
+	Cookies            string            `json:"cookies"`                                                                                  // For cookie auth, as in the Cookie header, kept if empty and the auth is unchanged
+	Proxy              string            `json:"proxy"`                                                                                    // HTTP(S) or SOCKS5 proxy URL, its password kept if not given again
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`                                                                     // Accept any TLS certificate, for internal hosts
+	Timeout            string            `json:"timeout" example:"30s"`                                                                    // Replaces the scrape timeout
+}
+
+// Encryption of the headers and credentials of a source: the scraper's for the sources
+// stored, plaintextSecrets for the previews
+type secretSealer interface {
+	EncryptHeaders(headers map[string]string) (map[string]string, error)
+	EncryptCredential(credential string) (string, error)
+}
+
+// Secrets left in plaintext, for the previews whose settings only live for their request
+type plaintextSecrets struct{}
+
+func (plaintextSecrets) EncryptHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	return headers, nil
+}
+
+func (plaintextSecrets) EncryptCredential(credential string) (string, error) {
+	return credential, nil
+}
+
+// Helper function: build the fetch settings of a source from the request, encrypting its
+// headers and credentials with secrets. The headers and credentials of the previous
+// settings are kept unless given again.
+func newFetchSettings(secrets secretSealer, req *FetchSettingsRequest, previous *db.FetchSettings) (*db.FetchSettings, error) {
+	if req == nil {
+		return previous, nil
+	}
+
+	settings := &db.FetchSettings{
+		Auth:               req.Auth,
+		Username:           req.Username,
+		InsecureSkipVerify: req.InsecureSkipVerify,
+	}
+	if settings.Auth == "none" {
+		settings.Auth = ""
+	}
+	switch {
+	case req.Headers != nil:
+		headers, err := secrets.EncryptHeaders(req.Headers)
+		if err != nil {
+			return nil, err
+		}
+		settings.Headers = headers
+	case previous != nil:
+		settings.Headers = previous.Headers
+	}
+
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q", req.Timeout)
+		}
+		settings.Timeout = timeout
+	}
+
+	if (req.Password != "" && settings.Auth != db.FetchAuthBasic) ||
+		(req.Token != "" && settings.Auth != db.FetchAuthBearer) ||
+		(req.Cookies != "" && settings.Auth != db.FetchAuthCookie) {
+		return nil, errors.New("password, token and cookies are only for the basic, bearer and cookie auth")
+	}
+	credential := req.Password + req.Token + req.Cookies
+	switch {
+	case credential != "":
+		encrypted, err := secrets.EncryptCredential(credential)
+		if err != nil {
+			return nil, err
+		}
+		settings.Credential = encrypted
+	case previous != nil && previous.Auth == settings.Auth:
+		settings.Credential = previous.Credential
+	}
+
+	if req.Proxy != "" {
+		proxy, err := url.Parse(req.Proxy)
+		if err != nil {
+			return nil, errors.New("invalid proxy url")
+		}
+		password, hasPassword := proxy.User.Password()
+		if proxy.User != nil {
+			proxy.User = url.User(proxy.User.Username())
+		}
+		settings.Proxy = proxy.String()
+
+		switch {
+		case hasPassword:
+			encrypted, err := secrets.EncryptCredential(password)
+			if err != nil {
+				return nil, err
+			}
+			settings.ProxyCredential = encrypted
+		case previous != nil && previous.Proxy == settings.Proxy:
+			settings.ProxyCredential = previous.ProxyCredential
+		}
+	}
+
+	return settings, service.ValidateFetchSettings(settings)
+}
+
+// Helper function: convert a source model into its response struct
+func NewSourceResponse(source db.Source) SourceResponse {
+	var deletedAt *time.Time = nil
+	if source.DeletedAt.Valid {
+		deletedAt = &source.DeletedAt.Time
+	}
+
+	return SourceResponse{
+		ID:        source.ID,
+		Link:      source.Link,
+		Provider:  source.Provider,
+		Category:  source.Category,
+		Type:      source.Type,
+		HTML:      source.HTML,
+		JSON:      NewJSONSourceResponse(source.JSON),
+		Sitemap:   source.Sitemap,
+		Fetch:     NewFetchSettingsResponse(source.Fetch),
+		FetchedAt: source.FetchedAt,
+		DeletedAt: deletedAt,
+	}
+}
+
+// Helper function: check the settings of the source against its type, RSS if not set
+func checkSourceType(source *db.Source) error {
+	if source.Type == "" {
+		source.Type = db.SourceTypeRSS
+	}
+
+	if source.Type != db.SourceTypeHTML && source.HTML != nil {
+		return errors.New("selectors are only for html sources")
+	}
+	if source.Type != db.SourceTypeJSON && source.JSON != nil {
+		return errors.New("request and mapping are only for json sources")
+	}
+	if source.Type != db.SourceTypeSitemap && source.Sitemap != nil {
+		return errors.New("sitemap options are only for sitemap sources")
+	}
+
+	switch source.Type {
+	case db.SourceTypeHTML:
+		return service.ValidateHTMLSelectors(source.HTML)
+	case db.SourceTypeJSON:
+		return service.ValidateJSONSource(source.JSON)
+	default:
+		return nil
+	}
+}
+
+// Helper function: encrypt the headers of the JSON request of the source with secrets,
+// keeping the ones of the previous request unless given again
+func encryptRequestHeaders(secrets secretSealer, source *db.Source, previous *db.JSONSource) error {
+	if source.JSON == nil {
+		return nil
+	}
+	if source.JSON.Request.Headers == nil && previous != nil {
+		source.JSON.Request.Headers = previous.Request.Headers
+		return nil
+	}
+
+	headers, err := secrets.EncryptHeaders(source.JSON.Request.Headers)
+	if err != nil {
+		return err
+	}
+	source.JSON.Request.Headers = headers
+	return nil
+}
+
+// Helper method: check that a sitemap source without page metadata gives the titles of
+// its entries, writing the error response if not
+func (server *Server) checkSitemap(ctx *gin.Context, route string, source db.Source) bool {
+	err := server.scraper.CheckSitemap(ctx.Request.Context(), source)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrSitemapUntitled):
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+	default:
+		server.logger.ErrorContext(ctx.Request.Context(), route+": Failed to check the sitemap", "error", err)
+		ctx.JSON(http.StatusBadGateway, ErrorResponse{Message: "Failed to check the sitemap: " + err.Error()})
+	}
+	return false
 }
 
 // GetSource godoc
@@ -25,48 +303,53 @@ type SourceResponse struct {
 // @Produce      json
 // @Param        id   path      int  true  "Source ID"
 // @Success      200  {object}  SourceResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
 // @Failure      404  {object}  ErrorResponse  "Source not found"
 // @Failure      500  {object}  ErrorResponse  "Failed to get source"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/sources/{id} [get]
 func (server *Server) GetSource(ctx *gin.Context) {
 	// Get ID from path parameter
-	id := ctx.Param("id")
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
 
 	// Fetch source from database
-	var source db.Source
-	result := server.queries.DB.First(&source, id)
-	if result.Error != nil {
+	source, err := server.sources.GetSource(ctx.Request.Context(), id)
+	if err != nil {
 		// If ID not match any record
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
 			return
 		}
 
 		// Other database error
-		server.logger.Error("GET /api/sources/:id: Failed to get source", "error", result.Error)
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/sources/:id: Failed to get source", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get source"})
 		return
 	}
 
 	// Return the result back to client
-	ctx.JSON(http.StatusOK, SourceResponse{
-		ID:       source.ID,
-		Link:     source.Link,
-		Provider: source.Provider,
-		Category: source.Category,
-	})
+	ctx.JSON(http.StatusOK, NewSourceResponse(source))
 }
 
 // ListSources godoc
 // @Summary      List news sources
-// @Description  Retrieve a paginated list of news sources
+// @Description  Retrieve a paginated list of news sources, or of the deleted ones
 // @Tags         sources
 // @Accept       json
 // @Produce      json
-// @Param        page_id    query     int  true   "Page number"
-// @Param        page_size  query     int  true   "Number of items per page"
+// @Param        page_id    query     int     true   "Page number"
+// @Param        page_size  query     int     true   "Number of items per page"
+// @Param        provider   query     string  false  "Only sources from this provider"
+// @Param        category   query     string  false  "Only sources of this category"
+// @Param        deleted    query     bool    false  "List deleted sources instead of active ones"
 // @Success      200  {array}   SourceResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid query parameter"
 // @Failure      500  {object}  ErrorResponse  "Failed to list sources"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/sources [get]
 func (server *Server) ListSources(ctx *gin.Context) {
 	// Get pagination parameters
@@ -76,23 +359,29 @@ func (server *Server) ListSources(ctx *gin.Context) {
 		return
 	}
 
+	deleted, err := strconv.ParseBool(ctx.DefaultQuery("deleted", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid deleted parameter"})
+		return
+	}
+
 	// Fetch sources from database with pagination
-	var sources []db.Source
-	result := server.queries.DB.Limit(int(pageSize)).Offset(int((pageID - 1) * pageSize)).Find(&sources)
-	if result.Error != nil {
-		server.logger.Error("GET /api/sources: Failed to list sources", "error", result.Error)
+	sources, err := server.sources.ListSources(ctx.Request.Context(), db.SourceFilter{
+		Provider: ctx.Query("provider"),
+		Category: ctx.Query("category"),
+		Deleted:  deleted,
+		Limit:    pageSize,
+		Offset:   (pageID - 1) * pageSize,
+	})
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/sources: Failed to list sources", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list sources"})
 		return
 	}
 
 	resp := make([]SourceResponse, len(sources))
 	for i, source := range sources {
-		resp[i] = SourceResponse{
-			ID:       source.ID,
-			Link:     source.Link,
-			Provider: source.Provider,
-			Category: source.Category,
-		}
+		resp[i] = NewSourceResponse(source)
 	}
 
 	// Return the result back to client
@@ -101,56 +390,117 @@ func (server *Server) ListSources(ctx *gin.Context) {
 
 // Request struct for create resource action
 type CreateSourceRequest struct {
-	Link     string `json:"link" binding:"required"`
-	Provider string `json:"provider" binding:"required"`
-	Category string `json:"category" binding:"required"`
+	Link     string                `json:"link" binding:"required"`
+	Provider string                `json:"provider" binding:"required"`
+	Category string                `json:"category" binding:"required"`
+	Type     string                `json:"type" binding:"omitempty,oneof=rss html json sitemap" enums:"rss,html,json,sitemap"` // rss by default
+	HTML     *db.HTMLSelectors     `json:"html"`                                                                               // Required for html sources
+	JSON     *db.JSONSource        `json:"json"`                                                                               // Required for json sources
+	Sitemap  *db.SitemapOptions    `json:"sitemap"`                                                                            // Optional for sitemap sources
+	Fetch    *FetchSettingsRequest `json:"fetch"`                                                                              // Headers, auth, proxy, TLS and timeout of the requests
+	Backfill *BackfillRequest      `json:"backfill"`                                                                           // Backfill the history of a feed source once added, by default if backfill.on_create
 }
 
 // CreateSource godoc
 // @Summary      Create a new news source
-// @Description  Add a new news source to the database
+// @Description  Add a new news source to the database. HTML sources need the CSS selectors of their articles,
+// @Description  JSON sources the gjson paths of their fields.
+// @Description  Sitemap sources can fill the title and image of their entries from the metadata of their pages,
+// @Description  which is required if their entries have no news:title.
+// @Description  Every type accepts fetch settings, whose headers and credentials are encrypted and never returned.
+// @Description  The history of feed sources is backfilled once added if asked, or if backfill.on_create is set.
 // @Tags         sources
 // @Accept       json
 // @Produce      json
+// @Security     ApiKeyAuth
 // @Param        source  body      CreateSourceRequest  true  "Source details"
 // @Success      201  {object}  SourceResponse
-// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body, selectors or fetch settings"
+// @Failure      409  {object}  ErrorResponse  "Source link already exists"
 // @Failure      500  {object}  ErrorResponse  "Failed to create source"
+// @Failure      502  {object}  ErrorResponse  "Failed to check the sitemap"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/sources [post]
 func (server *Server) CreateSource(ctx *gin.Context) {
 	var req CreateSourceRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		server.logger.Error("POST /api/sources: Invalid request body", "error", err)
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources: Invalid request body", "error", err)
 		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
 		return
 	}
 
 	var source = db.Source{
-		Model:    gorm.Model{},
 		Link:     req.Link,
 		Provider: req.Provider,
 		Category: req.Category,
+		Type:     req.Type,
+		HTML:     req.HTML,
+		JSON:     req.JSON,
+		Sitemap:  req.Sitemap,
+	}
+	if err := checkSourceType(&source); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+		return
+	}
+	if err := encryptRequestHeaders(server.scraper, &source, nil); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+		return
 	}
-	result := server.queries.DB.Create(&source)
-	if result.Error != nil {
-		server.logger.Error("POST /api/sources: Failed to create source", "error", result.Error)
+	if req.Backfill != nil && source.Type != db.SourceTypeRSS {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + service.ErrBackfillUnsupported.Error()})
+		return
+	}
+
+	fetch, err := newFetchSettings(server.scraper, req.Fetch, nil)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid fetch settings: " + err.Error()})
+		return
+	}
+	source.Fetch = fetch
+
+	if !server.checkSitemap(ctx, "POST /api/sources", source) {
+		return
+	}
+
+	if err := server.sources.CreateSource(ctx.Request.Context(), &source); err != nil {
+		if errors.Is(err, db.ErrDuplicate) {
+			ctx.JSON(http.StatusConflict, ErrorResponse{Message: "Source link already exists"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources: Failed to create source", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create source"})
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, SourceResponse{
-		ID:       source.ID,
-		Link:     source.Link,
-		Provider: source.Provider,
-		Category: source.Category,
-	})
+	// The source is created either way, its backfill can be enqueued again later
+	if server.backfiller != nil && source.Type == db.SourceTypeRSS && (req.Backfill != nil || server.config.Backfill.OnCreate) {
+		var backfill BackfillRequest
+		if req.Backfill != nil {
+			backfill = *req.Backfill
+		}
+		_, _, err := server.backfiller.Enqueue(ctx.Request.Context(), source.ID, service.BackfillRequest{
+			MaxPages: backfill.MaxPages,
+			Since:    backfill.Since,
+		})
+		if err != nil {
+			server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources: Failed to enqueue backfill", "error", err)
+		}
+	}
+
+	ctx.JSON(http.StatusCreated, NewSourceResponse(source))
 }
 
 // Request struct for update source action
 type UpdateSourceRequest struct {
-	Link     string `json:"link"`
-	Provider string `json:"provider"`
-	Category string `json:"category"`
+	Link     string                `json:"link"`
+	Provider string                `json:"provider"`
+	Category string                `json:"category"`
+	Type     string                `json:"type" binding:"omitempty,oneof=rss html json sitemap" enums:"rss,html,json,sitemap"`
+	HTML     *db.HTMLSelectors     `json:"html"`    // Replaces the selectors, which are dropped when switching to another type
+	JSON     *db.JSONSource        `json:"json"`    // Replaces the request and mapping, the headers kept if not given again, dropped when switching to another type
+	Sitemap  *db.SitemapOptions    `json:"sitemap"` // Replaces the sitemap options, dropped when switching to another type
+	Fetch    *FetchSettingsRequest `json:"fetch"`   // Replaces the fetch settings, the headers and credentials not given again are kept
 }
 
 // UpdateSource godoc
@@ -159,40 +509,49 @@ type UpdateSourceRequest struct {
 // @Tags         sources
 // @Accept       json
 // @Produce      json
+// @Security     ApiKeyAuth
 // @Param        id      path      int                  true  "Source ID"
 // @Param        source  body      UpdateSourceRequest  true  "Updated source details"
 // @Success      200  {object}  SourceResponse
-// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      400  {object}  ErrorResponse  "Invalid request body, selectors or fetch settings"
 // @Failure      404  {object}  ErrorResponse  "Source not found"
+// @Failure      409  {object}  ErrorResponse  "Source link already exists"
 // @Failure      500  {object}  ErrorResponse  "Failed to update source"
+// @Failure      502  {object}  ErrorResponse  "Failed to check the sitemap"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/sources/{id} [put]
 func (server *Server) UpdateSource(ctx *gin.Context) {
 	// Parse and validate request body
 	var req UpdateSourceRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		server.logger.Error("PUT /api/sources/:id: Invalid request body", "error", err)
+		server.logger.ErrorContext(ctx.Request.Context(), "PUT /api/sources/:id: Invalid request body", "error", err)
 		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
 		return
 	}
 
 	// Get ID from path parameter
-	id := ctx.Param("id")
-	var source db.Source
-	result := server.queries.DB.First(&source, id)
-	if result.Error != nil {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	source, err := server.sources.GetSource(ctx.Request.Context(), id)
+	if err != nil {
 		// If ID not match any record
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
 			return
 		}
 
 		// Other database error
-		server.logger.Error("PUT /api/sources/:id: Failed to get source", "error", result.Error)
+		server.logger.ErrorContext(ctx.Request.Context(), "PUT /api/sources/:id: Failed to get source", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get source"})
 		return
 	}
 
-	// Update new values if provided
+	// Update new values if provided, the headers of the JSON request are kept unless given again
+	previousJSON := source.JSON
 	if req.Link != "" {
 		source.Link = req.Link
 	}
@@ -205,56 +564,114 @@ func (server *Server) UpdateSource(ctx *gin.Context) {
 		source.Category = req.Category
 	}
 
+	if req.Type != "" {
+		source.Type = req.Type
+		if req.Type != db.SourceTypeHTML {
+			source.HTML = nil
+		}
+		if req.Type != db.SourceTypeJSON {
+			source.JSON = nil
+		}
+		if req.Type != db.SourceTypeSitemap {
+			source.Sitemap = nil
+		}
+	}
+
+	if req.HTML != nil {
+		source.HTML = req.HTML
+	}
+
+	if req.JSON != nil {
+		source.JSON = req.JSON
+	}
+
+	if req.Sitemap != nil {
+		source.Sitemap = req.Sitemap
+	}
+
+	if err := checkSourceType(&source); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+		return
+	}
+	if req.JSON != nil {
+		if err := encryptRequestHeaders(server.scraper, &source, previousJSON); err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+			return
+		}
+	}
+
+	if source.Fetch, err = newFetchSettings(server.scraper, req.Fetch, source.Fetch); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid fetch settings: " + err.Error()})
+		return
+	}
+
+	// The sitemap is checked again when it may have changed
+	if (req.Link != "" || req.Type != "" || req.Sitemap != nil) && !server.checkSitemap(ctx, "PUT /api/sources/:id", source) {
+		return
+	}
+
 	// Save changed to database
-	result = server.queries.DB.Save(&source)
-	if result.Error != nil {
-		server.logger.Error("PUT /api/sources/:id: Failed to update source", "error", result.Error)
+	if err := server.sources.UpdateSource(ctx.Request.Context(), &source); err != nil {
+		if errors.Is(err, db.ErrDuplicate) {
+			ctx.JSON(http.StatusConflict, ErrorResponse{Message: "Source link already exists"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "PUT /api/sources/:id: Failed to update source", "error", err)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to update source"})
 		return
 	}
 
 	// Return result back to client
-	ctx.JSON(http.StatusOK, SourceResponse{
-		ID:       source.ID,
-		Link:     source.Link,
-		Provider: source.Provider,
-		Category: source.Category,
-	})
+	ctx.JSON(http.StatusOK, NewSourceResponse(source))
 }
 
 // DeleteSource godoc
 // @Summary      Delete a news source
-// @Description  Remove an existing news source by ID
+// @Description  Soft delete a news source by ID, hiding its articles with it. With purge=true,
+// @Description  permanently remove the source (deleted or not), its articles and retention policies.
 // @Tags         sources
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int  true  "Source ID"
+// @Security     ApiKeyAuth
+// @Param        id     path      int   true   "Source ID"
+// @Param        purge  query     bool  false  "Permanently delete the source and its articles"
 // @Success      204  "No Content"
+// @Failure      400  {object}  ErrorResponse  "Invalid parameter"
 // @Failure      404  {object}  ErrorResponse  "Source not found"
 // @Failure      500  {object}  ErrorResponse  "Failed to delete source"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
 // @Router       /api/sources/{id} [delete]
 func (server *Server) DeleteSource(ctx *gin.Context) {
 	// Get ID from path parameter
-	id := ctx.Param("id")
-	var source db.Source
-	result := server.queries.DB.First(&source, id)
-	if result.Error != nil {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	purge, err := strconv.ParseBool(ctx.DefaultQuery("purge", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid purge parameter"})
+		return
+	}
+
+	// Delete the source
+	if purge {
+		err = server.sources.PurgeSource(ctx.Request.Context(), id)
+	} else {
+		err = server.sources.DeleteSource(ctx.Request.Context(), id)
+	}
+
+	if err != nil {
 		// If ID not match any record
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
 			return
 		}
 
 		// Other database error
-		server.logger.Error("DELETE /api/sources/:id: Failed to get source", "error", result.Error)
-		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get source"})
-		return
-	}
-
-	// Delete the source
-	result = server.queries.DB.Delete(&source)
-	if result.Error != nil {
-		server.logger.Error("DELETE /api/sources/:id: Failed to delete source", "error", result.Error)
+		server.logger.ErrorContext(ctx.Request.Context(), "DELETE /api/sources/:id: Failed to delete source", "error", err, "purge", purge)
 		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to delete source"})
 		return
 	}
@@ -262,3 +679,131 @@ func (server *Server) DeleteSource(ctx *gin.Context) {
 	// Return no content status
 	ctx.Status(http.StatusNoContent)
 }
+
+// RestoreSource godoc
+// @Summary      Restore a deleted news source
+// @Description  Undo the deletion of a news source, bringing back the articles deleted with it
+// @Tags         sources
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Source ID"
+// @Success      200  {object}  SourceResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      404  {object}  ErrorResponse  "Deleted source not found"
+// @Failure      409  {object}  ErrorResponse  "Source link already exists"
+// @Failure      500  {object}  ErrorResponse  "Failed to restore source"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/sources/{id}/restore [post]
+func (server *Server) RestoreSource(ctx *gin.Context) {
+	// Get ID from path parameter
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	source, err := server.sources.RestoreSource(ctx.Request.Context(), id)
+	if err != nil {
+		// If ID not match any deleted source
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Deleted source not found"})
+			return
+		}
+
+		// Another source uses the same link now
+		if errors.Is(err, db.ErrDuplicate) {
+			ctx.JSON(http.StatusConflict, ErrorResponse{Message: "Source link already exists"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources/:id/restore: Failed to restore source", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to restore source"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewSourceResponse(source))
+}
+
+// Request struct for previewing a source
+type PreviewSourceRequest struct {
+	Link    string                `json:"link" binding:"required,http_url"`
+	Type    string                `json:"type" binding:"omitempty,oneof=rss html json sitemap" enums:"rss,html,json,sitemap"` // rss by default
+	HTML    *db.HTMLSelectors     `json:"html"`                                                                               // Required for html sources
+	JSON    *db.JSONSource        `json:"json"`                                                                               // Required for json sources
+	Sitemap *db.SitemapOptions    `json:"sitemap"`                                                                            // Optional for sitemap sources
+	Fetch   *FetchSettingsRequest `json:"fetch"`                                                                              // Headers, auth, proxy, TLS and timeout of the requests
+}
+
+// Article found by previewing a source
+type PreviewArticleResponse struct {
+	Title         string  `json:"title"`
+	Url           string  `json:"url"`
+	Image         *string `json:"image"`
+	PublishedDate string  `json:"published_date"`
+}
+
+// PreviewSource godoc
+// @Summary      Preview the articles of a news source
+// @Description  Scrape the live page or feed with the given settings, e.g. to test the CSS selectors of an
+// @Description  HTML source or the mapping of a JSON source before saving it. Nothing is stored, so the
+// @Description  headers and credentials are not encrypted and need no credential key.
+// @Tags         sources
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        source  body      PreviewSourceRequest  true  "Source settings"
+// @Success      200  {array}   PreviewArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid request body, selectors or fetch settings"
+// @Failure      502  {object}  ErrorResponse  "Failed to scrape the source"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/sources/preview [post]
+func (server *Server) PreviewSource(ctx *gin.Context) {
+	var req PreviewSourceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/sources/preview: Invalid request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
+		return
+	}
+
+	source := db.Source{Link: req.Link, Type: req.Type, HTML: req.HTML, JSON: req.JSON, Sitemap: req.Sitemap}
+	if err := checkSourceType(&source); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+		return
+	}
+	if err := encryptRequestHeaders(plaintextSecrets{}, &source, nil); err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source: " + err.Error()})
+		return
+	}
+
+	fetch, err := newFetchSettings(plaintextSecrets{}, req.Fetch, nil)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid fetch settings: " + err.Error()})
+		return
+	}
+	source.Fetch = fetch
+
+	articles, err := server.scraper.PreviewPlaintext(ctx.Request.Context(), source)
+	if err != nil {
+		// The failure is what the client wants to know about
+		ctx.JSON(http.StatusBadGateway, ErrorResponse{Message: "Failed to scrape the source: " + err.Error()})
+		return
+	}
+
+	resp := make([]PreviewArticleResponse, len(articles))
+	for i, article := range articles {
+		var image *string = nil
+		if article.Image.Valid {
+			image = &article.Image.String
+		}
+
+		resp[i] = PreviewArticleResponse{
+			Title:         article.Title,
+			Url:           article.Url,
+			Image:         image,
+			PublishedDate: article.PublishedDate,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Name of the server-sent events carrying an article
+const streamArticleEvent = "article"
+
+// Largest message read from a WebSocket client, which only sends control frames
+const maxStreamMessageSize = 512
+
+// Message sent on the WebSocket stream for each new article
+type StreamMessage struct {
+	ID      uint64          `json:"id"` // Event ID, to resume the stream from with last_event_id
+	Article ArticleResponse `json:"article"`
+}
+
+// Helper function: convert a stream event into its WebSocket message
+func NewStreamMessage(event service.StreamEvent) StreamMessage {
+	return StreamMessage{ID: event.ID, Article: NewArticleResponse(event.Article)}
+}
+
+// StreamArticles godoc
+// @Summary      Stream new articles
+// @Description  Push the new articles as they are scraped, as server-sent events named "article" carrying an ArticleResponse, their ID being the event ID.
+// @Description  A comment is sent as heartbeat while the stream is idle. A client reconnecting with Last-Event-ID gets the articles it missed, as long as they are still buffered.
+// @Tags         articles
+// @Produce      text/event-stream
+// @Param        source_id      query     int     false  "Filter by source ID"
+// @Param        category       query     string  false  "Filter by category"
+// @Param        Last-Event-ID  header    int     false  "Resume after this event"
+// @Param        last_event_id  query     int     false  "Resume after this event, for clients that can't set headers"
+// @Success      200  {object}  ArticleResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid query parameter"
+// @Failure      503  {object}  ErrorResponse  "Server is shutting down"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/stream/articles [get]
+func (server *Server) StreamArticles(ctx *gin.Context) {
+	subscription, missed, ok := server.subscribeStream(ctx)
+	if !ok {
+		// Error already handled in subscribeStream
+		return
+	}
+	defer subscription.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no") // Disable buffering in nginx
+	ctx.Status(http.StatusOK)
+
+	// Helper function: send an event and flush it to the client
+	send := func(event service.StreamEvent) error {
+		data, err := json.Marshal(NewArticleResponse(event.Article))
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(ctx.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, streamArticleEvent, data); err != nil {
+			return err
+		}
+		ctx.Writer.Flush()
+		return nil
+	}
+
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(server.config.Stream.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Closed on shutdown or for being too slow, the client reconnects
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+// StreamArticlesWebSocket godoc
+// @Summary      Stream new articles over WebSocket
+// @Description  Push the new articles as they are scraped, as StreamMessage JSON text messages. Pings are sent as heartbeat while the stream is idle.
+// @Description  A client reconnecting with last_event_id gets the articles it missed, as long as they are still buffered.
+// @Tags         articles
+// @Param        source_id      query     int     false  "Filter by source ID"
+// @Param        category       query     string  false  "Filter by category"
+// @Param        last_event_id  query     int     false  "Resume after this event"
+// @Success      101  {object}  StreamMessage
+// @Failure      400  {object}  ErrorResponse  "Invalid query parameter"
+// @Failure      503  {object}  ErrorResponse  "Server is shutting down"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/stream/articles/ws [get]
+func (server *Server) StreamArticlesWebSocket(ctx *gin.Context) {
+	subscription, missed, ok := server.subscribeStream(ctx)
+	if !ok {
+		// Error already handled in subscribeStream
+		return
+	}
+	defer subscription.Close()
+
+	upgrader := websocket.Upgrader{CheckOrigin: server.checkStreamOrigin}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// The upgrader already answered the client
+		server.logger.WarnContext(ctx.Request.Context(), "GET /api/stream/articles/ws: Failed to upgrade connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// The client is considered gone if it doesn't answer two heartbeats
+	heartbeat := server.config.Stream.Heartbeat
+	conn.SetReadLimit(maxStreamMessageSize)
+	conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+
+	// Read until the connection closes, which also processes the pongs
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Helper function: send a message, giving up if the client doesn't take it in time
+	send := func(messageType int, data []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(heartbeat))
+		return conn.WriteMessage(messageType, data)
+	}
+
+	// Helper function: send an event as a JSON message
+	sendEvent := func(event service.StreamEvent) error {
+		data, err := json.Marshal(NewStreamMessage(event))
+		if err != nil {
+			return err
+		}
+		return send(websocket.TextMessage, data)
+	}
+
+	for _, event := range missed {
+		if err := sendEvent(event); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Closed on shutdown or for being too slow, the client reconnects
+				send(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := sendEvent(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := send(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Helper method: parse the filters and resume point of a stream request and subscribe to
+// the stream, returning the missed events to send first. Answers the client on failure.
+func (server *Server) subscribeStream(ctx *gin.Context) (*service.Subscription, []service.StreamEvent, bool) {
+	filter := service.StreamFilter{Category: ctx.Query("category")}
+	if sourceID := ctx.Query("source_id"); sourceID != "" {
+		id, err := strconv.ParseUint(sourceID, 10, 0)
+		if err != nil || id == 0 {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid source_id parameter"})
+			return nil, nil, false
+		}
+		filter.SourceID = uint(id)
+	}
+
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+
+	var lastID uint64
+	resume := lastEventID != ""
+	if resume {
+		var err error
+		if lastID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid last event ID"})
+			return nil, nil, false
+		}
+	}
+
+	subscription, missed := server.stream.Subscribe(filter, lastID, resume)
+	if subscription == nil {
+		ctx.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: "Server is shutting down"})
+		return nil, nil, false
+	}
+
+	return subscription, missed, true
+}
+
+// Helper method: accept WebSocket connections from the same host or from the allowed origins
+func (server *Server) checkStreamOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	origins := server.config.CORS.AllowedOrigins
+	if origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
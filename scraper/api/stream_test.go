@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// Server-sent event read from a stream
+type testEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// Helper function: read the next event of a server-sent events stream, skipping heartbeats
+func readEvent(t *testing.T, reader *bufio.Reader) testEvent {
+	t.Helper()
+
+	var event testEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event.data != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// Helper function: publish one article per title from the source to the stream of the server
+func publishArticles(server *Server, source db.Source, titles ...string) {
+	for i, title := range titles {
+		article := db.Article{Title: title, Url: "https://example.com/" + title, SourceID: source.ID, Source: source}
+		article.ID = uint(i + 1)
+		server.stream.HandleArticleCreated(context.Background(), service.ArticleCreated{Article: article})
+	}
+}
+
+// Test the server-sent events stream of articles, with filters and resume
+func TestStreamArticles(t *testing.T) {
+	server, _ := newTestServer(t)
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	tech := db.Source{Category: "tech"}
+	tech.ID = 1
+	sport := db.Source{Category: "sport"}
+	sport.ID = 2
+
+	// Invalid parameters
+	tests := []struct {
+		name   string
+		query  string
+		header string
+	}{
+		{"invalid source_id", "?source_id=abc", ""},
+		{"invalid last_event_id", "?last_event_id=abc", ""},
+		{"invalid Last-Event-ID", "", "-1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/stream/articles"+test.query, nil)
+			if test.header != "" {
+				req.Header.Set("Last-Event-ID", test.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.Handler().ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+
+	// Helper function: open a stream, waiting for the subscription to be registered
+	open := func(query, lastEventID string) (*bufio.Reader, func()) {
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+"/api/stream/articles"+query, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+	}
+
+	reader, closeStream := open("?category=tech", "")
+	publishArticles(server, sport, "football")
+	publishArticles(server, tech, "go", "rust")
+
+	event := readEvent(t, reader)
+	require.Equal(t, "2", event.id)
+	require.Equal(t, streamArticleEvent, event.event)
+	var article ArticleResponse
+	require.NoError(t, json.Unmarshal([]byte(event.data), &article))
+	require.Equal(t, "go", article.Title)
+	require.Equal(t, "tech", article.Category)
+
+	event = readEvent(t, reader)
+	require.Equal(t, "3", event.id)
+	closeStream()
+
+	// Resume after the first tech article, the missed one is replayed first
+	reader, closeStream = open("?source_id=1", "2")
+	defer closeStream()
+	event = readEvent(t, reader)
+	require.Equal(t, "3", event.id)
+	require.NoError(t, json.Unmarshal([]byte(event.data), &article))
+	require.Equal(t, "rust", article.Title)
+
+	// Shutting down ends the stream
+	require.NoError(t, server.Shutdown(context.Background()))
+	_, err := reader.ReadString('\n')
+	require.Error(t, err)
+}
+
+// Test the WebSocket stream of articles, with resume and heartbeats
+func TestStreamArticlesWebSocket(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.config.Stream.Heartbeat = 50 * time.Millisecond
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	tech := db.Source{Category: "tech"}
+	tech.ID = 1
+	publishArticles(server, tech, "go")
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/api/stream/articles/ws?last_event_id=0"
+
+	// Other origins are refused
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// The buffered article is replayed, then the new one is pushed
+	var message StreamMessage
+	require.NoError(t, conn.ReadJSON(&message))
+	require.Equal(t, uint64(1), message.ID)
+	require.Equal(t, "go", message.Article.Title)
+
+	publishArticles(server, tech, "rust")
+	require.NoError(t, conn.ReadJSON(&message))
+	require.Equal(t, uint64(2), message.ID)
+	require.Equal(t, "rust", message.Article.Title)
+
+	// Pings are only handled while reading
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat received")
+	}
+}
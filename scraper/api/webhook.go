@@ -0,0 +1,345 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Response struct for webhook
+type WebhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	SourceID  *uint     `json:"source_id"`
+	Category  string    `json:"category"`
+	Keyword   string    `json:"keyword"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"` // Only returned on creation
+}
+
+// Helper function: convert a webhook model into its response struct, without its secret
+func NewWebhookResponse(webhook db.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		SourceID:  webhook.SourceID,
+		Category:  webhook.Category,
+		Keyword:   webhook.Keyword,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+// Response struct for webhook delivery
+type WebhookDeliveryResponse struct {
+	ID            uint            `json:"id"`
+	WebhookID     uint            `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status" enums:"pending,succeeded,failed"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	StatusCode    int             `json:"status_code"`
+	Error         string          `json:"error"`
+	DeliveredAt   *time.Time      `json:"delivered_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// Helper function: convert a webhook delivery model into its response struct
+func NewWebhookDeliveryResponse(delivery db.WebhookDelivery) WebhookDeliveryResponse {
+	return WebhookDeliveryResponse{
+		ID:            delivery.ID,
+		WebhookID:     delivery.WebhookID,
+		Event:         delivery.Event,
+		Payload:       json.RawMessage(delivery.Payload),
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		StatusCode:    delivery.StatusCode,
+		Error:         delivery.Error,
+		DeliveredAt:   delivery.DeliveredAt,
+		CreatedAt:     delivery.CreatedAt,
+	}
+}
+
+// ListWebhooks godoc
+// @Summary      List webhooks
+// @Description  Retrieve every webhook subscription, without their secrets
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {array}   WebhookResponse
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      500  {object}  ErrorResponse  "Failed to list webhooks"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks [get]
+func (server *Server) ListWebhooks(ctx *gin.Context) {
+	webhooks, err := server.webhooks.ListWebhooks(ctx.Request.Context())
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/webhooks: Failed to list webhooks", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list webhooks"})
+		return
+	}
+
+	resp := make([]WebhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		resp[i] = NewWebhookResponse(webhook)
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// Request struct for create webhook action. Each filter left empty matches every article.
+type CreateWebhookRequest struct {
+	URL      string `json:"url" binding:"required,http_url"`
+	Secret   string `json:"secret" binding:"omitempty,min=16"` // Generated when empty
+	SourceID *uint  `json:"source_id"`
+	Category string `json:"category"`
+	Keyword  string `json:"keyword"`
+}
+
+// CreateWebhook godoc
+// @Summary      Create a webhook
+// @Description  Subscribe a URL to the new articles matching the filters. Deliveries are signed with the secret, which is only returned here.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        webhook  body      CreateWebhookRequest  true  "Webhook details"
+// @Success      201  {object}  WebhookResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid request body"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      404  {object}  ErrorResponse  "Source not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to create webhook"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks [post]
+func (server *Server) CreateWebhook(ctx *gin.Context) {
+	var req CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/webhooks: Invalid request body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid request body"})
+		return
+	}
+
+	// Make sure the source exists
+	if req.SourceID != nil {
+		if _, err := server.sources.GetSource(ctx.Request.Context(), *req.SourceID); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Source not found"})
+				return
+			}
+
+			server.logger.ErrorContext(ctx.Request.Context(), "POST /api/webhooks: Failed to get source", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get source"})
+			return
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = service.GenerateWebhookSecret(); err != nil {
+			server.logger.ErrorContext(ctx.Request.Context(), "POST /api/webhooks: Failed to generate secret", "error", err)
+			ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create webhook"})
+			return
+		}
+	}
+
+	webhook := db.Webhook{
+		URL:      req.URL,
+		Secret:   secret,
+		SourceID: req.SourceID,
+		Category: req.Category,
+		Keyword:  req.Keyword,
+	}
+	if err := server.webhooks.CreateWebhook(ctx.Request.Context(), &webhook); err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/webhooks: Failed to create webhook", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to create webhook"})
+		return
+	}
+
+	resp := NewWebhookResponse(webhook)
+	resp.Secret = secret
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+// GetWebhook godoc
+// @Summary      Get a webhook by ID
+// @Description  Retrieve a single webhook subscription, without its secret
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Webhook ID"
+// @Success      200  {object}  WebhookResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      404  {object}  ErrorResponse  "Webhook not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to get webhook"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks/{id} [get]
+func (server *Server) GetWebhook(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	webhook, err := server.webhooks.GetWebhook(ctx.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Webhook not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/webhooks/:id: Failed to get webhook", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to get webhook"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewWebhookResponse(webhook))
+}
+
+// DeleteWebhook godoc
+// @Summary      Delete a webhook
+// @Description  Unsubscribe a webhook by ID. Its pending deliveries fail, the delivery log is kept.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Webhook ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      404  {object}  ErrorResponse  "Webhook not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to delete webhook"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks/{id} [delete]
+func (server *Server) DeleteWebhook(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	if err := server.webhooks.DeleteWebhook(ctx.Request.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Webhook not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "DELETE /api/webhooks/:id: Failed to delete webhook", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to delete webhook"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary      List the deliveries of a webhook
+// @Description  Retrieve a paginated delivery log of a webhook, most recent first
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id         path      int  true  "Webhook ID"
+// @Param        page_id    query     int  true  "Page number"
+// @Param        page_size  query     int  true  "Number of items per page"
+// @Success      200  {array}   WebhookDeliveryResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id or query parameter"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      500  {object}  ErrorResponse  "Failed to list webhook deliveries"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks/{id}/deliveries [get]
+func (server *Server) ListWebhookDeliveries(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	pageID, pageSize := server.GetPagingParams(ctx)
+	if pageID == 0 || pageSize == 0 {
+		// Error already handled in GetPagingParams
+		return
+	}
+
+	deliveries, err := server.webhooks.ListDeliveries(ctx.Request.Context(), id, pageSize, (pageID-1)*pageSize)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /api/webhooks/:id/deliveries: Failed to list webhook deliveries", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to list webhook deliveries"})
+		return
+	}
+
+	resp := make([]WebhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		resp[i] = NewWebhookDeliveryResponse(delivery)
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// RedeliverWebhook godoc
+// @Summary      Redeliver a webhook delivery
+// @Description  Queue a delivery again with a fresh set of attempts, whether it failed or succeeded
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id           path      int  true  "Webhook ID"
+// @Param        delivery_id  path      int  true  "Delivery ID"
+// @Success      202  {object}  WebhookDeliveryResponse
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter"
+// @Failure      401  {object}  ErrorResponse  "Missing or invalid API key"
+// @Failure      403  {object}  ErrorResponse  "Insufficient role"
+// @Failure      404  {object}  ErrorResponse  "Webhook delivery not found"
+// @Failure      500  {object}  ErrorResponse  "Failed to redeliver webhook delivery"
+// @Failure      429  {object}  ErrorResponse  "Rate limit or daily quota exceeded"
+// @Router       /api/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (server *Server) RedeliverWebhook(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	deliveryID, err := strconv.ParseUint(ctx.Param("delivery_id"), 10, 0)
+	if err != nil || deliveryID == 0 {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid id parameter"})
+		return
+	}
+
+	// The delivery must belong to the webhook of the path
+	delivery, err := server.webhooks.GetDelivery(ctx.Request.Context(), uint(deliveryID))
+	if err == nil && delivery.WebhookID != id {
+		err = db.ErrNotFound
+	}
+	if err == nil {
+		delivery, err = server.dispatcher.Redeliver(ctx.Request.Context(), uint(deliveryID))
+	}
+
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Webhook delivery not found"})
+			return
+		}
+
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /api/webhooks/:id/deliveries/:delivery_id/redeliver: Failed to redeliver webhook delivery", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to redeliver webhook delivery"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, NewWebhookDeliveryResponse(delivery))
+}
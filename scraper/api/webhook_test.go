@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the webhook handlers, from the subscription to the redelivery
+func TestWebhookHandlers(t *testing.T) {
+	server, store := newTestServer(t)
+	ctx := context.Background()
+
+	source := db.Source{Link: "https://example.com/rss", Provider: "test", Category: "tech"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	unknownSource := uint(99)
+
+	// Invalid subscriptions
+	tests := []struct {
+		name string
+		body any
+		code int
+	}{
+		{"missing url", CreateWebhookRequest{}, http.StatusBadRequest},
+		{"invalid url", CreateWebhookRequest{URL: "not a url"}, http.StatusBadRequest},
+		{"short secret", CreateWebhookRequest{URL: "https://example.com/hook", Secret: "short"}, http.StatusBadRequest},
+		{"unknown source", CreateWebhookRequest{URL: "https://example.com/hook", SourceID: &unknownSource}, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doRequest(t, server, http.MethodPost, "/api/webhooks", test.body)
+			require.Equal(t, test.code, recorder.Code)
+		})
+	}
+
+	// The secret is generated and only returned on creation
+	recorder := doRequest(t, server, http.MethodPost, "/api/webhooks", CreateWebhookRequest{
+		URL:      "https://example.com/hook",
+		SourceID: &source.ID,
+		Keyword:  "go",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var created WebhookResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.True(t, strings.HasPrefix(created.Secret, service.WebhookSecretPrefix))
+	require.Equal(t, source.ID, *created.SourceID)
+
+	recorder = doRequest(t, server, http.MethodGet, fmt.Sprintf("/api/webhooks/%d", created.ID), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotContains(t, recorder.Body.String(), created.Secret)
+
+	recorder = doRequest(t, server, http.MethodGet, "/api/webhooks", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var webhooks []WebhookResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &webhooks))
+	require.Len(t, webhooks, 1)
+	require.Empty(t, webhooks[0].Secret)
+
+	// Only the matching article is queued
+	articles := []db.Article{
+		{Title: "Go 1.30 released", Url: "https://example.com/go", SourceID: source.ID},
+		{Title: "Rust news", Url: "https://example.com/rust", SourceID: source.ID},
+	}
+	inserted, err := store.UpsertArticles(ctx, articles)
+	require.NoError(t, err)
+	for _, article := range inserted {
+		article.Source = source
+		require.NoError(t, server.dispatcher.HandleArticleCreated(ctx, service.ArticleCreated{Article: article}))
+	}
+
+	deliveriesPath := fmt.Sprintf("/api/webhooks/%d/deliveries?page_id=1&page_size=10", created.ID)
+	recorder = doRequest(t, server, http.MethodGet, deliveriesPath, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var deliveries []WebhookDeliveryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 1)
+	require.Equal(t, service.EventArticleCreated, deliveries[0].Event)
+	require.Equal(t, db.DeliveryPending, deliveries[0].Status)
+
+	var event service.ArticleEvent
+	require.NoError(t, json.Unmarshal(deliveries[0].Payload, &event))
+	require.Equal(t, "Go 1.30 released", event.Article.Title)
+
+	// Mark the delivery failed, then redeliver it
+	delivery, err := store.GetDelivery(ctx, deliveries[0].ID)
+	require.NoError(t, err)
+	delivery.Status = db.DeliveryFailed
+	delivery.Attempts = 3
+	require.NoError(t, store.UpdateDelivery(ctx, &delivery))
+
+	recorder = doRequest(t, server, http.MethodPost, fmt.Sprintf("/api/webhooks/%d/deliveries/%d/redeliver", created.ID+1, delivery.ID), nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = doRequest(t, server, http.MethodPost, fmt.Sprintf("/api/webhooks/%d/deliveries/%d/redeliver", created.ID, delivery.ID), nil)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var redelivered WebhookDeliveryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &redelivered))
+	require.Equal(t, db.DeliveryPending, redelivered.Status)
+	require.Zero(t, redelivered.Attempts)
+
+	// Unsubscribe
+	recorder = doRequest(t, server, http.MethodDelete, fmt.Sprintf("/api/webhooks/%d", created.ID), nil)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = doRequest(t, server, http.MethodGet, fmt.Sprintf("/api/webhooks/%d", created.ID), nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// Administration only
+	recorder = doRequestWithKey(t, server, "", http.MethodGet, "/api/webhooks", nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
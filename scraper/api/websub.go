@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest feed a hub may push
+const maxWebSubBody = 10 << 20
+
+// Subscribe to the hubs of the feeds, serving the callbacks the hubs verify and push to
+func (server *Server) SetWebSub(websub *service.WebSub) {
+	server.websub = websub
+}
+
+// VerifyWebSub godoc
+// @Summary      Verify a WebSub subscription
+// @Description  Callback of a WebSub subscription, where its hub checks the intent to subscribe or unsubscribe by expecting the challenge back, or reports that it denied the subscription
+// @Tags         websub
+// @Produce      plain
+// @Param        id                 path   int     true   "Subscription ID"
+// @Param        hub.mode           query  string  true   "Mode"  Enums(subscribe, unsubscribe, denied)
+// @Param        hub.topic          query  string  true   "Topic of the subscription"
+// @Param        hub.challenge      query  string  false  "Challenge to answer, when subscribing or unsubscribing"
+// @Param        hub.lease_seconds  query  int     false  "Lease granted, when subscribing"
+// @Param        hub.reason         query  string  false  "Why the subscription was denied"
+// @Success      200  {string}  string  "The challenge"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter or verification"
+// @Failure      404  {object}  ErrorResponse  "Subscription not found or not expected"
+// @Failure      500  {object}  ErrorResponse  "Failed to verify subscription"
+// @Router       /websub/{id} [get]
+func (server *Server) VerifyWebSub(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	verification := service.WebSubVerification{
+		Mode:   ctx.Query("hub.mode"),
+		Topic:  ctx.Query("hub.topic"),
+		Reason: ctx.Query("hub.reason"),
+	}
+	challenge := ctx.Query("hub.challenge")
+	if verification.Mode != service.WebSubModeDenied && challenge == "" {
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Missing hub.challenge"})
+		return
+	}
+	if lease := ctx.Query("hub.lease_seconds"); lease != "" {
+		seconds, err := strconv.Atoi(lease)
+		if err != nil || seconds < 0 {
+			ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid hub.lease_seconds"})
+			return
+		}
+		verification.LeaseSeconds = seconds
+	}
+
+	agreed, err := server.websub.Verify(ctx.Request.Context(), id, verification)
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "GET /websub/:id: Failed to verify subscription", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to verify subscription"})
+		return
+	}
+	if !agreed {
+		ctx.JSON(http.StatusNotFound, ErrorResponse{Message: "Subscription not found or not expected"})
+		return
+	}
+
+	ctx.String(http.StatusOK, challenge)
+}
+
+// ReceiveWebSub godoc
+// @Summary      Receive WebSub content
+// @Description  Callback of a WebSub subscription, where its hub pushes the updated feed signed with the secret of the subscription. Content with an invalid signature is acknowledged but ignored.
+// @Tags         websub
+// @Accept       xml
+// @Produce      json
+// @Param        id               path    int     true  "Subscription ID"
+// @Param        X-Hub-Signature  header  string  true  "HMAC of the body, such as sha256=<hex>"
+// @Success      202  "Content received"
+// @Failure      400  {object}  ErrorResponse  "Invalid id parameter or body"
+// @Failure      410  {object}  ErrorResponse  "Subscription or source gone"
+// @Failure      500  {object}  ErrorResponse  "Failed to store content"
+// @Router       /websub/{id} [post]
+func (server *Server) ReceiveWebSub(ctx *gin.Context) {
+	id, ok := server.GetIDParam(ctx)
+	if !ok {
+		// Error already handled in GetIDParam
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxWebSubBody))
+	if err != nil {
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /websub/:id: Invalid body", "error", err)
+		ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "Invalid body"})
+		return
+	}
+
+	inserted, err := server.websub.Receive(ctx.Request.Context(), id, ctx.GetHeader(service.WebSubSignatureHeader), body)
+	switch {
+	case errors.Is(err, service.ErrWebSubSignature):
+		// Acknowledged so that the hub doesn't retry, see the WebSub spec
+		server.logger.WarnContext(ctx.Request.Context(), "POST /websub/:id: Ignored content with an invalid signature", "subscription", id)
+	case errors.Is(err, db.ErrNotFound):
+		ctx.JSON(http.StatusGone, ErrorResponse{Message: "Subscription or source gone"})
+		return
+	case err != nil:
+		server.logger.ErrorContext(ctx.Request.Context(), "POST /websub/:id: Failed to store content", "error", err)
+		ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: "Failed to store content"})
+		return
+	default:
+		server.logger.InfoContext(ctx.Request.Context(), "Received WebSub content", "subscription", id, "inserted", inserted)
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
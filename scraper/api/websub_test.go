@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/stretchr/testify/require"
+)
+
+// Feed pushed by the hub in the tests
+const testPushedFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Pushed</title>
+  <entry>
+    <title>Pushed release</title>
+    <link href="https://example.com/releases/1"/>
+    <updated>2025-03-08T10:00:00Z</updated>
+  </entry>
+</feed>`
+
+// Helper function: send a request to a WebSub callback, as a hub does
+func doHubRequest(t *testing.T, server *Server, method, path, signature, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/atom+xml")
+	if signature != "" {
+		req.Header.Set(service.WebSubSignatureHeader, signature)
+	}
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+// Test the WebSub callbacks, from the verification of the intent to the pushed content
+func TestWebSubHandlers(t *testing.T) {
+	server, store := newTestServerWith(t, func(server *Server, store *db.MemoryStore) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		server.SetWebSub(service.NewWebSub(store, store, server.scraper, service.WebSubOptions{
+			CallbackURL:  "https://news.example.com/websub",
+			Lease:        time.Hour,
+			Silence:      time.Hour,
+			PollInterval: time.Hour,
+		}, logger))
+	})
+	ctx := context.Background()
+
+	source := db.Source{Link: "https://example.com/feed.xml", Provider: "test", Category: "tech"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	subscription := db.WebSubSubscription{
+		SourceID: source.ID,
+		Hub:      "https://hub.example.com/",
+		Topic:    source.Link,
+		Secret:   "websub secret",
+		Status:   db.WebSubPending,
+	}
+	require.NoError(t, store.SaveSubscription(ctx, &subscription))
+
+	verifyPath := func(id any, query url.Values) string {
+		return fmt.Sprintf("/websub/%v?%s", id, query.Encode())
+	}
+	subscribe := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {source.Link},
+		"hub.challenge":     {"challenge-1234"},
+		"hub.lease_seconds": {"3600"},
+	}
+	with := func(name, value string) url.Values {
+		query := url.Values{}
+		for key, values := range subscribe {
+			query[key] = values
+		}
+		query.Set(name, value)
+		return query
+	}
+
+	// Invalid or unexpected verifications
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{"invalid id", verifyPath("abc", subscribe), http.StatusBadRequest},
+		{"missing challenge", verifyPath(subscription.ID, with("hub.challenge", "")), http.StatusBadRequest},
+		{"invalid lease", verifyPath(subscription.ID, with("hub.lease_seconds", "soon")), http.StatusBadRequest},
+		{"other topic", verifyPath(subscription.ID, with("hub.topic", "https://example.com/other.xml")), http.StatusNotFound},
+		{"unknown subscription", verifyPath(99, subscribe), http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := doHubRequest(t, server, http.MethodGet, test.path, "", "")
+			require.Equal(t, test.code, recorder.Code)
+		})
+	}
+
+	// The challenge is echoed back once the intent is verified
+	recorder := doHubRequest(t, server, http.MethodGet, verifyPath(subscription.ID, subscribe), "", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "challenge-1234", recorder.Body.String())
+
+	subscription, err := store.GetSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.WebSubActive, subscription.Status)
+
+	// Content with an invalid signature is acknowledged but ignored
+	path := fmt.Sprintf("/websub/%d", subscription.ID)
+	recorder = doHubRequest(t, server, http.MethodPost, path, service.SignWebSub("wrong secret", []byte(testPushedFeed)), testPushedFeed)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	recorder = doHubRequest(t, server, http.MethodPost, path, "", testPushedFeed)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{SourceID: source.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, articles)
+
+	// Signed content is stored
+	recorder = doHubRequest(t, server, http.MethodPost, path, service.SignWebSub(subscription.Secret, []byte(testPushedFeed)), testPushedFeed)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	articles, err = store.ListArticles(ctx, db.ArticleFilter{SourceID: source.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	require.Equal(t, "Pushed release", articles[0].Title)
+
+	// The hub is told to stop pushing to unknown subscriptions
+	recorder = doHubRequest(t, server, http.MethodPost, "/websub/99", service.SignWebSub(subscription.Secret, []byte(testPushedFeed)), testPushedFeed)
+	require.Equal(t, http.StatusGone, recorder.Code)
+
+	// No callbacks when WebSub is disabled
+	disabled, _ := newTestServer(t)
+	recorder = doHubRequest(t, disabled, http.MethodGet, verifyPath(subscription.ID, subscribe), "", "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+)
+
+const apiKeyUsage = `usage:
+  scraper apikey create -name NAME [-role reader|editor|admin] [-quota N] [flags]
+  scraper apikey list [flags]
+  scraper apikey revoke [flags] ID`
+
+// Admin command to manage API keys, which also bootstraps the first admin key
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	flags := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	var (
+		name, role string
+		quota      int
+	)
+	switch args[0] {
+	case "create":
+		flags.StringVar(&name, "name", "", "name of the key, to tell keys apart")
+		flags.StringVar(&role, "role", db.RoleReader, "role of the key: reader, editor or admin")
+		flags.IntVar(&quota, "quota", 0, "requests allowed per day, 0 for the server default")
+	case "list", "revoke":
+	default:
+		return errors.New(apiKeyUsage)
+	}
+
+	config, err := parseCommand(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	queries, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	store := db.NewGormStore(queries)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "create":
+		if name == "" {
+			return errors.New("-name is required")
+		}
+
+		key, plain, err := service.CreateAPIKey(ctx, store, name, role, quota)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created %s key %d (%s). Store it now, it won't be shown again:\n%s\n", key.Role, key.ID, key.Name, plain)
+		return nil
+
+	case "list":
+		keys, err := store.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tNAME\tPREFIX\tROLE\tQUOTA\tCREATED")
+		for _, key := range keys {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%d\t%s\n",
+				key.ID, key.Name, key.Prefix, key.Role, key.DailyQuota, key.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return writer.Flush()
+
+	case "revoke":
+		if flags.NArg() != 1 {
+			return errors.New(apiKeyUsage)
+		}
+
+		id, err := strconv.ParseUint(flags.Arg(0), 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", flags.Arg(0))
+		}
+
+		if err := store.RevokeAPIKey(ctx, uint(id)); err != nil {
+			return err
+		}
+
+		fmt.Printf("Revoked key %d\n", id)
+		return nil
+
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/danglnh07/newsaggr/scraper/util"
+)
+
+const configUsage = `usage:
+  scraper config print [flags]   print the effective config, as YAML
+  scraper config flags           list the config flags, accepted by every command`
+
+// Command to inspect the configuration
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "print":
+		config, err := parseCommand(flag.NewFlagSet("config print", flag.ContinueOnError), args[1:])
+		if err != nil {
+			return err
+		}
+
+		return config.Print(os.Stdout)
+
+	case "flags":
+		flags := flag.NewFlagSet("config flags", flag.ContinueOnError)
+		flags.SetOutput(os.Stdout)
+		util.RegisterConfigFlags(flags)
+		flags.PrintDefaults()
+		return nil
+
+	default:
+		return errors.New(configUsage)
+	}
+}
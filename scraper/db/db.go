@@ -1,13 +1,29 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 // Queries struct
 type Queries struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Driver string
+
+	// Whether SQLite was built with FTS5. If not, search falls back to LIKE.
+	fts5 bool
 }
 
 // Constructor method for Queries
@@ -15,20 +31,161 @@ func NewQueries() *Queries {
 	return &Queries{}
 }
 
-// Connect to database
-func (queries *Queries) ConnectDB(connStr string) error {
-	conn, err := gorm.Open(postgres.Open(connStr))
+// Connect to database. For SQLite, connStr is the database file path (or ":memory:").
+func (queries *Queries) ConnectDB(driver, connStr string) error {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverPostgres, "":
+		driver = DriverPostgres
+		dialector = postgres.Open(connStr)
+	case DriverSQLite:
+		dialector = sqlite.Open(connStr)
+	default:
+		return fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	conn, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		return err
 	}
 
+	// Trace every query, no-op until a tracer provider is set up
+	if err := conn.Use(&tracingPlugin{system: driver}); err != nil {
+		return err
+	}
+
+	if driver == DriverSQLite {
+		// SQLite allows a single writer, and every connection to ":memory:" is a
+		// separate database, so we serialize everything through one connection
+		sqlDB, err := conn.DB()
+		if err != nil {
+			return err
+		}
+		sqlDB.SetMaxOpenConns(1)
+
+		if err := conn.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
+			return err
+		}
+	}
+
 	queries.DB = conn
+	queries.Driver = driver
 	return nil
 }
 
+// Size the connection pool. SQLite keeps its single connection.
+func (queries *Queries) SetPool(maxOpen, maxIdle int, maxLifetime time.Duration) error {
+	if queries.Driver == DriverSQLite {
+		return nil
+	}
+
+	sqlDB, err := queries.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(maxIdle)
+	sqlDB.SetConnMaxLifetime(maxLifetime)
+	return nil
+}
+
+// Check that the database is reachable
+func (queries *Queries) Ping(ctx context.Context) error {
+	sqlDB, err := queries.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
 // Run auto migration
 func (queries *Queries) AutoMigration() error {
-	return queries.DB.AutoMigrate(&Source{}, &Article{})
+	if queries.Driver == DriverSQLite {
+		// SQLite migrations may recreate tables referenced by foreign keys, which fails
+		// while the constraints are enforced
+		if err := queries.DB.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer queries.DB.Exec("PRAGMA foreign_keys = ON")
+	}
+
+	if err := queries.DB.AutoMigrate(&Source{}, &Article{}, &RetentionPolicy{}, &RetentionRun{}, &APIKey{}); err != nil {
+		return err
+	}
+
+	return queries.migrateSearch()
+}
+
+// Helper method: create the full text search structures for the current driver
+func (queries *Queries) migrateSearch() error {
+	if queries.Driver == DriverPostgres {
+		return queries.DB.Exec(
+			"CREATE INDEX IF NOT EXISTS idx_articles_title_search ON articles USING GIN (to_tsvector('simple', title))",
+		).Error
+	}
+
+	// SQLite: an external content FTS5 table kept in sync with triggers
+	err := queries.DB.Exec(
+		"CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(title, content='articles', content_rowid='id')",
+	).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			// Built without the sqlite_fts5 tag, search will use LIKE instead
+			queries.fts5 = false
+			return nil
+		}
+		return err
+	}
+
+	statements := []string{
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_insert AFTER INSERT ON articles BEGIN
+			INSERT INTO articles_fts(rowid, title) VALUES (new.id, new.title);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_delete AFTER DELETE ON articles BEGIN
+			INSERT INTO articles_fts(articles_fts, rowid, title) VALUES ('delete', old.id, old.title);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE ON articles BEGIN
+			INSERT INTO articles_fts(articles_fts, rowid, title) VALUES ('delete', old.id, old.title);
+			INSERT INTO articles_fts(rowid, title) VALUES (new.id, new.title);
+		END`,
+		// Index rows that existed before the table was created
+		"INSERT INTO articles_fts(articles_fts) VALUES ('rebuild')",
+	}
+	for _, statement := range statements {
+		if err := queries.DB.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	queries.fts5 = true
+	return nil
+}
+
+// Helper method: restrict an articles query to the ones whose title matches the search text
+func (queries *Queries) searchArticles(query *gorm.DB, text string) *gorm.DB {
+	switch {
+	case queries.Driver == DriverPostgres:
+		return query.Where("to_tsvector('simple', articles.title) @@ plainto_tsquery('simple', ?)", text)
+	case queries.fts5:
+		return query.Where("articles.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)", ftsQuery(text))
+	default:
+		for _, term := range strings.Fields(text) {
+			query = query.Where("articles.title LIKE ?", "%"+term+"%")
+		}
+		return query
+	}
+}
+
+// Helper function: turn free text into an FTS5 query matching all terms, quoting
+// each term so characters from the FTS5 syntax are taken literally
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
 }
 
 func (queries *Queries) Seed() error {
@@ -0,0 +1,882 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORM backed implementation of SourceStore and ArticleStore, works with every supported driver
+type GormStore struct {
+	queries *Queries
+}
+
+// Constructor method for GormStore
+func NewGormStore(queries *Queries) *GormStore {
+	return &GormStore{
+		queries: queries,
+	}
+}
+
+// Helper method: map GORM errors into the store errors
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+// Get a source by ID
+func (store *GormStore) GetSource(ctx context.Context, id uint) (Source, error) {
+	var source Source
+	err := store.queries.DB.WithContext(ctx).First(&source, id).Error
+	return source, translateError(err)
+}
+
+// List sources matching the filter
+func (store *GormStore) ListSources(ctx context.Context, filter SourceFilter) ([]Source, error) {
+	query := store.queries.DB.WithContext(ctx).Order("id")
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if filter.Provider != "" {
+		query = query.Where("provider = ?", filter.Provider)
+	}
+
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	sources := make([]Source, 0)
+	err := query.Find(&sources).Error
+	return sources, translateError(err)
+}
+
+// Create a new source
+func (store *GormStore) CreateSource(ctx context.Context, source *Source) error {
+	if source.Type == "" {
+		source.Type = SourceTypeRSS
+	}
+	return translateError(store.queries.DB.WithContext(ctx).Create(source).Error)
+}
+
+// Save all fields of an existing source but FetchedAt
+func (store *GormStore) UpdateSource(ctx context.Context, source *Source) error {
+	return translateError(store.queries.DB.WithContext(ctx).Omit("FetchedAt").Save(source).Error)
+}
+
+// Record the start of the last successful scrape of a source, without touching UpdatedAt
+func (store *GormStore) SetSourceFetched(ctx context.Context, id uint, at time.Time) error {
+	result := store.queries.DB.WithContext(ctx).Model(&Source{}).Where("id = ?", id).UpdateColumn("fetched_at", at)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Soft delete a source and its articles, sharing the same deletion time so that
+// restoring the source only brings back the articles deleted along with it. The
+// articles another live source carries move to that source instead.
+func (store *GormStore) DeleteSource(ctx context.Context, id uint) error {
+	deletedAt := time.Now()
+	err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Source{}).Where("id = ?", id).Update("deleted_at", deletedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		// The oldest link of each article to a live source takes the place of the deleted one
+		var links []ArticleSource
+		articles := tx.Model(&Article{}).Select("id").Where("source_id = ?", id)
+		err := tx.Model(&ArticleSource{}).
+			Joins("JOIN sources ON sources.id = article_sources.source_id AND sources.deleted_at IS NULL").
+			Where("article_sources.article_id IN (?)", articles).
+			Order("article_sources.article_id, article_sources.created_at, article_sources.source_id").
+			Find(&links).Error
+		if err != nil {
+			return err
+		}
+
+		for i, link := range links {
+			if i > 0 && links[i-1].ArticleID == link.ArticleID {
+				continue
+			}
+
+			err := tx.Model(&Article{}).Where("id = ?", link.ArticleID).
+				Updates(map[string]any{"source_id": link.SourceID, "url": link.Url}).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Where("article_id = ? AND source_id = ?", link.ArticleID, link.SourceID).Delete(&ArticleSource{}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&Article{}).Where("source_id = ?", id).Update("deleted_at", deletedAt).Error
+	})
+
+	return translateError(err)
+}
+
+// Restore a soft deleted source and the articles deleted with it
+func (store *GormStore) RestoreSource(ctx context.Context, id uint) (Source, error) {
+	var source Source
+	err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&source, id).Error
+		if err != nil {
+			return err
+		}
+
+		// Articles deleted on their own before the source keep an older deletion time
+		err = tx.Unscoped().Model(&Article{}).
+			Where("source_id = ? AND deleted_at >= ?", id, source.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		source.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Model(&source).Update("deleted_at", nil).Error
+	})
+
+	return source, translateError(err)
+}
+
+// Permanently delete a source with its articles and retention policies
+func (store *GormStore) PurgeSource(ctx context.Context, id uint) error {
+	err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Links of the source to the articles of others, and of others to its articles
+		articles := tx.Unscoped().Model(&Article{}).Select("id").Where("source_id = ?", id)
+		if err := tx.Where("source_id = ? OR article_id IN (?)", id, articles).Delete(&ArticleSource{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("source_id = ?", id).Delete(&Article{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("source_id = ?", id).Delete(&RetentionPolicy{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("source_id = ?", id).Delete(&WebSubSubscription{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("source_id = ?", id).Delete(&Backfill{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("source_id = ?", id).Delete(&PurgedURL{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&Source{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+
+	return translateError(err)
+}
+
+// Get an article by ID
+func (store *GormStore) GetArticle(ctx context.Context, id uint) (Article, error) {
+	var article Article
+	err := store.queries.DB.WithContext(ctx).Preload("Source").Preload("Sources").First(&article, id).Error
+	return article, translateError(err)
+}
+
+// List articles matching the filter
+func (store *GormStore) ListArticles(ctx context.Context, filter ArticleFilter) ([]Article, error) {
+	db := store.queries.DB.WithContext(ctx)
+	query := db.Preload("Source").Preload("Sources").Order("articles.id")
+	if filter.SourceID != 0 {
+		carried := db.Model(&ArticleSource{}).Select("article_id").Where("source_id = ?", filter.SourceID)
+		query = query.Where("articles.source_id = ? OR articles.id IN (?)", filter.SourceID, carried)
+	}
+
+	if filter.Category != "" {
+		query = query.Joins("JOIN sources ON sources.id = articles.source_id").
+			Where("sources.category = ?", filter.Category)
+	}
+
+	if filter.Search != "" {
+		query = store.queries.searchArticles(query, filter.Search)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	articles := make([]Article, 0)
+	err := query.Find(&articles).Error
+	return articles, translateError(err)
+}
+
+// Create a new article
+func (store *GormStore) CreateArticle(ctx context.Context, article *Article) error {
+	article.DedupeKey = dedupeKey(*article)
+	return translateError(store.queries.DB.WithContext(ctx).Omit("Source", "Sources").Create(article).Error)
+}
+
+// Save all fields of an existing article
+func (store *GormStore) UpdateArticle(ctx context.Context, article *Article) error {
+	return translateError(store.queries.DB.WithContext(ctx).Omit("Source", "Sources").Save(article).Error)
+}
+
+// Delete an article by ID
+func (store *GormStore) DeleteArticle(ctx context.Context, id uint) error {
+	result := store.queries.DB.WithContext(ctx).Delete(&Article{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Insert articles that are not stored yet, skipping the ones whose URL or dedupe key
+// already exists or was purged
+func (store *GormStore) UpsertArticles(ctx context.Context, articles []Article) ([]Article, error) {
+	inserted := make([]Article, 0)
+	err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, article := range articles {
+			// Insert one by one so we know exactly which rows were new. Both the URL and
+			// the dedupe key are unique.
+			article.DedupeKey = dedupeKey(article)
+			purged, err := wasPurged(tx, article)
+			if err != nil {
+				return err
+			}
+			if purged {
+				continue
+			}
+
+			result := tx.Omit("Source", "Sources").Clauses(clause.OnConflict{DoNothing: true}).Create(&article)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected > 0 {
+				inserted = append(inserted, article)
+				continue
+			}
+
+			// Already stored, from this source or another one carrying it too
+			stored, err := duplicateOf(tx, article)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if !stored.DeletedAt.Valid && stored.SourceID != article.SourceID {
+				if _, err := linkSource(tx, stored, article); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return inserted, nil
+}
+
+// Find which of the URLs are stored as the URL or the dedupe key of an article,
+// deleted or purged, in batches to keep the statements small
+func (store *GormStore) KnownURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	const batchSize = 500
+
+	known := make(map[string]bool)
+	db := store.queries.DB.WithContext(ctx)
+	for start := 0; start < len(urls); start += batchSize {
+		batch := urls[start:min(start+batchSize, len(urls))]
+		for _, column := range []string{"url", "dedupe_key"} {
+			var stored []string
+			err := db.Unscoped().Model(&Article{}).Where(column+" IN ?", batch).Pluck(column, &stored).Error
+			if err != nil {
+				return nil, translateError(err)
+			}
+			for _, link := range stored {
+				known[link] = true
+			}
+		}
+
+		var purged []string
+		err := db.Model(&PurgedURL{}).Where("url IN ?", batch).Pluck("url", &purged).Error
+		if err != nil {
+			return nil, translateError(err)
+		}
+		for _, link := range purged {
+			known[link] = true
+		}
+	}
+
+	return known, nil
+}
+
+// List all retention policies
+func (store *GormStore) ListRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	policies := make([]RetentionPolicy, 0)
+	err := store.queries.DB.WithContext(ctx).Order("id").Find(&policies).Error
+	return policies, translateError(err)
+}
+
+// Create a new retention policy
+func (store *GormStore) CreateRetentionPolicy(ctx context.Context, policy *RetentionPolicy) error {
+	return translateError(store.queries.DB.WithContext(ctx).Create(policy).Error)
+}
+
+// Delete a retention policy by ID
+func (store *GormStore) DeleteRetentionPolicy(ctx context.Context, id uint) error {
+	result := store.queries.DB.WithContext(ctx).Delete(&RetentionPolicy{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// List the articles of a source, deleted or not, that fall outside the retention window,
+// oldest first
+func (store *GormStore) ExpiredArticles(ctx context.Context, sourceID uint, cutoff time.Time, keepLast int) ([]Article, error) {
+	articles := make([]Article, 0)
+	if cutoff.IsZero() && keepLast <= 0 {
+		return articles, nil
+	}
+
+	db := store.queries.DB.WithContext(ctx)
+	query := db.Unscoped().Preload("Source").Where("source_id = ? AND starred = ?", sourceID, false)
+
+	// The most recent articles to keep
+	recent := db.Unscoped().Model(&Article{}).Select("id").
+		Where("source_id = ? AND starred = ?", sourceID, false).
+		Order("created_at DESC, id DESC").Limit(keepLast)
+
+	switch {
+	case !cutoff.IsZero() && keepLast > 0:
+		query = query.Where("created_at < ? OR id NOT IN (?)", cutoff, recent)
+	case !cutoff.IsZero():
+		query = query.Where("created_at < ?", cutoff)
+	default:
+		query = query.Where("id NOT IN (?)", recent)
+	}
+
+	err := query.Order("created_at, id").Find(&articles).Error
+	return articles, translateError(err)
+}
+
+// Permanently delete articles, in batches to keep the statements small. Their URLs
+// and dedupe keys are kept so that they are not stored again.
+func (store *GormStore) PurgeArticles(ctx context.Context, ids []uint) (int, error) {
+	const batchSize = 500
+
+	purged := 0
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var articles []Article
+			err := tx.Unscoped().Select("id", "source_id", "url", "dedupe_key").Where("id IN ?", batch).Find(&articles).Error
+			if err != nil {
+				return err
+			}
+
+			if urls := purgedURLs(articles); len(urls) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&urls).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Where("article_id IN ?", batch).Delete(&ArticleSource{}).Error; err != nil {
+				return err
+			}
+
+			result := tx.Unscoped().Delete(&Article{}, batch)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += int(result.RowsAffected)
+			return nil
+		})
+		if err != nil {
+			return purged, translateError(err)
+		}
+	}
+
+	return purged, nil
+}
+
+// Record a retention run
+func (store *GormStore) CreateRetentionRun(ctx context.Context, run *RetentionRun) error {
+	return translateError(store.queries.DB.WithContext(ctx).Create(run).Error)
+}
+
+// List retention runs, most recent first
+func (store *GormStore) ListRetentionRuns(ctx context.Context, limit, offset int) ([]RetentionRun, error) {
+	runs := make([]RetentionRun, 0)
+	err := store.queries.DB.WithContext(ctx).Order("id DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, translateError(err)
+}
+
+// Create a new API key
+func (store *GormStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	return translateError(store.queries.DB.WithContext(ctx).Create(key).Error)
+}
+
+// Get an active API key by the hash of its value
+func (store *GormStore) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	var key APIKey
+	err := store.queries.DB.WithContext(ctx).Where("hash = ?", hash).First(&key).Error
+	return key, translateError(err)
+}
+
+// List active API keys
+func (store *GormStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+	err := store.queries.DB.WithContext(ctx).Order("id").Find(&keys).Error
+	return keys, translateError(err)
+}
+
+// Revoke an API key by ID
+func (store *GormStore) RevokeAPIKey(ctx context.Context, id uint) error {
+	result := store.queries.DB.WithContext(ctx).Delete(&APIKey{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Acquire or renew a lease, in a single statement so that concurrent instances can't both get it
+func (store *GormStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	lease := Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	// The conflicting row is only taken over when it is ours or expired
+	result := store.queries.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"holder", "expires_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "leases.holder = ? OR leases.expires_at < ?", Vars: []any{holder, now}},
+		}},
+	}).Create(&lease)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// Release a lease held by holder
+func (store *GormStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	err := store.queries.DB.WithContext(ctx).Where("name = ? AND holder = ?", name, holder).Delete(&Lease{}).Error
+	return translateError(err)
+}
+
+// Create a new webhook
+func (store *GormStore) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	return translateError(store.queries.DB.WithContext(ctx).Create(webhook).Error)
+}
+
+// Get a webhook by ID
+func (store *GormStore) GetWebhook(ctx context.Context, id uint) (Webhook, error) {
+	var webhook Webhook
+	err := store.queries.DB.WithContext(ctx).First(&webhook, id).Error
+	return webhook, translateError(err)
+}
+
+// List webhooks
+func (store *GormStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks := make([]Webhook, 0)
+	err := store.queries.DB.WithContext(ctx).Order("id").Find(&webhooks).Error
+	return webhooks, translateError(err)
+}
+
+// Delete a webhook by ID, its deliveries are kept for the record
+func (store *GormStore) DeleteWebhook(ctx context.Context, id uint) error {
+	result := store.queries.DB.WithContext(ctx).Delete(&Webhook{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Create webhook deliveries
+func (store *GormStore) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return translateError(store.queries.DB.WithContext(ctx).Create(&deliveries).Error)
+}
+
+// Get a webhook delivery by ID
+func (store *GormStore) GetDelivery(ctx context.Context, id uint) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := store.queries.DB.WithContext(ctx).First(&delivery, id).Error
+	return delivery, translateError(err)
+}
+
+// Update a webhook delivery
+func (store *GormStore) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return translateError(store.queries.DB.WithContext(ctx).Save(delivery).Error)
+}
+
+// List the deliveries of a webhook, most recent first
+func (store *GormStore) ListDeliveries(ctx context.Context, webhookID uint, limit, offset int) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0)
+	err := store.queries.DB.WithContext(ctx).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").Limit(limit).Offset(offset).
+		Find(&deliveries).Error
+	return deliveries, translateError(err)
+}
+
+// List the pending deliveries due at now, oldest first
+func (store *GormStore) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0)
+	err := store.queries.DB.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, translateError(err)
+}
+
+// Get a WebSub subscription by ID
+func (store *GormStore) GetSubscription(ctx context.Context, id uint) (WebSubSubscription, error) {
+	var subscription WebSubSubscription
+	err := store.queries.DB.WithContext(ctx).First(&subscription, id).Error
+	return subscription, translateError(err)
+}
+
+// Get the WebSub subscription of a source
+func (store *GormStore) GetSourceSubscription(ctx context.Context, sourceID uint) (WebSubSubscription, error) {
+	var subscription WebSubSubscription
+	err := store.queries.DB.WithContext(ctx).Where("source_id = ?", sourceID).First(&subscription).Error
+	return subscription, translateError(err)
+}
+
+// List WebSub subscriptions
+func (store *GormStore) ListSubscriptions(ctx context.Context) ([]WebSubSubscription, error) {
+	subscriptions := make([]WebSubSubscription, 0)
+	err := store.queries.DB.WithContext(ctx).Order("id").Find(&subscriptions).Error
+	return subscriptions, translateError(err)
+}
+
+// Create or save a WebSub subscription
+func (store *GormStore) SaveSubscription(ctx context.Context, subscription *WebSubSubscription) error {
+	if subscription.ID == 0 {
+		return translateError(store.queries.DB.WithContext(ctx).Create(subscription).Error)
+	}
+	return translateError(store.queries.DB.WithContext(ctx).Save(subscription).Error)
+}
+
+// Delete a WebSub subscription by ID
+func (store *GormStore) DeleteSubscription(ctx context.Context, id uint) error {
+	result := store.queries.DB.WithContext(ctx).Delete(&WebSubSubscription{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Get a backfill by ID
+func (store *GormStore) GetBackfill(ctx context.Context, id uint) (Backfill, error) {
+	var backfill Backfill
+	err := store.queries.DB.WithContext(ctx).First(&backfill, id).Error
+	return backfill, translateError(err)
+}
+
+// List the backfills of a source, most recent first
+func (store *GormStore) ListBackfills(ctx context.Context, sourceID uint, limit, offset int) ([]Backfill, error) {
+	backfills := make([]Backfill, 0)
+	err := store.queries.DB.WithContext(ctx).
+		Where("source_id = ?", sourceID).
+		Order("id DESC").Limit(limit).Offset(offset).
+		Find(&backfills).Error
+	return backfills, translateError(err)
+}
+
+// List the backfills with pages left to fetch, oldest first
+func (store *GormStore) PendingBackfills(ctx context.Context) ([]Backfill, error) {
+	backfills := make([]Backfill, 0)
+	err := store.queries.DB.WithContext(ctx).Where("status = ?", BackfillPending).Order("id").Find(&backfills).Error
+	return backfills, translateError(err)
+}
+
+// Create or save a backfill
+func (store *GormStore) SaveBackfill(ctx context.Context, backfill *Backfill) error {
+	if backfill.ID == 0 {
+		return translateError(store.queries.DB.WithContext(ctx).Create(backfill).Error)
+	}
+	return translateError(store.queries.DB.WithContext(ctx).Save(backfill).Error)
+}
+
+// Insert the new articles and update the changed ones, then record the events built
+// from the changes, all in one transaction
+func (store *GormStore) SaveArticles(ctx context.Context, articles []Article, events func(changes ArticleChanges) ([]OutboxEvent, error)) (ArticleChanges, error) {
+	changes := ArticleChanges{Inserted: make([]Article, 0), Updated: make([]Article, 0), Linked: make([]Article, 0)}
+	err := store.queries.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, article := range articles {
+			// Insert one by one so we know exactly which rows were new. Both the URL and
+			// the dedupe key are unique.
+			article.DedupeKey = dedupeKey(article)
+			purged, err := wasPurged(tx, article)
+			if err != nil {
+				return err
+			}
+			if purged {
+				continue
+			}
+
+			result := tx.Omit("Source", "Sources").Clauses(clause.OnConflict{DoNothing: true}).Create(&article)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected > 0 {
+				changes.Inserted = append(changes.Inserted, article)
+				continue
+			}
+
+			// Already stored, update it if the feed changed it. Deleted articles are left
+			// alone, the ones of other sources get linked to this source instead.
+			stored, err := duplicateOf(tx, article)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if stored.DeletedAt.Valid {
+				continue
+			}
+
+			if stored.SourceID != article.SourceID {
+				linked, err := linkSource(tx, stored, article)
+				if err != nil {
+					return err
+				}
+				if linked {
+					changes.Linked = append(changes.Linked, stored)
+				}
+				continue
+			}
+
+			if !articleChanged(stored, article) {
+				continue
+			}
+
+			stored.Title = article.Title
+			stored.Image = article.Image
+			stored.PublishedDate = article.PublishedDate
+			err = tx.Model(&stored).Omit("Source").
+				Select("title", "image", "published_date", "updated_at").
+				Updates(&stored).Error
+			if err != nil {
+				return err
+			}
+			changes.Updated = append(changes.Updated, stored)
+		}
+
+		records, err := events(changes)
+		if err != nil {
+			return err
+		}
+
+		if err := store.createEvents(tx, records); err != nil {
+			return err
+		}
+		changes.Events = records
+		return nil
+	})
+
+	if err != nil {
+		return ArticleChanges{}, translateError(err)
+	}
+
+	return changes, nil
+}
+
+// Record events, setting their IDs
+func (store *GormStore) CreateEvents(ctx context.Context, events []OutboxEvent) error {
+	return translateError(store.createEvents(store.queries.DB.WithContext(ctx), events))
+}
+
+// Update an event, after an attempt to publish it
+func (store *GormStore) UpdateEvent(ctx context.Context, event *OutboxEvent) error {
+	if event.PublishedAt != nil {
+		publishedAt := event.PublishedAt.UTC()
+		event.PublishedAt = &publishedAt
+	}
+	return translateError(store.queries.DB.WithContext(ctx).Save(event).Error)
+}
+
+// List the unpublished events created before the given time, oldest first
+func (store *GormStore) PendingEvents(ctx context.Context, before time.Time, limit int) ([]OutboxEvent, error) {
+	events := make([]OutboxEvent, 0)
+	err := store.queries.DB.WithContext(ctx).
+		Where("published_at IS NULL AND created_at < ?", before.UTC()).
+		Order("id").Limit(limit).
+		Find(&events).Error
+	return events, translateError(err)
+}
+
+// Delete the events published before the given time
+func (store *GormStore) PurgeEvents(ctx context.Context, before time.Time) (int, error) {
+	result := store.queries.DB.WithContext(ctx).Where("published_at < ?", before.UTC()).Delete(&OutboxEvent{})
+	return int(result.RowsAffected), translateError(result.Error)
+}
+
+// List the events with the given IDs, oldest first
+func (store *GormStore) GetEvents(ctx context.Context, ids []uint) ([]OutboxEvent, error) {
+	events := make([]OutboxEvent, 0, len(ids))
+	if len(ids) == 0 {
+		return events, nil
+	}
+
+	err := store.queries.DB.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&events).Error
+	return events, translateError(err)
+}
+
+// List the events recorded after the given one, oldest first
+func (store *GormStore) EventsAfter(ctx context.Context, afterID uint, limit int) ([]OutboxEvent, error) {
+	events := make([]OutboxEvent, 0)
+	err := store.queries.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&events).Error
+	return events, translateError(err)
+}
+
+// Get the ID of the last recorded event
+func (store *GormStore) LastEventID(ctx context.Context) (uint, error) {
+	var id uint
+	err := store.queries.DB.WithContext(ctx).Model(&OutboxEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, translateError(err)
+}
+
+// Helper method: insert events with the given connection, stamped in UTC so that their
+// times compare the same way whatever the time zone of the instance. On Postgres, their
+// IDs are notified to the listeners once the transaction commits.
+func (store *GormStore) createEvents(tx *gorm.DB, events []OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for i := range events {
+		events[i].CreatedAt = now
+	}
+	if err := tx.Create(&events).Error; err != nil {
+		return err
+	}
+
+	if store.queries.Driver != DriverPostgres {
+		return nil
+	}
+
+	ids := make([]uint, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	for _, payload := range formatEventIDs(ids) {
+		if err := tx.Exec("SELECT pg_notify(?, ?)", EventsChannel, payload).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function: check whether a scraped article differs from its stored version
+func articleChanged(stored, scraped Article) bool {
+	return stored.Title != scraped.Title ||
+		stored.Image != scraped.Image ||
+		stored.PublishedDate != scraped.PublishedDate
+}
+
+// Helper function: find the stored article, deleted or not, sharing the URL or the
+// dedupe key of the article
+func duplicateOf(tx *gorm.DB, article Article) (Article, error) {
+	query := tx.Unscoped().Where("url = ?", article.Url)
+	if article.DedupeKey != nil {
+		query = query.Or("dedupe_key = ?", *article.DedupeKey)
+	}
+
+	var stored Article
+	err := query.Order("id").Take(&stored).Error
+	return stored, err
+}
+
+// Helper function: check whether the URL or the dedupe key of the article was purged
+func wasPurged(tx *gorm.DB, article Article) (bool, error) {
+	urls := []string{article.Url}
+	if article.DedupeKey != nil {
+		urls = append(urls, *article.DedupeKey)
+	}
+
+	var count int64
+	err := tx.Model(&PurgedURL{}).Where("url IN ?", urls).Count(&count).Error
+	return count > 0, err
+}
+
+// Helper function: record that the source of the duplicate carried the stored article
+// too, returning false if already recorded
+func linkSource(tx *gorm.DB, stored, duplicate Article) (bool, error) {
+	link := ArticleSource{ArticleID: stored.ID, SourceID: duplicate.SourceID, Url: duplicate.Url}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&link)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Postgres channel notified with the comma separated IDs of the events recorded in the
+// outbox, once their transaction commits
+const EventsChannel = "newsaggr_events"
+
+// Event IDs per notification, keeping the payload well under the 8000 bytes limit
+const eventIDsPerNotification = 500
+
+// Listens to the outbox notifications on a dedicated Postgres connection, outside of
+// the pool since the connection is held for as long as it listens
+type PostgresListener struct {
+	connStr string
+}
+
+// Constructor method for PostgresListener
+func NewPostgresListener(connStr string) *PostgresListener {
+	return &PostgresListener{connStr: connStr}
+}
+
+// Connect and listen to the outbox notifications until ctx is done or the connection is
+// lost, which is returned as an error. connected is called once listening, before any
+// notification is handled; notify is called with the event IDs of each notification.
+func (listener *PostgresListener) Listen(ctx context.Context, connected func(ctx context.Context) error, notify func(ctx context.Context, ids []uint)) error {
+	conn, err := pgx.Connect(ctx, listener.connStr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{EventsChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	if err := connected(ctx); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		ids, err := parseEventIDs(notification.Payload)
+		if err != nil {
+			return fmt.Errorf("invalid notification %q: %w", notification.Payload, err)
+		}
+		notify(ctx, ids)
+	}
+}
+
+// Helper function: split event IDs into notification payloads
+func formatEventIDs(ids []uint) []string {
+	payloads := make([]string, 0, len(ids)/eventIDsPerNotification+1)
+	for start := 0; start < len(ids); start += eventIDsPerNotification {
+		end := min(start+eventIDsPerNotification, len(ids))
+
+		parts := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			parts = append(parts, strconv.FormatUint(uint64(id), 10))
+		}
+		payloads = append(payloads, strings.Join(parts, ","))
+	}
+	return payloads
+}
+
+// Helper function: parse the event IDs of a notification payload
+func parseEventIDs(payload string) ([]uint, error) {
+	parts := strings.Split(payload, ",")
+	ids := make([]uint, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseUint(part, 10, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test that event IDs survive the round trip through notification payloads
+func TestEventIDsPayload(t *testing.T) {
+	many := make([]uint, eventIDsPerNotification+2)
+	for i := range many {
+		many[i] = uint(i + 1)
+	}
+
+	tests := []struct {
+		name     string
+		ids      []uint
+		payloads int
+	}{
+		{"none", []uint{}, 0},
+		{"one", []uint{42}, 1},
+		{"several", []uint{1, 2, 300}, 1},
+		{"split", many, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payloads := formatEventIDs(test.ids)
+			require.Len(t, payloads, test.payloads)
+
+			ids := make([]uint, 0)
+			for _, payload := range payloads {
+				require.Less(t, len(payload), 8000)
+				parsed, err := parseEventIDs(payload)
+				require.NoError(t, err)
+				ids = append(ids, parsed...)
+			}
+			require.Equal(t, test.ids, ids)
+		})
+	}
+
+	_, err := parseEventIDs("1,abc")
+	require.Error(t, err)
+	_, err = parseEventIDs("")
+	require.Error(t, err)
+}
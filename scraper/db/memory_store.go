@@ -0,0 +1,1257 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// In-memory implementation of SourceStore and ArticleStore, mainly used for tests.
+// It mirrors the soft delete and unique constraints of the database models.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	sources       map[uint]Source
+	articles      map[uint]Article
+	links         map[uint][]ArticleSource // Other sources carrying an article, by article ID
+	purged        map[string]uint          // Source of the purged URLs and dedupe keys
+	policies      map[uint]RetentionPolicy
+	runs          []RetentionRun
+	apiKeys       map[uint]APIKey
+	leases        map[string]Lease
+	webhooks      map[uint]Webhook
+	deliveries    map[uint]WebhookDelivery
+	events        map[uint]OutboxEvent
+	subscriptions map[uint]WebSubSubscription
+	backfills     map[uint]Backfill
+	nextSourceID  uint
+	nextArticleID uint
+	nextPolicyID  uint
+	nextAPIKeyID  uint
+	nextWebhookID uint
+	nextDelivery  uint
+	nextEventID   uint
+	nextSubID     uint
+	nextBackfill  uint
+}
+
+// Constructor method for MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sources:       make(map[uint]Source),
+		articles:      make(map[uint]Article),
+		links:         make(map[uint][]ArticleSource),
+		purged:        make(map[string]uint),
+		policies:      make(map[uint]RetentionPolicy),
+		apiKeys:       make(map[uint]APIKey),
+		leases:        make(map[string]Lease),
+		webhooks:      make(map[uint]Webhook),
+		deliveries:    make(map[uint]WebhookDelivery),
+		events:        make(map[uint]OutboxEvent),
+		subscriptions: make(map[uint]WebSubSubscription),
+		backfills:     make(map[uint]Backfill),
+		nextSourceID:  1,
+		nextArticleID: 1,
+	}
+}
+
+// Get a source by ID
+func (store *MemoryStore) GetSource(ctx context.Context, id uint) (Source, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	source, ok := store.sources[id]
+	if !ok || source.DeletedAt.Valid {
+		return Source{}, ErrNotFound
+	}
+
+	return source, nil
+}
+
+// List sources matching the filter
+func (store *MemoryStore) ListSources(ctx context.Context, filter SourceFilter) ([]Source, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	sources := make([]Source, 0)
+	for _, source := range store.sources {
+		if source.DeletedAt.Valid != filter.Deleted {
+			continue
+		}
+
+		if filter.Provider != "" && source.Provider != filter.Provider {
+			continue
+		}
+
+		if filter.Category != "" && source.Category != filter.Category {
+			continue
+		}
+
+		sources = append(sources, source)
+	}
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].ID < sources[j].ID })
+	return paginate(sources, filter.Limit, filter.Offset), nil
+}
+
+// Create a new source
+func (store *MemoryStore) CreateSource(ctx context.Context, source *Source) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.sourceLinkTaken(source.Link, 0) {
+		return ErrDuplicate
+	}
+
+	if source.Type == "" {
+		source.Type = SourceTypeRSS
+	}
+
+	now := time.Now()
+	source.ID = store.nextSourceID
+	source.CreatedAt = now
+	source.UpdatedAt = now
+	store.nextSourceID++
+	store.sources[source.ID] = *source
+	return nil
+}
+
+// Save all fields of an existing source but FetchedAt
+func (store *MemoryStore) UpdateSource(ctx context.Context, source *Source) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.sources[source.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !source.DeletedAt.Valid && store.sourceLinkTaken(source.Link, source.ID) {
+		return ErrDuplicate
+	}
+
+	source.UpdatedAt = time.Now()
+	source.FetchedAt = stored.FetchedAt
+	store.sources[source.ID] = *source
+	return nil
+}
+
+// Record the start of the last successful scrape of a source
+func (store *MemoryStore) SetSourceFetched(ctx context.Context, id uint, at time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	source, ok := store.sources[id]
+	if !ok || source.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	source.FetchedAt = &at
+	store.sources[id] = source
+	return nil
+}
+
+// Soft delete a source and its articles, the ones another live source carries move
+// to that source instead
+func (store *MemoryStore) DeleteSource(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	source, ok := store.sources[id]
+	if !ok || source.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	deletedAt := gorm.DeletedAt{Time: time.Now(), Valid: true}
+	source.DeletedAt = deletedAt
+	store.sources[id] = source
+
+	for articleID, article := range store.articles {
+		if article.SourceID != id || article.DeletedAt.Valid {
+			continue
+		}
+
+		// The oldest link to a live source takes the place of the deleted one
+		if i := slices.IndexFunc(store.links[articleID], store.liveLink); i >= 0 {
+			link := store.links[articleID][i]
+			article.SourceID = link.SourceID
+			article.Url = link.Url
+			store.links[articleID] = slices.Delete(store.links[articleID], i, i+1)
+		} else {
+			article.DeletedAt = deletedAt
+		}
+		store.articles[articleID] = article
+	}
+
+	return nil
+}
+
+// Helper method: whether the source of the link is not deleted
+func (store *MemoryStore) liveLink(link ArticleSource) bool {
+	source, ok := store.sources[link.SourceID]
+	return ok && !source.DeletedAt.Valid
+}
+
+// Restore a soft deleted source and the articles deleted with it
+func (store *MemoryStore) RestoreSource(ctx context.Context, id uint) (Source, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	source, ok := store.sources[id]
+	if !ok || !source.DeletedAt.Valid {
+		return Source{}, ErrNotFound
+	}
+
+	if store.sourceLinkTaken(source.Link, id) {
+		return Source{}, ErrDuplicate
+	}
+
+	for articleID, article := range store.articles {
+		if article.SourceID == id && article.DeletedAt.Valid && !article.DeletedAt.Time.Before(source.DeletedAt.Time) {
+			article.DeletedAt = gorm.DeletedAt{}
+			store.articles[articleID] = article
+		}
+	}
+
+	source.DeletedAt = gorm.DeletedAt{}
+	source.UpdatedAt = time.Now()
+	store.sources[id] = source
+	return source, nil
+}
+
+// Permanently delete a source with its articles and retention policies
+func (store *MemoryStore) PurgeSource(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.sources[id]; !ok {
+		return ErrNotFound
+	}
+
+	for articleID, article := range store.articles {
+		if article.SourceID == id {
+			delete(store.articles, articleID)
+			delete(store.links, articleID)
+		}
+	}
+
+	for articleID, links := range store.links {
+		kept := make([]ArticleSource, 0, len(links))
+		for _, link := range links {
+			if link.SourceID != id {
+				kept = append(kept, link)
+			}
+		}
+		store.links[articleID] = kept
+	}
+
+	for policyID, policy := range store.policies {
+		if policy.SourceID != nil && *policy.SourceID == id {
+			delete(store.policies, policyID)
+		}
+	}
+
+	for subscriptionID, subscription := range store.subscriptions {
+		if subscription.SourceID == id {
+			delete(store.subscriptions, subscriptionID)
+		}
+	}
+
+	for backfillID, backfill := range store.backfills {
+		if backfill.SourceID == id {
+			delete(store.backfills, backfillID)
+		}
+	}
+
+	for url, sourceID := range store.purged {
+		if sourceID == id {
+			delete(store.purged, url)
+		}
+	}
+
+	delete(store.sources, id)
+	return nil
+}
+
+// Get an article by ID
+func (store *MemoryStore) GetArticle(ctx context.Context, id uint) (Article, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	article, ok := store.articles[id]
+	if !ok || article.DeletedAt.Valid {
+		return Article{}, ErrNotFound
+	}
+
+	return store.withSource(article), nil
+}
+
+// List articles matching the filter
+func (store *MemoryStore) ListArticles(ctx context.Context, filter ArticleFilter) ([]Article, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	articles := make([]Article, 0)
+	for _, article := range store.articles {
+		if article.DeletedAt.Valid {
+			continue
+		}
+
+		if filter.SourceID != 0 && article.SourceID != filter.SourceID && !store.carriedBy(article.ID, filter.SourceID) {
+			continue
+		}
+
+		article = store.withSource(article)
+		if filter.Category != "" && article.Source.Category != filter.Category {
+			continue
+		}
+
+		if filter.Search != "" && !matchAllTerms(article.Title, filter.Search) {
+			continue
+		}
+
+		articles = append(articles, article)
+	}
+
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	return paginate(articles, filter.Limit, filter.Offset), nil
+}
+
+// Create a new article
+func (store *MemoryStore) CreateArticle(ctx context.Context, article *Article) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	article.DedupeKey = dedupeKey(*article)
+	if store.articleUrlTaken(*article, 0) {
+		return ErrDuplicate
+	}
+
+	store.insertArticle(article)
+	return nil
+}
+
+// Save all fields of an existing article
+func (store *MemoryStore) UpdateArticle(ctx context.Context, article *Article) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.articles[article.ID]; !ok {
+		return ErrNotFound
+	}
+
+	if store.articleUrlTaken(*article, article.ID) {
+		return ErrDuplicate
+	}
+
+	article.UpdatedAt = time.Now()
+	stored := *article
+	stored.Source = Source{}
+	stored.Sources = nil
+	store.articles[article.ID] = stored
+	return nil
+}
+
+// Soft delete an article by ID
+func (store *MemoryStore) DeleteArticle(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	article, ok := store.articles[id]
+	if !ok || article.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	article.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	store.articles[id] = article
+	return nil
+}
+
+// Insert articles that are not stored yet, skipping the ones whose URL or dedupe key
+// already exists or was purged
+func (store *MemoryStore) UpsertArticles(ctx context.Context, articles []Article) ([]Article, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	inserted := make([]Article, 0)
+	for _, article := range articles {
+		article.DedupeKey = dedupeKey(article)
+		if store.wasPurged(article) {
+			continue
+		}
+		if stored, ok := store.duplicateOf(article); ok {
+			// Already stored, from this source or another one carrying it too
+			if !stored.DeletedAt.Valid && stored.SourceID != article.SourceID {
+				store.linkSource(stored, article, time.Now())
+			}
+			continue
+		}
+
+		store.insertArticle(&article)
+		inserted = append(inserted, article)
+	}
+
+	return inserted, nil
+}
+
+// Find which of the URLs are stored as the URL or the dedupe key of an article, deleted or purged
+func (store *MemoryStore) KnownURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(urls))
+	for _, link := range urls {
+		wanted[link] = true
+	}
+
+	known := make(map[string]bool)
+	for _, article := range store.articles {
+		if wanted[article.Url] {
+			known[article.Url] = true
+		}
+		if article.DedupeKey != nil && wanted[*article.DedupeKey] {
+			known[*article.DedupeKey] = true
+		}
+	}
+	for link := range store.purged {
+		if wanted[link] {
+			known[link] = true
+		}
+	}
+
+	return known, nil
+}
+
+// Helper method: check if a link is used by an active source other than the excluded ID.
+// Soft deleted sources do not count, just like the partial unique index in the database.
+func (store *MemoryStore) sourceLinkTaken(link string, excludeID uint) bool {
+	for id, source := range store.sources {
+		if id != excludeID && !source.DeletedAt.Valid && source.Link == link {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method: check if the URL or the dedupe key of the article is used by an
+// article other than the excluded ID
+func (store *MemoryStore) articleUrlTaken(article Article, excludeID uint) bool {
+	for id, stored := range store.articles {
+		if id != excludeID && sameArticle(stored, article) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method: check whether the URL or the dedupe key of the article was purged.
+// Caller must hold the lock.
+func (store *MemoryStore) wasPurged(article Article) bool {
+	if _, ok := store.purged[article.Url]; ok {
+		return true
+	}
+	if article.DedupeKey == nil {
+		return false
+	}
+	_, ok := store.purged[*article.DedupeKey]
+	return ok
+}
+
+// Helper method: check if the article is carried by the source besides the one it was
+// stored from
+func (store *MemoryStore) carriedBy(articleID, sourceID uint) bool {
+	for _, link := range store.links[articleID] {
+		if link.SourceID == sourceID {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method: record that the source of the duplicate carried the stored article too,
+// unless already recorded. Caller must hold the lock.
+func (store *MemoryStore) linkSource(stored, duplicate Article, now time.Time) {
+	if store.carriedBy(stored.ID, duplicate.SourceID) {
+		return
+	}
+
+	store.links[stored.ID] = append(store.links[stored.ID], ArticleSource{
+		ArticleID: stored.ID,
+		SourceID:  duplicate.SourceID,
+		Url:       duplicate.Url,
+		CreatedAt: now,
+	})
+}
+
+// Helper function: check if two articles share their URL or their dedupe key, like
+// the unique indexes of the database
+func sameArticle(stored, article Article) bool {
+	if stored.Url == article.Url {
+		return true
+	}
+	return stored.DedupeKey != nil && article.DedupeKey != nil && *stored.DedupeKey == *article.DedupeKey
+}
+
+// Helper method: assign ID and timestamps then store the article. Caller must hold the lock.
+func (store *MemoryStore) insertArticle(article *Article) {
+	now := time.Now()
+	article.ID = store.nextArticleID
+	article.CreatedAt = now
+	article.UpdatedAt = now
+	store.nextArticleID++
+
+	stored := *article
+	stored.Source = Source{}
+	stored.Sources = nil
+	store.articles[article.ID] = stored
+}
+
+// Helper method: populate the article's source and the other sources carrying it, like
+// Preload("Source") and Preload("Sources") do
+func (store *MemoryStore) withSource(article Article) Article {
+	if source, ok := store.sources[article.SourceID]; ok && !source.DeletedAt.Valid {
+		article.Source = source
+	}
+	article.Sources = append([]ArticleSource{}, store.links[article.ID]...)
+	return article
+}
+
+// Helper function: check if the text contains every term of the search, ignoring case
+func matchAllTerms(text, search string) bool {
+	text = strings.ToLower(text)
+	for _, term := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function: apply limit and offset to an already filtered slice
+func paginate[T any](items []T, limit, offset int) []T {
+	if limit <= 0 {
+		return items
+	}
+
+	if offset >= len(items) {
+		return make([]T, 0)
+	}
+
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[offset:end]
+}
+
+// List all retention policies
+func (store *MemoryStore) ListRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	policies := make([]RetentionPolicy, 0, len(store.policies))
+	for _, policy := range store.policies {
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+	return policies, nil
+}
+
+// Create a new retention policy
+func (store *MemoryStore) CreateRetentionPolicy(ctx context.Context, policy *RetentionPolicy) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	store.nextPolicyID++
+	policy.ID = store.nextPolicyID
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+	store.policies[policy.ID] = *policy
+	return nil
+}
+
+// Delete a retention policy by ID
+func (store *MemoryStore) DeleteRetentionPolicy(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.policies[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(store.policies, id)
+	return nil
+}
+
+// List the articles of a source that fall outside the retention window, oldest first
+func (store *MemoryStore) ExpiredArticles(ctx context.Context, sourceID uint, cutoff time.Time, keepLast int) ([]Article, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	// Candidates, most recent first
+	candidates := make([]Article, 0)
+	for _, article := range store.articles {
+		if article.SourceID != sourceID || article.Starred {
+			continue
+		}
+		candidates = append(candidates, store.withSource(article))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].CreatedAt.Equal(candidates[j].CreatedAt) {
+			return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+		}
+		return candidates[i].ID > candidates[j].ID
+	})
+
+	expired := make([]Article, 0)
+	for i, article := range candidates {
+		tooOld := !cutoff.IsZero() && article.CreatedAt.Before(cutoff)
+		tooMany := keepLast > 0 && i >= keepLast
+		if tooOld || tooMany {
+			expired = append(expired, article)
+		}
+	}
+
+	// Oldest first
+	for i, j := 0, len(expired)-1; i < j; i, j = i+1, j-1 {
+		expired[i], expired[j] = expired[j], expired[i]
+	}
+
+	return expired, nil
+}
+
+// Permanently delete articles, keeping their URLs and dedupe keys so that they are not
+// stored again
+func (store *MemoryStore) PurgeArticles(ctx context.Context, ids []uint) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	purged := 0
+	for _, id := range ids {
+		if article, ok := store.articles[id]; ok {
+			for _, url := range purgedURLs([]Article{article}) {
+				store.purged[url.Url] = url.SourceID
+			}
+			delete(store.articles, id)
+			delete(store.links, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// Record a retention run
+func (store *MemoryStore) CreateRetentionRun(ctx context.Context, run *RetentionRun) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	run.ID = uint(len(store.runs) + 1)
+	run.CreatedAt = now
+	run.UpdatedAt = now
+	store.runs = append(store.runs, *run)
+	return nil
+}
+
+// List retention runs, most recent first
+func (store *MemoryStore) ListRetentionRuns(ctx context.Context, limit, offset int) ([]RetentionRun, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	runs := make([]RetentionRun, len(store.runs))
+	for i, run := range store.runs {
+		runs[len(runs)-1-i] = run
+	}
+
+	return paginate(runs, limit, offset), nil
+}
+
+// Create a new API key
+func (store *MemoryStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, existing := range store.apiKeys {
+		if existing.Hash == key.Hash {
+			return ErrDuplicate
+		}
+	}
+
+	now := time.Now()
+	store.nextAPIKeyID++
+	key.ID = store.nextAPIKeyID
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	store.apiKeys[key.ID] = *key
+	return nil
+}
+
+// Get an active API key by the hash of its value
+func (store *MemoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, key := range store.apiKeys {
+		if key.Hash == hash && !key.DeletedAt.Valid {
+			return key, nil
+		}
+	}
+
+	return APIKey{}, ErrNotFound
+}
+
+// List active API keys
+func (store *MemoryStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]APIKey, 0)
+	for _, key := range store.apiKeys {
+		if !key.DeletedAt.Valid {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Revoke an API key by ID
+func (store *MemoryStore) RevokeAPIKey(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, ok := store.apiKeys[id]
+	if !ok || key.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	key.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	store.apiKeys[id] = key
+	return nil
+}
+
+// Acquire or renew a lease
+func (store *MemoryStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now().UTC()
+	lease, ok := store.leases[name]
+	if ok && lease.Holder != holder && !lease.ExpiresAt.Before(now) {
+		return false, nil
+	}
+
+	store.leases[name] = Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// Release a lease held by holder
+func (store *MemoryStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if lease, ok := store.leases[name]; ok && lease.Holder == holder {
+		delete(store.leases, name)
+	}
+	return nil
+}
+
+// Create a new webhook
+func (store *MemoryStore) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	store.nextWebhookID++
+	webhook.ID = store.nextWebhookID
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	store.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+// Get a webhook by ID
+func (store *MemoryStore) GetWebhook(ctx context.Context, id uint) (Webhook, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	webhook, ok := store.webhooks[id]
+	if !ok || webhook.DeletedAt.Valid {
+		return Webhook{}, ErrNotFound
+	}
+
+	return webhook, nil
+}
+
+// List webhooks
+func (store *MemoryStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	webhooks := make([]Webhook, 0)
+	for _, webhook := range store.webhooks {
+		if !webhook.DeletedAt.Valid {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// Delete a webhook by ID, its deliveries are kept for the record
+func (store *MemoryStore) DeleteWebhook(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	webhook, ok := store.webhooks[id]
+	if !ok || webhook.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	webhook.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	store.webhooks[id] = webhook
+	return nil
+}
+
+// Create webhook deliveries
+func (store *MemoryStore) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	for i := range deliveries {
+		store.nextDelivery++
+		deliveries[i].ID = store.nextDelivery
+		deliveries[i].CreatedAt = now
+		deliveries[i].UpdatedAt = now
+		store.deliveries[deliveries[i].ID] = deliveries[i]
+	}
+	return nil
+}
+
+// Get a webhook delivery by ID
+func (store *MemoryStore) GetDelivery(ctx context.Context, id uint) (WebhookDelivery, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	delivery, ok := store.deliveries[id]
+	if !ok {
+		return WebhookDelivery{}, ErrNotFound
+	}
+
+	return delivery, nil
+}
+
+// Update a webhook delivery
+func (store *MemoryStore) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.deliveries[delivery.ID]; !ok {
+		return ErrNotFound
+	}
+
+	delivery.UpdatedAt = time.Now()
+	store.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+// List the deliveries of a webhook, most recent first
+func (store *MemoryStore) ListDeliveries(ctx context.Context, webhookID uint, limit, offset int) ([]WebhookDelivery, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	return paginate(deliveries, limit, offset), nil
+}
+
+// List the pending deliveries due at now, oldest first
+func (store *MemoryStore) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return paginate(deliveries, limit, 0), nil
+}
+
+// Insert the new articles and update the changed ones, then record the events built
+// from the changes. Nothing is stored if building the events fails.
+func (store *MemoryStore) SaveArticles(ctx context.Context, articles []Article, events func(changes ArticleChanges) ([]OutboxEvent, error)) (ArticleChanges, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	nextID := store.nextArticleID
+	changes := ArticleChanges{Inserted: make([]Article, 0), Updated: make([]Article, 0), Linked: make([]Article, 0)}
+	links := make([]ArticleSource, 0)
+	for _, article := range articles {
+		article.DedupeKey = dedupeKey(article)
+		if insertedBefore(changes.Inserted, article) || store.wasPurged(article) {
+			continue
+		}
+
+		if stored, ok := store.duplicateOf(article); ok {
+			// Deleted articles are left alone, the ones of other sources get linked to
+			// this source instead
+			if stored.DeletedAt.Valid {
+				continue
+			}
+			if stored.SourceID != article.SourceID {
+				if !store.carriedBy(stored.ID, article.SourceID) && !linkedBefore(links, stored.ID) {
+					links = append(links, ArticleSource{ArticleID: stored.ID, SourceID: article.SourceID, Url: article.Url, CreatedAt: now})
+					changes.Linked = append(changes.Linked, stored)
+				}
+				continue
+			}
+			if !articleChanged(stored, article) {
+				continue
+			}
+
+			stored.Title = article.Title
+			stored.Image = article.Image
+			stored.PublishedDate = article.PublishedDate
+			stored.UpdatedAt = now
+			changes.Updated = append(changes.Updated, stored)
+			continue
+		}
+
+		article.ID = nextID
+		article.CreatedAt = now
+		article.UpdatedAt = now
+		nextID++
+		changes.Inserted = append(changes.Inserted, article)
+	}
+
+	records, err := events(changes)
+	if err != nil {
+		return ArticleChanges{}, err
+	}
+
+	// Commit the changes
+	store.nextArticleID = nextID
+	for _, article := range append(changes.Inserted, changes.Updated...) {
+		article.Source = Source{}
+		store.articles[article.ID] = article
+	}
+	for _, link := range links {
+		store.links[link.ArticleID] = append(store.links[link.ArticleID], link)
+	}
+	store.createEvents(records)
+	changes.Events = records
+
+	return changes, nil
+}
+
+// Record events, setting their IDs
+func (store *MemoryStore) CreateEvents(ctx context.Context, events []OutboxEvent) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.createEvents(events)
+	return nil
+}
+
+// Update an event, after an attempt to publish it
+func (store *MemoryStore) UpdateEvent(ctx context.Context, event *OutboxEvent) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.events[event.ID]; !ok {
+		return ErrNotFound
+	}
+
+	store.events[event.ID] = *event
+	return nil
+}
+
+// List the unpublished events created before the given time, oldest first
+func (store *MemoryStore) PendingEvents(ctx context.Context, before time.Time, limit int) ([]OutboxEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]OutboxEvent, 0)
+	for _, event := range store.events {
+		if event.PublishedAt == nil && event.CreatedAt.Before(before) {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return paginate(events, limit, 0), nil
+}
+
+// Delete the events published before the given time
+func (store *MemoryStore) PurgeEvents(ctx context.Context, before time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	purged := 0
+	for id, event := range store.events {
+		if event.PublishedAt != nil && event.PublishedAt.Before(before) {
+			delete(store.events, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// List the events with the given IDs, oldest first
+func (store *MemoryStore) GetEvents(ctx context.Context, ids []uint) ([]OutboxEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]OutboxEvent, 0, len(ids))
+	for _, id := range ids {
+		if event, ok := store.events[id]; ok {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// List the events recorded after the given one, oldest first
+func (store *MemoryStore) EventsAfter(ctx context.Context, afterID uint, limit int) ([]OutboxEvent, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	events := make([]OutboxEvent, 0)
+	for _, event := range store.events {
+		if event.ID > afterID {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return paginate(events, limit, 0), nil
+}
+
+// Get the ID of the last recorded event
+func (store *MemoryStore) LastEventID(ctx context.Context) (uint, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	return store.nextEventID, nil
+}
+
+// Helper method: store events, setting their IDs and creation time
+func (store *MemoryStore) createEvents(events []OutboxEvent) {
+	now := time.Now()
+	for i := range events {
+		store.nextEventID++
+		events[i].ID = store.nextEventID
+		events[i].CreatedAt = now
+		store.events[events[i].ID] = events[i]
+	}
+}
+
+// Helper method: find the stored article, deleted or not, sharing the URL or the
+// dedupe key of the article, the oldest one if several do
+func (store *MemoryStore) duplicateOf(article Article) (Article, bool) {
+	var (
+		found Article
+		ok    bool
+	)
+	for _, stored := range store.articles {
+		if sameArticle(stored, article) && (!ok || stored.ID < found.ID) {
+			found, ok = stored, true
+		}
+	}
+	return found, ok
+}
+
+// Helper function: check if an article of the batch already has the URL or the dedupe
+// key of the article
+func insertedBefore(inserted []Article, article Article) bool {
+	for _, other := range inserted {
+		if sameArticle(other, article) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: check if the batch already links the stored article
+func linkedBefore(links []ArticleSource, articleID uint) bool {
+	for _, link := range links {
+		if link.ArticleID == articleID {
+			return true
+		}
+	}
+	return false
+}
+
+// Get a WebSub subscription by ID
+func (store *MemoryStore) GetSubscription(ctx context.Context, id uint) (WebSubSubscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	subscription, ok := store.subscriptions[id]
+	if !ok {
+		return WebSubSubscription{}, ErrNotFound
+	}
+
+	return subscription, nil
+}
+
+// Get the WebSub subscription of a source
+func (store *MemoryStore) GetSourceSubscription(ctx context.Context, sourceID uint) (WebSubSubscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, subscription := range store.subscriptions {
+		if subscription.SourceID == sourceID {
+			return subscription, nil
+		}
+	}
+
+	return WebSubSubscription{}, ErrNotFound
+}
+
+// List WebSub subscriptions
+func (store *MemoryStore) ListSubscriptions(ctx context.Context) ([]WebSubSubscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	subscriptions := make([]WebSubSubscription, 0, len(store.subscriptions))
+	for _, subscription := range store.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+	return subscriptions, nil
+}
+
+// Create or save a WebSub subscription
+func (store *MemoryStore) SaveSubscription(ctx context.Context, subscription *WebSubSubscription) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, other := range store.subscriptions {
+		if other.SourceID == subscription.SourceID && other.ID != subscription.ID {
+			return ErrDuplicate
+		}
+	}
+
+	now := time.Now()
+	if subscription.ID == 0 {
+		store.nextSubID++
+		subscription.ID = store.nextSubID
+		subscription.CreatedAt = now
+	} else if _, ok := store.subscriptions[subscription.ID]; !ok {
+		return ErrNotFound
+	}
+
+	subscription.UpdatedAt = now
+	store.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+// Delete a WebSub subscription by ID
+func (store *MemoryStore) DeleteSubscription(ctx context.Context, id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(store.subscriptions, id)
+	return nil
+}
+
+// Get a backfill by ID
+func (store *MemoryStore) GetBackfill(ctx context.Context, id uint) (Backfill, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	backfill, ok := store.backfills[id]
+	if !ok {
+		return Backfill{}, ErrNotFound
+	}
+
+	return backfill, nil
+}
+
+// List the backfills of a source, most recent first
+func (store *MemoryStore) ListBackfills(ctx context.Context, sourceID uint, limit, offset int) ([]Backfill, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	backfills := make([]Backfill, 0)
+	for _, backfill := range store.backfills {
+		if backfill.SourceID == sourceID {
+			backfills = append(backfills, backfill)
+		}
+	}
+
+	sort.Slice(backfills, func(i, j int) bool { return backfills[i].ID > backfills[j].ID })
+	return paginate(backfills, limit, offset), nil
+}
+
+// List the backfills with pages left to fetch, oldest first
+func (store *MemoryStore) PendingBackfills(ctx context.Context) ([]Backfill, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	backfills := make([]Backfill, 0)
+	for _, backfill := range store.backfills {
+		if backfill.Status == BackfillPending {
+			backfills = append(backfills, backfill)
+		}
+	}
+
+	sort.Slice(backfills, func(i, j int) bool { return backfills[i].ID < backfills[j].ID })
+	return backfills, nil
+}
+
+// Create or save a backfill
+func (store *MemoryStore) SaveBackfill(ctx context.Context, backfill *Backfill) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	if backfill.ID == 0 {
+		store.nextBackfill++
+		backfill.ID = store.nextBackfill
+		backfill.CreatedAt = now
+	} else if _, ok := store.backfills[backfill.ID]; !ok {
+		return ErrNotFound
+	}
+
+	backfill.UpdatedAt = now
+	store.backfills[backfill.ID] = *backfill
+	return nil
+}
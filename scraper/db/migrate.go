@@ -0,0 +1,331 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A schema change, applied by Up and reverted by Down
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(queries *Queries) error
+	Down    func(queries *Queries) error
+}
+
+// Record of an applied migration
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// State of a migration in the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Every migration, in version order. The initial schema is created from the models,
+// later tables and changes get their own migration so existing databases receive them.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up:      (*Queries).AutoMigration,
+		Down:    (*Queries).dropSchema,
+	},
+	{
+		Version: 2,
+		Name:    "leases",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&Lease{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&Lease{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "webhooks",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&Webhook{}, &WebhookDelivery{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&WebhookDelivery{}, &Webhook{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "outbox events",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&OutboxEvent{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&OutboxEvent{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "source types",
+		Up: func(queries *Queries) error {
+			return queries.addColumns(&Source{}, "Type", "HTML")
+		},
+		Down: func(queries *Queries) error {
+			return queries.dropColumns(&Source{}, "HTML", "Type")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "json sources",
+		Up: func(queries *Queries) error {
+			return queries.addColumns(&Source{}, "JSON")
+		},
+		Down: func(queries *Queries) error {
+			return queries.dropColumns(&Source{}, "JSON")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "sitemap sources",
+		Up: func(queries *Queries) error {
+			return queries.addColumns(&Source{}, "Sitemap", "FetchedAt")
+		},
+		Down: func(queries *Queries) error {
+			return queries.dropColumns(&Source{}, "FetchedAt", "Sitemap")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "websub subscriptions",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&WebSubSubscription{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&WebSubSubscription{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "source fetch settings",
+		Up: func(queries *Queries) error {
+			return queries.addColumns(&Source{}, "Fetch")
+		},
+		Down: func(queries *Queries) error {
+			return queries.dropColumns(&Source{}, "Fetch")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "backfills",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&Backfill{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&Backfill{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "canonical urls",
+		Up:      (*Queries).addCanonicalURLs,
+		Down: func(queries *Queries) error {
+			migrator := queries.DB.Migrator()
+			if err := migrator.DropTable(&ArticleSource{}); err != nil {
+				return err
+			}
+			if migrator.HasIndex(&Article{}, "DedupeKey") {
+				if err := migrator.DropIndex(&Article{}, "DedupeKey"); err != nil {
+					return err
+				}
+			}
+			return queries.dropColumns(&Article{}, "CanonicalURL", "DedupeKey")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "purged urls",
+		Up: func(queries *Queries) error {
+			return queries.DB.AutoMigrate(&PurgedURL{})
+		},
+		Down: func(queries *Queries) error {
+			return queries.DB.Migrator().DropTable(&PurgedURL{})
+		},
+	},
+}
+
+// Helper method: add the columns of the model fields, unless there already (created
+// along with the table)
+func (queries *Queries) addColumns(model any, fields ...string) error {
+	migrator := queries.DB.Migrator()
+	for _, field := range fields {
+		if migrator.HasColumn(model, field) {
+			continue
+		}
+		if err := migrator.AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper method: drop the columns of the model fields, if there
+func (queries *Queries) dropColumns(model any, fields ...string) error {
+	migrator := queries.DB.Migrator()
+	for _, field := range fields {
+		if !migrator.HasColumn(model, field) {
+			continue
+		}
+		if err := migrator.DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper method: add the canonical URL and the dedupe key of the articles, the key filled
+// from their URL, and the table of the other sources carrying them. Only the oldest of
+// the articles already stored twice gets a key, the others are left as they are.
+func (queries *Queries) addCanonicalURLs() error {
+	if err := queries.addColumns(&Article{}, "CanonicalURL", "DedupeKey"); err != nil {
+		return err
+	}
+
+	var articles []Article
+	err := queries.DB.Unscoped().Select("id", "url").Where("dedupe_key IS NULL").Order("id").Find(&articles).Error
+	if err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool)
+	err = queries.DB.Transaction(func(tx *gorm.DB) error {
+		for _, article := range articles {
+			key := dedupeKey(article)
+			if key == nil || taken[*key] {
+				continue
+			}
+			taken[*key] = true
+
+			err := tx.Unscoped().Model(&Article{}).Where("id = ?", article.ID).UpdateColumn("dedupe_key", *key).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	migrator := queries.DB.Migrator()
+	if !migrator.HasIndex(&Article{}, "DedupeKey") {
+		if err := migrator.CreateIndex(&Article{}, "DedupeKey"); err != nil {
+			return err
+		}
+	}
+
+	return queries.DB.AutoMigrate(&ArticleSource{})
+}
+
+// Helper method: drop every table created by AutoMigration
+func (queries *Queries) dropSchema() error {
+	if queries.Driver == DriverSQLite {
+		if err := queries.DB.Exec("DROP TABLE IF EXISTS articles_fts").Error; err != nil {
+			return err
+		}
+	}
+
+	return queries.DB.Migrator().DropTable(&APIKey{}, &RetentionRun{}, &RetentionPolicy{}, &Article{}, &Source{})
+}
+
+// Helper method: get the applied migrations by version
+func (queries *Queries) appliedMigrations() (map[uint]SchemaMigration, error) {
+	if err := queries.DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []SchemaMigration
+	if err := queries.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// Apply the pending migrations in order, returning the ones applied
+func (queries *Queries) MigrateUp() ([]Migration, error) {
+	applied, err := queries.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := migration.Up(queries); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+
+		record := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := queries.DB.Create(&record).Error; err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Revert the last applied migrations, at most steps of them, returning the ones reverted
+func (queries *Queries) MigrateDown(steps int) ([]Migration, error) {
+	applied, err := queries.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if err := migration.Down(queries); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+
+		if err := queries.DB.Delete(&SchemaMigration{}, migration.Version).Error; err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// List every migration with whether it is applied
+func (queries *Queries) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := queries.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		record, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: record.AppliedAt}
+	}
+
+	return statuses, nil
+}
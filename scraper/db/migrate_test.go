@@ -0,0 +1,105 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test applying, checking and reverting the migrations
+func TestMigrations(t *testing.T) {
+	queries := NewQueries()
+	require.NoError(t, queries.ConnectDB(DriverSQLite, ":memory:"))
+
+	statuses, err := queries.MigrationStatus()
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrations))
+	for _, status := range statuses {
+		require.False(t, status.Applied)
+	}
+
+	applied, err := queries.MigrateUp()
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations))
+	require.True(t, queries.DB.Migrator().HasTable(&Source{}))
+
+	// Nothing left to apply
+	applied, err = queries.MigrateUp()
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	// Columns added to an existing table come and go with their migration (5 onwards)
+	reverted, err := queries.MigrateDown(len(migrations) - 4)
+	require.NoError(t, err)
+	require.Len(t, reverted, len(migrations)-4)
+	require.False(t, queries.DB.Migrator().HasColumn(&Source{}, "Type"))
+	require.False(t, queries.DB.Migrator().HasColumn(&Source{}, "JSON"))
+	require.False(t, queries.DB.Migrator().HasColumn(&Source{}, "Fetch"))
+	require.False(t, queries.DB.Migrator().HasColumn(&Article{}, "CanonicalURL"))
+	require.False(t, queries.DB.Migrator().HasColumn(&Article{}, "DedupeKey"))
+	require.False(t, queries.DB.Migrator().HasTable(&ArticleSource{}))
+	require.False(t, queries.DB.Migrator().HasTable(&PurgedURL{}))
+
+	applied, err = queries.MigrateUp()
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrations)-4)
+	require.True(t, queries.DB.Migrator().HasColumn(&Source{}, "Type"))
+	require.True(t, queries.DB.Migrator().HasColumn(&Source{}, "JSON"))
+	require.True(t, queries.DB.Migrator().HasColumn(&Source{}, "Fetch"))
+	require.True(t, queries.DB.Migrator().HasColumn(&Article{}, "CanonicalURL"))
+	require.True(t, queries.DB.Migrator().HasIndex(&Article{}, "DedupeKey"))
+	require.True(t, queries.DB.Migrator().HasTable(&ArticleSource{}))
+	require.True(t, queries.DB.Migrator().HasTable(&PurgedURL{}))
+
+	statuses, err = queries.MigrationStatus()
+	require.NoError(t, err)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[0].AppliedAt.IsZero())
+
+	// Reverting the initial schema drops the tables, which can be created again
+	reverted, err = queries.MigrateDown(len(migrations))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(migrations))
+	require.False(t, queries.DB.Migrator().HasTable(&Source{}))
+
+	reverted, err = queries.MigrateDown(1)
+	require.NoError(t, err)
+	require.Empty(t, reverted)
+
+	_, err = queries.MigrateUp()
+	require.NoError(t, err)
+	require.True(t, queries.DB.Migrator().HasTable(&Article{}))
+}
+
+// Test filling the dedupe key of the articles stored before, only the oldest of the
+// duplicates gets it
+func TestCanonicalURLMigration(t *testing.T) {
+	queries := NewQueries()
+	require.NoError(t, queries.ConnectDB(DriverSQLite, ":memory:"))
+	_, err := queries.MigrateUp()
+	require.NoError(t, err)
+
+	_, err = queries.MigrateDown(2)
+	require.NoError(t, err)
+	require.False(t, queries.DB.Migrator().HasColumn(&Article{}, "DedupeKey"))
+
+	source := Source{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+	require.NoError(t, queries.DB.Create(&source).Error)
+	for _, link := range []string{"http://example.com/a?utm_source=rss", "https://example.com/a/", "https://example.com/b"} {
+		err := queries.DB.Exec("INSERT INTO articles (source_id, title, url, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			source.ID, link, link, time.Now(), time.Now()).Error
+		require.NoError(t, err)
+	}
+
+	_, err = queries.MigrateUp()
+	require.NoError(t, err)
+
+	var articles []Article
+	require.NoError(t, queries.DB.Order("id").Find(&articles).Error)
+	require.Len(t, articles, 3)
+	require.Equal(t, "https://example.com/a", *articles[0].DedupeKey)
+	require.Nil(t, articles[1].DedupeKey)
+	require.Equal(t, "https://example.com/b", *articles[2].DedupeKey)
+	require.Nil(t, articles[0].CanonicalURL)
+}
@@ -2,16 +2,91 @@ package db
 
 import (
 	"database/sql"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// RSS source model
+// Types of sources, each scraped by its own scraper
+const (
+	SourceTypeRSS     = "rss"     // RSS or Atom feed
+	SourceTypeHTML    = "html"    // Web page scraped with CSS selectors
+	SourceTypeJSON    = "json"    // JSON API mapped with gjson paths
+	SourceTypeSitemap = "sitemap" // Sitemap or Google News sitemap
+)
+
+// News source model
 type Source struct {
 	gorm.Model
-	Link     string `json:"link" gorm:"unique"`
-	Provider string `json:"provider"`
-	Category string `json:"category"`
+	Link      string          `json:"link" gorm:"uniqueIndex:idx_sources_link,where:deleted_at IS NULL"` // Unique among non deleted sources
+	Provider  string          `json:"provider"`
+	Category  string          `json:"category"`
+	Type      string          `json:"type" gorm:"not null;default:rss"`         // SourceTypeRSS when empty
+	HTML      *HTMLSelectors  `json:"html,omitempty" gorm:"serializer:json"`    // Only for SourceTypeHTML
+	JSON      *JSONSource     `json:"json,omitempty" gorm:"serializer:json"`    // Only for SourceTypeJSON
+	Sitemap   *SitemapOptions `json:"sitemap,omitempty" gorm:"serializer:json"` // Only for SourceTypeSitemap
+	FetchedAt *time.Time      `json:"fetched_at,omitempty"`                     // Start of the last successful scrape, kept by the scraper
+	Fetch     *FetchSettings  `json:"fetch,omitempty" gorm:"serializer:json"`   // Requests of any type, the defaults if nil
+}
+
+// Authentication schemes of the fetch settings
+const (
+	FetchAuthBasic  = "basic"  // Username and password
+	FetchAuthBearer = "bearer" // Token sent in the Authorization header
+	FetchAuthCookie = "cookie" // Cookies sent in the Cookie header
+)
+
+// Settings of the requests fetching a source, whatever its type. The credentials are
+// encrypted with the configured key and only decrypted by the scraper.
+type FetchSettings struct {
+	Headers            map[string]string `json:"headers,omitempty"`              // Sent to the hosts of the source, values encrypted
+	Auth               string            `json:"auth,omitempty"`                 // FetchAuthBasic, FetchAuthBearer, FetchAuthCookie or none
+	Username           string            `json:"username,omitempty"`             // Only for FetchAuthBasic
+	Credential         string            `json:"credential,omitempty"`           // Encrypted password, token or cookies
+	Proxy              string            `json:"proxy,omitempty"`                // HTTP(S) or SOCKS5 proxy URL without password, the environment proxy if empty
+	ProxyCredential    string            `json:"proxy_credential,omitempty"`     // Encrypted password of the proxy user
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty"` // Accept any TLS certificate, for internal hosts
+	Timeout            time.Duration     `json:"timeout,omitempty"`              // Replaces the scrape timeout if set
+}
+
+// CSS selectors extracting the articles of an HTML source. Every selector but Item is
+// relative to the item container.
+type HTMLSelectors struct {
+	Item  string `json:"item"`            // Container of each article
+	Title string `json:"title"`           // Element holding the title as text
+	Link  string `json:"link,omitempty"`  // Element holding the link as href, the first link of the item if empty
+	Image string `json:"image,omitempty"` // Element holding the image as src, no image if empty
+	Date  string `json:"date,omitempty"`  // Element holding the date as datetime attribute or text, no date if empty
+}
+
+// Request and field mapping of a JSON source
+type JSONSource struct {
+	Request JSONRequest `json:"request"`
+	Mapping JSONMapping `json:"mapping"`
+}
+
+// Request sent to a JSON source. The header values are encrypted like the credentials.
+type JSONRequest struct {
+	URL     string            `json:"url,omitempty"`     // Endpoint of the API, the link of the source if empty
+	Headers map[string]string `json:"headers,omitempty"` // E.g. an API version or key, values encrypted
+}
+
+// Paths extracting the articles of a JSON response, in the gjson syntax
+// (https://github.com/tidwall/gjson/blob/master/SYNTAX.md). Every path but Items is
+// relative to an item.
+type JSONMapping struct {
+	Items string `json:"items,omitempty"` // Array of the items, the whole response if empty
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Image string `json:"image,omitempty"` // No image if empty
+	Date  string `json:"date,omitempty"`  // Text, or Unix time in seconds or milliseconds; no date if empty
+}
+
+// Options of a sitemap source
+type SitemapOptions struct {
+	// Fetch the pages of the new entries to fill their title and image from their
+	// metadata. Required for the sitemaps without news:title.
+	Metadata bool `json:"metadata"`
 }
 
 // Article model
@@ -23,4 +98,207 @@ type Article struct {
 	Url           string         `json:"url" gorm:"unique"` // The article URL
 	Image         sql.NullString `json:"image"`
 	PublishedDate string         `json:"published_date"`
+	Starred       bool           `json:"starred" gorm:"not null;default:false"` // Starred articles are exempt from retention
+
+	// Link the publisher gives for the article, behind a redirect wrapper or as the
+	// canonical link of its page, nil if not resolved
+	CanonicalURL *string `json:"canonical_url"`
+
+	// Key the duplicates are detected by across sources: the canonical URL if any, else
+	// the URL, normalized by NormalizeURL. Nil for the duplicates stored before it existed.
+	DedupeKey *string         `json:"-" gorm:"uniqueIndex"`
+	Sources   []ArticleSource `json:"sources" gorm:"foreignKey:ArticleID"` // Other sources that carried the article
+}
+
+// Another source that carried an article, under its own URL. The article keeps the
+// source it was first stored from.
+type ArticleSource struct {
+	ArticleID uint      `json:"article_id" gorm:"primaryKey;autoIncrement:false"`
+	SourceID  uint      `json:"source_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Url       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// URL or dedupe key of an article purged by the retention, so that the feeds still
+// listing it do not store it back. Purging the source frees its URLs again.
+type PurgedURL struct {
+	Url       string    `json:"url" gorm:"primaryKey"`
+	SourceID  uint      `json:"source_id" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Retention policy model. A policy applies to a single source, to every source of a
+// category, or to all sources when both are empty; the most specific one wins.
+// Articles are expired when older than MaxAgeDays or beyond the KeepLast most recent
+// ones of their source, whichever is set (either rule expires an article when both are).
+type RetentionPolicy struct {
+	gorm.Model
+	SourceID   *uint  `json:"source_id"`
+	Category   string `json:"category"`
+	MaxAgeDays int    `json:"max_age_days"`
+	KeepLast   int    `json:"keep_last"`
+	Archive    bool   `json:"archive"` // Write expired articles to the archive before deleting them
+}
+
+// History of retention runs
+type RetentionRun struct {
+	gorm.Model
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Deleted     int       `json:"deleted"`
+	Archived    int       `json:"archived"`
+	ArchiveFile string    `json:"archive_file"`
+	Report      string    `json:"report"` // JSON encoded purge counts per source
+	Error       string    `json:"error"`
+}
+
+// Roles of API keys, each one includes the permissions of the previous ones
+const (
+	RoleReader = "reader" // Read articles and sources
+	RoleEditor = "editor" // Manage sources and star articles
+	RoleAdmin  = "admin"  // Manage API keys and retention
+)
+
+// Rank of each role, used to compare them
+var roleRanks = map[string]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Check if the role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Check if the role grants at least the permissions of the required role
+func RoleAllows(role, required string) bool {
+	return ValidRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// API key model. Only the SHA-256 hash of the key is stored, revoking a key soft deletes it.
+type APIKey struct {
+	gorm.Model
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"` // First characters of the key, to tell keys apart
+	Hash   string `json:"-" gorm:"uniqueIndex"`
+	Role   string `json:"role"`
+
+	// Requests allowed per UTC day, 0 uses the server default
+	DailyQuota int `json:"daily_quota" gorm:"not null;default:0"`
+}
+
+// Lease model, a named lock held by one instance until it expires or is released.
+// Instances renew the leases they keep, so a crashed holder loses them after the TTL.
+type Lease struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Holder    string    `json:"holder" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+}
+
+// Webhook subscription, notified of the new articles matching all of its filters.
+// Empty filters match every article.
+type Webhook struct {
+	gorm.Model
+	URL      string `json:"url"`
+	Secret   string `json:"-"` // Key of the HMAC-SHA256 signature of each delivery
+	SourceID *uint  `json:"source_id"`
+	Category string `json:"category"`
+	Keyword  string `json:"keyword"` // Case insensitive match on the title
+}
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = "pending"   // Waiting for its next attempt
+	DeliverySucceeded = "succeeded" // Acknowledged with a 2xx response
+	DeliveryFailed    = "failed"    // Out of attempts, until redelivered
+)
+
+// Delivery of an event to a webhook, retried with backoff until it succeeds or runs out of attempts
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID     uint       `json:"webhook_id" gorm:"index"`
+	Event         string     `json:"event"`
+	Payload       string     `json:"payload"` // JSON body, the same on every attempt
+	Status        string     `json:"status" gorm:"index:idx_webhook_deliveries_due,priority:1"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	StatusCode    int        `json:"status_code"` // Response status of the last attempt, 0 if none
+	Error         string     `json:"error"`       // Error of the last attempt
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// Status of a WebSub subscription
+const (
+	WebSubPending       = "pending"       // Requested, until the hub verifies it
+	WebSubActive        = "active"        // Verified, the hub pushes the new items until the lease expires
+	WebSubDenied        = "denied"        // Refused by the hub, until the feed advertises another hub
+	WebSubUnsubscribing = "unsubscribing" // The feed no longer advertises a hub, until the hub verifies it
+)
+
+// WebSub subscription of a feed source to the hub it advertises, which pushes the new
+// items of the feed to the callback of the subscription
+type WebSubSubscription struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	SourceID      uint       `json:"source_id" gorm:"uniqueIndex"`
+	Hub           string     `json:"hub"`
+	Topic         string     `json:"topic"` // URL of the feed at the hub, its self link
+	Secret        string     `json:"-"`     // Key of the HMAC signature of the pushed content
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`        // Requests sent since the last verification
+	NextAttemptAt time.Time  `json:"next_attempt_at"` // When to send the request again, if not verified by then
+	Error         string     `json:"error"`           // Error of the last request, or reason of the denial
+	VerifiedAt    *time.Time `json:"verified_at"`
+	ExpiresAt     *time.Time `json:"expires_at"` // End of the lease granted by the hub
+	PushedAt      *time.Time `json:"pushed_at"`  // Last content pushed by the hub
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Event recorded in the same transaction as the change it describes, then published to
+// the subscribers of the event bus. Unpublished events survive a crash and are relayed later.
+type OutboxEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null"`
+	Payload     string     `json:"payload" gorm:"not null"` // JSON encoded event
+	Attempts    int        `json:"attempts"`                // Failed publications so far
+	Error       string     `json:"error"`                   // Error of the last failed publication
+	CreatedAt   time.Time  `json:"created_at" gorm:"index:idx_outbox_events_pending,priority:2"`
+	PublishedAt *time.Time `json:"published_at" gorm:"index:idx_outbox_events_pending,priority:1"`
+}
+
+// Status of a backfill
+const (
+	BackfillPending   = "pending"   // Pages left to fetch, resumed where it stopped after a restart
+	BackfillSucceeded = "succeeded" // Reached its depth, its date or the oldest page of the feed
+	BackfillFailed    = "failed"    // Out of attempts on a page, or its source is gone
+)
+
+// How a backfill finds the older pages of a feed
+const (
+	PagingArchive = "archive" // RFC 5005 archived feed, following the prev-archive links
+	PagingNext    = "next"    // RFC 5005 paged feed, following the next links
+	PagingPaged   = "paged"   // WordPress style feed, incrementing the paged query parameter
+)
+
+// Backfill of the history of a feed source, fetching its older pages one by one. Its
+// position is saved after each page, so that it resumes where it stopped.
+type Backfill struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	SourceID      uint       `json:"source_id" gorm:"index"`
+	Status        string     `json:"status" gorm:"index"`
+	MaxPages      int        `json:"max_pages"`       // Older pages fetched at most, the feed itself aside
+	Since         *time.Time `json:"since"`           // Items published before are left out, nil for no date limit
+	Paging        string     `json:"paging"`          // Found from the feed itself, empty until then
+	NextURL       string     `json:"next_url"`        // Page to fetch next, empty for the feed itself
+	Pages         int        `json:"pages"`           // Older pages fetched so far
+	NewArticles   int        `json:"new_articles"`    // Articles stored by the backfill
+	LastItem      string     `json:"-"`               // Link of the first item of the last page, to spot feeds ignoring paged
+	Attempts      int        `json:"attempts"`        // Failed attempts of the next page
+	NextAttemptAt time.Time  `json:"next_attempt_at"` // When to fetch the next page
+	Error         string     `json:"error"`           // Error of the last attempt
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
 }
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// Returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// Returned when a record violates a unique constraint
+	ErrDuplicate = errors.New("record already exists")
+)
+
+// Filter options for listing sources
+type SourceFilter struct {
+	Provider string
+	Category string
+	Deleted  bool // List soft deleted sources instead of the active ones
+	Limit    int
+	Offset   int
+}
+
+// Filter options for listing articles
+type ArticleFilter struct {
+	SourceID uint // Articles stored from the source or carried by it too
+	Category string
+	Search   string // Full text search on the title, every term must match
+	Limit    int
+	Offset   int
+}
+
+// Persistence operations on RSS sources
+type SourceStore interface {
+	GetSource(ctx context.Context, id uint) (Source, error)
+	ListSources(ctx context.Context, filter SourceFilter) ([]Source, error)
+	CreateSource(ctx context.Context, source *Source) error
+	UpdateSource(ctx context.Context, source *Source) error
+
+	// Record the start of the last successful scrape of a source, left as is by UpdateSource
+	SetSourceFetched(ctx context.Context, id uint, at time.Time) error
+
+	// Soft delete a source along with its articles
+	DeleteSource(ctx context.Context, id uint) error
+
+	// Undo DeleteSource, bringing back the articles deleted with the source.
+	// Returns ErrDuplicate if another source has taken its link since.
+	RestoreSource(ctx context.Context, id uint) (Source, error)
+
+	// Permanently delete a source, deleted or not, with its articles and retention policies
+	PurgeSource(ctx context.Context, id uint) error
+}
+
+// Persistence operations on articles. Returned articles always have their Source populated.
+type ArticleStore interface {
+	GetArticle(ctx context.Context, id uint) (Article, error)
+	ListArticles(ctx context.Context, filter ArticleFilter) ([]Article, error)
+	CreateArticle(ctx context.Context, article *Article) error
+	UpdateArticle(ctx context.Context, article *Article) error
+	DeleteArticle(ctx context.Context, id uint) error
+
+	// Insert the articles whose URL and dedupe key are neither stored nor purged yet and
+	// skip the rest, linking the ones stored from another source to the source of the duplicate.
+	// Returns the articles that were actually inserted, with their IDs set.
+	UpsertArticles(ctx context.Context, articles []Article) ([]Article, error)
+
+	// Of the given URLs, the ones stored as the URL or the dedupe key of an article,
+	// deleted or purged
+	KnownURLs(ctx context.Context, urls []string) (map[string]bool, error)
+}
+
+// Persistence operations for the retention job
+type RetentionStore interface {
+	ListRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error)
+	CreateRetentionPolicy(ctx context.Context, policy *RetentionPolicy) error
+	DeleteRetentionPolicy(ctx context.Context, id uint) error
+
+	// Articles of a source, deleted or not, created before the cutoff (if not zero) or
+	// beyond its keepLast most recent ones (if greater than zero). Starred articles are
+	// never returned.
+	ExpiredArticles(ctx context.Context, sourceID uint, cutoff time.Time, keepLast int) ([]Article, error)
+
+	// Permanently delete articles, whose URLs are then never stored again. Returns the
+	// number of rows removed.
+	PurgeArticles(ctx context.Context, ids []uint) (int, error)
+
+	CreateRetentionRun(ctx context.Context, run *RetentionRun) error
+	ListRetentionRuns(ctx context.Context, limit, offset int) ([]RetentionRun, error)
+}
+
+// Persistence operations on API keys
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uint) error
+}
+
+// Persistence operations on leases, shared by the instances to coordinate
+type LeaseStore interface {
+	// Acquire the named lease for holder until ttl from now, or renew it if holder
+	// already has it. Returns false if another holder has a lease that hasn't expired.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+
+	// Release the named lease if holder has it
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Persistence operations on webhooks and their deliveries
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, id uint) (Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id uint) error
+
+	CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	GetDelivery(ctx context.Context, id uint) (WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	// Deliveries of a webhook, most recent first
+	ListDeliveries(ctx context.Context, webhookID uint, limit, offset int) ([]WebhookDelivery, error)
+
+	// Pending deliveries whose next attempt is due at now, oldest first
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+}
+
+// Persistence operations on WebSub subscriptions, at most one per source
+type WebSubStore interface {
+	GetSubscription(ctx context.Context, id uint) (WebSubSubscription, error)
+
+	// The subscription of a source, ErrNotFound if none
+	GetSourceSubscription(ctx context.Context, sourceID uint) (WebSubSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]WebSubSubscription, error)
+
+	// Create the subscription if it has no ID, or save all its fields. Returns
+	// ErrDuplicate when creating a second subscription for a source.
+	SaveSubscription(ctx context.Context, subscription *WebSubSubscription) error
+	DeleteSubscription(ctx context.Context, id uint) error
+}
+
+// Persistence operations on the backfills of the feed sources
+type BackfillStore interface {
+	GetBackfill(ctx context.Context, id uint) (Backfill, error)
+
+	// Backfills of a source, most recent first
+	ListBackfills(ctx context.Context, sourceID uint, limit, offset int) ([]Backfill, error)
+
+	// Backfills with pages left to fetch, oldest first
+	PendingBackfills(ctx context.Context) ([]Backfill, error)
+
+	// Create the backfill if it has no ID, or save all its fields
+	SaveBackfill(ctx context.Context, backfill *Backfill) error
+}
+
+// Articles saved by SaveArticles
+type ArticleChanges struct {
+	Inserted []Article     // New articles
+	Updated  []Article     // Stored articles whose title, image or published date changed
+	Linked   []Article     // Articles stored from another source, now carried by this one too
+	Events   []OutboxEvent // Events recorded along with the changes, with their IDs
+}
+
+// Persistence operations on the outbox of the event bus
+type OutboxStore interface {
+	// Insert the new articles, not the purged ones, and update the changed ones,
+	// recording the events built from the changes in the same transaction
+	SaveArticles(ctx context.Context, articles []Article, events func(changes ArticleChanges) ([]OutboxEvent, error)) (ArticleChanges, error)
+
+	// Record events, setting their IDs
+	CreateEvents(ctx context.Context, events []OutboxEvent) error
+	UpdateEvent(ctx context.Context, event *OutboxEvent) error
+
+	// Unpublished events created before the given time, oldest first
+	PendingEvents(ctx context.Context, before time.Time, limit int) ([]OutboxEvent, error)
+
+	// Delete the events published before the given time, returns how many were deleted
+	PurgeEvents(ctx context.Context, before time.Time) (int, error)
+
+	// Events with the given IDs, published or not, oldest first. Unknown IDs are skipped.
+	GetEvents(ctx context.Context, ids []uint) ([]OutboxEvent, error)
+
+	// Events recorded after the given one, published or not, oldest first
+	EventsAfter(ctx context.Context, afterID uint, limit int) ([]OutboxEvent, error)
+
+	// ID of the last recorded event, 0 if none
+	LastEventID(ctx context.Context) (uint, error)
+}
+
+// Every persistence operation, implemented by GormStore and MemoryStore
+type Store interface {
+	SourceStore
+	ArticleStore
+	RetentionStore
+	APIKeyStore
+	LeaseStore
+	WebhookStore
+	OutboxStore
+	WebSubStore
+	BackfillStore
+}
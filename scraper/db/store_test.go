@@ -0,0 +1,886 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: create a GORM store on a fresh in-memory SQLite database
+func newSQLiteStore(t *testing.T) *GormStore {
+	t.Helper()
+
+	queries := NewQueries()
+	require.NoError(t, queries.ConnectDB(DriverSQLite, ":memory:"))
+	_, err := queries.MigrateUp()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, err := queries.DB.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return NewGormStore(queries)
+}
+
+// Both implementations must behave the same way
+type store = Store
+
+// Run the same scenario against every store implementation
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) store{
+		"Memory": func(t *testing.T) store { return NewMemoryStore() },
+		"SQLite": func(t *testing.T) store { return newSQLiteStore(t) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore(t))
+		})
+
+		t.Run(name+"Retention", func(t *testing.T) {
+			testRetentionStore(t, newStore(t))
+		})
+
+		t.Run(name+"SourceLifecycle", func(t *testing.T) {
+			testSourceLifecycle(t, newStore(t))
+		})
+
+		t.Run(name+"APIKeys", func(t *testing.T) {
+			testAPIKeyStore(t, newStore(t))
+		})
+
+		t.Run(name+"Leases", func(t *testing.T) {
+			testLeaseStore(t, newStore(t))
+		})
+
+		t.Run(name+"Webhooks", func(t *testing.T) {
+			testWebhookStore(t, newStore(t))
+		})
+
+		t.Run(name+"Outbox", func(t *testing.T) {
+			testOutboxStore(t, newStore(t))
+		})
+
+		t.Run(name+"WebSub", func(t *testing.T) {
+			testWebSubStore(t, newStore(t))
+		})
+
+		t.Run(name+"Backfills", func(t *testing.T) {
+			testBackfillStore(t, newStore(t))
+		})
+
+		t.Run(name+"Duplicates", func(t *testing.T) {
+			testDuplicateArticles(t, newStore(t))
+		})
+	}
+}
+
+func testStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	// Sources: create, unique link, update, list with filters
+	golang := Source{Link: "https://go.dev/blog/feed.atom", Provider: "go.dev", Category: "engineering"}
+	require.NoError(t, store.CreateSource(ctx, &golang))
+	require.NotZero(t, golang.ID)
+
+	news := Source{Link: "https://example.com/news.xml", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &news))
+
+	duplicate := Source{Link: golang.Link, Provider: "other", Category: "other"}
+	require.ErrorIs(t, store.CreateSource(ctx, &duplicate), ErrDuplicate)
+
+	news.Provider = "example.org"
+	require.NoError(t, store.UpdateSource(ctx, &news))
+
+	got, err := store.GetSource(ctx, news.ID)
+	require.NoError(t, err)
+	require.Equal(t, "example.org", got.Provider)
+
+	sources, err := store.ListSources(ctx, SourceFilter{Category: "engineering"})
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	require.Equal(t, golang.ID, sources[0].ID)
+	require.Equal(t, SourceTypeRSS, sources[0].Type)
+
+	// The selectors of HTML sources are stored along with them
+	page := Source{Link: "https://example.com/blog", Type: SourceTypeHTML, HTML: &HTMLSelectors{Item: "article", Title: "h2"}}
+	require.NoError(t, store.CreateSource(ctx, &page))
+	got, err = store.GetSource(ctx, page.ID)
+	require.NoError(t, err)
+	require.Equal(t, SourceTypeHTML, got.Type)
+	require.Equal(t, HTMLSelectors{Item: "article", Title: "h2"}, *got.HTML)
+	require.NoError(t, store.PurgeSource(ctx, page.ID))
+
+	// So are the request and mapping of JSON sources
+	settings := JSONSource{
+		Request: JSONRequest{Headers: map[string]string{"X-Api-Version": "2"}},
+		Mapping: JSONMapping{Items: "data.posts", Title: "title", URL: "url"},
+	}
+	fetch := FetchSettings{
+		Headers:    map[string]string{"X-Tenant": "news"},
+		Auth:       FetchAuthBasic,
+		Username:   "reader",
+		Credential: "v1:sealed",
+		Timeout:    45 * time.Second,
+	}
+	api := Source{Link: "https://api.example.com/posts", Type: SourceTypeJSON, JSON: &settings, Fetch: &fetch}
+	require.NoError(t, store.CreateSource(ctx, &api))
+	got, err = store.GetSource(ctx, api.ID)
+	require.NoError(t, err)
+	require.Equal(t, SourceTypeJSON, got.Type)
+	require.Equal(t, settings, *got.JSON)
+	require.Equal(t, fetch, *got.Fetch)
+	require.Nil(t, got.HTML)
+	require.NoError(t, store.PurgeSource(ctx, api.ID))
+
+	// The last fetch is only recorded by SetSourceFetched, updates keep it
+	fetchedAt := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, store.SetSourceFetched(ctx, news.ID, fetchedAt))
+	require.ErrorIs(t, store.SetSourceFetched(ctx, 9999, fetchedAt), ErrNotFound)
+
+	stale := news
+	stale.Category = "world"
+	require.NoError(t, store.UpdateSource(ctx, &stale))
+	got, err = store.GetSource(ctx, news.ID)
+	require.NoError(t, err)
+	require.Equal(t, "world", got.Category)
+	require.NotNil(t, got.FetchedAt)
+	require.True(t, fetchedAt.Equal(*got.FetchedAt))
+
+	sources, err = store.ListSources(ctx, SourceFilter{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	require.Equal(t, news.ID, sources[0].ID)
+
+	// Articles: upsert skips known URLs and reports only new rows
+	inserted, err := store.UpsertArticles(ctx, []Article{
+		{SourceID: golang.ID, Title: "Go 1.24 is released", Url: "https://go.dev/blog/go1.24"},
+		{SourceID: golang.ID, Title: "Range over function types", Url: "https://go.dev/blog/range-functions"},
+		{SourceID: news.ID, Title: "Local elections results", Url: "https://example.com/elections"},
+	})
+	require.NoError(t, err)
+	require.Len(t, inserted, 3)
+	for _, article := range inserted {
+		require.NotZero(t, article.ID)
+	}
+
+	inserted, err = store.UpsertArticles(ctx, []Article{
+		{SourceID: golang.ID, Title: "Go 1.24 is released", Url: "https://go.dev/blog/go1.24"},
+		{SourceID: golang.ID, Title: "Go 1.25 is released", Url: "https://go.dev/blog/go1.25"},
+	})
+	require.NoError(t, err)
+	require.Len(t, inserted, 1)
+	require.Equal(t, "https://go.dev/blog/go1.25", inserted[0].Url)
+
+	article, err := store.GetArticle(ctx, inserted[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, "engineering", article.Source.Category)
+
+	testCases := []struct {
+		name   string
+		filter ArticleFilter
+		count  int
+	}{
+		{name: "All", filter: ArticleFilter{}, count: 4},
+		{name: "BySource", filter: ArticleFilter{SourceID: news.ID}, count: 1},
+		{name: "ByCategory", filter: ArticleFilter{Category: "engineering"}, count: 3},
+		{name: "Paginated", filter: ArticleFilter{Limit: 3, Offset: 3}, count: 1},
+		{name: "Search", filter: ArticleFilter{Search: "released"}, count: 2},
+		{name: "SearchAllTerms", filter: ArticleFilter{Search: "go 1.25"}, count: 1},
+		{name: "SearchSyntaxCharacters", filter: ArticleFilter{Search: `"elections" OR*`}, count: 0},
+		{name: "SearchWithCategory", filter: ArticleFilter{Search: "results", Category: "engineering"}, count: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			articles, err := store.ListArticles(ctx, tc.filter)
+			require.NoError(t, err)
+			require.Len(t, articles, tc.count)
+		})
+	}
+
+	// Updating the title is reflected in search
+	article.Title = "Go 1.25 is out"
+	require.NoError(t, store.UpdateArticle(ctx, &article))
+	articles, err := store.ListArticles(ctx, ArticleFilter{Search: "released"})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+
+	// Deletes
+	require.NoError(t, store.DeleteArticle(ctx, article.ID))
+	_, err = store.GetArticle(ctx, article.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.DeleteSource(ctx, news.ID))
+	_, err = store.GetSource(ctx, news.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, store.DeleteSource(ctx, news.ID), ErrNotFound)
+}
+
+func testRetentionStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	source := Source{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// Articles created 0 to 5 days ago, the oldest one is starred and the next one
+	// deleted, which expires all the same
+	var deleted uint
+	for day := range 6 {
+		inserted, err := store.UpsertArticles(ctx, []Article{
+			{SourceID: source.ID, Title: fmt.Sprintf("Day %d", day), Url: fmt.Sprintf("https://example.com/%d", day)},
+		})
+		require.NoError(t, err)
+
+		article := inserted[0]
+		article.CreatedAt = time.Now().AddDate(0, 0, -day)
+		article.Starred = day == 5
+		require.NoError(t, store.UpdateArticle(ctx, &article))
+		if day == 4 {
+			deleted = article.ID
+		}
+	}
+	require.NoError(t, store.DeleteArticle(ctx, deleted))
+
+	testCases := []struct {
+		name     string
+		cutoff   time.Time
+		keepLast int
+		titles   []string
+	}{
+		{name: "NoRule", titles: []string{}},
+		{name: "Cutoff", cutoff: time.Now().AddDate(0, 0, -3).Add(time.Minute), titles: []string{"Day 4", "Day 3"}},
+		{name: "KeepLast", keepLast: 4, titles: []string{"Day 4"}},
+		{name: "Both", cutoff: time.Now().AddDate(0, 0, -4).Add(time.Minute), keepLast: 2, titles: []string{"Day 4", "Day 3", "Day 2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expired, err := store.ExpiredArticles(ctx, source.ID, tc.cutoff, tc.keepLast)
+			require.NoError(t, err)
+
+			titles := make([]string, len(expired))
+			for i, article := range expired {
+				titles[i] = article.Title
+			}
+			require.Equal(t, tc.titles, titles)
+		})
+	}
+
+	// Purge is permanent, the feeds still listing the articles do not store them again
+	expired, err := store.ExpiredArticles(ctx, source.ID, time.Time{}, 1)
+	require.NoError(t, err)
+	require.Len(t, expired, 4)
+
+	ids := []uint{expired[0].ID, expired[1].ID}
+	purged, err := store.PurgeArticles(ctx, ids)
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+
+	inserted, err := store.UpsertArticles(ctx, []Article{{SourceID: source.ID, Title: "Again", Url: expired[0].Url}})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	changes, err := store.SaveArticles(ctx, []Article{{SourceID: source.ID, Title: "Again", Url: expired[1].Url + "?utm_source=rss"}}, noEvents)
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+
+	known, err := store.KnownURLs(ctx, []string{expired[0].Url, expired[1].Url})
+	require.NoError(t, err)
+	require.Len(t, known, 2)
+
+	// Runs are listed most recent first
+	for i := range 3 {
+		require.NoError(t, store.CreateRetentionRun(ctx, &RetentionRun{Deleted: i}))
+	}
+
+	runs, err := store.ListRetentionRuns(ctx, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, 2, runs[0].Deleted)
+	require.Equal(t, 1, runs[1].Deleted)
+}
+
+func testSourceLifecycle(t *testing.T, store store) {
+	ctx := context.Background()
+
+	source := Source{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	inserted, err := store.UpsertArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "First", Url: "https://example.com/1"},
+		{SourceID: source.ID, Title: "Second", Url: "https://example.com/2"},
+		{SourceID: source.ID, Title: "Third", Url: "https://example.com/3"},
+	})
+	require.NoError(t, err)
+
+	// An article deleted on its own stays deleted after restore
+	require.NoError(t, store.DeleteArticle(ctx, inserted[0].ID))
+	time.Sleep(10 * time.Millisecond)
+
+	// Deleting the source hides its articles
+	require.NoError(t, store.DeleteSource(ctx, source.ID))
+	articles, err := store.ListArticles(ctx, ArticleFilter{})
+	require.NoError(t, err)
+	require.Empty(t, articles)
+
+	deleted, err := store.ListSources(ctx, SourceFilter{Deleted: true})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.True(t, deleted[0].DeletedAt.Valid)
+
+	active, err := store.ListSources(ctx, SourceFilter{})
+	require.NoError(t, err)
+	require.Empty(t, active)
+
+	// Restore brings back the source and the articles deleted with it
+	restored, err := store.RestoreSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.False(t, restored.DeletedAt.Valid)
+
+	articles, err = store.ListArticles(ctx, ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, 2)
+
+	_, err = store.RestoreSource(ctx, source.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// The link of a deleted source can be reused, which then blocks the restore
+	require.NoError(t, store.DeleteSource(ctx, source.ID))
+	recreated := Source{Link: source.Link, Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &recreated))
+
+	_, err = store.RestoreSource(ctx, source.ID)
+	require.ErrorIs(t, err, ErrDuplicate)
+
+	// Purge removes the deleted source for good, with its articles and policies
+	require.NoError(t, store.CreateRetentionPolicy(ctx, &RetentionPolicy{SourceID: &source.ID, KeepLast: 1}))
+	require.NoError(t, store.PurgeSource(ctx, source.ID))
+	require.ErrorIs(t, store.PurgeSource(ctx, source.ID), ErrNotFound)
+
+	deleted, err = store.ListSources(ctx, SourceFilter{Deleted: true})
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	policies, err := store.ListRetentionPolicies(ctx)
+	require.NoError(t, err)
+	require.Empty(t, policies)
+
+	// The purged URLs are free again
+	inserted, err = store.UpsertArticles(ctx, []Article{{SourceID: recreated.ID, Title: "First", Url: "https://example.com/1"}})
+	require.NoError(t, err)
+	require.Len(t, inserted, 1)
+}
+
+func testAPIKeyStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	reader := APIKey{Name: "reader", Prefix: "nak_aaa", Hash: "hash-a", Role: RoleReader}
+	require.NoError(t, store.CreateAPIKey(ctx, &reader))
+	admin := APIKey{Name: "admin", Prefix: "nak_bbb", Hash: "hash-b", Role: RoleAdmin}
+	require.NoError(t, store.CreateAPIKey(ctx, &admin))
+
+	duplicate := APIKey{Name: "other", Hash: "hash-a", Role: RoleEditor}
+	require.ErrorIs(t, store.CreateAPIKey(ctx, &duplicate), ErrDuplicate)
+
+	got, err := store.GetAPIKeyByHash(ctx, "hash-b")
+	require.NoError(t, err)
+	require.Equal(t, admin.ID, got.ID)
+	require.Equal(t, RoleAdmin, got.Role)
+
+	// Revoked keys can't be found nor listed
+	require.NoError(t, store.RevokeAPIKey(ctx, reader.ID))
+	require.ErrorIs(t, store.RevokeAPIKey(ctx, reader.ID), ErrNotFound)
+
+	_, err = store.GetAPIKeyByHash(ctx, "hash-a")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	keys, err := store.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, admin.ID, keys[0].ID)
+}
+
+func testLeaseStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	// Free lease
+	acquired, err := store.AcquireLease(ctx, "scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// Held by another holder, renewed by its holder
+	acquired, err = store.AcquireLease(ctx, "scheduler", "b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	acquired, err = store.AcquireLease(ctx, "scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// Leases are independent
+	acquired, err = store.AcquireLease(ctx, "source:1", "b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// Only the holder can release it
+	require.NoError(t, store.ReleaseLease(ctx, "scheduler", "b"))
+	acquired, err = store.AcquireLease(ctx, "scheduler", "b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	require.NoError(t, store.ReleaseLease(ctx, "scheduler", "a"))
+	acquired, err = store.AcquireLease(ctx, "scheduler", "b", 10*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// Expired leases are taken over
+	time.Sleep(20 * time.Millisecond)
+	acquired, err = store.AcquireLease(ctx, "scheduler", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+}
+
+func testWebhookStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	webhook := Webhook{URL: "http://localhost/hook", Secret: "secret", Category: "news"}
+	require.NoError(t, store.CreateWebhook(ctx, &webhook))
+	require.NotZero(t, webhook.ID)
+
+	got, err := store.GetWebhook(ctx, webhook.ID)
+	require.NoError(t, err)
+	require.Equal(t, "secret", got.Secret)
+	require.Equal(t, "news", got.Category)
+
+	// Deliveries, one due and one later
+	now := time.Now().UTC()
+	deliveries := []WebhookDelivery{
+		{WebhookID: webhook.ID, Event: "article.created", Payload: "{}", Status: DeliveryPending, NextAttemptAt: now.Add(-time.Second)},
+		{WebhookID: webhook.ID, Event: "article.created", Payload: "{}", Status: DeliveryPending, NextAttemptAt: now.Add(time.Hour)},
+	}
+	require.NoError(t, store.CreateDeliveries(ctx, deliveries))
+	require.NotZero(t, deliveries[0].ID)
+	require.NotZero(t, deliveries[1].ID)
+
+	due, err := store.DueDeliveries(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, deliveries[0].ID, due[0].ID)
+
+	// Delivered, no longer due
+	delivered := due[0]
+	delivered.Status = DeliverySucceeded
+	delivered.Attempts = 1
+	delivered.StatusCode = 200
+	delivered.DeliveredAt = &now
+	require.NoError(t, store.UpdateDelivery(ctx, &delivered))
+
+	due, err = store.DueDeliveries(ctx, now.Add(2*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, deliveries[1].ID, due[0].ID)
+
+	got2, err := store.GetDelivery(ctx, delivered.ID)
+	require.NoError(t, err)
+	require.Equal(t, DeliverySucceeded, got2.Status)
+	require.Equal(t, 200, got2.StatusCode)
+
+	// Most recent first
+	listed, err := store.ListDeliveries(ctx, webhook.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	require.Equal(t, deliveries[1].ID, listed[0].ID)
+
+	// Deleted webhooks are gone, their deliveries stay
+	require.NoError(t, store.DeleteWebhook(ctx, webhook.ID))
+	require.ErrorIs(t, store.DeleteWebhook(ctx, webhook.ID), ErrNotFound)
+	_, err = store.GetWebhook(ctx, webhook.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	webhooks, err := store.ListWebhooks(ctx)
+	require.NoError(t, err)
+	require.Empty(t, webhooks)
+
+	listed, err = store.ListDeliveries(ctx, webhook.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+}
+
+func testOutboxStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	source := Source{Link: "https://example.com/rss", Provider: "example", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	other := Source{Link: "https://other.com/rss", Provider: "other", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &other))
+
+	// Helper function: one event per inserted and updated article
+	events := func(changes ArticleChanges) ([]OutboxEvent, error) {
+		records := make([]OutboxEvent, 0)
+		for _, article := range changes.Inserted {
+			records = append(records, OutboxEvent{Type: "article.created", Payload: fmt.Sprintf(`{"id":%d}`, article.ID)})
+		}
+		for _, article := range changes.Updated {
+			records = append(records, OutboxEvent{Type: "article.updated", Payload: fmt.Sprintf(`{"id":%d}`, article.ID)})
+		}
+		return records, nil
+	}
+
+	changes, err := store.SaveArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "First", Url: "https://example.com/1"},
+		{SourceID: source.ID, Title: "Second", Url: "https://example.com/2"},
+	}, events)
+	require.NoError(t, err)
+	require.Len(t, changes.Inserted, 2)
+	require.Empty(t, changes.Updated)
+	require.Len(t, changes.Events, 2)
+	require.NotZero(t, changes.Inserted[0].ID)
+	require.NotZero(t, changes.Events[0].ID)
+
+	// Unchanged articles are skipped, changed ones updated, other sources' ones linked
+	changes, err = store.SaveArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "First", Url: "https://example.com/1"},
+		{SourceID: source.ID, Title: "Second, edited", Url: "https://example.com/2"},
+		{SourceID: other.ID, Title: "Stolen", Url: "https://example.com/1"},
+	}, events)
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+	require.Len(t, changes.Updated, 1)
+	require.Len(t, changes.Linked, 1)
+	require.Equal(t, "First", changes.Linked[0].Title)
+	require.Equal(t, "Second, edited", changes.Updated[0].Title)
+	require.Equal(t, "article.updated", changes.Events[0].Type)
+
+	updated, err := store.GetArticle(ctx, changes.Updated[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, "Second, edited", updated.Title)
+
+	// Nothing is stored when the events can't be built
+	_, err = store.SaveArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "Third", Url: "https://example.com/3"},
+	}, func(changes ArticleChanges) ([]OutboxEvent, error) {
+		return nil, fmt.Errorf("boom")
+	})
+	require.Error(t, err)
+	articles, err := store.ListArticles(ctx, ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, 2)
+
+	// Events without articles
+	run := []OutboxEvent{{Type: "run.completed", Payload: "{}"}}
+	require.NoError(t, store.CreateEvents(ctx, run))
+	require.NotZero(t, run[0].ID)
+
+	// Only the events created before the given time are pending
+	pending, err := store.PendingEvents(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	pending, err = store.PendingEvents(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 4)
+	require.Equal(t, "article.created", pending[0].Type)
+	require.Equal(t, run[0].ID, pending[3].ID)
+
+	// Published events are no longer pending, then purged
+	published := time.Now()
+	pending[0].PublishedAt = &published
+	require.NoError(t, store.UpdateEvent(ctx, &pending[0]))
+	pending[1].Attempts = 1
+	pending[1].Error = "handler failed"
+	require.NoError(t, store.UpdateEvent(ctx, &pending[1]))
+
+	left, err := store.PendingEvents(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, left, 3)
+	require.Equal(t, 1, left[0].Attempts)
+
+	purged, err := store.PurgeEvents(ctx, published.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, purged)
+
+	purged, err = store.PurgeEvents(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+
+	// Events loaded by ID or after another one, published or not
+	loaded, err := store.GetEvents(ctx, []uint{run[0].ID, pending[1].ID, 9999})
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	require.Equal(t, pending[1].ID, loaded[0].ID)
+	require.Equal(t, run[0].ID, loaded[1].ID)
+
+	after, err := store.EventsAfter(ctx, pending[1].ID, 10)
+	require.NoError(t, err)
+	require.Len(t, after, 2)
+	require.Equal(t, run[0].ID, after[1].ID)
+
+	after, err = store.EventsAfter(ctx, pending[1].ID, 1)
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+
+	last, err := store.LastEventID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, run[0].ID, last)
+}
+
+func testWebSubStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	feed := Source{Link: "https://example.com/feed.xml", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &feed))
+
+	_, err := store.GetSourceSubscription(ctx, feed.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// One subscription per source
+	subscription := WebSubSubscription{
+		SourceID:      feed.ID,
+		Hub:           "https://hub.example.com/",
+		Topic:         feed.Link,
+		Secret:        "secret",
+		Status:        WebSubPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	require.NoError(t, store.SaveSubscription(ctx, &subscription))
+	require.NotZero(t, subscription.ID)
+
+	duplicate := WebSubSubscription{SourceID: feed.ID, Hub: "https://other.example.com/", Status: WebSubPending}
+	require.ErrorIs(t, store.SaveSubscription(ctx, &duplicate), ErrDuplicate)
+
+	// Verified by the hub
+	expiresAt := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	subscription.Status = WebSubActive
+	subscription.ExpiresAt = &expiresAt
+	require.NoError(t, store.SaveSubscription(ctx, &subscription))
+
+	got, err := store.GetSourceSubscription(ctx, feed.ID)
+	require.NoError(t, err)
+	require.Equal(t, subscription.ID, got.ID)
+	require.Equal(t, WebSubActive, got.Status)
+	require.Equal(t, "secret", got.Secret)
+	require.True(t, expiresAt.Equal(*got.ExpiresAt))
+
+	subscriptions, err := store.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+
+	// Gone with its source
+	require.NoError(t, store.PurgeSource(ctx, feed.ID))
+	_, err = store.GetSubscription(ctx, subscription.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, store.DeleteSubscription(ctx, subscription.ID), ErrNotFound)
+}
+
+func testBackfillStore(t *testing.T, store store) {
+	ctx := context.Background()
+
+	feed := Source{Link: "https://example.com/feed.xml", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &feed))
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := Backfill{SourceID: feed.ID, Status: BackfillPending, MaxPages: 5, Since: &since, NextAttemptAt: time.Now().UTC()}
+	require.NoError(t, store.SaveBackfill(ctx, &first))
+	require.NotZero(t, first.ID)
+
+	// Progress saved after a page
+	first.Paging = PagingArchive
+	first.NextURL = "https://example.com/archive/2025-01.xml"
+	first.Pages = 1
+	first.NewArticles = 12
+	require.NoError(t, store.SaveBackfill(ctx, &first))
+
+	got, err := store.GetBackfill(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, PagingArchive, got.Paging)
+	require.Equal(t, first.NextURL, got.NextURL)
+	require.Equal(t, 12, got.NewArticles)
+	require.True(t, since.Equal(*got.Since))
+
+	second := Backfill{SourceID: feed.ID, Status: BackfillPending, MaxPages: 5}
+	require.NoError(t, store.SaveBackfill(ctx, &second))
+
+	pending, err := store.PendingBackfills(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, first.ID, pending[0].ID)
+
+	// Finished backfills are no longer pending
+	finishedAt := time.Now().UTC()
+	first.Status = BackfillSucceeded
+	first.FinishedAt = &finishedAt
+	require.NoError(t, store.SaveBackfill(ctx, &first))
+
+	pending, err = store.PendingBackfills(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, second.ID, pending[0].ID)
+
+	backfills, err := store.ListBackfills(ctx, feed.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, backfills, 2)
+	require.Equal(t, second.ID, backfills[0].ID)
+
+	backfills, err = store.ListBackfills(ctx, feed.ID, 10, 1)
+	require.NoError(t, err)
+	require.Len(t, backfills, 1)
+
+	// Gone with its source
+	require.NoError(t, store.PurgeSource(ctx, feed.ID))
+	_, err = store.GetBackfill(ctx, first.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func testDuplicateArticles(t *testing.T, store store) {
+	ctx := context.Background()
+
+	source := Source{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	other := Source{Link: "https://feeds.other.com/rss", Provider: "other.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &other))
+
+	inserted, err := store.UpsertArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "Story", Url: "https://example.com/story?utm_source=rss"},
+	})
+	require.NoError(t, err)
+	require.Len(t, inserted, 1)
+	require.Equal(t, "https://example.com/story", *inserted[0].DedupeKey)
+	require.Nil(t, inserted[0].CanonicalURL)
+	story := inserted[0]
+
+	// The same article under another URL is linked to the other source instead
+	inserted, err = store.UpsertArticles(ctx, []Article{
+		{SourceID: other.ID, Title: "Story", Url: "http://example.com/story/"},
+		{SourceID: other.ID, Title: "Story again", Url: "https://example.com/story#top"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	article, err := store.GetArticle(ctx, story.ID)
+	require.NoError(t, err)
+	require.Equal(t, source.ID, article.SourceID)
+	require.Len(t, article.Sources, 1)
+	require.Equal(t, other.ID, article.Sources[0].SourceID)
+	require.Equal(t, "http://example.com/story/", article.Sources[0].Url)
+
+	// A canonical URL resolved by the scraper, such as the link behind a redirect wrapper,
+	// is kept as given
+	canonical := "http://example.com/scoop"
+	changes, err := store.SaveArticles(ctx, []Article{
+		{SourceID: source.ID, Title: "Scoop", Url: "https://example.com/scoop?id=1", CanonicalURL: &canonical},
+	}, noEvents)
+	require.NoError(t, err)
+	require.Len(t, changes.Inserted, 1)
+
+	scoop, err := store.GetArticle(ctx, changes.Inserted[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, canonical, *scoop.CanonicalURL)
+	require.Equal(t, "https://example.com/scoop", *scoop.DedupeKey)
+
+	resolved := "https://example.com/scoop/"
+	changes, err = store.SaveArticles(ctx, []Article{
+		{SourceID: other.ID, Title: "Scoop", Url: "https://feeds.other.com/~r/scoop", CanonicalURL: &resolved},
+		{SourceID: other.ID, Title: "Scoop", Url: "https://feeds.other.com/~r/scoop?utm_source=feed", CanonicalURL: &resolved},
+	}, noEvents)
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+	require.Len(t, changes.Linked, 1)
+	require.Equal(t, "Scoop", changes.Linked[0].Title)
+
+	// The articles of a source include the ones it carried
+	articles, err := store.ListArticles(ctx, ArticleFilter{SourceID: other.ID})
+	require.NoError(t, err)
+	require.Len(t, articles, 2)
+
+	known, err := store.KnownURLs(ctx, []string{"https://example.com/story?utm_source=rss", "https://example.com/scoop", "https://example.com/new"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"https://example.com/story?utm_source=rss": true, "https://example.com/scoop": true}, known)
+
+	duplicate := Article{SourceID: other.ID, Title: "Story", Url: "https://EXAMPLE.com/story?fbclid=x"}
+	require.ErrorIs(t, store.CreateArticle(ctx, &duplicate), ErrDuplicate)
+
+	// The links go with the source, or with the article
+	require.NoError(t, store.PurgeSource(ctx, other.ID))
+	article, err = store.GetArticle(ctx, story.ID)
+	require.NoError(t, err)
+	require.Empty(t, article.Sources)
+
+	// A purged article is not stored again, until its source is purged too
+	_, err = store.PurgeArticles(ctx, []uint{story.ID})
+	require.NoError(t, err)
+	inserted, err = store.UpsertArticles(ctx, []Article{{SourceID: source.ID, Title: "Story", Url: "https://example.com/story"}})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	require.NoError(t, store.PurgeSource(ctx, source.ID))
+	recreated := Source{Link: source.Link, Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &recreated))
+	inserted, err = store.UpsertArticles(ctx, []Article{{SourceID: recreated.ID, Title: "Story", Url: "https://example.com/story"}})
+	require.NoError(t, err)
+	require.Len(t, inserted, 1)
+
+	// Deleting a source moves the articles another source carries to that source
+	first := Source{Link: "https://first.com/rss", Provider: "first.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &first))
+	second := Source{Link: "https://second.com/rss", Provider: "second.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &second))
+
+	inserted, err = store.UpsertArticles(ctx, []Article{
+		{SourceID: first.ID, Title: "Shared", Url: "https://wire.com/shared"},
+		{SourceID: first.ID, Title: "Own", Url: "https://first.com/own"},
+	})
+	require.NoError(t, err)
+	require.Len(t, inserted, 2)
+	shared, own := inserted[0], inserted[1]
+
+	inserted, err = store.UpsertArticles(ctx, []Article{{SourceID: second.ID, Title: "Shared", Url: "https://wire.com/shared?utm_source=second"}})
+	require.NoError(t, err)
+	require.Empty(t, inserted)
+
+	require.NoError(t, store.DeleteSource(ctx, first.ID))
+	article, err = store.GetArticle(ctx, shared.ID)
+	require.NoError(t, err)
+	require.Equal(t, second.ID, article.SourceID)
+	require.Equal(t, "https://wire.com/shared?utm_source=second", article.Url)
+	require.Empty(t, article.Sources)
+
+	_, err = store.GetArticle(ctx, own.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	articles, err = store.ListArticles(ctx, ArticleFilter{SourceID: second.ID})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+
+	// The next scrape of the remaining source updates the article, instead of skipping it
+	changes, err = store.SaveArticles(ctx, []Article{
+		{SourceID: second.ID, Title: "Shared (updated)", Url: "https://wire.com/shared?utm_source=second"},
+	}, noEvents)
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+	require.Len(t, changes.Updated, 1)
+	require.Equal(t, shared.ID, changes.Updated[0].ID)
+
+	// The restored source only gets back its own articles, and carries the shared one again
+	_, err = store.RestoreSource(ctx, first.ID)
+	require.NoError(t, err)
+	_, err = store.GetArticle(ctx, own.ID)
+	require.NoError(t, err)
+
+	changes, err = store.SaveArticles(ctx, []Article{
+		{SourceID: first.ID, Title: "Shared (updated)", Url: "https://wire.com/shared"},
+	}, noEvents)
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+	require.Len(t, changes.Linked, 1)
+}
+
+// Helper function: no events for the saved articles
+func noEvents(changes ArticleChanges) ([]OutboxEvent, error) {
+	return nil, nil
+}
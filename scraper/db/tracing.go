@@ -0,0 +1,84 @@
+package db
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Name of the tracer of the database spans
+const tracerName = "github.com/danglnh07/newsaggr/scraper/db"
+
+// Key of the current span in the GORM statement settings
+const spanSettingKey = "otel:span"
+
+// GORM plugin creating a span for every query, child of the span in the context
+// given to WithContext. Spans are no-ops while tracing is disabled.
+type tracingPlugin struct {
+	system string
+}
+
+// Name of the plugin
+func (plugin *tracingPlugin) Name() string {
+	return "otel-tracing"
+}
+
+// Register the callbacks around every kind of query
+func (plugin *tracingPlugin) Initialize(conn *gorm.DB) error {
+	callbacks := conn.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("otel:before_create", plugin.start("create")),
+		callbacks.Create().After("gorm:create").Register("otel:after_create", plugin.end),
+		callbacks.Query().Before("gorm:query").Register("otel:before_query", plugin.start("query")),
+		callbacks.Query().After("gorm:query").Register("otel:after_query", plugin.end),
+		callbacks.Update().Before("gorm:update").Register("otel:before_update", plugin.start("update")),
+		callbacks.Update().After("gorm:update").Register("otel:after_update", plugin.end),
+		callbacks.Delete().Before("gorm:delete").Register("otel:before_delete", plugin.start("delete")),
+		callbacks.Delete().After("gorm:delete").Register("otel:after_delete", plugin.end),
+		callbacks.Row().Before("gorm:row").Register("otel:before_row", plugin.start("row")),
+		callbacks.Row().After("gorm:row").Register("otel:after_row", plugin.end),
+		callbacks.Raw().Before("gorm:raw").Register("otel:before_raw", plugin.start("raw")),
+		callbacks.Raw().After("gorm:raw").Register("otel:after_raw", plugin.end),
+	)
+}
+
+// Helper method: start the span of a query
+func (plugin *tracingPlugin) start(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		_, span := otel.Tracer(tracerName).Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system.name", plugin.system),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		tx.Statement.Settings.Store(spanSettingKey, span)
+	}
+}
+
+// Helper method: end the span of a query with its statement and outcome
+func (plugin *tracingPlugin) end(tx *gorm.DB) {
+	value, ok := tx.Statement.Settings.LoadAndDelete(spanSettingKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.collection.name", tx.Statement.Table),
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.response.returned_rows", tx.Statement.RowsAffected),
+	)
+
+	// Not finding a record is an expected outcome rather than a failure
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Test that queries create spans under the span of their context
+func TestQueryTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	store := newSQLiteStore(t)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	source := Source{Link: "https://example.com/rss", Provider: "example.com", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	_, err := store.GetSource(ctx, source.ID+1)
+	require.ErrorIs(t, err, ErrNotFound)
+	parent.End()
+
+	operations := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			operations[span.Name()] = span
+		}
+	}
+
+	require.Contains(t, operations, "gorm.create")
+	require.Contains(t, operations, "gorm.query")
+
+	// Not found is not an error
+	query := operations["gorm.query"]
+	require.Equal(t, "Unset", query.Status().Code.String())
+	for _, attr := range query.Attributes() {
+		if attr.Key == "db.query.text" {
+			require.Contains(t, attr.Value.AsString(), "sources")
+		}
+	}
+}
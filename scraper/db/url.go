@@ -0,0 +1,104 @@
+package db
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Query parameters of analytics and ad platforms, which never change the page. Every
+// utm_* parameter is stripped too.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+}
+
+// Normalize a URL for deduplication: https whatever the scheme, lowercase host without
+// default port, no trailing slash, fragment nor tracking parameters, and the remaining
+// parameters sorted. Returns an empty string for anything but an absolute http(s) URL.
+func NormalizeURL(link string) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if port := parsed.Port(); port != "" && port != "80" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+
+	normalized := "https://" + host + strings.TrimRight(parsed.EscapedPath(), "/")
+	if query := normalizeQuery(parsed.RawQuery); query != "" {
+		normalized += "?" + query
+	}
+	return normalized
+}
+
+// Helper function: strip the tracking parameters of a query and sort the others, leaving
+// a query that can't be parsed as it is
+func normalizeQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+
+	for name := range values {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			values.Del(name)
+		}
+	}
+	return values.Encode()
+}
+
+// Helper function: the key an article is deduplicated by, normalized from its canonical
+// URL if any, else from its URL. Nil when neither is an absolute http(s) URL.
+func dedupeKey(article Article) *string {
+	links := []string{article.Url}
+	if article.CanonicalURL != nil {
+		links = []string{*article.CanonicalURL, article.Url}
+	}
+
+	for _, link := range links {
+		if normalized := NormalizeURL(link); normalized != "" {
+			return &normalized
+		}
+	}
+	return nil
+}
+
+// Helper function: the URLs and dedupe keys of the purged articles, each once
+func purgedURLs(articles []Article) []PurgedURL {
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+	urls := make([]PurgedURL, 0, 2*len(articles))
+	for _, article := range articles {
+		links := []string{article.Url}
+		if article.DedupeKey != nil {
+			links = append(links, *article.DedupeKey)
+		}
+
+		for _, link := range links {
+			if !seen[link] {
+				seen[link] = true
+				urls = append(urls, PurgedURL{Url: link, SourceID: article.SourceID, CreatedAt: now})
+			}
+		}
+	}
+	return urls
+}
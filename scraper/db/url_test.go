@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test normalizing the URLs the duplicates are detected by
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"already normalized", "https://example.com/posts/1", "https://example.com/posts/1"},
+		{"http", "http://example.com/posts/1", "https://example.com/posts/1"},
+		{"case", "HTTPS://Example.COM/Posts/1", "https://example.com/Posts/1"},
+		{"default port", "http://example.com:80/posts/1", "https://example.com/posts/1"},
+		{"other port", "http://example.com:8080/posts/1", "https://example.com:8080/posts/1"},
+		{"trailing slash", "https://example.com/posts/1/", "https://example.com/posts/1"},
+		{"root", "https://example.com/", "https://example.com"},
+		{"fragment", "https://example.com/posts/1#comments", "https://example.com/posts/1"},
+		{"tracking", "https://example.com/posts/1?utm_source=rss&UTM_Medium=feed&fbclid=abc", "https://example.com/posts/1"},
+		{"sorted query", "https://example.com/posts?page=2&id=1&gclid=x", "https://example.com/posts?id=1&page=2"},
+		{"escaped path", "https://example.com/posts/caf%C3%A9/", "https://example.com/posts/caf%C3%A9"},
+		{"relative", "/posts/1", ""},
+		{"other scheme", "ftp://example.com/posts/1", ""},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, NormalizeURL(test.link))
+		})
+	}
+}
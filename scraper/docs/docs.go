@@ -42,6 +42,24 @@ const docTemplate = `{
                         "name": "page_size",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only articles from this source, or carried by it too",
+                        "name": "source_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only articles whose source has this category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Full text search on the article title",
+                        "name": "q",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -54,6 +72,18 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to list articles",
                         "schema": {
@@ -92,12 +122,24 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ArticleResponse"
                         }
                     },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Article not found",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to get article",
                         "schema": {
@@ -107,9 +149,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/sources": {
-            "get": {
-                "description": "Retrieve a paginated list of news sources",
+        "/api/articles/{id}/star": {
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Mark an article as starred, starred articles are exempt from retention",
                 "consumes": [
                     "application/json"
                 ],
@@ -117,22 +164,15 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sources"
+                    "articles"
                 ],
-                "summary": "List news sources",
+                "summary": "Star an article",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Page number",
-                        "name": "page_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Number of items per page",
-                        "name": "page_size",
-                        "in": "query",
+                        "description": "Article ID",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     }
                 ],
@@ -140,22 +180,42 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/api.SourceResponse"
-                            }
+                            "$ref": "#/definitions/api.ArticleResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Article not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to list sources",
+                        "description": "Failed to update article",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
             },
-            "post": {
-                "description": "Add a new news source to the database",
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove the star of an article, making it subject to retention again",
                 "consumes": [
                     "application/json"
                 ],
@@ -163,35 +223,45 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sources"
+                    "articles"
                 ],
-                "summary": "Create a new news source",
+                "summary": "Unstar an article",
                 "parameters": [
                     {
-                        "description": "Source details",
-                        "name": "source",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/api.CreateSourceRequest"
-                        }
+                        "type": "integer",
+                        "description": "Article ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.SourceResponse"
+                            "$ref": "#/definitions/api.ArticleResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Article not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to create source",
+                        "description": "Failed to update article",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -199,9 +269,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/sources/{id}": {
+        "/api/backfills/{id}": {
             "get": {
-                "description": "Retrieve a single news source from the database using its ID",
+                "description": "Report the progress of a backfill: the older pages fetched and the articles they added",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,13 +279,13 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sources"
+                    "backfills"
                 ],
-                "summary": "Get a news source by ID",
+                "summary": "Get a backfill",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Source ID",
+                        "description": "Backfill ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -225,25 +295,39 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.SourceResponse"
+                            "$ref": "#/definitions/api.BackfillResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "Source not found",
+                        "description": "Backfill not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to get source",
+                        "description": "Failed to get backfill",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update details of an existing news source by ID",
+            }
+        },
+        "/api/jobs/{id}": {
+            "get": {
+                "description": "Report the progress of a scraping job, with the result of each scraped source. Finished jobs are kept for an hour.",
                 "consumes": [
                     "application/json"
                 ],
@@ -251,32 +335,127 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sources"
+                    "jobs"
                 ],
-                "summary": "Update a news source",
+                "summary": "Get a scraping job",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Source ID",
+                        "type": "string",
+                        "description": "Job ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.JobResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Job not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
                     },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/keys": {
+            "get": {
+                "security": [
                     {
-                        "description": "Updated source details",
-                        "name": "source",
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve every active API key, without their values",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "keys"
+                ],
+                "summary": "List API keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.APIKeyResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list API keys",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Generate a new API key. Its value is only returned in this response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "keys"
+                ],
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "description": "Key details",
+                        "name": "key",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.UpdateSourceRequest"
+                            "$ref": "#/definitions/api.CreateAPIKeyRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/api.SourceResponse"
+                            "$ref": "#/definitions/api.APIKeyResponse"
                         }
                     },
                     "400": {
@@ -285,22 +464,41 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Source not found",
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to update source",
+                        "description": "Failed to create API key",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/keys/{id}": {
             "delete": {
-                "description": "Remove an existing news source by ID",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Revoke an API key by ID, requests using it are rejected from now on",
                 "consumes": [
                     "application/json"
                 ],
@@ -308,13 +506,13 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sources"
+                    "keys"
                 ],
-                "summary": "Delete a news source",
+                "summary": "Revoke an API key",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Source ID",
+                        "description": "API key ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -324,32 +522,2236 @@ const docTemplate = `{
                     "204": {
                         "description": "No Content"
                     },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "404": {
-                        "description": "Source not found",
+                        "description": "API key not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to delete source",
+                        "description": "Failed to revoke API key",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.ArticleResponse": {
+        },
+        "/api/retention/policies": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve every retention policy",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "retention"
+                ],
+                "summary": "List retention policies",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.RetentionPolicyResponse"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list retention policies",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a retention policy for a source, a category or every source",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "retention"
+                ],
+                "summary": "Create a retention policy",
+                "parameters": [
+                    {
+                        "description": "Policy details",
+                        "name": "policy",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateRetentionPolicyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.RetentionPolicyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to create retention policy",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/retention/policies/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Remove an existing retention policy by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "retention"
+                ],
+                "summary": "Delete a retention policy",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Policy ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Retention policy not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete retention policy",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/retention/runs": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve a paginated history of retention runs with what each one purged, most recent first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "retention"
+                ],
+                "summary": "List retention runs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "page_size",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.RetentionRunResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list retention runs",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/scrape": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Enqueue an immediate scrape of every source. If one is already in progress, that job is returned instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "Scrape every news source now",
+                "responses": {
+                    "200": {
+                        "description": "Job already in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.JobResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Job enqueued",
+                        "schema": {
+                            "$ref": "#/definitions/api.JobResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to enqueue scraping job",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources": {
+            "get": {
+                "description": "Retrieve a paginated list of news sources, or of the deleted ones",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "List news sources",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "page_size",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only sources from this provider",
+                        "name": "provider",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only sources of this category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "List deleted sources instead of active ones",
+                        "name": "deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.SourceResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list sources",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Add a new news source to the database. HTML sources need the CSS selectors of their articles,\nJSON sources the gjson paths of their fields.\nSitemap sources can fill the title and image of their entries from the metadata of their pages,\nwhich is required if their entries have no news:title.\nEvery type accepts fetch settings, whose headers and credentials are encrypted and never returned.\nThe history of feed sources is backfilled once added if asked, or if backfill.on_create is set.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Create a new news source",
+                "parameters": [
+                    {
+                        "description": "Source details",
+                        "name": "source",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateSourceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.SourceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, selectors or fetch settings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Source link already exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to create source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Failed to check the sitemap",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/preview": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Scrape the live page or feed with the given settings, e.g. to test the CSS selectors of an\nHTML source or the mapping of a JSON source before saving it. Nothing is stored, so the\nheaders and credentials are not encrypted and need no credential key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Preview the articles of a news source",
+                "parameters": [
+                    {
+                        "description": "Source settings",
+                        "name": "source",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.PreviewSourceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.PreviewArticleResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, selectors or fetch settings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Failed to scrape the source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/{id}": {
+            "get": {
+                "description": "Retrieve a single news source from the database using its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Get a news source by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.SourceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Update details of an existing news source by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Update a news source",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated source details",
+                        "name": "source",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.UpdateSourceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.SourceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body, selectors or fetch settings",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Source link already exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to update source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Failed to check the sitemap",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Soft delete a news source by ID, hiding its articles with it. With purge=true,\npermanently remove the source (deleted or not), its articles and retention policies.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Delete a news source",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Permanently delete the source and its articles",
+                        "name": "purge",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/{id}/backfill": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Enqueue a backfill of the older items of a feed source, following the RFC 5005 prev-archive or next links of its feed,\nor else the ?paged=N pages of WordPress feeds. It stops after max_pages older pages (at most the configured maximum),\nat the first item published before since, or at the oldest page. If one is already in progress, that backfill is returned instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "backfills"
+                ],
+                "summary": "Backfill the history of a feed source",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Depth of the backfill",
+                        "name": "backfill",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/api.BackfillRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Backfill already in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.BackfillResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Backfill enqueued",
+                        "schema": {
+                            "$ref": "#/definitions/api.BackfillResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter or request body, or not a feed source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to enqueue backfill",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/{id}/backfills": {
+            "get": {
+                "description": "Retrieve a paginated list of the backfills of a source, most recent first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "backfills"
+                ],
+                "summary": "List the backfills of a source",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "page_size",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.BackfillResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id or query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list backfills",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Undo the deletion of a news source, bringing back the articles deleted with it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sources"
+                ],
+                "summary": "Restore a deleted news source",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.SourceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Deleted source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Source link already exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to restore source",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sources/{id}/scrape": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Enqueue an immediate scrape of a source. If one is already in progress, that job is returned instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "Scrape a news source now",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Source ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Job already in progress",
+                        "schema": {
+                            "$ref": "#/definitions/api.JobResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Job enqueued",
+                        "schema": {
+                            "$ref": "#/definitions/api.JobResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to enqueue scraping job",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/stream/articles": {
+            "get": {
+                "description": "Push the new articles as they are scraped, as server-sent events named \"article\" carrying an ArticleResponse, their ID being the event ID.\nA comment is sent as heartbeat while the stream is idle. A client reconnecting with Last-Event-ID gets the articles it missed, as long as they are still buffered.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "articles"
+                ],
+                "summary": "Stream new articles",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by source ID",
+                        "name": "source_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event, for clients that can't set headers",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ArticleResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Server is shutting down",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/stream/articles/ws": {
+            "get": {
+                "description": "Push the new articles as they are scraped, as StreamMessage JSON text messages. Pings are sent as heartbeat while the stream is idle.\nA client reconnecting with last_event_id gets the articles it missed, as long as they are still buffered.",
+                "tags": [
+                    "articles"
+                ],
+                "summary": "Stream new articles over WebSocket",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter by source ID",
+                        "name": "source_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/api.StreamMessage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Server is shutting down",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve every webhook subscription, without their secrets",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.WebhookResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list webhooks",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Subscribe a URL to the new articles matching the filters. Deliveries are signed with the secret, which is only returned here.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook details",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.WebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Source not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to create webhook",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve a single webhook subscription, without its secret",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.WebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get webhook",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Unsubscribe a webhook by ID. Its pending deliveries fail, the delivery log is kept.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete webhook",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Retrieve a paginated delivery log of a webhook, most recent first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List the deliveries of a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "page_size",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.WebhookDeliveryResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id or query parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list webhook deliveries",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}/deliveries/{delivery_id}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Queue a delivery again with a fresh set of attempts, whether it failed or succeeded",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver a webhook delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "delivery_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/api.WebhookDeliveryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Insufficient role",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook delivery not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit or daily quota exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to redeliver webhook delivery",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Report that the process is up and serving requests",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Run the readiness checks (database, scheduler, last scraping run), failing while shutting down",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.HealthResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/api.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/websub/{id}": {
+            "get": {
+                "description": "Callback of a WebSub subscription, where its hub checks the intent to subscribe or unsubscribe by expecting the challenge back, or reports that it denied the subscription",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "websub"
+                ],
+                "summary": "Verify a WebSub subscription",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "subscribe",
+                            "unsubscribe",
+                            "denied"
+                        ],
+                        "type": "string",
+                        "description": "Mode",
+                        "name": "hub.mode",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Topic of the subscription",
+                        "name": "hub.topic",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Challenge to answer, when subscribing or unsubscribing",
+                        "name": "hub.challenge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lease granted, when subscribing",
+                        "name": "hub.lease_seconds",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Why the subscription was denied",
+                        "name": "hub.reason",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The challenge",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id parameter or verification",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found or not expected",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to verify subscription",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Callback of a WebSub subscription, where its hub pushes the updated feed signed with the secret of the subscription. Content with an invalid signature is acknowledged but ignored.",
+                "consumes": [
+                    "text/xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "websub"
+                ],
+                "summary": "Receive WebSub content",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "HMAC of the body, such as sha256=\u003chex\u003e",
+                        "name": "X-Hub-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Content received"
+                    },
+                    "400": {
+                        "description": "Invalid id parameter or body",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Subscription or source gone",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to store content",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.APIKeyResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "daily_quota": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ArticleResponse": {
+            "type": "object",
+            "properties": {
+                "canonical_url": {
+                    "description": "Link the publisher gives for the article, else its URL",
+                    "type": "string"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "image": {
+                    "type": "string"
+                },
+                "published_date": {
+                    "type": "string"
+                },
+                "source_id": {
+                    "description": "Source the article was first stored from",
+                    "type": "integer"
+                },
+                "sources": {
+                    "description": "Other sources that carried the article",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ArticleSourceResponse"
+                    }
+                },
+                "starred": {
+                    "type": "boolean"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ArticleSourceResponse": {
+            "type": "object",
+            "properties": {
+                "source_id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.BackfillRequest": {
+            "type": "object",
+            "properties": {
+                "max_pages": {
+                    "description": "Older pages to fetch, at most the configured maximum",
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "since": {
+                    "description": "Leave out the items published before",
+                    "type": "string"
+                }
+            }
+        },
+        "api.BackfillResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Failed attempts of the next page",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "max_pages": {
+                    "type": "integer"
+                },
+                "new_articles": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "description": "Only while pending",
+                    "type": "string"
+                },
+                "pages": {
+                    "description": "Older pages fetched so far",
+                    "type": "integer"
+                },
+                "paging": {
+                    "description": "Empty until the feed is fetched",
+                    "type": "string",
+                    "enum": [
+                        "archive",
+                        "next",
+                        "paged"
+                    ]
+                },
+                "since": {
+                    "type": "string"
+                },
+                "source_id": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "succeeded",
+                        "failed"
+                    ]
+                }
+            }
+        },
+        "api.CreateAPIKeyRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "role"
+            ],
+            "properties": {
+                "daily_quota": {
+                    "description": "Requests allowed per UTC day, 0 uses the server default",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "reader",
+                        "editor",
+                        "admin"
+                    ]
+                }
+            }
+        },
+        "api.CreateRetentionPolicyRequest": {
+            "type": "object",
+            "properties": {
+                "archive": {
+                    "type": "boolean"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "keep_last": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_age_days": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "source_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.CreateSourceRequest": {
+            "type": "object",
+            "required": [
+                "category",
+                "link",
+                "provider"
+            ],
+            "properties": {
+                "backfill": {
+                    "description": "Backfill the history of a feed source once added, by default if backfill.on_create",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.BackfillRequest"
+                        }
+                    ]
+                },
+                "category": {
+                    "type": "string"
+                },
+                "fetch": {
+                    "description": "Headers, auth, proxy, TLS and timeout of the requests",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.FetchSettingsRequest"
+                        }
+                    ]
+                },
+                "html": {
+                    "description": "Required for html sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.HTMLSelectors"
+                        }
+                    ]
+                },
+                "json": {
+                    "description": "Required for json sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.JSONSource"
+                        }
+                    ]
+                },
+                "link": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "sitemap": {
+                    "description": "Optional for sitemap sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.SitemapOptions"
+                        }
+                    ]
+                },
+                "type": {
+                    "description": "rss by default",
+                    "type": "string",
+                    "enum": [
+                        "rss",
+                        "html",
+                        "json",
+                        "sitemap"
+                    ]
+                }
+            }
+        },
+        "api.CreateWebhookRequest": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "category": {
+                    "type": "string"
+                },
+                "keyword": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Generated when empty",
+                    "type": "string",
+                    "minLength": 16
+                },
+                "source_id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.FetchSettingsRequest": {
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "description": "none by default",
+                    "type": "string",
+                    "enum": [
+                        "none",
+                        "basic",
+                        "bearer",
+                        "cookie"
+                    ]
+                },
+                "cookies": {
+                    "description": "For cookie auth, as in the Cookie header, kept if empty and the auth is unchanged",
+                    "type": "string"
+                },
+                "headers": {
+                    "description": "Sent to the hosts of the source, kept if not given again, {} removes them",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "insecure_skip_verify": {
+                    "description": "Accept any TLS certificate, for internal hosts",
+                    "type": "boolean"
+                },
+                "password": {
+                    "description": "For basic auth, kept if empty and the auth is unchanged",
+                    "type": "string"
+                },
+                "proxy": {
+                    "description": "HTTP(S) or SOCKS5 proxy URL, its password kept if not given again",
+                    "type": "string"
+                },
+                "timeout": {
+                    "description": "Replaces the scrape timeout",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "token": {
+                    "description": "For bearer auth, kept if empty and the auth is unchanged",
+                    "type": "string"
+                },
+                "username": {
+                    "description": "For basic auth",
+                    "type": "string"
+                }
+            }
+        },
+        "api.FetchSettingsResponse": {
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "type": "string",
+                    "enum": [
+                        "basic",
+                        "bearer",
+                        "cookie"
+                    ]
+                },
+                "has_credential": {
+                    "description": "Whether the password, token or cookies are set",
+                    "type": "boolean"
+                },
+                "headers": {
+                    "description": "Names of the custom headers, their values are never returned",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "insecure_skip_verify": {
+                    "type": "boolean"
+                },
+                "proxy": {
+                    "description": "Without its password",
+                    "type": "string"
+                },
+                "timeout": {
+                    "type": "string",
+                    "example": "30s"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.HealthResponse": {
             "type": "object",
             "properties": {
-                "category": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.JSONRequestResponse": {
+            "type": "object",
+            "properties": {
+                "headers": {
+                    "description": "Names of the headers, their values are never returned",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.JSONSourceResponse": {
+            "type": "object",
+            "properties": {
+                "mapping": {
+                    "$ref": "#/definitions/db.JSONMapping"
+                },
+                "request": {
+                    "$ref": "#/definitions/api.JSONRequestResponse"
+                }
+            }
+        },
+        "api.JobResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "done": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
                     "type": "string"
                 },
                 "id": {
+                    "type": "string"
+                },
+                "new_articles": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.JobSourceResultResponse"
+                    }
+                },
+                "source_id": {
+                    "description": "Null when scraping every source",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "queued",
+                        "running",
+                        "succeeded",
+                        "failed"
+                    ]
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.JobSourceResultResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "link": {
+                    "type": "string"
+                },
+                "new_articles": {
                     "type": "integer"
                 },
+                "skipped": {
+                    "description": "Another instance was scraping the source",
+                    "type": "boolean"
+                },
+                "source_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.PreviewArticleResponse": {
+            "type": "object",
+            "properties": {
                 "image": {
                     "type": "string"
                 },
@@ -364,30 +2766,111 @@ const docTemplate = `{
                 }
             }
         },
-        "api.CreateSourceRequest": {
+        "api.PreviewSourceRequest": {
             "type": "object",
             "required": [
-                "category",
-                "link",
-                "provider"
+                "link"
             ],
             "properties": {
-                "category": {
-                    "type": "string"
+                "fetch": {
+                    "description": "Headers, auth, proxy, TLS and timeout of the requests",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.FetchSettingsRequest"
+                        }
+                    ]
+                },
+                "html": {
+                    "description": "Required for html sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.HTMLSelectors"
+                        }
+                    ]
+                },
+                "json": {
+                    "description": "Required for json sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.JSONSource"
+                        }
+                    ]
                 },
                 "link": {
                     "type": "string"
                 },
-                "provider": {
+                "sitemap": {
+                    "description": "Optional for sitemap sources",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.SitemapOptions"
+                        }
+                    ]
+                },
+                "type": {
+                    "description": "rss by default",
+                    "type": "string",
+                    "enum": [
+                        "rss",
+                        "html",
+                        "json",
+                        "sitemap"
+                    ]
+                }
+            }
+        },
+        "api.RetentionPolicyResponse": {
+            "type": "object",
+            "properties": {
+                "archive": {
+                    "type": "boolean"
+                },
+                "category": {
                     "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "keep_last": {
+                    "type": "integer"
+                },
+                "max_age_days": {
+                    "type": "integer"
+                },
+                "source_id": {
+                    "type": "integer"
                 }
             }
         },
-        "api.ErrorResponse": {
+        "api.RetentionRunResponse": {
             "type": "object",
             "properties": {
+                "archive_file": {
+                    "type": "string"
+                },
+                "archived": {
+                    "type": "integer"
+                },
+                "deleted": {
+                    "type": "integer"
+                },
                 "error": {
                     "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "report": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/service.RetentionReport"
+                    }
+                },
+                "started_at": {
+                    "type": "string"
                 }
             }
         },
@@ -397,14 +2880,48 @@ const docTemplate = `{
                 "category": {
                     "type": "string"
                 },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "fetch": {
+                    "$ref": "#/definitions/api.FetchSettingsResponse"
+                },
+                "fetched_at": {
+                    "description": "Start of the last successful scrape",
+                    "type": "string"
+                },
+                "html": {
+                    "$ref": "#/definitions/db.HTMLSelectors"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "json": {
+                    "$ref": "#/definitions/api.JSONSourceResponse"
+                },
                 "link": {
                     "type": "string"
                 },
                 "provider": {
                     "type": "string"
+                },
+                "sitemap": {
+                    "$ref": "#/definitions/db.SitemapOptions"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.StreamMessage": {
+            "type": "object",
+            "properties": {
+                "article": {
+                    "$ref": "#/definitions/api.ArticleResponse"
+                },
+                "id": {
+                    "description": "Event ID, to resume the stream from with last_event_id",
+                    "type": "integer"
                 }
             }
         },
@@ -414,14 +2931,237 @@ const docTemplate = `{
                 "category": {
                     "type": "string"
                 },
+                "fetch": {
+                    "description": "Replaces the fetch settings, the headers and credentials not given again are kept",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/api.FetchSettingsRequest"
+                        }
+                    ]
+                },
+                "html": {
+                    "description": "Replaces the selectors, which are dropped when switching to another type",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.HTMLSelectors"
+                        }
+                    ]
+                },
+                "json": {
+                    "description": "Replaces the request and mapping, the headers kept if not given again, dropped when switching to another type",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.JSONSource"
+                        }
+                    ]
+                },
                 "link": {
                     "type": "string"
                 },
                 "provider": {
                     "type": "string"
+                },
+                "sitemap": {
+                    "description": "Replaces the sitemap options, dropped when switching to another type",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.SitemapOptions"
+                        }
+                    ]
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "rss",
+                        "html",
+                        "json",
+                        "sitemap"
+                    ]
+                }
+            }
+        },
+        "api.WebhookDeliveryResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "succeeded",
+                        "failed"
+                    ]
+                },
+                "status_code": {
+                    "type": "integer"
+                },
+                "webhook_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.WebhookResponse": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "keyword": {
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Only returned on creation",
+                    "type": "string"
+                },
+                "source_id": {
+                    "type": "integer"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.HTMLSelectors": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "description": "Element holding the date as datetime attribute or text, no date if empty",
+                    "type": "string"
+                },
+                "image": {
+                    "description": "Element holding the image as src, no image if empty",
+                    "type": "string"
+                },
+                "item": {
+                    "description": "Container of each article",
+                    "type": "string"
+                },
+                "link": {
+                    "description": "Element holding the link as href, the first link of the item if empty",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Element holding the title as text",
+                    "type": "string"
+                }
+            }
+        },
+        "db.JSONMapping": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "description": "Text, or Unix time in seconds or milliseconds; no date if empty",
+                    "type": "string"
+                },
+                "image": {
+                    "description": "No image if empty",
+                    "type": "string"
+                },
+                "items": {
+                    "description": "Array of the items, the whole response if empty",
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.JSONRequest": {
+            "type": "object",
+            "properties": {
+                "headers": {
+                    "description": "E.g. an API version or key, values encrypted",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "description": "Endpoint of the API, the link of the source if empty",
+                    "type": "string"
+                }
+            }
+        },
+        "db.JSONSource": {
+            "type": "object",
+            "properties": {
+                "mapping": {
+                    "$ref": "#/definitions/db.JSONMapping"
+                },
+                "request": {
+                    "$ref": "#/definitions/db.JSONRequest"
+                }
+            }
+        },
+        "db.SitemapOptions": {
+            "type": "object",
+            "properties": {
+                "metadata": {
+                    "description": "Fetch the pages of the new entries to fill their title and image from their\nmetadata. Required for the sitemaps without news:title.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "service.RetentionReport": {
+            "type": "object",
+            "properties": {
+                "archived": {
+                    "type": "integer"
+                },
+                "deleted": {
+                    "type": "integer"
+                },
+                "link": {
+                    "type": "string"
+                },
+                "policy_id": {
+                    "type": "integer"
+                },
+                "source_id": {
+                    "type": "integer"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "description": "API key, also accepted as \"Authorization: Bearer \u003ckey\u003e\"",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        }
     }
 }`
 
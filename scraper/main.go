@@ -3,52 +3,120 @@
 // @description This is the API for RSS Scraper service
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key, also accepted as "Authorization: Bearer <key>"
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
-	"github.com/danglnh07/newsaggr/scraper/api"
 	"github.com/danglnh07/newsaggr/scraper/db"
-	"github.com/danglnh07/newsaggr/scraper/service"
 	"github.com/danglnh07/newsaggr/scraper/util"
 )
 
+const usage = `usage: scraper <command> [flags] [arguments]
+
+commands:
+  serve     run the API and the scheduled jobs (default)
+  worker    run the scheduled jobs only, without the API
+  scrape    scrape the sources on schedule, or once with -once
+  migrate   apply, revert or list the schema migrations
+  sources   list, add, remove or import sources
+  seed      insert the sample sources
+  apikey    create, list or revoke API keys
+  config    print the effective config or list the config flags
+
+Every command accepts the config flags before its arguments, see "scraper config flags".
+Run "scraper <command> -h" for the flags of a command.`
+
+// Commands by name
+var commands = map[string]func(args []string) error{
+	"serve":   runServeCommand,
+	"worker":  runWorkerCommand,
+	"scrape":  runScrapeCommand,
+	"migrate": runMigrateCommand,
+	"sources": runSourcesCommand,
+	"seed":    runSeedCommand,
+	"apikey":  runAPIKeyCommand,
+	"config":  runConfigCommand,
+}
+
 func main() {
-	// Initialize logger
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	// Serve when no command is given, to keep "scraper [flags]" working
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"serve"}, args...)
+	}
 
-	// Load config
-	config := util.LoadConfig(".env")
+	if args[0] == "help" {
+		fmt.Println(usage)
+		return
+	}
 
-	// Create queries, connect database, run auto migration and seed data
-	queries := db.NewQueries()
+	command, ok := commands[args[0]]
+	if !ok {
+		exitOnError(fmt.Errorf("unknown command %q\n\n%s", args[0], usage))
+	}
 
-	if err := queries.ConnectDB(config.DBConn); err != nil {
-		logger.Error("Error connecting database", "error", err)
-		os.Exit(1)
+	exitOnError(command(args[1:]))
+}
+
+// Helper function: parse the arguments of a command, its own flags along with the
+// config flags, then load the config. The positional arguments stay in flags.Args().
+func parseCommand(flags *flag.FlagSet, args []string) (*util.Config, error) {
+	configFlags := util.RegisterConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
 	}
 
-	if err := queries.AutoMigration(); err != nil {
-		logger.Error("Error running auto migration", "error", err)
-		os.Exit(1)
+	return configFlags.Load(".env")
+}
+
+// Helper function: create the logger from the log config
+func newLogger(config util.LogConfig) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(config.Level)) // Already validated
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, options)
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, options)
 	}
 
-	if err := queries.Seed(); err != nil {
-		logger.Error("Error create seed data", "error", err)
-		os.Exit(1)
+	return slog.New(util.NewTraceHandler(handler))
+}
+
+// Helper function: connect the database of the config
+func connectDB(config *util.Config) (*db.Queries, error) {
+	queries := db.NewQueries()
+	if err := queries.ConnectDB(config.Database.Driver, config.Database.Conn); err != nil {
+		return nil, err
+	}
+
+	err := queries.SetPool(config.Database.MaxOpenConns, config.Database.MaxIdleConns, config.Database.ConnMaxLifetime)
+	if err != nil {
+		return nil, err
 	}
 
-	// Run the cron job
-	rss := service.NewRssScraper(queries)
-	scheduler := service.NewScheduler(rss, logger)
-	scheduler.Start()
+	return queries, nil
+}
+
+// Helper function: print the error and exit, if any
+func exitOnError(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		// Usage already printed by the flag set
+		os.Exit(0)
+	}
 
-	// Create and run server
-	server := api.NewServer(queries, config, logger)
-	if err := server.Start(); err != nil {
-		logger.Error("Error staring server", "error", err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage:
+  scraper migrate up [flags]              apply the pending migrations
+  scraper migrate down [-steps N] [flags] revert the last migrations, one by default
+  scraper migrate status [flags]          list the migrations and whether they are applied`
+
+// Command to manage the schema migrations
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := 0
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	config, err := parseCommand(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New(migrateUsage)
+	}
+
+	queries, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := queries.MigrateUp()
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("No pending migration")
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %d %s\n", migration.Version, migration.Name)
+		}
+		return nil
+
+	case "down":
+		if steps < 1 {
+			return errors.New("-steps must be at least 1")
+		}
+
+		reverted, err := queries.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+
+		if len(reverted) == 0 {
+			fmt.Println("No applied migration")
+		}
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d %s\n", migration.Version, migration.Name)
+		}
+		return nil
+
+	default:
+		statuses, err := queries.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.AppliedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return writer.Flush()
+	}
+}
+
+// Command to insert the sample sources, on top of the migrated schema
+func runSeedCommand(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	config, err := parseCommand(flags, args)
+	if err != nil {
+		return err
+	}
+
+	queries, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+
+	if _, err := queries.MigrateUp(); err != nil {
+		return err
+	}
+
+	if err := queries.Seed(); err != nil {
+		return err
+	}
+
+	fmt.Println("Seeded the sample sources")
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os/signal"
+	"syscall"
+)
+
+// Command to scrape the sources, on schedule or once
+func runScrapeCommand(args []string) error {
+	flags := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	once := flags.Bool("once", false, "scrape once and exit instead of following the schedule")
+	sourceID := flags.Uint("source", 0, "only scrape the source with this ID, requires -once")
+	config, err := parseCommand(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *sourceID != 0 && !*once {
+		return fmt.Errorf("-source requires -once")
+	}
+
+	app, err := newApp(config)
+	if err != nil {
+		return err
+	}
+
+	if !*once {
+		// Scraping job only, retention is left to the worker or the server
+		scheduler := app.newScheduler(false)
+		scheduler.Start()
+		app.logger.Info("Scraper started", "scrape", config.Schedule.Scrape)
+
+		app.runUntilSignal(scheduler, nil)
+		return nil
+	}
+	defer app.shutdownTracing(context.Background())
+
+	// A termination signal cancels the scrape
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *sourceID == 0 {
+		if err := app.rss.Run(ctx); err != nil {
+			return err
+		}
+
+		app.logger.Info("Scraped every source")
+		return nil
+	}
+
+	source, err := app.store.GetSource(ctx, *sourceID)
+	if err != nil {
+		return fmt.Errorf("source %d: %w", *sourceID, err)
+	}
+
+	inserted, err := app.rss.Scrape(ctx, source)
+	if err != nil {
+		return fmt.Errorf("error scraping source %s: %w", source.Link, err)
+	}
+
+	app.logger.Info("Scraped source", "id", source.ID, "link", source.Link, "new_articles", inserted)
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/danglnh07/newsaggr/scraper/api"
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+	"github.com/danglnh07/newsaggr/scraper/util"
+)
+
+// Dependencies shared by the long running commands
+type app struct {
+	config          *util.Config
+	logger          *slog.Logger
+	queries         *db.Queries
+	store           *db.GormStore
+	rss             *service.RssScraper
+	jobs            *service.Jobs
+	leases          *service.Leases
+	webhooks        *service.Webhooks
+	websub          *service.WebSub // Only when enabled
+	backfills       *service.Backfills
+	events          *service.EventBus
+	listener        *service.EventListener // Only for the API, on Postgres
+	retention       *service.Retention
+	shutdownTracing func(context.Context) error
+}
+
+// Helper function: set up logging, tracing and the database, applying the pending migrations
+func newApp(config *util.Config) (*app, error) {
+	logger := newLogger(config.Log)
+
+	// Set up tracing, exported to the OTLP endpoint if any
+	shutdownTracing, err := util.SetupTracing(context.Background(), config.Tracing.OTLPEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err := connectDB(config)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := queries.MigrateUp()
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range applied {
+		logger.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
+
+	store := db.NewGormStore(queries)
+	rss := service.NewRssScraper(store, store, service.ScrapeOptions{
+		Concurrency:    config.Scrape.Concurrency,
+		Timeout:        config.Scrape.Timeout,
+		RedirectHosts:  config.Scrape.RedirectHosts,
+		CanonicalLinks: config.Scrape.CanonicalLinks,
+	})
+
+	// Decrypt the credentials of the sources, which can't be saved without a key
+	if config.Scrape.CredentialKey != "" {
+		credentials, err := service.NewCredentialCipher(config.Scrape.CredentialKey)
+		if err != nil {
+			return nil, err
+		}
+		rss.SetCredentialCipher(credentials)
+	}
+
+	// Send the new articles to the webhooks
+	webhooks := service.NewWebhooks(store, service.WebhookOptions{
+		MaxAttempts:  config.Webhook.MaxAttempts,
+		Timeout:      config.Webhook.Timeout,
+		Backoff:      config.Webhook.Backoff,
+		PollInterval: config.Webhook.PollInterval,
+	}, logger)
+
+	// Record the changes in the outbox and dispatch them to the subscribers
+	events := service.NewEventBus(store, service.EventBusOptions{
+		MaxAttempts:  config.Events.MaxAttempts,
+		Grace:        config.Events.Grace,
+		PollInterval: config.Events.PollInterval,
+		Retention:    config.Events.Retention,
+	}, logger)
+	rss.SetEventBus(events)
+	service.Subscribe(events, "webhooks", webhooks.HandleArticleCreated)
+
+	// Subscribe to the hubs of the feeds, which push to the callbacks of the API
+	var websub *service.WebSub
+	if config.WebSub.Enabled {
+		websub = service.NewWebSub(store, store, rss, service.WebSubOptions{
+			CallbackURL:  strings.TrimSuffix(config.Server.BaseURL, "/") + "/websub",
+			Lease:        config.WebSub.Lease,
+			Silence:      config.WebSub.Silence,
+			PollInterval: config.WebSub.PollInterval,
+		}, logger)
+		rss.SetWebSub(websub)
+	}
+
+	// Backfill the history of the feeds, resuming the backfills left pending
+	backfills := service.NewBackfills(store, store, rss, service.BackfillOptions{
+		MaxPages:     config.Backfill.MaxPages,
+		PageDelay:    config.Backfill.PageDelay,
+		PollInterval: config.Backfill.PollInterval,
+	}, logger)
+
+	// Share the work with the other instances using the same database
+	var leases *service.Leases
+	if config.Schedule.LeaseTTL > 0 {
+		leases = service.NewLeases(store, service.NewInstanceID())
+		rss.SetLeases(leases)
+		webhooks.SetLeases(leases)
+		events.SetLeases(leases)
+		backfills.SetLeases(leases)
+		if websub != nil {
+			websub.SetLeases(leases)
+		}
+		logger.Info("Coordinating with other instances", "instance", leases.Holder())
+	}
+
+	return &app{
+		config:          config,
+		logger:          logger,
+		queries:         queries,
+		store:           store,
+		rss:             rss,
+		jobs:            service.NewJobs(rss, store, logger),
+		leases:          leases,
+		webhooks:        webhooks,
+		websub:          websub,
+		backfills:       backfills,
+		events:          events,
+		retention:       service.NewRetention(store, store, config.Retention.ArchiveDir, logger),
+		shutdownTracing: shutdownTracing,
+	}, nil
+}
+
+// Helper method: create the scheduler of the jobs, without retention if disabled
+func (app *app) newScheduler(withRetention bool) *service.Scheduler {
+	schedule := service.Schedule{
+		Scrape:    app.config.Schedule.Scrape,
+		Retention: app.config.Schedule.Retention,
+		Overlap:   app.config.Schedule.Overlap,
+	}
+	retention := app.retention
+	if !withRetention {
+		retention = nil
+	}
+
+	scheduler := service.NewScheduler(app.rss, retention, schedule, app.logger)
+	if app.leases != nil {
+		scheduler.SetLeases(app.leases, app.config.Schedule.LeaseTTL)
+	}
+	return scheduler
+}
+
+// Helper method: wait for a termination signal, then stop the server and the event
+// listener (if any), the scheduler, the scraping jobs, the backfills, the event bus, the
+// webhook deliveries and the WebSub requests (if enabled) within the shutdown timeout.
+// Every subscriber must be registered before.
+func (app *app) runUntilSignal(scheduler *service.Scheduler, server *api.Server) {
+	defer app.shutdownTracing(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	app.events.Start()
+	app.webhooks.Start()
+	app.backfills.Start()
+	if app.websub != nil {
+		app.websub.Start()
+	}
+	if app.listener != nil {
+		app.listener.Start()
+	}
+
+	serverErr := make(chan error, 1)
+	if server != nil {
+		go func() {
+			serverErr <- server.Start()
+		}()
+		app.logger.Info("Server started", "addr", app.config.Server.Addr, "tls", app.config.Server.TLSCertFile != "")
+	}
+
+	select {
+	case err := <-serverErr:
+		app.logger.Error("Error staring server", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		app.logger.Info("Shutting down", "timeout", app.config.Server.ShutdownTimeout)
+	}
+
+	// Drain the requests in flight, then wait for the running jobs, all within the deadline
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.Server.ShutdownTimeout)
+	defer cancel()
+
+	if server != nil {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			app.logger.Error("Error draining HTTP requests", "error", err)
+		}
+	}
+
+	if app.listener != nil {
+		if err := app.listener.Shutdown(shutdownCtx); err != nil {
+			app.logger.Error("Event listener cancelled at shutdown deadline", "error", err)
+		}
+	}
+
+	if err := scheduler.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("Running jobs cancelled at shutdown deadline", "error", err)
+	}
+
+	if err := app.jobs.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("Scraping jobs cancelled at shutdown deadline", "error", err)
+	}
+
+	if err := app.backfills.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("Backfill page cancelled at shutdown deadline", "error", err)
+	}
+
+	if err := app.events.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("Events left to the outbox relay at shutdown deadline", "error", err)
+	}
+
+	if err := app.webhooks.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("Webhook deliveries cancelled at shutdown deadline", "error", err)
+	}
+
+	if app.websub != nil {
+		if err := app.websub.Shutdown(shutdownCtx); err != nil {
+			app.logger.Error("WebSub requests cancelled at shutdown deadline", "error", err)
+		}
+	}
+
+	app.logger.Info("Shutdown complete")
+}
+
+// Command to run the API along with the scheduled jobs
+func runServeCommand(args []string) error {
+	config, err := parseCommand(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	app, err := newApp(config)
+	if err != nil {
+		return err
+	}
+
+	// Push the new articles to the clients of the live stream. On Postgres, they come from
+	// the notifications of every process sharing the database, such as separate workers.
+	stream := service.NewArticleStream(config.Stream.ReplaySize)
+	if app.queries.Driver == db.DriverPostgres {
+		app.listener = service.NewEventListener(app.store, db.NewPostgresListener(config.Database.Conn), app.logger)
+		service.Subscribe(app.listener, "stream", stream.HandleArticleCreated)
+	} else {
+		service.Subscribe(app.events, "stream", stream.HandleArticleCreated)
+	}
+
+	scheduler := app.newScheduler(true)
+	scheduler.Start()
+
+	// Create the server, ready once the database answers and scraping runs on time
+	server := api.NewServer(app.store, app.rss, app.jobs, app.webhooks, stream, config, app.logger)
+	server.SetBackfills(app.backfills)
+	if app.websub != nil {
+		server.SetWebSub(app.websub)
+	}
+	server.AddReadinessCheck("database", app.queries.Ping)
+	server.AddReadinessCheck("scheduler", func(ctx context.Context) error {
+		return scheduler.Check(config.Server.ReadyMaxScrapeAge)
+	})
+
+	app.runUntilSignal(scheduler, server)
+	return nil
+}
+
+// Command to run the scheduled jobs without the API
+func runWorkerCommand(args []string) error {
+	config, err := parseCommand(flag.NewFlagSet("worker", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	app, err := newApp(config)
+	if err != nil {
+		return err
+	}
+
+	scheduler := app.newScheduler(true)
+	scheduler.Start()
+	app.logger.Info("Worker started", "scrape", config.Schedule.Scrape, "retention", config.Schedule.Retention)
+
+	app.runUntilSignal(scheduler, nil)
+	return nil
+}
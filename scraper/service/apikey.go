@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Every API key starts with this prefix, so leaked keys are easy to recognize
+const APIKeyPrefix = "nak_"
+
+// Hash an API key for storage and lookup
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate and store a new API key. The plain key is returned only here, the
+// database keeps its hash. A zero daily quota means the server default applies.
+func CreateAPIKey(
+	ctx context.Context,
+	store db.APIKeyStore,
+	name, role string,
+	dailyQuota int,
+) (db.APIKey, string, error) {
+	if !db.ValidRole(role) {
+		return db.APIKey{}, "", fmt.Errorf("invalid role %q", role)
+	}
+
+	if dailyQuota < 0 {
+		return db.APIKey{}, "", fmt.Errorf("invalid daily quota %d", dailyQuota)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return db.APIKey{}, "", err
+	}
+	plain := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := db.APIKey{
+		Name:   name,
+		Prefix: plain[:len(APIKeyPrefix)+6],
+		Hash:   HashAPIKey(plain),
+		Role:   role,
+
+		DailyQuota: dailyQuota,
+	}
+	if err := store.CreateAPIKey(ctx, &key); err != nil {
+		return db.APIKey{}, "", err
+	}
+
+	return key, plain, nil
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/mmcdole/gofeed"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Name of the lease held by the instance fetching the backfill pages
+const backfillLease = "backfill"
+
+// Failed attempts of a page before its backfill fails
+const maxBackfillAttempts = 5
+
+// Longest delay between two attempts of a page that failed
+const maxBackfillBackoff = time.Hour
+
+// Only the feed sources have older pages to follow
+var ErrBackfillUnsupported = errors.New("only feed sources can be backfilled")
+
+// Backfill metrics
+var backfillPages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "backfill_pages_total",
+	Help: "Older feed pages fetched by the backfills, labeled by outcome: fetched or failed.",
+}, []string{"outcome"})
+
+// Settings of the backfills
+type BackfillOptions struct {
+	MaxPages     int           // Older pages fetched when a backfill doesn't say, and the most it may ask for
+	PageDelay    time.Duration // Time between two pages of a backfill, to spare the server of the feed
+	PollInterval time.Duration // Time between two checks for the backfills to resume
+}
+
+// Depth of a backfill, zero values take the defaults
+type BackfillRequest struct {
+	MaxPages int        // Older pages to fetch, at most the MaxPages option
+	Since    *time.Time // Leave out the items published before
+}
+
+// Backfills the history of the feed sources beyond the items currently in their feed,
+// following the RFC 5005 prev-archive or next links of the feed, or else the ?paged=N
+// pages of the WordPress feeds. One page is fetched at a time and the position saved
+// after each, so that the backfills resume where they stopped after a restart.
+type Backfills struct {
+	store   db.BackfillStore
+	sources db.SourceStore
+	scraper *RssScraper
+	options BackfillOptions
+	logger  *slog.Logger
+	leases  *Leases
+
+	// Context of the pages in flight, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	kick    chan struct{} // Wakes the fetcher up when a backfill is enqueued
+	started bool
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Constructor method for Backfills, the pages are fetched and stored by scraper
+func NewBackfills(store db.BackfillStore, sources db.SourceStore, scraper *RssScraper, options BackfillOptions, logger *slog.Logger) *Backfills {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Backfills{
+		store:   store,
+		sources: sources,
+		scraper: scraper,
+		options: options,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Only fetch the pages while holding the backfill lease, so that a single instance
+// fetches them when several share the database
+func (backfills *Backfills) SetLeases(leases *Leases) {
+	backfills.leases = leases
+}
+
+// Enqueue a backfill of the source, returning whether it was created. If the source
+// already has a backfill in progress, that one is returned instead. Returns
+// db.ErrNotFound for an unknown source and ErrBackfillUnsupported if it isn't a feed.
+func (backfills *Backfills) Enqueue(ctx context.Context, sourceID uint, request BackfillRequest) (db.Backfill, bool, error) {
+	source, err := backfills.sources.GetSource(ctx, sourceID)
+	if err != nil {
+		return db.Backfill{}, false, err
+	}
+	if source.Type != "" && source.Type != db.SourceTypeRSS {
+		return db.Backfill{}, false, ErrBackfillUnsupported
+	}
+
+	pending, err := backfills.store.PendingBackfills(ctx)
+	if err != nil {
+		return db.Backfill{}, false, err
+	}
+	for _, backfill := range pending {
+		if backfill.SourceID == sourceID {
+			return backfill, false, nil
+		}
+	}
+
+	maxPages := backfills.options.MaxPages
+	if request.MaxPages > 0 && request.MaxPages < maxPages {
+		maxPages = request.MaxPages
+	}
+	backfill := db.Backfill{
+		SourceID:      sourceID,
+		Status:        db.BackfillPending,
+		MaxPages:      maxPages,
+		Since:         request.Since,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := backfills.store.SaveBackfill(ctx, &backfill); err != nil {
+		return db.Backfill{}, false, err
+	}
+
+	backfills.logger.Info("Backfill enqueued", "backfill", backfill.ID, "source", sourceID, "max_pages", maxPages)
+	backfills.wake()
+	return backfill, true, nil
+}
+
+// Helper method: wake the fetcher up, if not already awake
+func (backfills *Backfills) wake() {
+	select {
+	case backfills.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Start fetching the pages of the backfills in the background, resuming the ones left
+// pending by a previous run
+func (backfills *Backfills) Start() {
+	backfills.started = true
+	go func() {
+		defer close(backfills.stopped)
+
+		for {
+			next, err := backfills.runDue(backfills.ctx)
+			if err != nil {
+				backfills.logger.Error("Failed to run backfills", "error", err)
+			}
+
+			// Wake up for the next page due, or check again at the poll interval
+			wait := backfills.options.PollInterval
+			if !next.IsZero() {
+				wait = min(wait, max(time.Until(next), 0))
+			}
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-backfills.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			case <-backfills.kick:
+				timer.Stop()
+			}
+		}
+	}()
+}
+
+// Stop fetching and wait for the page in flight, cancelling it if ctx is done first.
+// The backfills left pending resume on the next start.
+func (backfills *Backfills) Shutdown(ctx context.Context) error {
+	backfills.once.Do(func() { close(backfills.stop) })
+	if !backfills.started {
+		return nil
+	}
+
+	select {
+	case <-backfills.stopped:
+		backfills.leases.Release(context.Background(), backfillLease)
+		return nil
+	case <-ctx.Done():
+		backfills.cancel()
+		<-backfills.stopped
+		backfills.leases.Release(context.Background(), backfillLease)
+		return ctx.Err()
+	}
+}
+
+// Helper method: fetch the next page of each backfill due, returning when the next
+// page is due, zero if no backfill is pending
+func (backfills *Backfills) runDue(ctx context.Context) (time.Time, error) {
+	// Hold the lease at least until the next poll, plus the time to fetch a page
+	ttl := 2*backfills.options.PollInterval + defaultSourceLeaseTTL
+	acquired, err := backfills.leases.Acquire(ctx, backfillLease, ttl)
+	if err != nil || !acquired {
+		return time.Time{}, err
+	}
+
+	pending, err := backfills.store.PendingBackfills(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, backfill := range pending {
+		select {
+		case <-backfills.stop:
+			return time.Time{}, nil
+		default:
+		}
+
+		now := time.Now().UTC()
+		if !now.Before(backfill.NextAttemptAt) {
+			if err := backfills.step(ctx, &backfill, now); err != nil {
+				return time.Time{}, err
+			}
+		}
+
+		if backfill.Status == db.BackfillPending && (next.IsZero() || backfill.NextAttemptAt.Before(next)) {
+			next = backfill.NextAttemptAt
+		}
+	}
+	return next, nil
+}
+
+// Helper method: fetch the next page of a backfill, store its articles and save the
+// position. Only storage errors are returned, failed pages are fetched again later.
+func (backfills *Backfills) step(ctx context.Context, backfill *db.Backfill, now time.Time) error {
+	source, err := backfills.sources.GetSource(ctx, backfill.SourceID)
+	if errors.Is(err, db.ErrNotFound) {
+		return backfills.finish(ctx, backfill, db.BackfillFailed, "source deleted")
+	}
+	if err != nil {
+		return err
+	}
+	if source.Type != "" && source.Type != db.SourceTypeRSS {
+		return backfills.finish(ctx, backfill, db.BackfillFailed, ErrBackfillUnsupported.Error())
+	}
+
+	// The feed itself comes first, telling how to find its older pages
+	first := backfill.NextURL == ""
+	link := backfill.NextURL
+	if first {
+		link = source.Link
+	}
+
+	feed, links, err := backfills.fetchPage(ctx, source, link)
+	if ctx.Err() != nil {
+		// Shutting down, the attempt doesn't count
+		return nil
+	}
+	if err != nil {
+		var httpErr gofeed.HTTPError
+		if backfill.Paging == db.PagingPaged && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			// Past the last page of the feed
+			return backfills.finish(ctx, backfill, db.BackfillSucceeded, "")
+		}
+
+		backfillPages.WithLabelValues("failed").Inc()
+		backfill.Attempts++
+		backfill.Error = err.Error()
+		backfills.logger.Warn("Backfill page failed", "backfill", backfill.ID, "source", source.ID,
+			"url", link, "attempt", backfill.Attempts, "error", err)
+		if backfill.Attempts >= maxBackfillAttempts {
+			return backfills.finish(ctx, backfill, db.BackfillFailed, backfill.Error)
+		}
+
+		backfill.NextAttemptAt = now.Add(backfillBackoff(backfill.Attempts))
+		return backfills.store.SaveBackfill(ctx, backfill)
+	}
+	backfillPages.WithLabelValues("fetched").Inc()
+
+	var lastItem string
+	if len(feed.Items) > 0 {
+		lastItem = feed.Items[0].Link
+	}
+	items := len(feed.Items)
+	older := itemsSince(feed, backfill.Since)
+
+	inserted, err := backfills.scraper.save(ctx, source, backfills.scraper.toArticles(source, feed))
+	if err != nil {
+		return err
+	}
+
+	if first {
+		backfill.Paging = pagingOf(links)
+	} else {
+		backfill.Pages++
+	}
+	backfill.NewArticles += inserted
+	backfill.Attempts = 0
+	backfill.Error = ""
+
+	var next string
+	switch backfill.Paging {
+	case db.PagingArchive:
+		next = links["prev-archive"]
+	case db.PagingNext:
+		next = links["next"]
+	case db.PagingPaged:
+		next = pagedURL(source.Link, backfill.Pages+2)
+	}
+
+	// Feeds ignoring the paged parameter serve the same items on every page
+	repeated := !first && backfill.Paging == db.PagingPaged && lastItem == backfill.LastItem
+	backfill.LastItem = lastItem
+
+	if next == "" || next == link || items == 0 || older || repeated || backfill.Pages >= backfill.MaxPages {
+		return backfills.finish(ctx, backfill, db.BackfillSucceeded, "")
+	}
+
+	backfill.NextURL = next
+	backfill.NextAttemptAt = now.Add(backfills.options.PageDelay)
+	return backfills.store.SaveBackfill(ctx, backfill)
+}
+
+// Helper method: record the end of a backfill
+func (backfills *Backfills) finish(ctx context.Context, backfill *db.Backfill, status, message string) error {
+	now := time.Now().UTC()
+	backfill.Status = status
+	backfill.Error = message
+	backfill.FinishedAt = &now
+
+	backfills.logger.Info("Backfill finished", "backfill", backfill.ID, "source", backfill.SourceID, "status", status,
+		"pages", backfill.Pages, "new_articles", backfill.NewArticles, "error", message)
+	return backfills.store.SaveBackfill(ctx, backfill)
+}
+
+// Helper method: fetch a page of the feed of the source, with its fetch settings and timeout
+func (backfills *Backfills) fetchPage(ctx context.Context, source db.Source, link string) (*gofeed.Feed, feedLinks, error) {
+	if timeout := backfills.scraper.timeoutOf(source); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, err := withFetchSettings(ctx, source, backfills.scraper.credentials.Decrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return backfills.scraper.fetchFeed(ctx, link)
+}
+
+// Helper function: leave out the items of the feed published before since, if set,
+// returning whether there were any
+func itemsSince(feed *gofeed.Feed, since *time.Time) bool {
+	if since == nil {
+		return false
+	}
+
+	older := false
+	kept := feed.Items[:0]
+	for _, item := range feed.Items {
+		published := item.PublishedParsed
+		if published == nil {
+			published = item.UpdatedParsed
+		}
+		if published != nil && published.Before(*since) {
+			older = true
+			continue
+		}
+		kept = append(kept, item)
+	}
+	feed.Items = kept
+	return older
+}
+
+// Helper function: how to find the older pages of a feed from its links, the paged
+// parameter of WordPress if it has neither RFC 5005 link
+func pagingOf(links feedLinks) string {
+	switch {
+	case links["prev-archive"] != "":
+		return db.PagingArchive
+	case links["next"] != "":
+		return db.PagingNext
+	default:
+		return db.PagingPaged
+	}
+}
+
+// Helper function: the URL of a page of a WordPress style feed, counting from 1
+func pagedURL(link string, page int) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	query := parsed.Query()
+	query.Set("paged", strconv.Itoa(page))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// Helper function: delay before fetching a page again, after the given number of attempts
+func backfillBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < maxBackfillBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackfillBackoff)
+}
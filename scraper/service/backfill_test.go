@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: publication date of a test post, the higher the older
+func testPostDate(post int) time.Time {
+	return time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -post)
+}
+
+// Helper function: an Atom feed page with the given links and posts
+func testFeedPage(links string, posts ...int) string {
+	var entries strings.Builder
+	for _, post := range posts {
+		fmt.Fprintf(&entries, `<entry><title>Post %d</title><link href="https://example.com/posts/%d"/><updated>%s</updated></entry>`,
+			post, post, testPostDate(post).Format(time.RFC3339))
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Posts</title>` +
+		links + entries.String() + `</feed>`
+}
+
+// Helper function: create backfills of the sources of the store, without delay between pages
+func newTestBackfills(t *testing.T, scraper *RssScraper, store *db.MemoryStore, maxPages int) *Backfills {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewBackfills(store, store, scraper, BackfillOptions{MaxPages: maxPages, PollInterval: time.Hour}, logger)
+}
+
+// Helper function: run the due pages until the backfill is over
+func runBackfill(t *testing.T, backfills *Backfills, store *db.MemoryStore, id uint) db.Backfill {
+	t.Helper()
+
+	for range 20 {
+		_, err := backfills.runDue(context.Background())
+		require.NoError(t, err)
+
+		backfill, err := store.GetBackfill(context.Background(), id)
+		require.NoError(t, err)
+		if backfill.Status != db.BackfillPending {
+			return backfill
+		}
+	}
+
+	t.Fatal("backfill still pending")
+	return db.Backfill{}
+}
+
+// Helper function: create a feed source
+func createTestFeed(t *testing.T, store *db.MemoryStore, link string) db.Source {
+	t.Helper()
+
+	source := db.Source{Link: link, Provider: "example.com", Category: "tech"}
+	require.NoError(t, store.CreateSource(context.Background(), &source))
+	return source
+}
+
+// Test following the RFC 5005 prev-archive links, resuming after a restart
+func TestBackfillArchive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Write([]byte(testFeedPage(`<link rel="prev-archive" href="/archive/2.xml"/>`, 1, 2)))
+		case "/archive/2.xml":
+			w.Write([]byte(testFeedPage(`<link rel="prev-archive" href="/archive/1.xml"/>`, 3, 4)))
+		case "/archive/1.xml":
+			w.Write([]byte(testFeedPage(``, 5, 6)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	scraper, store := newTestScraper(t)
+	source := createTestFeed(t, store, server.URL+"/feed.xml")
+	ctx := context.Background()
+
+	backfills := newTestBackfills(t, scraper, store, 10)
+	backfill, created, err := backfills.Enqueue(ctx, source.ID, BackfillRequest{})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, 10, backfill.MaxPages)
+
+	// The feed itself tells how to find its history
+	_, err = backfills.runDue(ctx)
+	require.NoError(t, err)
+
+	backfill, err = store.GetBackfill(ctx, backfill.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.BackfillPending, backfill.Status)
+	require.Equal(t, db.PagingArchive, backfill.Paging)
+	require.Equal(t, server.URL+"/archive/2.xml", backfill.NextURL)
+	require.Equal(t, 0, backfill.Pages)
+
+	// Another instance resumes from the saved position
+	restarted := newTestBackfills(t, scraper, store, 10)
+	backfill = runBackfill(t, restarted, store, backfill.ID)
+	require.Equal(t, db.BackfillSucceeded, backfill.Status)
+	require.Equal(t, 2, backfill.Pages)
+	require.Equal(t, 6, backfill.NewArticles)
+	require.NotNil(t, backfill.FinishedAt)
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{SourceID: source.ID})
+	require.NoError(t, err)
+	require.Len(t, articles, 6)
+}
+
+// Test the WordPress paged feeds, up to their last page, their depth or their date
+func TestBackfillPaged(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		ignored bool // Serve the feed itself whatever the page
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		page := 1
+		if paged := r.URL.Query().Get("paged"); paged != "" && !ignored {
+			page, _ = strconv.Atoi(paged)
+		}
+		if page > 4 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testFeedPage(``, 2*page-1, 2*page)))
+	}))
+	t.Cleanup(server.Close)
+
+	since := testPostDate(5)
+	tests := []struct {
+		name        string
+		ignored     bool
+		request     BackfillRequest
+		pages       int
+		newArticles int
+	}{
+		{"last page", false, BackfillRequest{}, 3, 8},
+		{"depth", false, BackfillRequest{MaxPages: 2}, 2, 6},
+		{"capped depth", false, BackfillRequest{MaxPages: 50}, 3, 8},
+		{"date", false, BackfillRequest{Since: &since}, 2, 5},
+		{"paged ignored", true, BackfillRequest{}, 1, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu.Lock()
+			ignored = test.ignored
+			mu.Unlock()
+
+			scraper, store := newTestScraper(t)
+			source := createTestFeed(t, store, server.URL+"/feed/?lang=en")
+			backfills := newTestBackfills(t, scraper, store, 10)
+
+			backfill, _, err := backfills.Enqueue(context.Background(), source.ID, test.request)
+			require.NoError(t, err)
+
+			backfill = runBackfill(t, backfills, store, backfill.ID)
+			require.Equal(t, db.BackfillSucceeded, backfill.Status)
+			require.Equal(t, db.PagingPaged, backfill.Paging)
+			require.Equal(t, test.pages, backfill.Pages)
+			require.Equal(t, test.newArticles, backfill.NewArticles)
+		})
+	}
+
+	require.Equal(t, "https://example.com/feed/?lang=en&paged=3", pagedURL("https://example.com/feed/?lang=en", 3))
+}
+
+// Test retrying a page that failed, then failing once out of attempts
+func TestBackfillFailure(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		failing = true
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/feed.xml":
+			w.Write([]byte(testFeedPage(`<link rel="next" href="/page/2.xml"/>`, 1, 2)))
+		case failing:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(testFeedPage(``, 3, 4)))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+	backfills := newTestBackfills(t, scraper, store, 10)
+
+	// Retried later, until the page is back
+	source := createTestFeed(t, store, server.URL+"/feed.xml")
+	backfill, _, err := backfills.Enqueue(ctx, source.ID, BackfillRequest{})
+	require.NoError(t, err)
+
+	_, err = backfills.runDue(ctx)
+	require.NoError(t, err)
+	next, err := backfills.runDue(ctx)
+	require.NoError(t, err)
+
+	backfill, err = store.GetBackfill(ctx, backfill.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.BackfillPending, backfill.Status)
+	require.Equal(t, db.PagingNext, backfill.Paging)
+	require.Equal(t, 1, backfill.Attempts)
+	require.Contains(t, backfill.Error, "503")
+	require.True(t, backfill.NextAttemptAt.After(time.Now()))
+	require.True(t, next.Equal(backfill.NextAttemptAt))
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	backfill.NextAttemptAt = time.Now().UTC()
+	require.NoError(t, store.SaveBackfill(ctx, &backfill))
+
+	backfill = runBackfill(t, backfills, store, backfill.ID)
+	require.Equal(t, db.BackfillSucceeded, backfill.Status)
+	require.Equal(t, 1, backfill.Pages)
+	require.Empty(t, backfill.Error)
+
+	// Out of attempts
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+	backfill, created, err := backfills.Enqueue(ctx, source.ID, BackfillRequest{})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	for range 1 + maxBackfillAttempts {
+		_, err = backfills.runDue(ctx)
+		require.NoError(t, err)
+
+		backfill, err = store.GetBackfill(ctx, backfill.ID)
+		require.NoError(t, err)
+		backfill.NextAttemptAt = time.Now().UTC()
+		require.NoError(t, store.SaveBackfill(ctx, &backfill))
+	}
+	require.Equal(t, db.BackfillFailed, backfill.Status)
+	require.Contains(t, backfill.Error, "503")
+}
+
+// Test enqueuing the backfills: one at a time per source, only for feeds
+func TestBackfillEnqueue(t *testing.T) {
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+	backfills := newTestBackfills(t, scraper, store, 10)
+
+	source := createTestFeed(t, store, "https://example.com/feed.xml")
+	first, created, err := backfills.Enqueue(ctx, source.ID, BackfillRequest{MaxPages: 3})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, 3, first.MaxPages)
+
+	second, created, err := backfills.Enqueue(ctx, source.ID, BackfillRequest{})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, first.ID, second.ID)
+
+	_, _, err = backfills.Enqueue(ctx, 99, BackfillRequest{})
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	page := db.Source{
+		Link:     "https://example.com/blog",
+		Provider: "example.com",
+		Category: "tech",
+		Type:     db.SourceTypeHTML,
+		HTML:     &db.HTMLSelectors{Item: "article", Title: "h2", Link: "a"},
+	}
+	require.NoError(t, store.CreateSource(ctx, &page))
+	_, _, err = backfills.Enqueue(ctx, page.ID, BackfillRequest{})
+	require.ErrorIs(t, err, ErrBackfillUnsupported)
+
+	// A source deleted meanwhile fails its backfill
+	require.NoError(t, store.DeleteSource(ctx, source.ID))
+	backfill := runBackfill(t, backfills, store, first.ID)
+	require.Equal(t, db.BackfillFailed, backfill.Status)
+	require.Equal(t, "source deleted", backfill.Error)
+}
+
+// Test finding the RFC 5005 links of a feed along with its WebSub links
+func TestDiscoverLinks(t *testing.T) {
+	header := http.Header{"Link": {`</archive/2025-02.xml>; rel="prev-archive"`}}
+	body := testFeedPage(`<link rel="hub" href="https://hub.example.com/"/><link rel="next" href="?page=2"/><link rel="prev-archive" href="/other.xml"/>`, 1)
+
+	links := discoverLinks("https://example.com/feed.xml", header, []byte(body))
+	require.Equal(t, "https://example.com/archive/2025-02.xml", links["prev-archive"])
+	require.Equal(t, "https://example.com/feed.xml?page=2", links["next"])
+	require.Equal(t, "https://hub.example.com/", links["hub"])
+	require.Equal(t, db.PagingArchive, pagingOf(links))
+	require.Equal(t, db.PagingPaged, pagingOf(feedLinks{}))
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	maxCanonicalPages    = 50        // New articles resolved per save, the others keep their own URL
+	canonicalConcurrency = 4         // Article links resolved at the same time
+	maxCanonicalBytes    = 256 << 10 // Start of a page read for its canonical link, enough for its <head>
+)
+
+// Helper method: resolve the canonical URL of the articles not stored yet, so that the
+// store detects the same article carried by several sources. The links of the redirect
+// wrappers, such as FeedBurner's, are followed, then the <link rel="canonical"> of the
+// page is read if enabled. Articles failing to resolve keep their own URL, which the
+// store normalizes. Half of the time left is kept to save the articles.
+func (scraper *RssScraper) resolveCanonical(ctx context.Context, articles []db.Article) error {
+	if len(scraper.options.RedirectHosts) == 0 && !scraper.options.CanonicalLinks {
+		return nil
+	}
+
+	// Stored articles were resolved when first saved
+	urls := make([]string, 0, 2*len(articles))
+	for _, article := range articles {
+		urls = append(urls, article.Url, db.NormalizeURL(canonicalLink(article)))
+	}
+	known, err := scraper.articles.KnownURLs(ctx, urls)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+		defer cancel()
+	}
+
+	var (
+		wg       sync.WaitGroup
+		slots    = make(chan struct{}, canonicalConcurrency)
+		resolved = 0
+	)
+	for i := range articles {
+		article := &articles[i]
+		link := canonicalLink(*article)
+		if known[article.Url] || known[db.NormalizeURL(link)] || !scraper.resolvable(link) {
+			continue
+		}
+
+		if resolved == maxCanonicalPages {
+			break
+		}
+		resolved++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			canonical, err := scraper.fetchCanonical(ctx, link)
+			if err != nil {
+				return
+			}
+			article.CanonicalURL = &canonical
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Helper method: check if the link needs a request to find its canonical URL: every page
+// when their canonical link is read, else only the links of the redirect wrappers
+func (scraper *RssScraper) resolvable(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+
+	if scraper.options.CanonicalLinks {
+		return true
+	}
+
+	for _, host := range scraper.options.RedirectHosts {
+		if strings.EqualFold(parsed.Host, host) || strings.EqualFold(parsed.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper method: follow the redirects of an article link, then read the canonical link of
+// the page it lands on if enabled
+func (scraper *RssScraper) fetchCanonical(ctx context.Context, link string) (string, error) {
+	ctx, span := startSpan(ctx, "scraper.canonical", attribute.String("url.full", link))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+
+	resp, err := scraper.client.Do(req)
+	if err != nil {
+		recordError(span, err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// The redirects tell where the article is, even if its page can't be read
+	landed := resp.Request.URL
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+		recordError(span, err)
+		if landed.String() != link {
+			return landed.String(), nil
+		}
+		return "", err
+	}
+
+	if !scraper.options.CanonicalLinks {
+		return landed.String(), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCanonicalBytes))
+	if err != nil {
+		recordError(span, err)
+		return "", err
+	}
+
+	document, err := parseHTML(body)
+	if err != nil {
+		recordError(span, err)
+		return "", err
+	}
+
+	if canonical := resolveURL(landed, document.Find(`link[rel="canonical"]`).First().AttrOr("href", "")); canonical != "" {
+		return canonical, nil
+	}
+	return landed.String(), nil
+}
+
+// Helper function: the link an article is resolved from, the canonical URL given by its
+// feed if any
+func canonicalLink(article db.Article) string {
+	if article.CanonicalURL != nil {
+		return *article.CanonicalURL
+	}
+	return article.Url
+}
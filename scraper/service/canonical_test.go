@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: an RSS feed with an item of the given link, and FeedBurner's original
+// link if not empty
+func testCanonicalFeed(link, origLink string) []byte {
+	extra := ""
+	if origLink != "" {
+		extra = fmt.Sprintf("<feedburner:origLink>%s</feedburner:origLink>", origLink)
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:feedburner="http://rssnamespace.org/feedburner/ext/1.0"><channel><title>News</title>
+<item><title>Story</title><link>%s</link>%s</item></channel></rss>`, link, extra))
+}
+
+// Test storing once the same article carried by two sources under different links
+func TestCanonicalDuplicates(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2025/story.html", "/amp/story":
+			w.Write([]byte(`<html><head><link rel="canonical" href="/2025/story.html"></head><body>Story</body></html>`))
+		case "/late":
+			// Only the start of the pages is read
+			fmt.Fprintf(w, `<html><head><!-- %s --><link rel="canonical" href="/2025/story.html"></head></html>`, strings.Repeat("x", maxCanonicalBytes))
+		case "/blocked":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(site.Close)
+
+	// A link wrapper like FeedBurner's
+	wrapper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/~r/news/story":
+			http.Redirect(w, r, site.URL+"/2025/story.html?utm_source=feedburner&utm_medium=feed", http.StatusMovedPermanently)
+		case "/~r/news/blocked":
+			http.Redirect(w, r, site.URL+"/blocked/?utm_source=feedburner", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(wrapper.Close)
+	wrapperHost, err := url.Parse(wrapper.URL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		options  ScrapeOptions
+		link     string // Link of the article in the other feed
+		origLink string
+		linked   bool // Stored once, carried by both sources
+	}{
+		{"tracking parameters", ScrapeOptions{}, site.URL + "/2025/story.html/?utm_source=rss", "", true},
+		{"redirect wrapper", ScrapeOptions{RedirectHosts: []string{wrapperHost.Host}}, wrapper.URL + "/~r/news/story", "", true},
+		{"redirect wrapper not configured", ScrapeOptions{}, wrapper.URL + "/~r/news/story", "", false},
+		{"feedburner original link", ScrapeOptions{}, wrapper.URL + "/~r/news/other", site.URL + "/2025/story.html", true},
+		{"canonical link", ScrapeOptions{CanonicalLinks: true}, site.URL + "/amp/story", "", true},
+		{"canonical link not read", ScrapeOptions{RedirectHosts: []string{wrapperHost.Host}}, site.URL + "/amp/story", "", false},
+		{"unavailable page", ScrapeOptions{CanonicalLinks: true}, wrapper.URL + "/~r/news/missing", "", false},
+		{"canonical link past the limit", ScrapeOptions{CanonicalLinks: true}, site.URL + "/late", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := db.NewMemoryStore()
+			scraper := NewRssScraper(store, store, test.options)
+			ctx := context.Background()
+
+			source := db.Source{Link: site.URL + "/feed.xml", Provider: "site", Category: "news"}
+			require.NoError(t, store.CreateSource(ctx, &source))
+			other := db.Source{Link: wrapper.URL + "/news", Provider: "wrapper", Category: "news"}
+			require.NoError(t, store.CreateSource(ctx, &other))
+
+			inserted, err := scraper.Ingest(ctx, source, testCanonicalFeed(site.URL+"/2025/story.html", ""))
+			require.NoError(t, err)
+			require.Equal(t, 1, inserted)
+
+			inserted, err = scraper.Ingest(ctx, other, testCanonicalFeed(test.link, test.origLink))
+			require.NoError(t, err)
+
+			articles, err := store.ListArticles(ctx, db.ArticleFilter{SourceID: source.ID})
+			require.NoError(t, err)
+			require.Len(t, articles, 1)
+
+			if !test.linked {
+				require.Equal(t, 1, inserted)
+				require.Empty(t, articles[0].Sources)
+				return
+			}
+
+			require.Zero(t, inserted)
+			require.Len(t, articles[0].Sources, 1)
+			require.Equal(t, other.ID, articles[0].Sources[0].SourceID)
+			require.Equal(t, test.link, articles[0].Sources[0].Url)
+		})
+	}
+
+	// The redirects are kept even if the page they lead to can't be read
+	scraper, store := newTestScraper(t)
+	scraper.options.CanonicalLinks = true
+	source := db.Source{Link: wrapper.URL + "/news", Provider: "wrapper", Category: "news"}
+	require.NoError(t, store.CreateSource(context.Background(), &source))
+
+	_, err = scraper.Ingest(context.Background(), source, testCanonicalFeed(wrapper.URL+"/~r/news/blocked", ""))
+	require.NoError(t, err)
+	articles, err := store.ListArticles(context.Background(), db.ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	require.Equal(t, site.URL+"/blocked/?utm_source=feedburner", *articles[0].CanonicalURL)
+	require.Equal(t, db.NormalizeURL(site.URL+"/blocked"), *articles[0].DedupeKey)
+}
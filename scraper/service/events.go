@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Types of the events published on the bus
+const (
+	EventArticleCreated      = "article.created"
+	EventArticleUpdated      = "article.updated"
+	EventSourceFailed        = "source.failed"
+	EventSourceStatusChanged = "source.status_changed"
+	EventRunCompleted        = "run.completed"
+)
+
+// Name of the lease held by the instance relaying the events left in the outbox
+const outboxLease = "outbox"
+
+// Events loaded at once by the relay
+const outboxBatchSize = 100
+
+// Events waiting to be dispatched in memory, beyond which they are left to the relay
+const eventQueueSize = 1024
+
+// Event bus metrics, labeled by event type
+var (
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_published_total",
+		Help: "Events dispatched to every subscriber.",
+	}, []string{"type"})
+
+	eventHandlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_handler_errors_total",
+		Help: "Failed calls to an event subscriber.",
+	}, []string{"type", "subscriber"})
+
+	eventsRelayed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_relayed_total",
+		Help: "Events picked up from the outbox after not being dispatched in time.",
+	}, []string{"type"})
+)
+
+// Event published on the bus, identified by its type
+type Event interface {
+	EventType() string
+}
+
+// An article was stored for the first time, along with its source
+type ArticleCreated struct {
+	Article db.Article `json:"article"`
+}
+
+// A stored article changed in its feed, along with its source
+type ArticleUpdated struct {
+	Article db.Article `json:"article"`
+}
+
+// Scraping a source failed
+type SourceFailed struct {
+	Source db.Source `json:"source"`
+	Error  string    `json:"error"`
+}
+
+// A source started failing, or recovered
+type SourceStatusChanged struct {
+	Source db.Source `json:"source"`
+	Status string    `json:"status"`          // SourceHealthy or SourceFailing
+	Error  string    `json:"error,omitempty"` // Error of the failing scrape
+}
+
+// A scraping run over several sources finished
+type RunCompleted struct {
+	Sources     int       `json:"sources"`
+	NewArticles int       `json:"new_articles"`
+	Failed      int       `json:"failed"`
+	Skipped     int       `json:"skipped"` // Scraped by another instance
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+func (ArticleCreated) EventType() string      { return EventArticleCreated }
+func (ArticleUpdated) EventType() string      { return EventArticleUpdated }
+func (SourceFailed) EventType() string        { return EventSourceFailed }
+func (SourceStatusChanged) EventType() string { return EventSourceStatusChanged }
+func (RunCompleted) EventType() string        { return EventRunCompleted }
+
+// Helper function: the source as sent in events, without its fetch settings whose
+// headers and credentials must not reach the webhooks and listeners
+func eventSource(source db.Source) db.Source {
+	source.Fetch = nil
+	return source
+}
+
+// Delivery settings of the event bus
+type EventBusOptions struct {
+	MaxAttempts  int           // Failed dispatches before an event is given up
+	Grace        time.Duration // Age from which the relay takes over an event not dispatched yet
+	PollInterval time.Duration // Time between two checks of the outbox by the relay
+	Retention    time.Duration // Time published events are kept in the outbox
+}
+
+// Subscriber of an event type
+type eventHandler struct {
+	name   string
+	handle func(ctx context.Context, event Event) error
+}
+
+// Subscribers of each event type, along with the decoders of their payloads
+type eventSubscribers struct {
+	mu       sync.RWMutex
+	handlers map[string][]eventHandler
+	decoders map[string]func(payload []byte) (Event, error)
+}
+
+// Holder of event subscribers: the event bus, or the listener of another process' events
+type subscribable interface {
+	subscribers() *eventSubscribers
+}
+
+// Subscribe the handler, identified by name in logs and metrics, to the events of type E
+func Subscribe[E Event](target subscribable, name string, handler func(ctx context.Context, event E) error) {
+	var zero E
+	eventType := zero.EventType()
+
+	subscribers := target.subscribers()
+	subscribers.mu.Lock()
+	defer subscribers.mu.Unlock()
+
+	if subscribers.handlers == nil {
+		subscribers.handlers = make(map[string][]eventHandler)
+		subscribers.decoders = make(map[string]func(payload []byte) (Event, error))
+	}
+
+	subscribers.decoders[eventType] = func(payload []byte) (Event, error) {
+		var event E
+		err := json.Unmarshal(payload, &event)
+		return event, err
+	}
+	subscribers.handlers[eventType] = append(subscribers.handlers[eventType], eventHandler{
+		name: name,
+		handle: func(ctx context.Context, event Event) error {
+			return handler(ctx, event.(E))
+		},
+	})
+}
+
+// Helper method: the subscribers to register the handlers on
+func (subscribers *eventSubscribers) subscribers() *eventSubscribers {
+	return subscribers
+}
+
+// Helper method: the subscribers of an event type
+func (subscribers *eventSubscribers) of(eventType string) []eventHandler {
+	subscribers.mu.RLock()
+	defer subscribers.mu.RUnlock()
+	return subscribers.handlers[eventType]
+}
+
+// Helper method: decode the payload of a recorded event, nil for types nobody subscribed to
+func (subscribers *eventSubscribers) decode(record db.OutboxEvent) (Event, error) {
+	subscribers.mu.RLock()
+	decode, ok := subscribers.decoders[record.Type]
+	subscribers.mu.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+	return decode([]byte(record.Payload))
+}
+
+// Event waiting to be dispatched
+type queuedEvent struct {
+	record db.OutboxEvent
+	event  Event
+}
+
+// In-process event bus. Events are recorded in the outbox, in the same transaction as
+// the change they describe when there is one, then dispatched in the background to the
+// subscribers of their type. Events that are not dispatched in time, because the process
+// died or a subscriber failed, are relayed from the outbox by the instance holding its
+// lease. Subscribers get every event at least once, so they must be idempotent.
+type EventBus struct {
+	store   db.OutboxStore
+	options EventBusOptions
+	logger  *slog.Logger
+	leases  *Leases
+
+	eventSubscribers
+
+	// Context of the handlers, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queue   chan queuedEvent
+	started bool
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Constructor method for EventBus
+func NewEventBus(store db.OutboxStore, options EventBusOptions, logger *slog.Logger) *EventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventBus{
+		store:   store,
+		options: options,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		queue:   make(chan queuedEvent, eventQueueSize),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Only relay the outbox while holding its lease, so that a single instance relays
+// the events when several share the database
+func (bus *EventBus) SetLeases(leases *Leases) {
+	bus.leases = leases
+}
+
+// Record the events in the outbox and queue them for dispatch. Errors are logged rather
+// than returned, the change the events describe is already done.
+func (bus *EventBus) Publish(ctx context.Context, events ...Event) {
+	records, err := newOutboxEvents(events)
+	if err == nil {
+		err = bus.store.CreateEvents(ctx, records)
+	}
+	if err != nil {
+		bus.logger.ErrorContext(ctx, "Failed to record events", "error", err)
+		return
+	}
+
+	bus.enqueue(records, events)
+}
+
+// Insert the new articles of a source and update the changed ones, recording an
+// article.created or article.updated event for each in the same transaction
+func (bus *EventBus) SaveArticles(ctx context.Context, source db.Source, articles []db.Article) (db.ArticleChanges, error) {
+	var events []Event
+	changes, err := bus.store.SaveArticles(ctx, articles, func(changes db.ArticleChanges) ([]db.OutboxEvent, error) {
+		events = make([]Event, 0, len(changes.Inserted)+len(changes.Updated))
+		for _, article := range changes.Inserted {
+			article.Source = eventSource(source)
+			events = append(events, ArticleCreated{Article: article})
+		}
+		for _, article := range changes.Updated {
+			article.Source = eventSource(source)
+			events = append(events, ArticleUpdated{Article: article})
+		}
+		return newOutboxEvents(events)
+	})
+	if err != nil {
+		return db.ArticleChanges{}, err
+	}
+
+	bus.enqueue(changes.Events, events)
+	return changes, nil
+}
+
+// Start dispatching the events in the background, and relaying the outbox
+func (bus *EventBus) Start() {
+	bus.started = true
+	go func() {
+		defer close(bus.stopped)
+
+		ticker := time.NewTicker(bus.options.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-bus.stop:
+				bus.drain()
+				return
+			case queued := <-bus.queue:
+				bus.dispatch(queued.record, queued.event)
+			case <-ticker.C:
+				if err := bus.relay(bus.ctx); err != nil {
+					bus.logger.Error("Failed to relay the outbox", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop after dispatching the queued events, cancelling the handlers if ctx is done
+// first. The events left are relayed from the outbox later.
+func (bus *EventBus) Shutdown(ctx context.Context) error {
+	bus.once.Do(func() { close(bus.stop) })
+	if !bus.started {
+		return nil
+	}
+
+	select {
+	case <-bus.stopped:
+		bus.leases.Release(context.Background(), outboxLease)
+		return nil
+	case <-ctx.Done():
+		bus.cancel()
+		<-bus.stopped
+		bus.leases.Release(context.Background(), outboxLease)
+		return ctx.Err()
+	}
+}
+
+// Helper method: queue recorded events for dispatch. When the queue is full, or the
+// bus isn't started (e.g. a one-off scrape), the relay of a running instance sends them.
+func (bus *EventBus) enqueue(records []db.OutboxEvent, events []Event) {
+	for i, record := range records {
+		select {
+		case bus.queue <- queuedEvent{record: record, event: events[i]}:
+		default:
+			return
+		}
+	}
+}
+
+// Helper method: dispatch the events left in the queue on shutdown
+func (bus *EventBus) drain() {
+	for {
+		select {
+		case queued := <-bus.queue:
+			bus.dispatch(queued.record, queued.event)
+		default:
+			return
+		}
+	}
+}
+
+// Helper method: call every subscriber of the event, then record the outcome. A failed
+// event stays in the outbox to be relayed again, up to the maximum attempts.
+func (bus *EventBus) dispatch(record db.OutboxEvent, event Event) {
+	var failed error
+	for _, handler := range bus.of(record.Type) {
+		if err := handler.handle(bus.ctx, event); err != nil {
+			eventHandlerErrors.WithLabelValues(record.Type, handler.name).Inc()
+			bus.logger.Error("Event subscriber failed", "event", record.ID, "type", record.Type, "subscriber", handler.name, "error", err)
+			failed = fmt.Errorf("%s: %w", handler.name, err)
+		}
+	}
+
+	now := time.Now()
+	if failed != nil {
+		record.Attempts++
+		record.Error = failed.Error()
+		if record.Attempts < bus.options.MaxAttempts {
+			bus.update(record)
+			return
+		}
+		bus.logger.Error("Giving up on event", "event", record.ID, "type", record.Type, "attempts", record.Attempts)
+	} else {
+		eventsPublished.WithLabelValues(record.Type).Inc()
+	}
+
+	record.PublishedAt = &now
+	bus.update(record)
+}
+
+// Helper method: save the outcome of a dispatch
+func (bus *EventBus) update(record db.OutboxEvent) {
+	if err := bus.store.UpdateEvent(context.WithoutCancel(bus.ctx), &record); err != nil {
+		bus.logger.Error("Failed to update event", "event", record.ID, "error", err)
+	}
+}
+
+// Helper method: dispatch the events left in the outbox for longer than the grace
+// period, then purge the old published ones
+func (bus *EventBus) relay(ctx context.Context) error {
+	// Hold the lease at least until the next poll
+	acquired, err := bus.leases.Acquire(ctx, outboxLease, 2*bus.options.PollInterval)
+	if err != nil || !acquired {
+		return err
+	}
+
+	// Failed events stay pending, they are retried on the next poll rather than right away
+	seen := make(map[uint]bool)
+	for {
+		records, err := bus.store.PendingEvents(ctx, time.Now().Add(-bus.options.Grace), outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 && seen[records[0].ID] {
+			break
+		}
+
+		for _, record := range records {
+			seen[record.ID] = true
+
+			select {
+			case <-bus.stop:
+				return nil
+			default:
+			}
+
+			event, err := bus.decode(record)
+			if err != nil {
+				// Not dispatchable, keep it for the record
+				bus.logger.Error("Failed to decode event", "event", record.ID, "type", record.Type, "error", err)
+				record.Attempts = bus.options.MaxAttempts
+				record.Error = err.Error()
+				now := time.Now()
+				record.PublishedAt = &now
+				bus.update(record)
+				continue
+			}
+
+			eventsRelayed.WithLabelValues(record.Type).Inc()
+			bus.dispatch(record, event)
+		}
+
+		if len(records) < outboxBatchSize {
+			break
+		}
+	}
+
+	if _, err := bus.store.PurgeEvents(ctx, time.Now().Add(-bus.options.Retention)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function: encode events into outbox records
+func newOutboxEvents(events []Event) ([]db.OutboxEvent, error) {
+	records := make([]db.OutboxEvent, len(events))
+	for i, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = db.OutboxEvent{Type: event.EventType(), Payload: string(payload)}
+	}
+	return records, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: create an event bus relaying fast, started and shut down with the test
+func newTestEventBus(t *testing.T, store db.OutboxStore) *EventBus {
+	t.Helper()
+
+	bus := NewEventBus(store, EventBusOptions{
+		MaxAttempts:  3,
+		Grace:        50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		Retention:    time.Hour,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { bus.Shutdown(context.Background()) })
+
+	return bus
+}
+
+// Events received by a test subscriber
+type received struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Helper function: subscribe to the events of type E, recording them
+func record[E Event](target subscribable, received *received) {
+	Subscribe(target, "test", func(ctx context.Context, event E) error {
+		received.mu.Lock()
+		defer received.mu.Unlock()
+		received.events = append(received.events, event)
+		return nil
+	})
+}
+
+// Helper method: the events received so far
+func (received *received) get() []Event {
+	received.mu.Lock()
+	defer received.mu.Unlock()
+	return append([]Event(nil), received.events...)
+}
+
+// Helper function: the unpublished events of the store
+func pendingEvents(t *testing.T, store db.OutboxStore) []db.OutboxEvent {
+	t.Helper()
+
+	events, err := store.PendingEvents(context.Background(), time.Now().Add(time.Hour), 100)
+	require.NoError(t, err)
+	return events
+}
+
+// Test that the changes and events published on the bus reach their subscribers
+func TestEventBusDispatch(t *testing.T) {
+	store := db.NewMemoryStore()
+	ctx := context.Background()
+	bus := newTestEventBus(t, store)
+
+	var created, updated, completed received
+	record[ArticleCreated](bus, &created)
+	record[ArticleUpdated](bus, &updated)
+	record[RunCompleted](bus, &completed)
+	bus.Start()
+
+	source := db.Source{Link: "https://example.com/rss", Category: "tech"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	changes, err := bus.SaveArticles(ctx, source, []db.Article{
+		{SourceID: source.ID, Title: "Go", Url: "https://example.com/go"},
+		{SourceID: source.ID, Title: "Rust", Url: "https://example.com/rust"},
+	})
+	require.NoError(t, err)
+	require.Len(t, changes.Inserted, 2)
+
+	changes, err = bus.SaveArticles(ctx, source, []db.Article{
+		{SourceID: source.ID, Title: "Go 2", Url: "https://example.com/go"},
+		{SourceID: source.ID, Title: "Rust", Url: "https://example.com/rust"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, changes.Inserted)
+	require.Len(t, changes.Updated, 1)
+
+	bus.Publish(ctx, RunCompleted{Sources: 1, NewArticles: 2})
+
+	require.Eventually(t, func() bool {
+		return len(created.get()) == 2 && len(updated.get()) == 1 && len(completed.get()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// The events come along with the source of their article
+	event := created.get()[0].(ArticleCreated)
+	require.Equal(t, "Go", event.Article.Title)
+	require.Equal(t, "tech", event.Article.Source.Category)
+	require.Equal(t, "Go 2", updated.get()[0].(ArticleUpdated).Article.Title)
+	require.Equal(t, 2, completed.get()[0].(RunCompleted).NewArticles)
+
+	require.Eventually(t, func() bool {
+		return len(pendingEvents(t, store)) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+// Test that the events left in the outbox are relayed, and that failed ones are retried
+func TestEventBusRelay(t *testing.T) {
+	store := db.NewMemoryStore()
+	ctx := context.Background()
+
+	// Recorded by an instance that died before dispatching them
+	crashed := NewEventBus(store, EventBusOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	crashed.Publish(ctx, SourceFailed{Source: db.Source{Link: "https://example.com/rss"}, Error: "timeout"})
+	crashed.Publish(ctx, RunCompleted{Sources: 1, Failed: 1})
+	require.Len(t, pendingEvents(t, store), 2)
+
+	// The run subscriber fails twice before succeeding
+	bus := newTestEventBus(t, store)
+	var failed received
+	record[SourceFailed](bus, &failed)
+
+	var mu sync.Mutex
+	failures := 2
+	Subscribe(bus, "flaky", func(ctx context.Context, event RunCompleted) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("not now")
+		}
+		return nil
+	})
+	bus.Start()
+
+	require.Eventually(t, func() bool {
+		return len(pendingEvents(t, store)) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Len(t, failed.get(), 1)
+	require.Equal(t, "timeout", failed.get()[0].(SourceFailed).Error)
+
+	// A subscriber failing every time is given up after the maximum attempts
+	Subscribe(bus, "broken", func(ctx context.Context, event ArticleUpdated) error {
+		return errors.New("broken")
+	})
+	bus.Publish(ctx, ArticleUpdated{Article: db.Article{Title: "Go"}})
+
+	require.Eventually(t, func() bool {
+		return len(pendingEvents(t, store)) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+// Test that scraping publishes the failed sources and the completed runs
+func TestRunSourcesEvents(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	bus := newTestEventBus(t, store)
+	var created, failed, status, completed received
+	record[ArticleCreated](bus, &created)
+	record[SourceFailed](bus, &failed)
+	record[SourceStatusChanged](bus, &status)
+	record[RunCompleted](bus, &completed)
+	bus.Start()
+	scraper.SetEventBus(bus)
+
+	for _, path := range []string{"/rss.xml", "/error"} {
+		source := db.Source{
+			Link:     server.URL + path,
+			Provider: "fixture",
+			Category: "test",
+			Fetch:    &db.FetchSettings{Headers: map[string]string{"X-Api-Key": "secret"}},
+		}
+		require.NoError(t, store.CreateSource(ctx, &source))
+	}
+	require.Error(t, scraper.Run(ctx))
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(completed.get()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Len(t, created.get(), len(articles))
+	require.Len(t, failed.get(), 1)
+	require.Equal(t, server.URL+"/error", failed.get()[0].(SourceFailed).Source.Link)
+
+	// Only the failing source changed status, a healthy one is not reported on its first scrape
+	require.Len(t, status.get(), 1)
+	require.Equal(t, SourceFailing, status.get()[0].(SourceStatusChanged).Status)
+
+	// The fetch settings of the sources are not sent along with the events
+	for _, event := range append(created.get(), append(failed.get(), status.get()...)...) {
+		payload, err := json.Marshal(event)
+		require.NoError(t, err)
+		require.NotContains(t, string(payload), "secret")
+	}
+
+	run := completed.get()[0].(RunCompleted)
+	require.Equal(t, 2, run.Sources)
+	require.Equal(t, 1, run.Failed)
+	require.Equal(t, len(articles), run.NewArticles)
+	require.False(t, run.FinishedAt.Before(run.StartedAt))
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"golang.org/x/net/http/httpguts"
+)
+
+// Prefix of the encrypted credentials, naming the scheme in case it changes
+const credentialPrefix = "v1:"
+
+// Credentials can't be encrypted or decrypted without a key
+var ErrNoCredentialKey = errors.New("no credential key configured")
+
+// Encrypts the credentials of the sources with AES-256-GCM
+type CredentialCipher struct {
+	aead cipher.AEAD
+}
+
+// Constructor method for CredentialCipher, from a base64 encoded 32 bytes key
+func NewCredentialCipher(key string) (*CredentialCipher, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential key: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("invalid credential key: %d bytes instead of 32", len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialCipher{aead: aead}, nil
+}
+
+// Encrypt a credential with a random nonce
+func (credentials *CredentialCipher) Encrypt(plaintext string) (string, error) {
+	if credentials == nil {
+		return "", ErrNoCredentialKey
+	}
+
+	nonce := make([]byte, credentials.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := credentials.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return credentialPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a credential encrypted by Encrypt with the same key
+func (credentials *CredentialCipher) Decrypt(ciphertext string) (string, error) {
+	if credentials == nil {
+		return "", ErrNoCredentialKey
+	}
+
+	encoded, ok := strings.CutPrefix(ciphertext, credentialPrefix)
+	if !ok {
+		return "", errors.New("unknown credential encryption")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < credentials.aead.NonceSize() {
+		return "", errors.New("malformed credential")
+	}
+
+	nonce, sealed := sealed[:credentials.aead.NonceSize()], sealed[credentials.aead.NonceSize():]
+	plaintext, err := credentials.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("credential encrypted with another key")
+	}
+	return string(plaintext), nil
+}
+
+// Check the fetch settings of a source, which may be nil
+func ValidateFetchSettings(settings *db.FetchSettings) error {
+	if settings == nil {
+		return nil
+	}
+
+	if err := validateHeaders(settings.Headers); err != nil {
+		return err
+	}
+
+	switch settings.Auth {
+	case "":
+		if settings.Credential != "" || settings.Username != "" {
+			return errors.New("credentials need an auth type")
+		}
+	case db.FetchAuthBasic, db.FetchAuthBearer, db.FetchAuthCookie:
+		if settings.Credential == "" {
+			return fmt.Errorf("%s auth needs a credential", settings.Auth)
+		}
+		if settings.Auth == db.FetchAuthBasic && settings.Username == "" {
+			return errors.New("basic auth needs a username")
+		}
+		if settings.Auth != db.FetchAuthBasic && settings.Username != "" {
+			return errors.New("username is only for basic auth")
+		}
+	default:
+		return fmt.Errorf("unsupported auth type %q", settings.Auth)
+	}
+
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") || proxy.Host == "" {
+			return errors.New("invalid proxy url, http, https or socks5 expected")
+		}
+		if _, ok := proxy.User.Password(); ok {
+			return errors.New("the proxy password must be encrypted apart from the proxy url")
+		}
+		if settings.ProxyCredential != "" && proxy.User.Username() == "" {
+			return errors.New("proxy password needs a proxy username")
+		}
+	} else if settings.ProxyCredential != "" {
+		return errors.New("proxy password needs a proxy url")
+	}
+
+	if settings.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
+
+// Helper function: check the names and values of custom request headers
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	return nil
+}
+
+// Fetch settings of a source with its headers and credential decrypted, carried by the
+// context of its requests
+type fetchConfig struct {
+	hosts    map[string]bool // Hosts the headers and credential are sent to
+	header   http.Header
+	proxy    *url.URL
+	insecure bool
+}
+
+// Context key of the fetch config
+type fetchConfigKey struct{}
+
+// Helper function: attach the fetch settings of the source, and the headers of its JSON
+// request, to the context of its requests, decrypting them with decrypt
+func withFetchSettings(ctx context.Context, source db.Source, decrypt func(string) (string, error)) (context.Context, error) {
+	var requestHeaders map[string]string
+	if source.JSON != nil {
+		requestHeaders = source.JSON.Request.Headers
+	}
+
+	settings := source.Fetch
+	if settings == nil {
+		if len(requestHeaders) == 0 {
+			return ctx, nil
+		}
+		settings = &db.FetchSettings{}
+	}
+
+	config := &fetchConfig{hosts: make(map[string]bool), header: make(http.Header), insecure: settings.InsecureSkipVerify}
+
+	// Only the hosts of the source get the headers, not the ones it links or redirects to
+	links := []string{source.Link}
+	if source.JSON != nil && source.JSON.Request.URL != "" {
+		links = append(links, source.JSON.Request.URL)
+	}
+	for _, link := range links {
+		if parsed, err := url.Parse(link); err == nil && parsed.Host != "" {
+			config.hosts[strings.ToLower(parsed.Host)] = true
+		}
+	}
+
+	// The fetch settings apply to every type, over the JSON request
+	for _, headers := range []map[string]string{requestHeaders, settings.Headers} {
+		for name, value := range headers {
+			value, err := decryptHeader(decrypt, value)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting the header %s: %w", name, err)
+			}
+			config.header.Set(name, value)
+		}
+	}
+	if settings.Auth != "" {
+		credential, err := decrypt(settings.Credential)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting the source credential: %w", err)
+		}
+
+		switch settings.Auth {
+		case db.FetchAuthBasic:
+			request := http.Request{Header: make(http.Header)}
+			request.SetBasicAuth(settings.Username, credential)
+			config.header.Set("Authorization", request.Header.Get("Authorization"))
+		case db.FetchAuthBearer:
+			config.header.Set("Authorization", "Bearer "+credential)
+		case db.FetchAuthCookie:
+			config.header.Set("Cookie", credential)
+		}
+	}
+
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if settings.ProxyCredential != "" {
+			password, err := decrypt(settings.ProxyCredential)
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting the proxy password: %w", err)
+			}
+			proxy.User = url.UserPassword(proxy.User.Username(), password)
+		}
+		config.proxy = proxy
+	}
+
+	return context.WithValue(ctx, fetchConfigKey{}, config), nil
+}
+
+// Helper function: decrypt the value of a custom header. Values stored before the headers
+// were encrypted are sent as is, until the source is saved again.
+func decryptHeader(decrypt func(string) (string, error), value string) (string, error) {
+	if !strings.HasPrefix(value, credentialPrefix) {
+		return value, nil
+	}
+	return decrypt(value)
+}
+
+// Helper function: leave a secret as is, for the sources previewed before being stored
+func plaintext(value string) (string, error) {
+	return value, nil
+}
+
+// Helper function: the fetch config of a request, nil if none
+func fetchConfigOf(ctx context.Context) *fetchConfig {
+	config, _ := ctx.Value(fetchConfigKey{}).(*fetchConfig)
+	return config
+}
+
+// Transport of the scrapers, applying the fetch settings of the source in the context
+// of each request. Connections are pooled per proxy and TLS verification.
+type fetchTransport struct {
+	secure   *http.Transport
+	insecure *http.Transport
+}
+
+// Constructor method for fetchTransport
+func newFetchTransport() *fetchTransport {
+	secure := http.DefaultTransport.(*http.Transport).Clone()
+	secure.Proxy = fetchProxy
+
+	insecure := secure.Clone()
+	insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	return &fetchTransport{secure: secure, insecure: insecure}
+}
+
+// Send the request with the headers and through the transport of its fetch config
+func (transport *fetchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	config := fetchConfigOf(req.Context())
+	if config == nil {
+		return transport.secure.RoundTrip(req)
+	}
+
+	if len(config.header) > 0 && config.hosts[strings.ToLower(req.URL.Host)] {
+		// A RoundTripper must not change the request
+		req = req.Clone(req.Context())
+		for name, values := range config.header {
+			req.Header[name] = values
+		}
+	}
+
+	if config.insecure {
+		return transport.insecure.RoundTrip(req)
+	}
+	return transport.secure.RoundTrip(req)
+}
+
+// Helper function: the proxy of the fetch config of the request, the environment proxy
+// if none
+func fetchProxy(req *http.Request) (*url.URL, error) {
+	if config := fetchConfigOf(req.Context()); config != nil && config.proxy != nil {
+		return config.proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Feed fixtures served by the fixture server, path -> file in testdata and its content type
+var fixtures = map[string]struct {
+	file        string
+	contentType string
+}{
+	"/rss.xml":            {file: "rss2.xml", contentType: "application/rss+xml"},
+	"/atom.xml":           {file: "atom.xml", contentType: "application/atom+xml"},
+	"/feed.json":          {file: "feed.json", contentType: "application/feed+json"},
+	"/latin1.xml":         {file: "latin1.xml", contentType: "application/rss+xml"},
+	"/broken.xml":         {file: "broken.xml", contentType: "application/rss+xml"},
+	"/wrong-encoding.xml": {file: "wrong_encoding.xml", contentType: "application/rss+xml"},
+	"/blog.html":          {file: "blog.html", contentType: "text/html; charset=utf-8"},
+	"/posts.json":         {file: "posts.json", contentType: "application/json"},
+}
+
+// Start a local HTTP server serving the recorded feeds plus a few misbehaving endpoints:
+//   - /error always answers 500
+//   - /slow only answers after 5 seconds, or never if the client gives up first
+//   - /redirect permanently redirects to /rss.xml
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	for path, fixture := range fixtures {
+		content, err := os.ReadFile(filepath.Join("testdata", fixture.file))
+		if err != nil {
+			t.Fatalf("failed to read fixture %s: %v", fixture.file, err)
+		}
+
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", fixture.contentType)
+			w.Write(content)
+		})
+	}
+
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	})
+
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			http.Redirect(w, r, "/rss.xml", http.StatusFound)
+		}
+	})
+
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/rss.xml", http.StatusMovedPermanently)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Helper function: create a scraper backed by a fresh in-memory store
+func newTestScraper(t *testing.T) (*RssScraper, *db.MemoryStore) {
+	t.Helper()
+
+	store := db.NewMemoryStore()
+	return NewRssScraper(store, store, ScrapeOptions{}), store
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html/charset"
+)
+
+// Scrapes web pages without feed, extracting the articles with the CSS selectors of the source
+type HtmlScraper struct {
+	client *http.Client
+}
+
+// Constructor method for HtmlScraper
+func NewHtmlScraper(client *http.Client) *HtmlScraper {
+	return &HtmlScraper{client: client}
+}
+
+// Check that the selectors of an HTML source are set and valid
+func ValidateHTMLSelectors(selectors *db.HTMLSelectors) error {
+	if selectors == nil {
+		return errors.New("selectors are required")
+	}
+	if selectors.Item == "" {
+		return errors.New("item selector is required")
+	}
+	if selectors.Title == "" {
+		return errors.New("title selector is required")
+	}
+
+	for name, selector := range map[string]string{
+		"item":  selectors.Item,
+		"title": selectors.Title,
+		"link":  selectors.Link,
+		"image": selectors.Image,
+		"date":  selectors.Date,
+	} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("invalid %s selector %q: %w", name, selector, err)
+		}
+	}
+	return nil
+}
+
+// Fetch the page of the source and extract its articles. Items without title or link
+// are skipped, relative links are resolved against the page.
+func (scraper *HtmlScraper) Fetch(ctx context.Context, source db.Source) ([]db.Article, error) {
+	if err := ValidateHTMLSelectors(source.HTML); err != nil {
+		return nil, err
+	}
+
+	fetchCtx, span := startSpan(ctx, "scraper.fetch", attribute.String("url.full", source.Link))
+	body, err := fetchURL(fetchCtx, scraper.client, source.Link, nil)
+	recordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = startSpan(ctx, "scraper.parse", attribute.Int("page.bytes", len(body)))
+	defer span.End()
+
+	articles, err := extractArticles(source, body)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("page.items", len(articles)))
+
+	return articles, nil
+}
+
+// Helper function: parse an HTML page, decoding it from the charset declared in its
+// meta tags if not UTF-8
+func parseHTML(body []byte) (*goquery.Document, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), "")
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(reader)
+}
+
+// Helper function: extract the articles of an HTML page with the selectors of the source
+func extractArticles(source db.Source, body []byte) ([]db.Article, error) {
+	document, err := parseHTML(body)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(source.Link)
+	if err != nil {
+		return nil, err
+	}
+	if href, ok := document.Find("base[href]").First().Attr("href"); ok {
+		if resolved, err := base.Parse(href); err == nil {
+			base = resolved
+		}
+	}
+
+	selectors := source.HTML
+	articles := make([]db.Article, 0)
+	seen := make(map[string]bool)
+	document.Find(selectors.Item).Each(func(_ int, item *goquery.Selection) {
+		title := cleanText(item.Find(selectors.Title).First().Text())
+
+		var link *goquery.Selection
+		if selectors.Link != "" {
+			link = item.Find(selectors.Link).First()
+		} else {
+			// The item itself when it is a link
+			link = item.Filter("a[href]").AddSelection(item.Find("a[href]")).First()
+		}
+		href := resolveURL(base, link.AttrOr("href", ""))
+
+		if title == "" || href == "" || seen[href] {
+			return
+		}
+		seen[href] = true
+
+		article := db.Article{SourceID: source.ID, Title: title, Url: href}
+		if selectors.Image != "" {
+			image := item.Find(selectors.Image).First()
+			src := image.AttrOr("src", image.AttrOr("data-src", ""))
+			if src = resolveURL(base, src); src != "" {
+				article.Image = sql.NullString{String: src, Valid: true}
+			}
+		}
+		if selectors.Date != "" {
+			date := item.Find(selectors.Date).First()
+			article.PublishedDate = date.AttrOr("datetime", cleanText(date.Text()))
+		}
+
+		articles = append(articles, article)
+	})
+
+	return articles, nil
+}
+
+// Helper function: resolve a link of the page into an absolute http(s) URL, empty if invalid
+func resolveURL(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+
+	resolved, err := base.Parse(link)
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+		return ""
+	}
+	resolved.Fragment = ""
+	return resolved.String()
+}
+
+// Helper function: collapse the whitespace of a text
+func cleanText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the validation of the selectors of HTML sources
+func TestValidateHTMLSelectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		selectors *db.HTMLSelectors
+		valid     bool
+	}{
+		{"missing", nil, false},
+		{"no item", &db.HTMLSelectors{Title: "h2"}, false},
+		{"no title", &db.HTMLSelectors{Item: "article"}, false},
+		{"invalid", &db.HTMLSelectors{Item: "article", Title: "h2", Date: "time["}, false},
+		{"minimal", &db.HTMLSelectors{Item: "article", Title: "h2"}, true},
+		{"complete", &db.HTMLSelectors{Item: "article.post", Title: "h2 > a", Link: "h2 a", Image: "img.cover", Date: "time"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateHTMLSelectors(test.selectors)
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+// Test extracting the articles of a page with the selectors of its source
+func TestHtmlScraper(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper := NewHtmlScraper(http.DefaultClient)
+	ctx := context.Background()
+
+	source := db.Source{
+		Link: server.URL + "/blog.html",
+		Type: db.SourceTypeHTML,
+		HTML: &db.HTMLSelectors{Item: ".post", Title: ".post-title", Image: "img.cover", Date: "time, .date"},
+	}
+	source.ID = 7
+
+	articles, err := scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+
+	// Items without title or link are skipped, as well as the repeated links; relative
+	// links are resolved against the base of the page
+	titles := make([]string, len(articles))
+	for i, article := range articles {
+		titles[i] = article.Title
+		require.Equal(t, source.ID, article.SourceID)
+	}
+	require.Equal(t, []string{"Zero downtime migrations", "Caching at the edge", "Weekly notes"}, titles)
+
+	require.Equal(t, server.URL+"/blog/posts/zero-downtime-migrations", articles[0].Url)
+	require.Equal(t, server.URL+"/images/migrations.png", articles[0].Image.String)
+	require.Equal(t, "2025-03-02T09:00:00Z", articles[0].PublishedDate)
+
+	require.Equal(t, "https://cdn.example.com/posts/caching", articles[1].Url)
+	require.Equal(t, server.URL+"/blog/images/caching.png", articles[1].Image.String)
+	require.Equal(t, "February 14, 2025", articles[1].PublishedDate)
+
+	require.Equal(t, server.URL+"/blog/posts/weekly-notes", articles[2].Url)
+	require.False(t, articles[2].Image.Valid)
+
+	// An explicit link selector
+	source.HTML = &db.HTMLSelectors{Item: "article", Title: "h2", Link: "h2 > a"}
+	articles, err = scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+	require.Len(t, articles, 2)
+
+	// Invalid selectors and failing pages
+	source.HTML = &db.HTMLSelectors{Item: "article["}
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+
+	source.Link = server.URL + "/error"
+	source.HTML = &db.HTMLSelectors{Item: "article", Title: "h2"}
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+}
+
+// Test that sources are scraped by the scraper of their type
+func TestScrapeSourceTypes(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	page := db.Source{
+		Link: server.URL + "/blog.html",
+		Type: db.SourceTypeHTML,
+		HTML: &db.HTMLSelectors{Item: ".post", Title: ".post-title"},
+	}
+	require.NoError(t, store.CreateSource(ctx, &page))
+
+	inserted, err := scraper.Scrape(ctx, page)
+	require.NoError(t, err)
+	require.Equal(t, 3, inserted)
+
+	api := db.Source{
+		Link: server.URL + "/posts.json",
+		Type: db.SourceTypeJSON,
+		JSON: &db.JSONSource{Mapping: db.JSONMapping{Items: "data.posts", Title: "title", URL: "links.self"}},
+	}
+	require.NoError(t, store.CreateSource(ctx, &api))
+
+	inserted, err = scraper.Scrape(ctx, api)
+	require.NoError(t, err)
+	require.Equal(t, 3, inserted)
+
+	// Previewing stores nothing
+	articles, err := scraper.Preview(ctx, db.Source{Link: server.URL + "/rss.xml"})
+	require.NoError(t, err)
+	require.NotEmpty(t, articles)
+
+	stored, err := store.ListArticles(ctx, db.ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, stored, 6)
+
+	_, err = scraper.Scrape(ctx, db.Source{Link: server.URL + "/rss.xml", Type: "gopher"})
+	require.ErrorContains(t, err, "unsupported source type")
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/google/uuid"
+)
+
+// Status of a scraping job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Finished jobs are kept this long for their status to be read
+const jobRetention = time.Hour
+
+// Outcome of scraping one source in a job
+type JobSourceResult struct {
+	SourceID    uint
+	Link        string
+	NewArticles int
+	Skipped     bool // Another instance was scraping the source
+	Error       string
+	FinishedAt  time.Time
+}
+
+// Scraping job, of a single source or of every source (SourceID 0)
+type Job struct {
+	ID          string
+	SourceID    uint
+	Status      string
+	Total       int // Sources to scrape, known once the job is running
+	Done        int // Sources scraped so far
+	NewArticles int
+	Results     []JobSourceResult
+	Error       string
+	CreatedAt   time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// Helper method: whether the job is over
+func (job *Job) finished() bool {
+	return job.Status == JobSucceeded || job.Status == JobFailed
+}
+
+// Runs scraping jobs on demand, in the background, keeping their status in memory.
+// At most one job runs per scope (a source, or every source) at a time.
+type Jobs struct {
+	rss     *RssScraper
+	sources db.SourceStore
+	logger  *slog.Logger
+
+	// Context of the running jobs, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	active map[uint]string // Job ID by scope, while queued or running
+}
+
+// Constructor method for Jobs
+func NewJobs(rss *RssScraper, sources db.SourceStore, logger *slog.Logger) *Jobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Jobs{
+		rss:     rss,
+		sources: sources,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(map[string]*Job),
+		active:  make(map[uint]string),
+	}
+}
+
+// Enqueue a run scraping the source with the given ID, or every source if 0. If a
+// run of the same scope is already queued or running, that job is returned instead,
+// with created set to false. Returns db.ErrNotFound if the source doesn't exist.
+func (jobs *Jobs) EnqueueScrape(ctx context.Context, sourceID uint) (job Job, created bool, err error) {
+	if sourceID != 0 {
+		if _, err := jobs.sources.GetSource(ctx, sourceID); err != nil {
+			return Job{}, false, err
+		}
+	}
+
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	jobs.prune(time.Now())
+	if id, ok := jobs.active[sourceID]; ok {
+		return jobs.snapshot(jobs.jobs[id]), false, nil
+	}
+
+	queued := &Job{
+		ID:        uuid.NewString(),
+		SourceID:  sourceID,
+		Status:    JobQueued,
+		Results:   make([]JobSourceResult, 0),
+		CreatedAt: time.Now(),
+	}
+	jobs.jobs[queued.ID] = queued
+	jobs.active[sourceID] = queued.ID
+
+	jobs.wg.Add(1)
+	go jobs.run(queued)
+
+	return jobs.snapshot(queued), true, nil
+}
+
+// Get a job by ID, returns db.ErrNotFound if unknown or expired
+func (jobs *Jobs) Get(id string) (Job, error) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return Job{}, db.ErrNotFound
+	}
+
+	return jobs.snapshot(job), nil
+}
+
+// Wait for the running jobs, cancelling them if ctx is done first
+func (jobs *Jobs) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		jobs.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		jobs.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Helper method: run a job, recording its progress as each source finishes
+func (jobs *Jobs) run(job *Job) {
+	defer jobs.wg.Done()
+
+	sources, err := jobs.jobSources(job.SourceID)
+
+	jobs.mu.Lock()
+	job.Status = JobRunning
+	job.StartedAt = time.Now()
+	job.Total = len(sources)
+	jobs.mu.Unlock()
+
+	if err == nil {
+		err = jobs.rss.RunSources(jobs.ctx, sources, func(result SourceResult) {
+			jobs.mu.Lock()
+			defer jobs.mu.Unlock()
+
+			sourceResult := JobSourceResult{
+				SourceID:    result.Source.ID,
+				Link:        result.Source.Link,
+				NewArticles: result.NewArticles,
+				Skipped:     result.Skipped,
+				FinishedAt:  time.Now(),
+			}
+			if result.Err != nil {
+				sourceResult.Error = result.Err.Error()
+			}
+			job.Results = append(job.Results, sourceResult)
+			job.Done++
+			job.NewArticles += result.NewArticles
+		})
+	}
+
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	job.Status = JobSucceeded
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		jobs.logger.Error("Scraping job failed", "job", job.ID, "error", err)
+	}
+	job.FinishedAt = time.Now()
+	delete(jobs.active, job.SourceID)
+}
+
+// Helper method: the sources scraped by a job
+func (jobs *Jobs) jobSources(sourceID uint) ([]db.Source, error) {
+	if sourceID != 0 {
+		source, err := jobs.sources.GetSource(jobs.ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		return []db.Source{source}, nil
+	}
+
+	sources, err := jobs.sources.ListSources(jobs.ctx, db.SourceFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New("no rss source found in database")
+	}
+	return sources, nil
+}
+
+// Helper method: copy a job, so it can be read without holding the lock
+func (jobs *Jobs) snapshot(job *Job) Job {
+	copied := *job
+	copied.Results = append([]JobSourceResult(nil), job.Results...)
+	return copied
+}
+
+// Helper method: forget the jobs finished for longer than the retention
+func (jobs *Jobs) prune(now time.Time) {
+	for id, job := range jobs.jobs {
+		if job.finished() && now.Sub(job.FinishedAt) > jobRetention {
+			delete(jobs.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: wait for a job to finish and return it
+func waitJob(t *testing.T, jobs *Jobs, id string) Job {
+	t.Helper()
+
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = jobs.Get(id)
+		require.NoError(t, err)
+		return job.finished()
+	}, 3*time.Second, 10*time.Millisecond)
+
+	return job
+}
+
+// Test running scraping jobs on demand and reporting their results
+func TestJobs(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	jobs := NewJobs(scraper, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	healthy := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &healthy))
+	failing := db.Source{Link: server.URL + "/error", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &failing))
+
+	// A single source
+	job, created, err := jobs.EnqueueScrape(ctx, healthy.ID)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, healthy.ID, job.SourceID)
+
+	job = waitJob(t, jobs, job.ID)
+	require.Equal(t, JobSucceeded, job.Status)
+	require.Equal(t, 1, job.Total)
+	require.Equal(t, 1, job.Done)
+	require.Equal(t, 3, job.NewArticles)
+	require.Len(t, job.Results, 1)
+	require.Equal(t, healthy.Link, job.Results[0].Link)
+	require.Empty(t, job.Results[0].Error)
+
+	// Every source, the failing one fails the job while the healthy one finds nothing new
+	job, created, err = jobs.EnqueueScrape(ctx, 0)
+	require.NoError(t, err)
+	require.True(t, created)
+
+	job = waitJob(t, jobs, job.ID)
+	require.Equal(t, JobFailed, job.Status)
+	require.Equal(t, 2, job.Done)
+	require.Zero(t, job.NewArticles)
+	require.Contains(t, job.Error, failing.Link)
+
+	// Unknown source and job
+	_, _, err = jobs.EnqueueScrape(ctx, 100)
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = jobs.Get("unknown")
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
+
+// Test that a run already in progress is returned instead of starting another one
+func TestJobsDedupe(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	jobs := NewJobs(scraper, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	slow := db.Source{Link: server.URL + "/slow", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &slow))
+
+	first, created, err := jobs.EnqueueScrape(ctx, slow.ID)
+	require.NoError(t, err)
+	require.True(t, created)
+
+	second, created, err := jobs.EnqueueScrape(ctx, slow.ID)
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, first.ID, second.ID)
+
+	// Another scope gets its own job
+	all, created, err := jobs.EnqueueScrape(ctx, 0)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotEqual(t, first.ID, all.ID)
+
+	// Shutdown cancels the jobs stuck on the slow source
+	shutdownCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, jobs.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+	job, err := jobs.Get(first.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobFailed, job.Status)
+
+	// Finished, so the next request starts a new job
+	third, created, err := jobs.EnqueueScrape(ctx, slow.ID)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotEqual(t, first.ID, third.ID)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Unix times above this are taken as milliseconds, seconds would be past the year 5000
+const maxUnixSeconds = 1e11
+
+// Scrapes JSON APIs, extracting the articles with the gjson paths of the source
+type JsonScraper struct {
+	client *http.Client
+}
+
+// Constructor method for JsonScraper
+func NewJsonScraper(client *http.Client) *JsonScraper {
+	return &JsonScraper{client: client}
+}
+
+// Check that the request and mapping of a JSON source are set and valid
+func ValidateJSONSource(settings *db.JSONSource) error {
+	if settings == nil {
+		return errors.New("request and mapping are required")
+	}
+
+	if settings.Request.URL != "" {
+		endpoint, err := url.Parse(settings.Request.URL)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("invalid request url %q", settings.Request.URL)
+		}
+	}
+	if err := validateHeaders(settings.Request.Headers); err != nil {
+		return err
+	}
+
+	if settings.Mapping.Title == "" {
+		return errors.New("title path is required")
+	}
+	if settings.Mapping.URL == "" {
+		return errors.New("url path is required")
+	}
+	return nil
+}
+
+// Request the API of the source and extract its articles. Items without title or URL
+// are skipped, relative URLs are resolved against the endpoint.
+func (scraper *JsonScraper) Fetch(ctx context.Context, source db.Source) ([]db.Article, error) {
+	if err := ValidateJSONSource(source.JSON); err != nil {
+		return nil, err
+	}
+
+	endpoint := source.JSON.Request.URL
+	if endpoint == "" {
+		endpoint = source.Link
+	}
+	// The encrypted headers of the request are sent with the fetch settings
+	header := http.Header{"Accept": {"application/json"}}
+
+	fetchCtx, span := startSpan(ctx, "scraper.fetch", attribute.String("url.full", endpoint))
+	body, err := fetchURL(fetchCtx, scraper.client, endpoint, header)
+	recordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = startSpan(ctx, "scraper.parse", attribute.Int("response.bytes", len(body)))
+	defer span.End()
+
+	articles, err := mapArticles(source, endpoint, body)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("response.items", len(articles)))
+
+	return articles, nil
+}
+
+// Helper function: extract the articles of a JSON response with the mapping of the source
+func mapArticles(source db.Source, endpoint string, body []byte) ([]db.Article, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, errors.New("invalid JSON response")
+	}
+
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := source.JSON.Mapping
+	items := gjson.ParseBytes(body)
+	if mapping.Items != "" {
+		items = items.Get(mapping.Items)
+	}
+	if !items.IsArray() {
+		return nil, fmt.Errorf("items path %q is not an array", mapping.Items)
+	}
+
+	articles := make([]db.Article, 0)
+	seen := make(map[string]bool)
+	for _, item := range items.Array() {
+		title := cleanText(item.Get(mapping.Title).String())
+		link := resolveURL(base, item.Get(mapping.URL).String())
+		if title == "" || link == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		article := db.Article{SourceID: source.ID, Title: title, Url: link}
+		if mapping.Image != "" {
+			if image := resolveURL(base, item.Get(mapping.Image).String()); image != "" {
+				article.Image = sql.NullString{String: image, Valid: true}
+			}
+		}
+		if mapping.Date != "" {
+			article.PublishedDate = mapDate(item.Get(mapping.Date))
+		}
+
+		articles = append(articles, article)
+	}
+
+	return articles, nil
+}
+
+// Helper function: the date of an item as is, or formatted as RFC 3339 for Unix times
+func mapDate(date gjson.Result) string {
+	if date.Type != gjson.Number {
+		return cleanText(date.String())
+	}
+
+	unix := date.Int()
+	if unix <= 0 {
+		return ""
+	}
+	if unix > maxUnixSeconds {
+		return time.UnixMilli(unix).UTC().Format(time.RFC3339)
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
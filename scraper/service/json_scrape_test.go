@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the validation of the request and mapping of JSON sources
+func TestValidateJSONSource(t *testing.T) {
+	mapping := db.JSONMapping{Title: "title", URL: "url"}
+
+	tests := []struct {
+		name     string
+		settings *db.JSONSource
+		valid    bool
+	}{
+		{"missing", nil, false},
+		{"no title", &db.JSONSource{Mapping: db.JSONMapping{URL: "url"}}, false},
+		{"no url", &db.JSONSource{Mapping: db.JSONMapping{Title: "title"}}, false},
+		{"invalid endpoint", &db.JSONSource{Request: db.JSONRequest{URL: "ftp://example.com/posts"}, Mapping: mapping}, false},
+		{"invalid header name", &db.JSONSource{Request: db.JSONRequest{Headers: map[string]string{"Bad Header": "1"}}, Mapping: mapping}, false},
+		{"invalid header value", &db.JSONSource{Request: db.JSONRequest{Headers: map[string]string{"X-Version": "1\r\n"}}, Mapping: mapping}, false},
+		{"minimal", &db.JSONSource{Mapping: mapping}, true},
+		{"complete", &db.JSONSource{
+			Request: db.JSONRequest{URL: "https://api.example.com/v2/posts?limit=20", Headers: map[string]string{"X-Version": "2"}},
+			Mapping: db.JSONMapping{Items: "data.posts", Title: "title", URL: "links.self", Image: "cover.url", Date: "published_at"},
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateJSONSource(test.settings)
+			if test.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+// Test extracting the articles of an API response with the mapping of its source
+func TestJsonScraper(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper := NewJsonScraper(http.DefaultClient)
+	ctx := context.Background()
+
+	source := db.Source{
+		Link: server.URL + "/posts.json",
+		Type: db.SourceTypeJSON,
+		JSON: &db.JSONSource{Mapping: db.JSONMapping{
+			Items: "data.posts",
+			Title: "title",
+			URL:   "links.self",
+			Image: "cover.url",
+			Date:  "published_at",
+		}},
+	}
+	source.ID = 3
+
+	articles, err := scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+
+	// Items without title are skipped, as well as the repeated URLs; relative URLs are
+	// resolved against the endpoint
+	titles := make([]string, len(articles))
+	for i, article := range articles {
+		titles[i] = article.Title
+		require.Equal(t, source.ID, article.SourceID)
+	}
+	require.Equal(t, []string{"Shipping the new search", "Release notes 4.2", "Postmortem: queue backlog"}, titles)
+
+	require.Equal(t, server.URL+"/articles/new-search", articles[0].Url)
+	require.Equal(t, "https://cdn.example.com/search.png", articles[0].Image.String)
+	require.Equal(t, "2025-03-04T10:00:00Z", articles[0].PublishedDate)
+
+	// Unix times in seconds and milliseconds
+	require.Equal(t, "https://example.com/releases/4.2", articles[1].Url)
+	require.False(t, articles[1].Image.Valid)
+	require.Equal(t, "2025-03-10T10:00:00Z", articles[1].PublishedDate)
+	require.Equal(t, "2025-03-11T10:00:00Z", articles[2].PublishedDate)
+
+	// The items must be an array
+	source.JSON.Mapping.Items = "data"
+	_, err = scraper.Fetch(ctx, source)
+	require.ErrorContains(t, err, "not an array")
+
+	// Responses which are not JSON and failing endpoints
+	source.JSON.Mapping.Items = ""
+	source.Link = server.URL + "/blog.html"
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+
+	source.Link = server.URL + "/error"
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+}
+
+// Test that the endpoint and headers of the request are used instead of the link
+func TestJsonScraperRequest(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/posts" || r.Header.Get("X-Api-Version") != "2" || r.Header.Get("Accept") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name": "Hello", "href": "posts/hello"}]`))
+	}))
+	t.Cleanup(api.Close)
+
+	// The headers are encrypted, and sent with the fetch settings
+	scraper, _ := newTestScraper(t)
+	scraper.SetCredentialCipher(newTestCipher(t))
+	headers, err := scraper.EncryptHeaders(map[string]string{"x-api-version": "2"})
+	require.NoError(t, err)
+	require.NotEqual(t, "2", headers["x-api-version"])
+
+	source := db.Source{
+		Link: "https://example.com/blog",
+		Type: db.SourceTypeJSON,
+		JSON: &db.JSONSource{
+			Request: db.JSONRequest{URL: api.URL + "/v2/posts", Headers: headers},
+			Mapping: db.JSONMapping{Title: "name", URL: "href"},
+		},
+	}
+
+	articles, err := scraper.Preview(context.Background(), source)
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	require.Equal(t, "Hello", articles[0].Title)
+	require.Equal(t, api.URL+"/v2/posts/hello", articles[0].Url)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Prefix of the leases held by the instance running each scheduled job
+const schedulerLease = "scheduler"
+
+// Time a source lease is kept when scraping has no timeout, in case the holder crashes
+const defaultSourceLeaseTTL = 10 * time.Minute
+
+// Leases taken by this instance, to share the work with the other instances using the
+// same database. A nil *Leases always acquires, for a single instance setup.
+type Leases struct {
+	store  db.LeaseStore
+	holder string
+}
+
+// Constructor method for Leases, holder identifies this instance
+func NewLeases(store db.LeaseStore, holder string) *Leases {
+	return &Leases{store: store, holder: holder}
+}
+
+// Generate an identifier for this instance, unique across hosts and restarts
+func NewInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Identifier of this instance
+func (leases *Leases) Holder() string {
+	if leases == nil {
+		return ""
+	}
+	return leases.holder
+}
+
+// Acquire or renew the named lease for ttl
+func (leases *Leases) Acquire(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	if leases == nil {
+		return true, nil
+	}
+	return leases.store.AcquireLease(ctx, name, leases.holder, ttl)
+}
+
+// Release the named lease, if held
+func (leases *Leases) Release(ctx context.Context, name string) error {
+	if leases == nil {
+		return nil
+	}
+	return leases.store.ReleaseLease(ctx, name, leases.holder)
+}
+
+// Helper function: name of the lease of a source
+func sourceLease(id uint) string {
+	return "source:" + strconv.FormatUint(uint64(id), 10)
+}
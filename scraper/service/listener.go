@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Delay before reconnecting the listener, doubled after each failed attempt
+const (
+	minListenRetryDelay = time.Second
+	maxListenRetryDelay = 30 * time.Second
+)
+
+// Event listener metrics
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_received_total",
+		Help: "Events received through the outbox notifications, labeled by event type.",
+	}, []string{"type"})
+
+	listenerReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "event_listener_reconnects_total",
+		Help: "Connections of the event listener lost or failed.",
+	})
+)
+
+// Notifications of the events recorded in the outbox, implemented by db.PostgresListener
+type EventNotifications interface {
+	Listen(ctx context.Context, connected func(ctx context.Context) error, notify func(ctx context.Context, ids []uint)) error
+}
+
+// Dispatches the events recorded by every process sharing the database, such as a
+// separate worker, to the subscribers of this process, such as the live stream. Unlike
+// the event bus, each process gets the events and failed handlers are not retried.
+// After losing its connection, the listener reconnects and catches up with the events
+// recorded meanwhile.
+type EventListener struct {
+	eventSubscribers
+
+	store         db.OutboxStore
+	notifications EventNotifications
+	logger        *slog.Logger
+	retryDelay    time.Duration
+
+	// Only used by the listening goroutine
+	lastID    uint // Last event dispatched
+	connected bool // Whether the listener connected once, lastID is set from then on
+	listening bool // Whether the current attempt connected
+
+	// Context of the listener, cancelled on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	started bool
+	stopped chan struct{}
+}
+
+// Constructor method for EventListener
+func NewEventListener(store db.OutboxStore, notifications EventNotifications, logger *slog.Logger) *EventListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventListener{
+		store:         store,
+		notifications: notifications,
+		logger:        logger,
+		retryDelay:    minListenRetryDelay,
+		ctx:           ctx,
+		cancel:        cancel,
+		stopped:       make(chan struct{}),
+	}
+}
+
+// Start listening in the background, reconnecting until shutdown. Events recorded
+// before the first connection are not dispatched.
+func (listener *EventListener) Start() {
+	listener.started = true
+	go listener.run()
+}
+
+// Stop listening, waiting for the handlers in progress until ctx is done
+func (listener *EventListener) Shutdown(ctx context.Context) error {
+	listener.cancel()
+	if !listener.started {
+		return nil
+	}
+
+	select {
+	case <-listener.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Helper method: listen, then reconnect with an increasing delay each time the
+// connection is lost or fails
+func (listener *EventListener) run() {
+	defer close(listener.stopped)
+
+	delay := listener.retryDelay
+	for {
+		listener.listening = false
+		err := listener.notifications.Listen(listener.ctx, listener.onConnected, listener.onNotify)
+		if listener.ctx.Err() != nil {
+			return
+		}
+
+		// Start over from the shortest delay once a connection worked
+		if listener.listening {
+			delay = listener.retryDelay
+		}
+
+		listenerReconnects.Inc()
+		listener.logger.Warn("Event notifications lost, reconnecting", "error", err, "retry_in", delay)
+
+		select {
+		case <-listener.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxListenRetryDelay)
+	}
+}
+
+// Helper method: once listening, catch up with the events recorded since the last one
+// dispatched, if this is a reconnection
+func (listener *EventListener) onConnected(ctx context.Context) error {
+	listener.listening = true
+	if !listener.connected {
+		lastID, err := listener.store.LastEventID(ctx)
+		if err != nil {
+			return err
+		}
+		listener.lastID = lastID
+		listener.connected = true
+		listener.logger.Info("Listening to event notifications")
+		return nil
+	}
+
+	for {
+		records, err := listener.store.EventsAfter(ctx, listener.lastID, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		listener.dispatch(ctx, records)
+
+		if len(records) < outboxBatchSize {
+			listener.logger.Info("Listening to event notifications again", "last_event", listener.lastID)
+			return nil
+		}
+	}
+}
+
+// Helper method: dispatch the notified events
+func (listener *EventListener) onNotify(ctx context.Context, ids []uint) {
+	records, err := listener.store.GetEvents(ctx, ids)
+	if err != nil {
+		listener.logger.ErrorContext(ctx, "Failed to load notified events", "events", ids, "error", err)
+		return
+	}
+	listener.dispatch(ctx, records)
+}
+
+// Helper method: call the subscribers of each event, logging their failures
+func (listener *EventListener) dispatch(ctx context.Context, records []db.OutboxEvent) {
+	for _, record := range records {
+		listener.lastID = max(listener.lastID, record.ID)
+
+		event, err := listener.decode(record)
+		if err != nil {
+			listener.logger.ErrorContext(ctx, "Failed to decode event", "event", record.ID, "type", record.Type, "error", err)
+			continue
+		}
+		if event == nil {
+			continue
+		}
+
+		eventsReceived.WithLabelValues(record.Type).Inc()
+		for _, handler := range listener.of(record.Type) {
+			if err := handler.handle(ctx, event); err != nil {
+				eventHandlerErrors.WithLabelValues(record.Type, handler.name).Inc()
+				listener.logger.ErrorContext(ctx, "Event subscriber failed", "event", record.ID, "type", record.Type, "subscriber", handler.name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Notifications of a test, each connection reading its notifications from the next
+// session sent; closing the session loses the connection
+type testNotifications struct {
+	sessions chan chan []uint
+}
+
+func (notifications *testNotifications) Listen(ctx context.Context, connected func(ctx context.Context) error, notify func(ctx context.Context, ids []uint)) error {
+	var session chan []uint
+	select {
+	case session = <-notifications.sessions:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := connected(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ids, ok := <-session:
+			if !ok {
+				return errors.New("connection lost")
+			}
+			notify(ctx, ids)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Helper function: record an article.created event, returning its ID
+func recordArticleCreated(t *testing.T, store db.OutboxStore, title string) uint {
+	t.Helper()
+
+	records, err := newOutboxEvents([]Event{ArticleCreated{Article: db.Article{Title: title}}})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateEvents(context.Background(), records))
+	return records[0].ID
+}
+
+// Helper function: titles of the received article.created events
+func createdTitles(received *received) []string {
+	titles := make([]string, 0)
+	for _, event := range received.get() {
+		titles = append(titles, event.(ArticleCreated).Article.Title)
+	}
+	return titles
+}
+
+// Test that the notified events reach the subscribers, including the ones recorded
+// while the connection was lost
+func TestEventListener(t *testing.T) {
+	store := db.NewMemoryStore()
+	notifications := &testNotifications{sessions: make(chan chan []uint)}
+	listener := NewEventListener(store, notifications, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	listener.retryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { listener.Shutdown(context.Background()) })
+
+	var created received
+	record[ArticleCreated](listener, &created)
+
+	// Recorded before listening, never dispatched
+	recordArticleCreated(t, store, "old")
+
+	listener.Start()
+	session := make(chan []uint)
+	notifications.sessions <- session
+
+	id := recordArticleCreated(t, store, "first")
+	session <- []uint{id}
+	require.Eventually(t, func() bool {
+		return len(created.get()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// Recorded while disconnected, caught up once connected again
+	close(session)
+	recordArticleCreated(t, store, "missed")
+	session = make(chan []uint)
+	notifications.sessions <- session
+
+	id = recordArticleCreated(t, store, "second")
+	session <- []uint{id, 9999}
+	require.Eventually(t, func() bool {
+		return len(created.get()) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"first", "missed", "second"}, createdTitles(&created))
+
+	require.NoError(t, listener.Shutdown(context.Background()))
+}
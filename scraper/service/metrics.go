@@ -0,0 +1,131 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Health status of a source, from the outcome of its last scrape
+const (
+	SourceHealthy = "healthy"
+	SourceFailing = "failing"
+)
+
+// Scraper metrics, labeled by source ID
+var (
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_fetch_duration_seconds",
+		Help:    "Duration of fetching and parsing the feed of a source.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"source"})
+
+	articlesInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_articles_inserted_total",
+		Help: "Articles inserted by scraping a source.",
+	}, []string{"source"})
+
+	articlesDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_articles_duplicate_total",
+		Help: "Scraped articles skipped because their URL was already stored.",
+	}, []string{"source"})
+
+	scrapeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_errors_total",
+		Help: "Failed scrapes of a source.",
+	}, []string{"source"})
+
+	sourcesByHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scraper_sources",
+		Help: "Scraped sources by health status of their last scrape.",
+	}, []string{"status"})
+
+	lastSourceSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scraper_source_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful scrape of a source.",
+	}, []string{"source"})
+
+	lastRunSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scraper_last_success_timestamp_seconds",
+		Help: "Unix time of the last scraping run without errors.",
+	})
+)
+
+// Health of the scraped sources, to keep the health gauges up to date
+type sourceHealth struct {
+	mu     sync.Mutex
+	status map[uint]string
+}
+
+// Helper method: record the outcome of a scrape and refresh the metrics, returning
+// whether the status of the source changed. Only failing counts as a change for a
+// source not scraped by this process before.
+func (health *sourceHealth) record(source db.Source, err error) bool {
+	label := strconv.FormatUint(uint64(source.ID), 10)
+	if err != nil {
+		scrapeErrors.WithLabelValues(label).Inc()
+	} else {
+		lastSourceSuccess.WithLabelValues(label).SetToCurrentTime()
+	}
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	if health.status == nil {
+		health.status = make(map[uint]string)
+	}
+
+	previous, known := health.status[source.ID]
+	status := SourceHealthy
+	if err != nil {
+		status = SourceFailing
+	}
+	health.status[source.ID] = status
+	health.refresh()
+
+	if !known {
+		return status == SourceFailing
+	}
+	return status != previous
+}
+
+// Helper method: forget the sources that are no longer scraped
+func (health *sourceHealth) keep(sources []db.Source) {
+	ids := make(map[uint]bool, len(sources))
+	for _, source := range sources {
+		ids[source.ID] = true
+	}
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	for id := range health.status {
+		if !ids[id] {
+			delete(health.status, id)
+			label := strconv.FormatUint(uint64(id), 10)
+			lastSourceSuccess.DeleteLabelValues(label)
+		}
+	}
+	health.refresh()
+}
+
+// Helper method: set the health gauges from the status of every source, the lock must be held
+func (health *sourceHealth) refresh() {
+	counts := map[string]int{SourceHealthy: 0, SourceFailing: 0}
+	for _, status := range health.status {
+		counts[status]++
+	}
+
+	for status, count := range counts {
+		sourcesByHealth.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+// Helper function: record a successful scraping run
+func recordRunSuccess(at time.Time) {
+	lastRunSuccess.Set(float64(at.Unix()))
+}
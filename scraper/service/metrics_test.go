@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the scraper metrics recorded for healthy and failing sources. Metrics are
+// global and source IDs repeat across tests, so only the changes are compared.
+func TestScrapeMetrics(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	healthy := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &healthy))
+	failing := db.Source{Link: server.URL + "/error", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &failing))
+
+	healthyLabel := strconv.FormatUint(uint64(healthy.ID), 10)
+	failingLabel := strconv.FormatUint(uint64(failing.ID), 10)
+
+	inserted := testutil.ToFloat64(articlesInserted.WithLabelValues(healthyLabel))
+	duplicate := testutil.ToFloat64(articlesDuplicate.WithLabelValues(healthyLabel))
+	errors := testutil.ToFloat64(scrapeErrors.WithLabelValues(failingLabel))
+
+	// The second scrape only finds duplicates
+	require.Error(t, scraper.Run(ctx))
+	require.Error(t, scraper.Run(ctx))
+
+	require.Equal(t, inserted+3, testutil.ToFloat64(articlesInserted.WithLabelValues(healthyLabel)))
+	require.Equal(t, duplicate+3, testutil.ToFloat64(articlesDuplicate.WithLabelValues(healthyLabel)))
+	require.Equal(t, errors+2, testutil.ToFloat64(scrapeErrors.WithLabelValues(failingLabel)))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(sourcesByHealth.WithLabelValues(SourceHealthy)))
+	require.Equal(t, 1.0, testutil.ToFloat64(sourcesByHealth.WithLabelValues(SourceFailing)))
+	require.NotZero(t, testutil.ToFloat64(lastSourceSuccess.WithLabelValues(healthyLabel)))
+}
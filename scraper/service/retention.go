@@ -0,0 +1,280 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Purge counts of a single source in a retention run
+type RetentionReport struct {
+	SourceID uint   `json:"source_id"`
+	Link     string `json:"link"`
+	PolicyID uint   `json:"policy_id"`
+	Deleted  int    `json:"deleted"`
+	Archived int    `json:"archived"`
+}
+
+// Line of the NDJSON archive
+type ArchivedArticle struct {
+	ID            uint      `json:"id"`
+	SourceID      uint      `json:"source_id"`
+	SourceLink    string    `json:"source_link"`
+	Category      string    `json:"category"`
+	Title         string    `json:"title"`
+	Url           string    `json:"url"`
+	Image         *string   `json:"image"`
+	PublishedDate string    `json:"published_date"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Retention job: removes articles that fall outside their source's retention policy
+type Retention struct {
+	sources    db.SourceStore
+	store      db.RetentionStore
+	archiveDir string
+	logger     *slog.Logger
+}
+
+// Constructor method for Retention. Archives are written as gzip compressed NDJSON in archiveDir.
+func NewRetention(sources db.SourceStore, store db.RetentionStore, archiveDir string, logger *slog.Logger) *Retention {
+	return &Retention{
+		sources:    sources,
+		store:      store,
+		archiveDir: archiveDir,
+		logger:     logger,
+	}
+}
+
+// Pick the policy of a source: source specific first, then category, then global.
+// Among policies of the same level, the first created one wins.
+func ResolvePolicy(policies []db.RetentionPolicy, source db.Source) *db.RetentionPolicy {
+	var category, global *db.RetentionPolicy
+	for i := range policies {
+		policy := &policies[i]
+		switch {
+		case policy.SourceID != nil:
+			if *policy.SourceID == source.ID {
+				return policy
+			}
+		case policy.Category != "":
+			if policy.Category == source.Category && category == nil {
+				category = policy
+			}
+		default:
+			if global == nil {
+				global = policy
+			}
+		}
+	}
+
+	if category != nil {
+		return category
+	}
+
+	return global
+}
+
+// Run the retention job once and record it in the run history
+func (retention *Retention) Run(ctx context.Context) (db.RetentionRun, error) {
+	run := db.RetentionRun{StartedAt: time.Now()}
+
+	reports, err := retention.purge(ctx, &run)
+	if data, marshalErr := json.Marshal(reports); marshalErr == nil {
+		run.Report = string(data)
+	}
+
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now()
+
+	if recordErr := retention.store.CreateRetentionRun(ctx, &run); recordErr != nil {
+		return run, errors.Join(err, fmt.Errorf("failed to record retention run: %w", recordErr))
+	}
+
+	return run, err
+}
+
+// Helper method: find expired articles, archive the ones whose policy asks for it, then delete them.
+// Nothing is deleted unless the archive has been fully written.
+func (retention *Retention) purge(ctx context.Context, run *db.RetentionRun) ([]RetentionReport, error) {
+	reports := make([]RetentionReport, 0)
+
+	policies, err := retention.store.ListRetentionPolicies(ctx)
+	if err != nil {
+		return reports, err
+	}
+
+	if len(policies) == 0 {
+		return reports, nil
+	}
+
+	// Deleted sources keep their articles until purged, under the same policies
+	sources, err := retention.sources.ListSources(ctx, db.SourceFilter{})
+	if err != nil {
+		return reports, err
+	}
+
+	deleted, err := retention.sources.ListSources(ctx, db.SourceFilter{Deleted: true})
+	if err != nil {
+		return reports, err
+	}
+	sources = append(sources, deleted...)
+
+	// Collect the expired articles of every source
+	var (
+		archive    *archiveWriter
+		expiredIDs = make([][]uint, 0)
+	)
+	for _, source := range sources {
+		policy := ResolvePolicy(policies, source)
+		if policy == nil {
+			continue
+		}
+
+		var cutoff time.Time
+		if policy.MaxAgeDays > 0 {
+			cutoff = run.StartedAt.AddDate(0, 0, -policy.MaxAgeDays)
+		}
+
+		expired, err := retention.store.ExpiredArticles(ctx, source.ID, cutoff, policy.KeepLast)
+		if err != nil {
+			archive.abort()
+			return reports, err
+		}
+
+		if len(expired) == 0 {
+			continue
+		}
+
+		report := RetentionReport{SourceID: source.ID, Link: source.Link, PolicyID: policy.ID}
+		if policy.Archive {
+			if archive == nil {
+				archive, err = newArchiveWriter(retention.archiveDir, run.StartedAt)
+				if err != nil {
+					return reports, err
+				}
+			}
+
+			for _, article := range expired {
+				article.Source = source
+				if err := archive.write(article); err != nil {
+					archive.abort()
+					return reports, err
+				}
+			}
+			report.Archived = len(expired)
+		}
+
+		ids := make([]uint, len(expired))
+		for i, article := range expired {
+			ids[i] = article.ID
+		}
+		expiredIDs = append(expiredIDs, ids)
+		reports = append(reports, report)
+	}
+
+	if archive != nil {
+		if err := archive.close(); err != nil {
+			return reports, err
+		}
+		run.ArchiveFile = archive.path
+	}
+
+	// Everything that must be archived is on disk now
+	for i := range reports {
+		deleted, err := retention.store.PurgeArticles(ctx, expiredIDs[i])
+		reports[i].Deleted = deleted
+		run.Deleted += deleted
+		run.Archived += reports[i].Archived
+		if err != nil {
+			return reports, err
+		}
+	}
+
+	retention.logger.Info("Retention run completed", "deleted", run.Deleted, "archived", run.Archived)
+	return reports, nil
+}
+
+// Gzip compressed NDJSON file of archived articles
+type archiveWriter struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+// Helper function: create the archive file for a run
+func newArchiveWriter(dir string, startedAt time.Time) (*archiveWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("articles-%s.ndjson.gz", startedAt.UTC().Format("20060102-150405")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(file)
+	return &archiveWriter{
+		path:    path,
+		file:    file,
+		gz:      gz,
+		encoder: json.NewEncoder(gz),
+	}, nil
+}
+
+// Append an article to the archive
+func (archive *archiveWriter) write(article db.Article) error {
+	var image *string = nil
+	if article.Image.Valid {
+		image = &article.Image.String
+	}
+
+	return archive.encoder.Encode(ArchivedArticle{
+		ID:            article.ID,
+		SourceID:      article.SourceID,
+		SourceLink:    article.Source.Link,
+		Category:      article.Source.Category,
+		Title:         article.Title,
+		Url:           article.Url,
+		Image:         image,
+		PublishedDate: article.PublishedDate,
+		CreatedAt:     article.CreatedAt,
+	})
+}
+
+// Flush and sync the archive to disk
+func (archive *archiveWriter) close() error {
+	if err := archive.gz.Close(); err != nil {
+		archive.abort()
+		return err
+	}
+
+	if err := archive.file.Sync(); err != nil {
+		archive.abort()
+		return err
+	}
+
+	return archive.file.Close()
+}
+
+// Drop a partially written archive. Safe to call on a nil archive.
+func (archive *archiveWriter) abort() {
+	if archive == nil {
+		return
+	}
+
+	archive.file.Close()
+	os.Remove(archive.path)
+}
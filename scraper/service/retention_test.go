@@ -0,0 +1,223 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Test picking the most specific policy of a source
+func TestResolvePolicy(t *testing.T) {
+	sourceID := uint(2)
+	policies := []db.RetentionPolicy{
+		{MaxAgeDays: 90},
+		{Category: "news", KeepLast: 10},
+		{Category: "news", KeepLast: 20},
+		{SourceID: &sourceID, MaxAgeDays: 7},
+	}
+	for i := range policies {
+		policies[i].ID = uint(i + 1)
+	}
+
+	testCases := []struct {
+		name   string
+		source db.Source
+		want   uint
+	}{
+		{name: "SourcePolicy", source: db.Source{Category: "news"}, want: 4},
+		{name: "CategoryPolicy", source: db.Source{Category: "news"}, want: 2},
+		{name: "GlobalPolicy", source: db.Source{Category: "engineering"}, want: 1},
+	}
+	testCases[0].source.ID = 2
+	testCases[1].source.ID = 3
+	testCases[2].source.ID = 4
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := ResolvePolicy(policies, tc.source)
+			require.NotNil(t, policy)
+			require.Equal(t, tc.want, policy.ID)
+		})
+	}
+
+	require.Nil(t, ResolvePolicy(policies[1:3], db.Source{Category: "engineering"}))
+}
+
+// Test a retention run with age and count based policies, archival and starred exemption
+func TestRetentionRun(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	archiveDir := t.TempDir()
+	retention := NewRetention(store, store, archiveDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Two sources, each with 5 articles created 0 to 4 weeks ago
+	news := db.Source{Link: "https://news.example.com/rss", Provider: "news", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &news))
+	blog := db.Source{Link: "https://blog.example.com/rss", Provider: "blog", Category: "engineering"}
+	require.NoError(t, store.CreateSource(ctx, &blog))
+
+	for _, source := range []db.Source{news, blog} {
+		for week := range 5 {
+			articles, err := store.UpsertArticles(ctx, []db.Article{{
+				SourceID: source.ID,
+				Title:    fmt.Sprintf("%s week %d", source.Provider, week),
+				Url:      fmt.Sprintf("%s/%d", source.Link, week),
+			}})
+			require.NoError(t, err)
+
+			article := articles[0]
+			article.CreatedAt = time.Now().AddDate(0, 0, -7*week)
+			article.Starred = source.ID == blog.ID && week == 4
+			require.NoError(t, store.UpdateArticle(ctx, &article))
+		}
+	}
+
+	// No policy, nothing happens
+	run, err := retention.Run(ctx)
+	require.NoError(t, err)
+	require.Zero(t, run.Deleted)
+
+	// News keeps its 2 most recent articles and archives the rest,
+	// everything else is deleted after 10 days
+	require.NoError(t, store.CreateRetentionPolicy(ctx, &db.RetentionPolicy{Category: "news", KeepLast: 2, Archive: true}))
+	require.NoError(t, store.CreateRetentionPolicy(ctx, &db.RetentionPolicy{MaxAgeDays: 10}))
+
+	run, err = retention.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3+2, run.Deleted)
+	require.Equal(t, 3, run.Archived)
+	require.NotEmpty(t, run.ArchiveFile)
+
+	var reports []RetentionReport
+	require.NoError(t, json.Unmarshal([]byte(run.Report), &reports))
+	require.Len(t, reports, 2)
+
+	// Remaining articles: 2 news, 2 recent blog posts and the starred old one
+	remaining, err := store.ListArticles(ctx, db.ArticleFilter{SourceID: news.ID})
+	require.NoError(t, err)
+	require.Len(t, remaining, 2)
+
+	remaining, err = store.ListArticles(ctx, db.ArticleFilter{SourceID: blog.ID})
+	require.NoError(t, err)
+	require.Len(t, remaining, 3)
+
+	// The archive holds the 3 oldest news articles
+	file, err := os.Open(run.ArchiveFile)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	titles := make([]string, 0)
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var archived ArchivedArticle
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &archived))
+		require.Equal(t, "news", archived.Category)
+		titles = append(titles, archived.Title)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []string{"news week 4", "news week 3", "news week 2"}, titles)
+
+	// Running again purges nothing and the history has every run
+	run, err = retention.Run(ctx)
+	require.NoError(t, err)
+	require.Zero(t, run.Deleted)
+	require.Empty(t, run.ArchiveFile)
+
+	runs, err := store.ListRetentionRuns(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	require.Equal(t, 5, runs[1].Deleted)
+}
+
+// Test that scraping a feed again does not store back the articles purged from it
+func TestRetentionRescrape(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	retention := NewRetention(store, store, t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	bus := newTestEventBus(t, store)
+	var created received
+	record[ArticleCreated](bus, &created)
+	bus.Start()
+	scraper.SetEventBus(bus)
+
+	source := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	inserted, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Greater(t, inserted, 1)
+
+	require.NoError(t, store.CreateRetentionPolicy(ctx, &db.RetentionPolicy{KeepLast: 1}))
+	run, err := retention.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, inserted-1, run.Deleted)
+
+	// The feed still lists the purged articles
+	again, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Zero(t, again)
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+
+	require.Eventually(t, func() bool {
+		return len(created.get()) == inserted
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Empty(t, pendingEvents(t, store))
+	require.Len(t, created.get(), inserted)
+}
+
+// Test that the articles of a deleted source are purged under its policy too
+func TestRetentionDeletedSource(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	retention := NewRetention(store, store, t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	source := db.Source{Link: "https://news.example.com/rss", Provider: "news", Category: "news"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	for week := range 3 {
+		articles, err := store.UpsertArticles(ctx, []db.Article{{
+			SourceID: source.ID,
+			Title:    fmt.Sprintf("week %d", week),
+			Url:      fmt.Sprintf("%s/%d", source.Link, week),
+		}})
+		require.NoError(t, err)
+
+		article := articles[0]
+		article.CreatedAt = time.Now().AddDate(0, 0, -7*week)
+		require.NoError(t, store.UpdateArticle(ctx, &article))
+	}
+
+	require.NoError(t, store.CreateRetentionPolicy(ctx, &db.RetentionPolicy{MaxAgeDays: 5, Archive: true}))
+	require.NoError(t, store.DeleteSource(ctx, source.ID))
+
+	run, err := retention.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, run.Deleted)
+	require.Equal(t, 2, run.Archived)
+
+	// Restoring the source only brings back the article within the policy
+	_, err = store.RestoreSource(ctx, source.ID)
+	require.NoError(t, err)
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{SourceID: source.ID})
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	require.Equal(t, "week 0", articles[0].Title)
+}
@@ -1,40 +1,540 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/danglnh07/newsaggr/scraper/db"
 	"github.com/mmcdole/gofeed"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html/charset"
 )
 
-// Scraper struct
+// Fetches the articles of the sources of a type, without storing them
+type Scraper interface {
+	Fetch(ctx context.Context, source db.Source) ([]db.Article, error)
+}
+
+// Scraper struct. It fetches the RSS sources, and runs the scraping of every source
+// with the scraper of its type.
 type RssScraper struct {
-	queries *db.Queries
+	sources  db.SourceStore
+	articles db.ArticleStore
+	options  ScrapeOptions
+	client   *http.Client
+	health   sourceHealth
+	leases   *Leases
+	events   *EventBus
+	websub   *WebSub
+	scrapers map[string]Scraper // By source type
+
+	credentials *CredentialCipher // Decrypts the credentials of the sources, nil if no key
+}
+
+// Limits of the scraper, zero values mean no limit
+type ScrapeOptions struct {
+	Concurrency int           // Sources scraped at the same time by Run
+	Timeout     time.Duration // Time allowed to scrape a single source
+
+	// Hosts of the link wrappers, such as FeedBurner's, whose new article links are
+	// followed to the article they redirect to
+	RedirectHosts []string
+
+	// Fetch the pages of the new articles for their <link rel="canonical">, following the
+	// redirects of any link
+	CanonicalLinks bool
+}
+
+// Constructor method for Scraper. Every type fetches with the same client, which applies
+// the fetch settings of the source being scraped.
+func NewRssScraper(sources db.SourceStore, articles db.ArticleStore, options ScrapeOptions) *RssScraper {
+	client := &http.Client{Transport: otelhttp.NewTransport(newFetchTransport())}
+	scraper := &RssScraper{
+		sources:  sources,
+		articles: articles,
+		options:  options,
+		client:   client,
+	}
+
+	scraper.scrapers = map[string]Scraper{
+		db.SourceTypeRSS:     scraper,
+		db.SourceTypeHTML:    NewHtmlScraper(client),
+		db.SourceTypeJSON:    NewJsonScraper(client),
+		db.SourceTypeSitemap: NewSitemapScraper(client, articles),
+	}
+	return scraper
+}
+
+// Scrape the sources of the type with the given scraper
+func (scraper *RssScraper) SetScraper(sourceType string, typeScraper Scraper) {
+	scraper.scrapers[sourceType] = typeScraper
+}
+
+// Fetch the articles of the source with the scraper of its type, without storing them
+func (scraper *RssScraper) Preview(ctx context.Context, source db.Source) ([]db.Article, error) {
+	return scraper.preview(ctx, source, scraper.credentials.Decrypt)
 }
 
-// Constructor method for Scraper
-func NewRssScraper(queries *db.Queries) *RssScraper {
-	return &RssScraper{
-		queries: queries,
+// Fetch the articles of a source that is not stored, whose custom headers and credentials
+// are given in plaintext, so that no credential key is needed
+func (scraper *RssScraper) PreviewPlaintext(ctx context.Context, source db.Source) ([]db.Article, error) {
+	return scraper.preview(ctx, source, plaintext)
+}
+
+// Helper method: fetch the articles of the source, decrypting its secrets with decrypt
+func (scraper *RssScraper) preview(ctx context.Context, source db.Source, decrypt func(string) (string, error)) ([]db.Article, error) {
+	typeScraper, err := scraper.scraperOf(source)
+	if err != nil {
+		return nil, err
 	}
+
+	if timeout := scraper.timeoutOf(source); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, err = withFetchSettings(ctx, source, decrypt)
+	if err != nil {
+		return nil, err
+	}
+	return typeScraper.Fetch(ctx, source)
 }
 
-// Scrape from an individual RSS source
-func (scraper *RssScraper) Scrape(source db.Source) error {
-	// Avoid nil slice
-	articles := make([]db.Article, 0)
+// Check that a sitemap source has titles to store, see SitemapScraper.CheckTitles. Other
+// types, and sitemaps scraped by another scraper, always pass.
+func (scraper *RssScraper) CheckSitemap(ctx context.Context, source db.Source) error {
+	sitemap, ok := scraper.scrapers[db.SourceTypeSitemap].(*SitemapScraper)
+	if source.Type != db.SourceTypeSitemap || !ok {
+		return nil
+	}
+
+	if timeout := scraper.timeoutOf(source); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	// Parse the RSS feed
-	parser := gofeed.NewParser()
-	feed, err := parser.ParseURL(source.Link)
+	ctx, err := withFetchSettings(ctx, source, scraper.credentials.Decrypt)
 	if err != nil {
 		return err
 	}
+	return sitemap.CheckTitles(ctx, source)
+}
+
+// Helper method: time allowed to scrape the source, its own timeout if set
+func (scraper *RssScraper) timeoutOf(source db.Source) time.Duration {
+	if source.Fetch != nil && source.Fetch.Timeout > 0 {
+		return source.Fetch.Timeout
+	}
+	return scraper.options.Timeout
+}
+
+// Fetch the articles of an RSS source
+func (scraper *RssScraper) Fetch(ctx context.Context, source db.Source) ([]db.Article, error) {
+	articles, _, err := scraper.fetchRSS(ctx, source)
+	return articles, err
+}
+
+// Helper method: fetch the articles of an RSS source, along with the WebSub links of its feed
+func (scraper *RssScraper) fetchRSS(ctx context.Context, source db.Source) ([]db.Article, webSubLinks, error) {
+	feed, links, err := scraper.fetchFeed(ctx, source.Link)
+	if err != nil {
+		return nil, webSubLinks{}, err
+	}
+	return scraper.toArticles(source, feed), links.webSub(), nil
+}
+
+// Helper method: the scraper of the type of the source, RSS if not set
+func (scraper *RssScraper) scraperOf(source db.Source) (Scraper, error) {
+	sourceType := source.Type
+	if sourceType == "" {
+		sourceType = db.SourceTypeRSS
+	}
+
+	typeScraper, ok := scraper.scrapers[sourceType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported source type %q", sourceType)
+	}
+	return typeScraper, nil
+}
+
+// Take a lease on each source before scraping it in RunSources, so that the sources
+// are shared with the other instances instead of being scraped by all of them
+func (scraper *RssScraper) SetLeases(leases *Leases) {
+	scraper.leases = leases
+}
+
+// Decrypt the credentials of the sources with the cipher, and encrypt the new ones
+func (scraper *RssScraper) SetCredentialCipher(credentials *CredentialCipher) {
+	scraper.credentials = credentials
+}
+
+// Encrypt a credential of a source, failing with ErrNoCredentialKey if no key is configured
+func (scraper *RssScraper) EncryptCredential(credential string) (string, error) {
+	return scraper.credentials.Encrypt(credential)
+}
+
+// Check then encrypt the values of custom request headers, nil if there are none. Fails
+// with ErrNoCredentialKey if no key is configured.
+func (scraper *RssScraper) EncryptHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if err := validateHeaders(headers); err != nil {
+		return nil, err
+	}
+
+	encrypted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		value, err := scraper.credentials.Encrypt(value)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[name] = value
+	}
+	return encrypted, nil
+}
+
+// Subscribe to the WebSub hubs advertised by the scraped feeds, and leave the sources
+// pushed by their hub out of Run
+func (scraper *RssScraper) SetWebSub(websub *WebSub) {
+	scraper.websub = websub
+}
+
+// Save the articles through the event bus, which records an event for each new or
+// changed article, and publish the failed sources and the completed runs
+func (scraper *RssScraper) SetEventBus(events *EventBus) {
+	scraper.events = events
+}
+
+// Outcome of scraping a source
+type SourceResult struct {
+	Source      db.Source
+	NewArticles int
+	Skipped     bool // Another instance was scraping the source
+	Err         error
+}
+
+// Scrape from an individual source, returning the number of new articles
+func (scraper *RssScraper) Scrape(ctx context.Context, source db.Source) (int, error) {
+	ctx, span := startSpan(ctx, "scraper.Scrape",
+		attribute.Int64("source.id", int64(source.ID)),
+		attribute.String("source.link", source.Link),
+		attribute.String("source.type", source.Type),
+	)
+	defer span.End()
+
+	if timeout := scraper.timeoutOf(source); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	inserted, err := scraper.scrape(ctx, source)
+	changed := scraper.health.record(source, err)
+	recordError(span, err)
+	if scraper.events != nil {
+		scraper.publishStatus(context.WithoutCancel(ctx), source, changed, err)
+	}
+	return inserted, err
+}
+
+// Helper method: publish the failure of a scrape, and the change of status of the source
+func (scraper *RssScraper) publishStatus(ctx context.Context, source db.Source, changed bool, err error) {
+	events := make([]Event, 0, 2)
+	if err != nil {
+		events = append(events, SourceFailed{Source: eventSource(source), Error: err.Error()})
+	}
+	if changed {
+		status := SourceStatusChanged{Source: eventSource(source), Status: SourceHealthy}
+		if err != nil {
+			status.Status = SourceFailing
+			status.Error = err.Error()
+		}
+		events = append(events, status)
+	}
+
+	if len(events) > 0 {
+		scraper.events.Publish(ctx, events...)
+	}
+}
+
+// Helper method: fetch the articles of the source and store the new ones
+func (scraper *RssScraper) scrape(ctx context.Context, source db.Source) (int, error) {
+	label := strconv.FormatUint(uint64(source.ID), 10)
+
+	typeScraper, err := scraper.scraperOf(source)
+	if err != nil {
+		return 0, err
+	}
+
+	fetchCtx, err := withFetchSettings(ctx, source, scraper.credentials.Decrypt)
+	if err != nil {
+		return 0, err
+	}
+
+	// Fetch and parse the articles, feeds may also advertise a WebSub hub, and sitemaps
+	// leave the entries they couldn't process for the next fetch
+	var (
+		articles []db.Article
+		links    webSubLinks
+		isFeed   = typeScraper == Scraper(scraper)
+		start    = time.Now()
+		fetched  = start
+	)
+	if sitemap, ok := typeScraper.(*SitemapScraper); ok {
+		var pending *time.Time
+		articles, pending, err = sitemap.fetchChanges(fetchCtx, source)
+		if pending != nil && pending.Before(fetched) {
+			fetched = *pending
+		}
+	} else if isFeed {
+		articles, links, err = scraper.fetchRSS(fetchCtx, source)
+	} else {
+		articles, err = typeScraper.Fetch(fetchCtx, source)
+	}
+	fetchDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	inserted, err := scraper.save(ctx, source, articles)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sitemaps only pick up the entries changed since then, a source never fetched stays
+	// so if some were left; a source deleted meanwhile has nothing to record
+	if !fetched.IsZero() {
+		err = scraper.sources.SetSourceFetched(ctx, source.ID, fetched)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return inserted, err
+		}
+	}
+
+	if isFeed && scraper.websub != nil {
+		if err := scraper.websub.Discovered(ctx, source, links); err != nil {
+			return inserted, fmt.Errorf("error updating the websub subscription: %w", err)
+		}
+	}
+
+	return inserted, nil
+}
+
+// Store the articles of feed content pushed for an RSS source, such as the content
+// distributed by a WebSub hub, returning the number of new articles
+func (scraper *RssScraper) Ingest(ctx context.Context, source db.Source, body []byte) (int, error) {
+	ctx, span := startSpan(ctx, "scraper.Ingest",
+		attribute.Int64("source.id", int64(source.ID)),
+		attribute.Int("feed.bytes", len(body)),
+	)
+	defer span.End()
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+
+	inserted, err := scraper.save(ctx, source, scraper.toArticles(source, feed))
+	recordError(span, err)
+	return inserted, err
+}
+
+// Helper method: store the articles of the source, recording the outcome in the
+// metrics, returning the number of new articles
+func (scraper *RssScraper) save(ctx context.Context, source db.Source, articles []db.Article) (int, error) {
+	label := strconv.FormatUint(uint64(source.ID), 10)
+
+	// Add all new articles into database, the ones already stored are skipped
+	ctx, span := startSpan(ctx, "scraper.persist", attribute.Int("articles.count", len(articles)))
+	defer span.End()
+
+	// The same article carried by several sources is stored once, by its canonical URL
+	if err := scraper.resolveCanonical(ctx, articles); err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+
+	inserted, updated, err := scraper.persist(ctx, source, articles)
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int("articles.inserted", inserted), attribute.Int("articles.updated", updated))
+
+	articlesInserted.WithLabelValues(label).Add(float64(inserted))
+	articlesDuplicate.WithLabelValues(label).Add(float64(len(articles) - inserted))
+
+	return inserted, nil
+}
+
+// Helper method: store the articles, returning how many were new and how many changed.
+// Without event bus, the stored articles are left as they are.
+func (scraper *RssScraper) persist(ctx context.Context, source db.Source, articles []db.Article) (inserted, updated int, err error) {
+	if scraper.events == nil {
+		stored, err := scraper.articles.UpsertArticles(ctx, articles)
+		return len(stored), 0, err
+	}
+
+	changes, err := scraper.events.SaveArticles(ctx, source, articles)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(changes.Inserted), len(changes.Updated), nil
+}
+
+// Helper method: download then parse the feed, each step in its own span, along with
+// the links found in the response headers or the feed
+func (scraper *RssScraper) fetchFeed(ctx context.Context, link string) (*gofeed.Feed, feedLinks, error) {
+	fetchCtx, span := startSpan(ctx, "scraper.fetch", attribute.String("url.full", link))
+	body, header, err := fetchResponse(fetchCtx, scraper.client, link, nil)
+	recordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, span = startSpan(ctx, "scraper.parse", attribute.Int("feed.bytes", len(body)))
+	defer span.End()
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		recordError(span, err)
+		return nil, nil, err
+	}
+	span.SetAttributes(attribute.Int("feed.items", len(feed.Items)))
+
+	return feed, discoverLinks(link, header, body), nil
+}
+
+// Links of a feed by relation, such as hub, self, next or prev-archive
+type feedLinks map[string]string
+
+// Helper method: the WebSub links among the links of a feed
+func (links feedLinks) webSub() webSubLinks {
+	return webSubLinks{hub: links["hub"], self: links["self"]}
+}
+
+// Link header entries, such as <https://hub.example.com/>; rel="hub"
+var linkHeaderPattern = regexp.MustCompile(`<([^>]*)>\s*((?:;\s*[^;,]*)*)`)
+
+// Helper function: find the links of a feed in the Link headers of its response, then
+// in the link elements of the feed before its first item, resolved against the feed
+// URL. The first link of each relation wins.
+func discoverLinks(link string, header http.Header, body []byte) feedLinks {
+	links := make(feedLinks)
+	base, err := url.Parse(link)
+	if err != nil {
+		return links
+	}
+
+	found := func(rel, href string) {
+		href = resolveURL(base, href)
+		for _, value := range strings.Fields(strings.ToLower(rel)) {
+			if _, ok := links[value]; !ok && href != "" {
+				links[value] = href
+			}
+		}
+	}
+
+	for _, value := range header.Values("Link") {
+		for _, match := range linkHeaderPattern.FindAllStringSubmatch(value, -1) {
+			for _, param := range strings.Split(match[2], ";") {
+				name, rel, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(name), "rel") {
+					found(strings.Trim(strings.TrimSpace(rel), `"`), match[1])
+				}
+			}
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if element.Name.Local == "item" || element.Name.Local == "entry" {
+			break
+		}
+		if element.Name.Local != "link" {
+			continue
+		}
+
+		var rel, href string
+		for _, attr := range element.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+		if href != "" {
+			found(rel, href)
+		}
+	}
+
+	return links
+}
+
+// Helper function: download a page or feed with the extra headers, failing on non 2xx
+// responses like gofeed does
+func fetchURL(ctx context.Context, client *http.Client, link string, header http.Header) ([]byte, error) {
+	body, _, err := fetchResponse(ctx, client, link, header)
+	return body, err
+}
+
+// Helper function: download a page or feed like fetchURL, along with the response headers
+func fetchResponse(ctx context.Context, client *http.Client, link string, header http.Header) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.Header, err
+}
+
+// Helper method: convert the items of a feed into articles of the source
+func (scraper *RssScraper) toArticles(source db.Source, feed *gofeed.Feed) []db.Article {
+	articles := make([]db.Article, 0, len(feed.Items))
 
 	// Loop through each item and create articles
 	for _, item := range feed.Items {
@@ -45,71 +545,128 @@ func (scraper *RssScraper) Scrape(source db.Source) error {
 		}
 
 		article := db.Article{
-			Model:         gorm.Model{},
 			SourceID:      source.ID,
 			Title:         item.Title,
 			Url:           item.Link,
 			Image:         image,
 			PublishedDate: item.Published,
 		}
+
+		// FeedBurner keeps the link of the original feed next to its redirect wrapper
+		if origLinks := item.Extensions["feedburner"]["origLink"]; len(origLinks) > 0 {
+			if origLink := strings.TrimSpace(origLinks[0].Value); origLink != "" {
+				article.CanonicalURL = &origLink
+			}
+		}
 		articles = append(articles, article)
 	}
 
-	// Add all articles into database
-	for _, article := range articles {
-		result := scraper.queries.DB.Where("url = ?", article.Url).First(&db.Article{})
-		if result.Error != nil {
-			// If this article not exist in database, we insert them into database
-			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-				result = scraper.queries.DB.Create(&article)
-				if result.Error != nil {
-					return result.Error
-				}
-			}
+	return articles
+}
 
-			// If this article already exists, do nothing
-		}
+// Helper method: scrape a source under its lease, skipping it if another instance has the lease
+func (scraper *RssScraper) scrapeLeased(ctx context.Context, source db.Source) (inserted int, skipped bool, err error) {
+	// The lease outlives the scrape, whose timeout may be the source's own
+	ttl := defaultSourceLeaseTTL
+	if timeout := scraper.timeoutOf(source); timeout > 0 {
+		ttl = timeout + time.Minute
 	}
 
-	return nil
+	name := sourceLease(source.ID)
+	acquired, err := scraper.leases.Acquire(ctx, name, ttl)
+	if err != nil {
+		return 0, false, fmt.Errorf("error acquiring lease: %w", err)
+	}
+	if !acquired {
+		return 0, true, nil
+	}
+	defer scraper.leases.Release(context.WithoutCancel(ctx), name)
+
+	inserted, err = scraper.Scrape(ctx, source)
+	return inserted, false, err
 }
 
-// Run scraping for all RSS sources in database
-func (scraper *RssScraper) Run() error {
+// Run scraping for all sources in database
+func (scraper *RssScraper) Run(ctx context.Context) error {
 	// Get all the sources
-	var sources []db.Source
-	result := scraper.queries.DB.Find(&sources)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("no rss source found in database")
+	sources, err := scraper.sources.ListSources(ctx, db.SourceFilter{})
+	if err != nil {
+		return err
+	}
+
+	if len(sources) == 0 {
+		return fmt.Errorf("no rss source found in database")
+	}
+
+	// The hubs push the new items of their sources, which are only polled once silent
+	if scraper.websub != nil {
+		if sources, err = scraper.websub.Polled(ctx, sources); err != nil {
+			return err
 		}
+	}
+
+	return scraper.RunSources(ctx, sources, nil)
+}
+
+// Scrape the given sources, calling report (if not nil) as each one finishes
+func (scraper *RssScraper) RunSources(ctx context.Context, sources []db.Source, report func(SourceResult)) (err error) {
+	ctx, span := startSpan(ctx, "scraper.Run")
+	defer func() {
+		recordError(span, err)
+		span.End()
+	}()
+
+	scraper.health.keep(sources)
+	span.SetAttributes(attribute.Int("sources.count", len(sources)))
 
-		return result.Error
+	// Start scraping each source in a separate goroutine, up to the concurrency limit
+	concurrency := scraper.options.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(sources)
 	}
 
-	// Start scraping each source in a separate goroutine
 	var (
-		wg    sync.WaitGroup
-		mutex sync.Mutex
-		errs  = make([]string, 0)
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		errs      = make([]string, 0)
+		slots     = make(chan struct{}, concurrency)
+		completed = RunCompleted{Sources: len(sources), StartedAt: time.Now()}
 	)
 	for _, source := range sources {
 		wg.Add(1)
 		go func(src db.Source) {
 			defer wg.Done()
-			err := scraper.Scrape(src)
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			inserted, skipped, err := scraper.scrapeLeased(ctx, src)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			completed.NewArticles += inserted
+			if skipped {
+				completed.Skipped++
+			}
 			if err != nil {
-				mutex.Lock()
+				completed.Failed++
 				errs = append(errs, fmt.Sprintf("error scraping source %s: %v", src.Link, err))
-				mutex.Unlock()
+			}
+			if report != nil {
+				report(SourceResult{Source: src, NewArticles: inserted, Skipped: skipped, Err: err})
 			}
 		}(source)
 	}
 
 	wg.Wait()
 
+	if scraper.events != nil {
+		completed.FinishedAt = time.Now()
+		scraper.events.Publish(context.WithoutCancel(ctx), completed)
+	}
+
 	// Check if there is any error
 	if len(errs) == 0 {
+		recordRunSuccess(time.Now())
 		return nil
 	}
 
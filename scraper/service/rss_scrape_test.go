@@ -1,104 +1,321 @@
 package service
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/danglnh07/newsaggr/scraper/db"
 	"github.com/danglnh07/newsaggr/scraper/util"
+	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
-	"gorm.io/gorm"
 )
 
 var (
+	queries *db.Queries
 	scraper *RssScraper
 	logger  = slog.New(slog.NewTextHandler(os.Stdout, nil))
 )
 
 // Main entry point of this package test
 func TestMain(m *testing.M) {
-	// Load config
-	config := util.LoadConfig("../.env")
+	// Load config, falling back to an in-memory SQLite database only when no database is
+	// configured, so that an invalid config fails the tests instead of being ignored
+	godotenv.Load("../.env")
+	var args []string
+	if os.Getenv("DB_CONN") == "" && os.Getenv("CONFIG_FILE") == "" {
+		args = []string{"-database.driver", db.DriverSQLite, "-database.conn", ":memory:"}
+	}
 
-	// Create queries, connect database and run auto migration
-	queries := db.NewQueries()
+	config, err := util.LoadConfig("../.env", args)
+	if err != nil {
+		logger.Error("Error loading config", "error", err)
+		os.Exit(1)
+	}
 
-	if err := queries.ConnectDB(config.DBConn); err != nil {
+	// Create queries, connect database and run the migrations, for the schema of the app
+	queries = db.NewQueries()
+
+	if err := queries.ConnectDB(config.Database.Driver, config.Database.Conn); err != nil {
 		logger.Error("Error connecting database", "error", err)
 		os.Exit(1)
 	}
 
-	if err := queries.AutoMigration(); err != nil {
-		logger.Error("Error running auto migration", "error", err)
+	if _, err := queries.MigrateUp(); err != nil {
+		logger.Error("Error running migrations", "error", err)
 		os.Exit(1)
 	}
 
 	// Create scraper
-	scraper = NewRssScraper(queries)
+	store := db.NewGormStore(queries)
+	scraper = NewRssScraper(store, store, ScrapeOptions{})
 
 	os.Exit(m.Run())
 }
 
-// Test RSS scraping
+// Test RSS scraping end to end against the configured database
 func TestScrape(t *testing.T) {
+	server := newFixtureServer(t)
+
 	// Insert some sources
 	sources := []db.Source{
 		{
-			Model:    gorm.Model{},
-			Link:     "https://cloudblog.withgoogle.com/rss/",
-			Provider: "cloud.google.com/blog",
+			Link:     server.URL + "/rss.xml",
+			Provider: "engineering.example.com",
 			Category: "engineering",
 		},
 		{
-			Model:    gorm.Model{},
-			Link:     "https://blog.google/rss/",
-			Provider: "blog.google",
-			Category: "engineering",
+			Link:     server.URL + "/atom.xml",
+			Provider: "releases.example.com",
+			Category: "releases",
 		},
 		{
-			Model:    gorm.Model{},
-			Link:     "https://feeds.feedburner.com/GDBcode",
-			Provider: "https://developers.googleblog.com",
+			Link:     server.URL + "/feed.json",
+			Provider: "json.example.com",
 			Category: "engineering",
 		},
 	}
 
 	// Create source in database
-	result := scraper.queries.DB.CreateInBatches(&sources, len(sources))
-	require.NoError(t, result.Error)
-
-	// Refresh inserted sources to ensure IDs are populated (safe guard)
-	links := make([]string, 0, len(sources))
-	for _, s := range sources {
-		links = append(links, s.Link)
-	}
-	var inserted []db.Source
-	result = scraper.queries.DB.Where("link IN ?", links).Find(&inserted)
+	result := queries.DB.CreateInBatches(&sources, len(sources))
 	require.NoError(t, result.Error)
-	require.Equal(t, len(sources), len(inserted))
 
-	// Run scraping
-	err := scraper.Run()
-	require.NoError(t, err)
-
-	// Check result and clean up
-	for _, src := range inserted {
+	// Scrape each source and check result, then clean up
+	for _, src := range sources {
 		require.NotZero(t, src.ID, "source ID should be set")
+		_, err := scraper.Scrape(context.Background(), src)
+		require.NoError(t, err)
 
 		var count int64
-		res := scraper.queries.DB.Model(&db.Article{}).Where("source_id = ?", src.ID).Count(&count)
+		res := queries.DB.Model(&db.Article{}).Where("source_id = ?", src.ID).Count(&count)
 		require.NoError(t, res.Error)
 		require.Greater(t, count, int64(0), "expected articles for source %s", src.Link)
 
 		// Permanently remove articles for this source
-		res = scraper.queries.DB.Where("source_id = ?", src.ID).Unscoped().Delete(&db.Article{})
+		res = queries.DB.Where("source_id = ?", src.ID).Unscoped().Delete(&db.Article{})
 		require.NoError(t, res.Error)
 		require.Greater(t, res.RowsAffected, int64(0), "no articles deleted for source %d", src.ID)
 
 		// Permanently remove the source
-		res = scraper.queries.DB.Unscoped().Delete(&db.Source{}, src.ID)
+		res = queries.DB.Unscoped().Delete(&db.Source{}, src.ID)
 		require.NoError(t, res.Error)
 		require.Equal(t, int64(1), res.RowsAffected, "source not deleted")
 	}
 }
+
+// Test scraping every kind of fixture feed
+func TestScrapeFixtures(t *testing.T) {
+	server := newFixtureServer(t)
+
+	testCases := []struct {
+		name    string
+		path    string
+		timeout time.Duration
+		wantErr bool
+		titles  []string
+		images  int
+	}{
+		{
+			name:   "RSS2",
+			path:   "/rss.xml",
+			titles: []string{"Scaling our ingestion pipeline", "Postmortem: cache stampede", "Why we moved to structured logging"},
+			images: 2,
+		},
+		{
+			name:   "Atom",
+			path:   "/atom.xml",
+			titles: []string{"Release 2.4.0", "Release 2.3.1"},
+		},
+		{
+			name:   "JSONFeed",
+			path:   "/feed.json",
+			titles: []string{"Hello from JSON Feed", "Second JSON Feed post"},
+			images: 1,
+		},
+		{
+			name:   "Latin1Encoding",
+			path:   "/latin1.xml",
+			titles: []string{"Café opening"},
+		},
+		{
+			name:   "Redirect",
+			path:   "/redirect",
+			titles: []string{"Scaling our ingestion pipeline", "Postmortem: cache stampede", "Why we moved to structured logging"},
+			images: 2,
+		},
+		{name: "BrokenXML", path: "/broken.xml", wantErr: true},
+		{name: "UnknownEncoding", path: "/wrong-encoding.xml", wantErr: true},
+		{name: "ServerError", path: "/error", wantErr: true},
+		{name: "NotFound", path: "/missing.xml", wantErr: true},
+		{name: "SlowResponse", path: "/slow", timeout: 200 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scraper, store := newTestScraper(t)
+
+			source := db.Source{Link: server.URL + tc.path, Provider: "fixture", Category: "test"}
+			require.NoError(t, store.CreateSource(context.Background(), &source))
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			inserted, err := scraper.Scrape(ctx, source)
+			articles, listErr := store.ListArticles(context.Background(), db.ArticleFilter{})
+			require.NoError(t, listErr)
+
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Empty(t, articles)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, len(tc.titles), inserted)
+			titles := make([]string, len(articles))
+			images := 0
+			for i, article := range articles {
+				titles[i] = article.Title
+				require.Equal(t, source.ID, article.SourceID)
+				require.NotEmpty(t, article.Url)
+				if article.Image.Valid {
+					images++
+				}
+			}
+			require.ElementsMatch(t, tc.titles, titles)
+			require.Equal(t, tc.images, images)
+		})
+	}
+}
+
+// Test that scraping the same items again does not create duplicates
+func TestScrapeDedupe(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	// The redirect serves the same items as the direct link
+	direct := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &direct))
+	redirect := db.Source{Link: server.URL + "/redirect", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &redirect))
+
+	for i := range 2 {
+		inserted, err := scraper.Scrape(ctx, direct)
+		require.NoError(t, err)
+		require.Equal(t, 3*(1-i), inserted, "only the first scrape finds new articles")
+
+		inserted, err = scraper.Scrape(ctx, redirect)
+		require.NoError(t, err)
+		require.Zero(t, inserted)
+	}
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, 3)
+
+	// The first source to publish an item keeps it
+	for _, article := range articles {
+		require.Equal(t, direct.ID, article.SourceID)
+	}
+}
+
+// Test that Run scrapes every source and aggregates the errors of the failing ones
+func TestRun(t *testing.T) {
+	server := newFixtureServer(t)
+
+	testCases := []struct {
+		name      string
+		paths     []string
+		wantErrs  []string
+		wantCount int
+	}{
+		{
+			name:      "AllHealthy",
+			paths:     []string{"/rss.xml", "/atom.xml", "/feed.json"},
+			wantCount: 7,
+		},
+		{
+			name:      "SomeFailing",
+			paths:     []string{"/rss.xml", "/error", "/broken.xml", "/atom.xml"},
+			wantErrs:  []string{server.URL + "/error", server.URL + "/broken.xml"},
+			wantCount: 5,
+		},
+		{
+			name:      "AllFailing",
+			paths:     []string{"/error", "/missing.xml"},
+			wantErrs:  []string{server.URL + "/error", server.URL + "/missing.xml"},
+			wantCount: 0,
+		},
+		{
+			name:     "NoSource",
+			paths:    nil,
+			wantErrs: []string{"no rss source found"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scraper, store := newTestScraper(t)
+			ctx := context.Background()
+
+			for _, path := range tc.paths {
+				source := db.Source{Link: server.URL + path, Provider: "fixture", Category: "test"}
+				require.NoError(t, store.CreateSource(ctx, &source))
+			}
+
+			err := scraper.Run(ctx)
+			if len(tc.wantErrs) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				for _, want := range tc.wantErrs {
+					require.Contains(t, err.Error(), want)
+				}
+			}
+
+			articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+			require.NoError(t, err)
+			require.Len(t, articles, tc.wantCount)
+		})
+	}
+}
+
+// Test that a source leased by another instance is skipped
+func TestRunSourcesLeased(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	scraper.SetLeases(NewLeases(store, "this"))
+	ctx := context.Background()
+
+	free := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &free))
+	leased := db.Source{Link: server.URL + "/atom.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &leased))
+
+	acquired, err := store.AcquireLease(ctx, sourceLease(leased.ID), "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	results := make(map[uint]SourceResult)
+	err = scraper.RunSources(ctx, []db.Source{free, leased}, func(result SourceResult) {
+		results[result.Source.ID] = result
+	})
+	require.NoError(t, err)
+
+	require.False(t, results[free.ID].Skipped)
+	require.Equal(t, 3, results[free.ID].NewArticles)
+	require.True(t, results[leased.ID].Skipped)
+	require.Zero(t, results[leased.ID].NewArticles)
+
+	// The lease of the scraped source is released
+	acquired, err = store.AcquireLease(ctx, sourceLease(free.ID), "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+}
@@ -1,42 +1,276 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
 
+// What to do when a job is due while its previous run is still going
+const (
+	OverlapSkip  = "skip"  // Skip the new run
+	OverlapQueue = "queue" // Start the new run once the previous one finishes
+)
+
+// Cron expressions (with seconds) of the scheduled jobs, and how to handle overlapping runs
+type Schedule struct {
+	Scrape    string
+	Retention string
+	Overlap   string
+}
+
+// Scrape at the start of every hour, apply retention every night at 3AM
+var DefaultSchedule = Schedule{
+	Scrape:    "0 0 * * * *",
+	Retention: "0 0 3 * * *",
+	Overlap:   OverlapSkip,
+}
+
 // Scheduler struct
 type Scheduler struct {
 	c          *cron.Cron
+	schedule   Schedule
 	RssScraper *RssScraper
+	Retention  *Retention
 	logger     *slog.Logger
+
+	// Context of the running jobs, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Leader election, only the instance holding the lease of a job runs it
+	leases   *Leases
+	leaseTTL time.Duration
+	stopped  chan struct{}
+
+	mu         sync.Mutex
+	running    bool
+	leader     map[string]bool // Jobs this instance leads, by name
+	startedAt  time.Time
+	lastScrape time.Time // When the last scraping run finished
 }
 
-// Constructor method of Scheduler
-func NewScheduler(rss *RssScraper, logger *slog.Logger) *Scheduler {
+// Adapter of slog to the logger of cron
+type cronLogger struct {
+	logger *slog.Logger
+}
+
+func (logger cronLogger) Info(msg string, keysAndValues ...any) {
+	logger.logger.Info("Cron: "+msg, keysAndValues...)
+}
+
+func (logger cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	logger.logger.Error("Cron: "+msg, append(keysAndValues, "error", err)...)
+}
+
+// Constructor method of Scheduler. Retention may be nil to disable the retention job.
+func NewScheduler(rss *RssScraper, retention *Retention, schedule Schedule, logger *slog.Logger) *Scheduler {
+	// A job never runs on top of its previous run
+	overlap := cron.SkipIfStillRunning(cronLogger{logger})
+	if schedule.Overlap == OverlapQueue {
+		overlap = cron.DelayIfStillRunning(cronLogger{logger})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
-		c:          cron.New(cron.WithSeconds()),
+		c:          cron.New(cron.WithSeconds(), cron.WithChain(overlap)),
+		schedule:   schedule,
 		RssScraper: rss,
+		Retention:  retention,
 		logger:     logger,
+		ctx:        ctx,
+		cancel:     cancel,
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Coordinate with the other instances sharing the leases: each job only runs on the
+// instance holding its lease, which renews it every third of the TTL. The others stand
+// by and take over once the lease expires.
+func (scheduler *Scheduler) SetLeases(leases *Leases, ttl time.Duration) {
+	scheduler.leases = leases
+	scheduler.leaseTTL = ttl
+	scheduler.leader = make(map[string]bool)
+}
+
+// Check whether this instance runs the named job, always true without leases
+func (scheduler *Scheduler) Leader(job string) bool {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	return scheduler.leads(job)
+}
+
+// Helper method: check whether this instance runs the named job, with the lock held
+func (scheduler *Scheduler) leads(job string) bool {
+	return scheduler.leases == nil || scheduler.leader[job]
+}
+
+// Helper method: acquire or renew the lease of each job, logging changes of leadership
+func (scheduler *Scheduler) campaign(jobs []string) {
+	for _, job := range jobs {
+		acquired, err := scheduler.leases.Acquire(scheduler.ctx, schedulerLease+":"+job, scheduler.leaseTTL)
+		if err != nil {
+			// Keep the current state, the lease outlives a few failed renewals
+			scheduler.logger.Error("Failed to renew the scheduler lease", "job", job, "error", err)
+			continue
+		}
+
+		scheduler.mu.Lock()
+		if acquired != scheduler.leader[job] {
+			scheduler.logger.Info("Scheduler leadership changed", "job", job, "leader", acquired, "instance", scheduler.leases.Holder())
+		}
+		if job == "scrape" && acquired && !scheduler.leader[job] {
+			// The readiness check counts from the takeover until our first run
+			scheduler.startedAt = time.Now()
+			scheduler.lastScrape = time.Time{}
+		}
+		scheduler.leader[job] = acquired
+		scheduler.mu.Unlock()
+	}
+}
+
+// Helper method: keep campaigning for the leases of the jobs until the scheduler
+// stops, then release them so other instances take over right away
+func (scheduler *Scheduler) keepLeases(jobs []string) {
+	ticker := time.NewTicker(scheduler.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			scheduler.campaign(jobs)
+		case <-scheduler.stopped:
+			scheduler.mu.Lock()
+			clear(scheduler.leader)
+			scheduler.mu.Unlock()
+
+			for _, job := range jobs {
+				if err := scheduler.leases.Release(context.Background(), schedulerLease+":"+job); err != nil {
+					scheduler.logger.Error("Failed to release the scheduler lease", "job", job, "error", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// Helper method: wrap a job so that it only runs on its leader
+func (scheduler *Scheduler) leaderOnly(name string, job func()) func() {
+	return func() {
+		if !scheduler.Leader(name) {
+			scheduler.logger.Debug("Skipping job, another instance leads it", "job", name)
+			return
+		}
+		job()
 	}
 }
 
 // Start cron job
 func (scheduler *Scheduler) Start() {
-	// Run scraping for every hour
-	_, err := scheduler.c.AddFunc("0 0 * * * *", func() {
-		err := scheduler.RssScraper.Run()
+	_, err := scheduler.c.AddFunc(scheduler.schedule.Scrape, scheduler.leaderOnly("scrape", func() {
+		err := scheduler.RssScraper.Run(scheduler.ctx)
+
+		scheduler.mu.Lock()
+		scheduler.lastScrape = time.Now()
+		scheduler.mu.Unlock()
+
 		if err != nil {
 			scheduler.logger.Error("Failed to run RSS scraping", "error", err)
 			return
 		}
-	})
+	}))
 
 	if err != nil {
 		scheduler.logger.Error("Failed to set up cron job for RSS scraper", "error", err)
 		return
 	}
 
+	if scheduler.Retention != nil {
+		_, err = scheduler.c.AddFunc(scheduler.schedule.Retention, scheduler.leaderOnly("retention", func() {
+			_, err := scheduler.Retention.Run(scheduler.ctx)
+			if err != nil {
+				scheduler.logger.Error("Failed to run retention", "error", err)
+				return
+			}
+		}))
+
+		if err != nil {
+			scheduler.logger.Error("Failed to set up cron job for retention", "error", err)
+			return
+		}
+	}
+
+	if scheduler.leases != nil {
+		jobs := []string{"scrape"}
+		if scheduler.Retention != nil {
+			jobs = append(jobs, "retention")
+		}
+
+		scheduler.campaign(jobs)
+		go scheduler.keepLeases(jobs)
+	}
+
+	scheduler.mu.Lock()
+	scheduler.running = true
+	scheduler.startedAt = time.Now()
+	scheduler.mu.Unlock()
+
 	scheduler.c.Start()
 }
+
+// Stop the cron job. The returned context is done once the running jobs, if any, complete.
+func (scheduler *Scheduler) Stop() context.Context {
+	scheduler.mu.Lock()
+	if scheduler.running && scheduler.leases != nil {
+		close(scheduler.stopped)
+	}
+	scheduler.running = false
+	scheduler.mu.Unlock()
+
+	return scheduler.c.Stop()
+}
+
+// Stop the cron job and wait for the running jobs. If they are still running when
+// the context is done, they are cancelled and the context error is returned.
+func (scheduler *Scheduler) Shutdown(ctx context.Context) error {
+	select {
+	case <-scheduler.Stop().Done():
+		scheduler.cancel()
+		return nil
+	case <-ctx.Done():
+		scheduler.cancel()
+		return ctx.Err()
+	}
+}
+
+// Check that the scheduler is running and that a scraping run finished within
+// maxAge, counting from the start while the first run is pending. An instance
+// standing by for the leader has no run to check.
+func (scheduler *Scheduler) Check(maxAge time.Duration) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	if !scheduler.running {
+		return errors.New("scheduler is not running")
+	}
+
+	if !scheduler.leads("scrape") {
+		return nil
+	}
+
+	last := scheduler.lastScrape
+	if last.IsZero() {
+		last = scheduler.startedAt
+	}
+
+	if age := time.Since(last); age > maxAge {
+		return fmt.Errorf("last scraping run finished %s ago", age.Round(time.Second))
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the scheduler runs the scraper on its schedule and stops cleanly
+func TestScheduler(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	source := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// Every second
+	schedule := Schedule{Scrape: "* * * * * *"}
+	scheduler := NewScheduler(scraper, nil, schedule, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scheduler.Start()
+
+	require.Eventually(t, func() bool {
+		articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+		return err == nil && len(articles) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	select {
+	case <-scheduler.Stop().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+// Test that an invalid schedule does not start the cron
+func TestSchedulerInvalidSpec(t *testing.T) {
+	scraper, _ := newTestScraper(t)
+	schedule := Schedule{Scrape: "not a cron spec"}
+	scheduler := NewScheduler(scraper, nil, schedule, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scheduler.Start()
+
+	require.Empty(t, scheduler.c.Entries())
+	<-scheduler.Stop().Done()
+}
+
+// Test the readiness check of the scheduler
+func TestSchedulerCheck(t *testing.T) {
+	scraper, _ := newTestScraper(t)
+	schedule := Schedule{Scrape: "0 0 * * * *"}
+	scheduler := NewScheduler(scraper, nil, schedule, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Error(t, scheduler.Check(time.Hour))
+
+	// Until the first run, the age counts from the start
+	scheduler.Start()
+	require.NoError(t, scheduler.Check(time.Hour))
+	time.Sleep(10 * time.Millisecond)
+	require.ErrorContains(t, scheduler.Check(time.Millisecond), "last scraping run")
+
+	<-scheduler.Stop().Done()
+	require.ErrorContains(t, scheduler.Check(time.Hour), "not running")
+}
+
+// Test that shutdown cancels the running scrape once the deadline is reached
+func TestSchedulerShutdown(t *testing.T) {
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	// The slow endpoint holds the scrape until the client gives up
+	source := db.Source{Link: server.URL + "/slow", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	schedule := Schedule{Scrape: "* * * * * *"}
+	scheduler := NewScheduler(scraper, nil, schedule, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scheduler.Start()
+
+	// Wait for the job to be running
+	require.Eventually(t, func() bool {
+		return len(scheduler.c.Entries()) == 1 && !scheduler.c.Entries()[0].Prev.IsZero()
+	}, 3*time.Second, 10*time.Millisecond)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	require.ErrorIs(t, scheduler.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+	// The cancelled scrape returns right away instead of after 5 seconds
+	require.Eventually(t, func() bool {
+		scheduler.mu.Lock()
+		defer scheduler.mu.Unlock()
+		return !scheduler.lastScrape.IsZero()
+	}, time.Second, 10*time.Millisecond)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+// Test that only one of the instances sharing the leases runs each job, and that
+// another one takes over when it stops
+func TestSchedulerLeader(t *testing.T) {
+	scraper, store := newTestScraper(t)
+	retention := NewRetention(store, store, t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Far from due, only leadership matters here
+	schedule := Schedule{Scrape: "0 0 0 1 1 *", Retention: "0 0 0 1 1 *"}
+	newInstance := func(holder string) *Scheduler {
+		scheduler := NewScheduler(scraper, retention, schedule, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		scheduler.SetLeases(NewLeases(store, holder), 300*time.Millisecond)
+		return scheduler
+	}
+
+	first := newInstance("first")
+	first.Start()
+	require.True(t, first.Leader("scrape"))
+	require.True(t, first.Leader("retention"))
+
+	second := newInstance("second")
+	second.Start()
+	defer second.Stop()
+	require.False(t, second.Leader("scrape"))
+	require.False(t, second.Leader("retention"))
+
+	// The standby instance is ready without running anything
+	require.NoError(t, second.Check(time.Nanosecond))
+
+	// Leadership stays while the leader renews its leases
+	time.Sleep(400 * time.Millisecond)
+	require.True(t, first.Leader("scrape"))
+	require.False(t, second.Leader("scrape"))
+
+	// Stopping releases the leases, taken over at the next renewal
+	<-first.Stop().Done()
+	require.Eventually(t, func() bool {
+		return second.Leader("scrape") && second.Leader("retention")
+	}, 2*time.Second, 10*time.Millisecond)
+	require.False(t, first.Leader("scrape"))
+}
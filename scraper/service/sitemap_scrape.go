@@ -0,0 +1,456 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html/charset"
+)
+
+// Limits of a sitemap fetch
+const (
+	maxIndexSitemaps    = 20 // Sitemaps of an index fetched per scrape
+	maxMetadataPages    = 50 // Pages fetched for their metadata, the newest entries first
+	metadataConcurrency = 4  // Pages fetched at the same time for their metadata
+)
+
+// Error of a sitemap source whose entries have no title to store
+var ErrSitemapUntitled = errors.New("the sitemap entries have no news:title, enable the metadata of the pages")
+
+// Scrapes sitemaps, sitemap indexes and Google News sitemaps, picking up the entries
+// changed since the last successful scrape of the source
+type SitemapScraper struct {
+	client   *http.Client
+	articles db.ArticleStore // Spares fetching the pages of stored entries, if not nil
+}
+
+// Constructor method for SitemapScraper, articles may be nil
+func NewSitemapScraper(client *http.Client, articles db.ArticleStore) *SitemapScraper {
+	return &SitemapScraper{client: client, articles: articles}
+}
+
+// Sitemap or sitemap index, see https://www.sitemaps.org/protocol.html
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+// Sitemap listed by an index
+type sitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Page listed by a sitemap, with the Google News and image extensions
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	News    *struct {
+		Title           string `xml:"title"`
+		PublicationDate string `xml:"publication_date"`
+	} `xml:"http://www.google.com/schemas/sitemap-news/0.9 news"`
+	Images []struct {
+		Loc string `xml:"loc"`
+	} `xml:"http://www.google.com/schemas/sitemap-image/1.1 image"`
+}
+
+// Article of a sitemap entry, with the parsed date to pick and order the entries
+type sitemapArticle struct {
+	article db.Article
+	date    time.Time // Zero if unknown
+}
+
+// Fetch the sitemap of the source and extract the entries changed since its last fetch,
+// from every sitemap it lists if it is an index. Entries without title are skipped,
+// unless the metadata of their page fills it.
+func (scraper *SitemapScraper) Fetch(ctx context.Context, source db.Source) ([]db.Article, error) {
+	articles, _, err := scraper.fetchChanges(ctx, source)
+	return articles, err
+}
+
+// Helper method: fetch the entries of the sitemap changed since its last fetch, along with
+// the time the last fetch must not be recorded past, if any entries are left for the next
+// fetch: those of the sitemaps of an index failing to load, whose lastmod may be older
+// than theirs, and the entries missing a title whose page was over the limit or failed to
+// load. The zero time if the source was never fetched and some of its sitemaps failed.
+func (scraper *SitemapScraper) fetchChanges(ctx context.Context, source db.Source) ([]db.Article, *time.Time, error) {
+	document, err := scraper.fetchSitemap(ctx, source.Link)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		urls    = document.URLs
+		pending *time.Time
+	)
+	if len(document.Sitemaps) > 0 {
+		urls, pending, err = scraper.fetchIndex(ctx, document.Sitemaps, source.FetchedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	entries := make([]sitemapArticle, 0)
+	seen := make(map[string]bool)
+	for _, entry := range urls {
+		loc := strings.TrimSpace(entry.Loc)
+		if parsed, err := url.Parse(loc); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || seen[loc] {
+			continue
+		}
+		seen[loc] = true
+
+		date := strings.TrimSpace(entry.LastMod)
+		article := db.Article{SourceID: source.ID, Url: loc}
+		if entry.News != nil {
+			article.Title = cleanText(entry.News.Title)
+			if published := strings.TrimSpace(entry.News.PublicationDate); published != "" {
+				date = published
+			}
+		}
+		if len(entry.Images) > 0 && entry.Images[0].Loc != "" {
+			article.Image = sql.NullString{String: strings.TrimSpace(entry.Images[0].Loc), Valid: true}
+		}
+		article.PublishedDate = date
+
+		if !changedSince(date, source.FetchedAt) {
+			continue
+		}
+
+		parsed, _ := parseW3CDate(date)
+		entries = append(entries, sitemapArticle{article: article, date: parsed})
+	}
+
+	// Newest first, the entries without date last
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].date.After(entries[j].date)
+	})
+
+	// Without the metadata, the entries without title are never stored
+	metadata := source.Sitemap != nil && source.Sitemap.Metadata
+	if metadata {
+		known, err := scraper.knownURLs(ctx, entries)
+		if err != nil {
+			return nil, nil, err
+		}
+		scraper.fillMetadata(ctx, entries, known)
+
+		// The entries without date are picked up again anyway
+		for _, entry := range entries {
+			if entry.article.Title == "" && !known[entry.article.Url] && !entry.date.IsZero() {
+				pending = oldest(pending, entry.date.Add(-time.Second))
+			}
+		}
+	}
+
+	articles := make([]db.Article, 0, len(entries))
+	for _, entry := range entries {
+		if entry.article.Title != "" {
+			articles = append(articles, entry.article)
+		}
+	}
+	return articles, pending, nil
+}
+
+// Check that the sitemap of the source gives the title of its entries, from their
+// news:title or the metadata of their pages. Only the most recently changed sitemap of an
+// index is read, and an empty sitemap passes.
+func (scraper *SitemapScraper) CheckTitles(ctx context.Context, source db.Source) error {
+	if source.Sitemap != nil && source.Sitemap.Metadata {
+		return nil
+	}
+
+	document, err := scraper.fetchSitemap(ctx, source.Link)
+	if err != nil {
+		return err
+	}
+
+	if len(document.Sitemaps) > 0 {
+		sitemaps := newestSitemaps(document.Sitemaps)
+		if document, err = scraper.fetchSitemap(ctx, strings.TrimSpace(sitemaps[0].Loc)); err != nil {
+			return err
+		}
+	}
+
+	if len(document.URLs) == 0 {
+		return nil
+	}
+	for _, entry := range document.URLs {
+		if entry.News != nil && cleanText(entry.News.Title) != "" {
+			return nil
+		}
+	}
+	return ErrSitemapUntitled
+}
+
+// Helper method: the URLs of the entries already stored, none without an article store
+func (scraper *SitemapScraper) knownURLs(ctx context.Context, entries []sitemapArticle) (map[string]bool, error) {
+	if scraper.articles == nil || len(entries) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		urls[i] = entry.article.Url
+	}
+	return scraper.articles.KnownURLs(ctx, urls)
+}
+
+// Helper method: fetch the most recently changed sitemaps of an index since the last
+// fetch, returning their entries. Sitemaps failing to load are skipped, unless they all
+// fail, and the last fetch is returned so that they are fetched again.
+func (scraper *SitemapScraper) fetchIndex(ctx context.Context, sitemaps []sitemapRef, since *time.Time) ([]sitemapURL, *time.Time, error) {
+	changed := make([]sitemapRef, 0, len(sitemaps))
+	for _, sitemap := range sitemaps {
+		if strings.TrimSpace(sitemap.Loc) != "" && changedSince(sitemap.LastMod, since) {
+			changed = append(changed, sitemap)
+		}
+	}
+
+	var (
+		urls    = make([]sitemapURL, 0)
+		pending *time.Time
+		lastErr error
+		loaded  int
+	)
+
+	// A source never fetched only gets its latest sitemaps, not its whole archive. Otherwise
+	// the oldest changes are fetched first and the newer ones are left for the next scrape.
+	changed = newestSitemaps(changed)
+	if len(changed) > maxIndexSitemaps {
+		if since == nil {
+			changed = changed[:maxIndexSitemaps]
+		} else {
+			changed = changed[len(changed)-maxIndexSitemaps:]
+			pending = since
+			if date, ok := sitemapDate(changed[0].LastMod); ok {
+				date = date.Add(-time.Second)
+				pending = &date
+			}
+		}
+	}
+
+	for _, sitemap := range changed {
+		// Indexes are not nested, the sitemaps listed by this one are ignored
+		document, err := scraper.fetchSitemap(ctx, strings.TrimSpace(sitemap.Loc))
+		if err != nil {
+			lastErr = err
+			pending = &time.Time{}
+			if since != nil {
+				pending = since
+			}
+			continue
+		}
+		loaded++
+		urls = append(urls, document.URLs...)
+	}
+
+	if loaded == 0 && lastErr != nil {
+		return nil, nil, lastErr
+	}
+	return urls, pending, nil
+}
+
+// Helper method: download then parse a sitemap, gzipped or not, each step in its own span
+func (scraper *SitemapScraper) fetchSitemap(ctx context.Context, link string) (*sitemapDocument, error) {
+	fetchCtx, span := startSpan(ctx, "scraper.fetch", attribute.String("url.full", link))
+	body, err := fetchURL(fetchCtx, scraper.client, link, nil)
+	recordError(span, err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = startSpan(ctx, "scraper.parse", attribute.Int("sitemap.bytes", len(body)))
+	defer span.End()
+
+	document, err := parseSitemap(body)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("sitemap.urls", len(document.URLs)), attribute.Int("sitemap.sitemaps", len(document.Sitemaps)))
+
+	return document, nil
+}
+
+// Helper method: fill the missing title, image and date of the newest entries not stored
+// yet from the metadata of their page. Pages failing to load are left as they are.
+func (scraper *SitemapScraper) fillMetadata(ctx context.Context, entries []sitemapArticle, known map[string]bool) {
+	var (
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, metadataConcurrency)
+		fetched = 0
+	)
+	for i := range entries {
+		article := &entries[i].article
+		if known[article.Url] || (article.Title != "" && article.Image.Valid && article.PublishedDate != "") {
+			continue
+		}
+
+		if fetched == maxMetadataPages {
+			break
+		}
+		fetched++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			metadata, err := scraper.fetchMetadata(ctx, article.Url)
+			if err != nil {
+				return
+			}
+			if article.Title == "" {
+				article.Title = metadata.title
+			}
+			if !article.Image.Valid && metadata.image != "" {
+				article.Image = sql.NullString{String: metadata.image, Valid: true}
+			}
+			if article.PublishedDate == "" {
+				article.PublishedDate = metadata.date
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Metadata of a page, empty when missing
+type pageMetadata struct {
+	title string
+	image string
+	date  string
+}
+
+// Helper method: fetch a page and read its Open Graph metadata, falling back to the
+// Twitter card and the title of the document
+func (scraper *SitemapScraper) fetchMetadata(ctx context.Context, link string) (pageMetadata, error) {
+	ctx, span := startSpan(ctx, "scraper.metadata", attribute.String("url.full", link))
+	defer span.End()
+
+	body, err := fetchURL(ctx, scraper.client, link, nil)
+	if err != nil {
+		recordError(span, err)
+		return pageMetadata{}, err
+	}
+
+	document, err := parseHTML(body)
+	if err != nil {
+		recordError(span, err)
+		return pageMetadata{}, err
+	}
+
+	base, err := url.Parse(link)
+	if err != nil {
+		return pageMetadata{}, err
+	}
+
+	meta := func(selectors ...string) string {
+		for _, selector := range selectors {
+			if content := cleanText(document.Find(selector).First().AttrOr("content", "")); content != "" {
+				return content
+			}
+		}
+		return ""
+	}
+
+	metadata := pageMetadata{
+		title: meta(`meta[property="og:title"]`, `meta[name="twitter:title"]`),
+		image: resolveURL(base, meta(`meta[property="og:image"]`, `meta[name="twitter:image"]`)),
+		date:  meta(`meta[property="article:published_time"]`),
+	}
+	if metadata.title == "" {
+		metadata.title = cleanText(document.Find("head title").First().Text())
+	}
+	return metadata, nil
+}
+
+// Helper function: parse a sitemap or sitemap index, gunzipping it first if needed
+func parseSitemap(body []byte) (*sitemapDocument, error) {
+	var reader io.Reader = bytes.NewReader(body)
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		gzipped, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipped.Close()
+		reader = gzipped
+	}
+
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var document sitemapDocument
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if document.XMLName.Local != "urlset" && document.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("unexpected root element %q, not a sitemap", document.XMLName.Local)
+	}
+	return &document, nil
+}
+
+// Helper function: parse a date in the W3C format of sitemaps, with or without time
+func parseW3CDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Helper function: sort the sitemaps of an index, the most recently changed first
+func newestSitemaps(sitemaps []sitemapRef) []sitemapRef {
+	sort.SliceStable(sitemaps, func(i, j int) bool {
+		first, _ := parseW3CDate(sitemaps[i].LastMod)
+		second, _ := parseW3CDate(sitemaps[j].LastMod)
+		return first.After(second)
+	})
+	return sitemaps
+}
+
+// Helper function: the oldest of the dates, the other one if date is nil
+func oldest(date *time.Time, other time.Time) *time.Time {
+	if date == nil || other.Before(*date) {
+		return &other
+	}
+	return date
+}
+
+// Helper function: whether an entry of the given date may have changed since the last
+// fetch. Entries without a valid date always may, and date only values cover the whole day.
+func changedSince(value string, since *time.Time) bool {
+	if since == nil {
+		return true
+	}
+
+	date, ok := sitemapDate(value)
+	return !ok || date.After(*since)
+}
+
+// Helper function: the time an entry was last changed at, the end of the day for date only values
+func sitemapDate(value string) (time.Time, bool) {
+	date, ok := parseW3CDate(value)
+	if ok && len(strings.TrimSpace(value)) == len("2006-01-02") {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, ok
+}
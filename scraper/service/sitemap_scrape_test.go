@@ -0,0 +1,365 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Google News sitemap, the entries without news:title have no title
+const testNewsSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+        xmlns:news="http://www.google.com/schemas/sitemap-news/0.9"
+        xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url>
+    <loc>{{server}}/articles/budget-vote</loc>
+    <news:news>
+      <news:publication><news:name>Example</news:name><news:language>en</news:language></news:publication>
+      <news:publication_date>2025-03-05T08:30:00Z</news:publication_date>
+      <news:title>Budget vote   postponed</news:title>
+    </news:news>
+    <image:image><image:loc>https://cdn.example.com/budget.jpg</image:loc></image:image>
+  </url>
+  <url>
+    <loc>{{server}}/articles/storm-warning</loc>
+    <lastmod>2025-03-04</lastmod>
+    <news:news>
+      <news:publication_date>2025-03-04T18:00:00+01:00</news:publication_date>
+      <news:title>Storm warning for the coast</news:title>
+    </news:news>
+  </url>
+  <url>
+    <loc>{{server}}/articles/untitled</loc>
+    <lastmod>2025-03-05</lastmod>
+  </url>
+  <url>
+    <loc>{{server}}/articles/budget-vote</loc>
+    <news:news><news:title>Budget vote postponed (updated)</news:title></news:news>
+  </url>
+</urlset>`
+
+// Index of a gzipped sitemap, an old one and a missing one
+const testSitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>{{server}}/pages.xml.gz</loc><lastmod>2025-03-05T10:00:00Z</lastmod></sitemap>
+  <sitemap><loc>{{server}}/old.xml</loc><lastmod>2020-01-01</lastmod></sitemap>
+  <sitemap><loc>{{server}}/missing.xml</loc></sitemap>
+</sitemapindex>`
+
+// Plain sitemap, the titles come from the metadata of the pages
+const testPagesSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>{{server}}/pages/og</loc><lastmod>2025-03-05T09:00:00Z</lastmod></url>
+  <url><loc>{{server}}/pages/plain</loc><lastmod>2025-03-04T09:00:00Z</lastmod></url>
+  <url><loc>{{server}}/pages/broken</loc></url>
+</urlset>`
+
+// Helper function: start a server of sitemaps and pages linking back to it
+func newSitemapServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	content := func(template string) string {
+		return strings.ReplaceAll(template, "{{server}}", server.URL)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/news.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, content(testNewsSitemap))
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, content(testSitemapIndex))
+	})
+	mux.HandleFunc("/pages.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		fmt.Fprint(writer, content(testPagesSitemap))
+		writer.Close()
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(buffer.Bytes())
+	})
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the sitemaps not changed since the last fetch must not be fetched")
+	})
+	mux.HandleFunc("/pages/og", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Site | Spring release</title>
+<meta property="og:title" content="Spring release">
+<meta property="og:image" content="/images/spring.png">
+<meta property="article:published_time" content="2025-03-05T09:00:00Z">
+</head><body></body></html>`)
+	})
+	mux.HandleFunc("/pages/plain", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title> Office hours </title></head><body></body></html>`)
+	})
+	mux.HandleFunc("/pages/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Helper function: titles of the articles
+func articleTitles(articles []db.Article) []string {
+	titles := make([]string, len(articles))
+	for i, article := range articles {
+		titles[i] = article.Title
+	}
+	return titles
+}
+
+// Test extracting the entries of a Google News sitemap changed since the last fetch
+func TestSitemapScraper(t *testing.T) {
+	server := newSitemapServer(t)
+	scraper := NewSitemapScraper(http.DefaultClient, nil)
+	ctx := context.Background()
+
+	source := db.Source{Link: server.URL + "/news.xml", Type: db.SourceTypeSitemap}
+	source.ID = 4
+
+	// Never fetched: every entry with a title, newest first, without repeated URLs
+	articles, err := scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Budget vote postponed", "Storm warning for the coast"}, articleTitles(articles))
+
+	require.Equal(t, source.ID, articles[0].SourceID)
+	require.Equal(t, server.URL+"/articles/budget-vote", articles[0].Url)
+	require.Equal(t, "https://cdn.example.com/budget.jpg", articles[0].Image.String)
+	require.Equal(t, "2025-03-05T08:30:00Z", articles[0].PublishedDate)
+	require.False(t, articles[1].Image.Valid)
+	require.Equal(t, "2025-03-04T18:00:00+01:00", articles[1].PublishedDate)
+	require.NoError(t, scraper.CheckTitles(ctx, source))
+
+	// Only the entries changed since the last fetch
+	fetchedAt := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	source.FetchedAt = &fetchedAt
+	articles, err = scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Budget vote postponed"}, articleTitles(articles))
+
+	// Not a sitemap, or failing
+	source.Link = server.URL + "/pages/og"
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+
+	source.Link = server.URL + "/pages/broken"
+	_, err = scraper.Fetch(ctx, source)
+	require.Error(t, err)
+}
+
+// Test following a sitemap index and filling the entries from the metadata of their pages
+func TestSitemapIndexMetadata(t *testing.T) {
+	server := newSitemapServer(t)
+	scraper := NewSitemapScraper(http.DefaultClient, nil)
+	ctx := context.Background()
+
+	fetchedAt := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	source := db.Source{Link: server.URL + "/index.xml", Type: db.SourceTypeSitemap, FetchedAt: &fetchedAt}
+
+	// Plain sitemaps have no title without the metadata of the pages
+	articles, err := scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+	require.Empty(t, articles)
+	require.ErrorIs(t, scraper.CheckTitles(ctx, source), ErrSitemapUntitled)
+
+	// The pages failing to load are skipped
+	source.Sitemap = &db.SitemapOptions{Metadata: true}
+	require.NoError(t, scraper.CheckTitles(ctx, source))
+	articles, err = scraper.Fetch(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Spring release", "Office hours"}, articleTitles(articles))
+
+	require.Equal(t, server.URL+"/images/spring.png", articles[0].Image.String)
+	require.Equal(t, "2025-03-05T09:00:00Z", articles[0].PublishedDate)
+	require.False(t, articles[1].Image.Valid)
+	require.Equal(t, "2025-03-04T09:00:00Z", articles[1].PublishedDate)
+}
+
+// Test that scraping a sitemap source only stores the entries changed since its last scrape
+func TestScrapeSitemapSource(t *testing.T) {
+	server := newSitemapServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	source := db.Source{Link: server.URL + "/news.xml", Type: db.SourceTypeSitemap}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	before := time.Now()
+	inserted, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, 2, inserted)
+
+	source, err = store.GetSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.NotNil(t, source.FetchedAt)
+	require.False(t, source.FetchedAt.Before(before))
+
+	// The fixture has no entry newer than now, nothing is fetched again
+	articles, err := scraper.Preview(ctx, source)
+	require.NoError(t, err)
+	require.Empty(t, articles)
+}
+
+// Test that the entries left without title are fetched again on the next scrape
+func TestScrapeSitemapPending(t *testing.T) {
+	var (
+		server *httptest.Server
+		pages  atomic.Int32
+		broken atomic.Bool
+		total  = maxMetadataPages + 2
+		newest = time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := range total {
+			fmt.Fprintf(w, "<url><loc>%s/pages/%d</loc><lastmod>%s</lastmod></url>", server.URL, i, newest.Add(-time.Duration(i)*time.Hour).Format(time.RFC3339))
+		}
+		fmt.Fprint(w, `</urlset>`)
+	})
+	mux.HandleFunc("/pages/", func(w http.ResponseWriter, r *http.Request) {
+		pages.Add(1)
+		if broken.Load() && r.URL.Path == "/pages/0" {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head></html>", r.URL.Path)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+	source := db.Source{Link: server.URL + "/sitemap.xml", Type: db.SourceTypeSitemap, Sitemap: &db.SitemapOptions{Metadata: true}}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// The pages over the limit are left for the next scrape
+	inserted, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, maxMetadataPages, inserted)
+
+	source, err = store.GetSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, newest.Add(-time.Duration(total-1)*time.Hour-time.Second), source.FetchedAt.UTC())
+
+	// Only the pages not stored yet are fetched
+	pages.Store(0)
+	before := time.Now()
+	inserted, err = scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, 2, inserted)
+	require.EqualValues(t, 2, pages.Load())
+
+	source, err = store.GetSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.False(t, source.FetchedAt.Before(before))
+
+	// A page failing to load is fetched again
+	scraper, store = newTestScraper(t)
+	broken.Store(true)
+	fetchedAt := newest.Add(-time.Minute)
+	source = db.Source{Link: server.URL + "/sitemap.xml", Type: db.SourceTypeSitemap, Sitemap: &db.SitemapOptions{Metadata: true}, FetchedAt: &fetchedAt}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	inserted, err = scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Zero(t, inserted)
+
+	source, err = store.GetSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, newest.Add(-time.Second), source.FetchedAt.UTC())
+}
+
+// Test that the changed sitemaps of an index over the limit are fetched on the next scrapes
+func TestScrapeSitemapIndexPending(t *testing.T) {
+	var (
+		server  *httptest.Server
+		fetched atomic.Int32
+		total   = maxIndexSitemaps + 5
+		since   = time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+		lastmod = func(i int) time.Time { return since.Add(time.Duration(i+1) * time.Hour) }
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := range total {
+			fmt.Fprintf(w, "<sitemap><loc>%s/sitemaps/%d</loc><lastmod>%s</lastmod></sitemap>", server.URL, i, lastmod(i).Format(time.RFC3339))
+		}
+		fmt.Fprint(w, `</sitemapindex>`)
+	})
+	mux.HandleFunc("/sitemaps/", func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+<url><loc>%s/articles%s</loc><news:news><news:title>Article %s</news:title></news:news></url></urlset>`, server.URL, r.URL.Path, r.URL.Path)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+	source := db.Source{Link: server.URL + "/index.xml", Type: db.SourceTypeSitemap, FetchedAt: &since}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// The oldest changes are fetched first, the rest is left for the next scrape
+	inserted, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, maxIndexSitemaps, inserted)
+	require.EqualValues(t, maxIndexSitemaps, fetched.Load())
+
+	source, err = store.GetSource(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, lastmod(maxIndexSitemaps-1).Add(-time.Second), source.FetchedAt.UTC())
+
+	// The newest fetched sitemap is fetched again along with the ones left
+	fetched.Store(0)
+	inserted, err = scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, total-maxIndexSitemaps, inserted)
+	require.EqualValues(t, total-maxIndexSitemaps+1, fetched.Load())
+
+	articles, err := store.ListArticles(ctx, db.ArticleFilter{})
+	require.NoError(t, err)
+	require.Len(t, articles, total)
+}
+
+// Test the dates of the entries against the last fetch
+func TestChangedSince(t *testing.T) {
+	since := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		since   *time.Time
+		changed bool
+	}{
+		{"never fetched", "2020-01-01", nil, true},
+		{"no date", "", &since, true},
+		{"invalid date", "yesterday", &since, true},
+		{"newer", "2025-03-05T12:30:00Z", &since, true},
+		{"older", "2025-03-05T11:30:00Z", &since, false},
+		{"other time zone", "2025-03-05T13:30:00+02:00", &since, false},
+		{"without seconds", "2025-03-05T12:01Z", &since, true},
+		{"same day", "2025-03-05", &since, true},
+		{"day before", "2025-03-04", &since, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.changed, changedSince(test.value, test.since))
+		})
+	}
+}
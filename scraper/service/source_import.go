@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Formats of a source list
+const (
+	SourceListOPML = "opml"
+	SourceListCSV  = "csv"
+)
+
+// Guess the format of a source list from its file name
+func SourceListFormat(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".opml", ".xml":
+		return SourceListOPML, nil
+	case ".csv":
+		return SourceListCSV, nil
+	default:
+		return "", fmt.Errorf("unknown source list format of %q, expected .opml, .xml or .csv", name)
+	}
+}
+
+// Parse a list of sources, either an OPML subscription list or a CSV file with
+// link, provider and category columns. The sources are not validated against the database.
+func ParseSourceList(reader io.Reader, format string) ([]db.Source, error) {
+	switch format {
+	case SourceListOPML:
+		return parseOPML(reader)
+	case SourceListCSV:
+		return parseSourceCSV(reader)
+	default:
+		return nil, fmt.Errorf("unknown source list format %q", format)
+	}
+}
+
+// Outline element of an OPML document, nested to group feeds by category
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	Category string        `xml:"category,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// Helper function: collect the feeds of an OPML document. A feed without a category
+// attribute takes the text of its parent outline as category.
+func parseOPML(reader io.Reader) ([]db.Source, error) {
+	var document struct {
+		XMLName  xml.Name      `xml:"opml"`
+		Outlines []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.NewDecoder(reader).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid OPML: %w", err)
+	}
+
+	sources := make([]db.Source, 0)
+	var walk func(outlines []opmlOutline, parent string) error
+	walk = func(outlines []opmlOutline, parent string) error {
+		for _, outline := range outlines {
+			if outline.XMLURL == "" {
+				// A folder of feeds
+				category := outline.Text
+				if category == "" {
+					category = outline.Title
+				}
+				if err := walk(outline.Outlines, category); err != nil {
+					return err
+				}
+				continue
+			}
+
+			source, err := newImportedSource(outline.XMLURL, opmlProvider(outline), outline.Category)
+			if err != nil {
+				return err
+			}
+			if source.Category == "" {
+				source.Category = parent
+			}
+			sources = append(sources, source)
+		}
+		return nil
+	}
+
+	if err := walk(document.Outlines, ""); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// Helper function: name the provider of an OPML feed after its website, or its title
+func opmlProvider(outline opmlOutline) string {
+	if link, err := url.Parse(outline.HTMLURL); err == nil && link.Host != "" {
+		return link.Host
+	}
+
+	if outline.Title != "" {
+		return outline.Title
+	}
+	return outline.Text
+}
+
+// Helper function: read the sources of a CSV file, skipping the header row if any
+func parseSourceCSV(reader io.Reader) ([]db.Source, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	csvReader.Comment = '#'
+
+	sources := make([]db.Source, 0)
+	for line := 1; ; line++ {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "link") {
+			continue
+		}
+		if len(record) > 3 {
+			return nil, fmt.Errorf("line %d: expected link, provider and category, got %d fields", line, len(record))
+		}
+
+		// Missing provider and category are left empty
+		record = append(record, "", "")
+		source, err := newImportedSource(record[0], record[1], record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// Helper function: create a source after checking its link is an absolute HTTP URL
+func newImportedSource(link, provider, category string) (db.Source, error) {
+	link = strings.TrimSpace(link)
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return db.Source{}, fmt.Errorf("invalid feed link %q", link)
+	}
+
+	return db.Source{
+		Link:     link,
+		Provider: strings.TrimSpace(provider),
+		Category: strings.TrimSpace(category),
+	}, nil
+}
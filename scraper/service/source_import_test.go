@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="engineering">
+      <outline type="rss" text="Go Blog" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/blog"/>
+      <outline type="rss" text="Other" title="Other blog" xmlUrl="https://example.com/rss" category="misc"/>
+    </outline>
+    <outline type="rss" text="Top level" xmlUrl="http://example.org/feed"/>
+  </body>
+</opml>`
+
+// Test parsing the supported source lists
+func TestParseSourceList(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		input  string
+		want   []db.Source
+		err    string
+	}{
+		{
+			name:   "OPML",
+			format: SourceListOPML,
+			input:  testOPML,
+			want: []db.Source{
+				{Link: "https://go.dev/blog/feed.atom", Provider: "go.dev", Category: "engineering"},
+				{Link: "https://example.com/rss", Provider: "Other blog", Category: "misc"},
+				{Link: "http://example.org/feed", Provider: "Top level"},
+			},
+		},
+		{
+			name:   "InvalidOPML",
+			format: SourceListOPML,
+			input:  "<opml><body>",
+			err:    "invalid OPML",
+		},
+		{
+			name:   "CSV",
+			format: SourceListCSV,
+			input:  "link,provider,category\n# comment\nhttps://go.dev/blog/feed.atom, go.dev, engineering\nhttps://example.com/rss\n",
+			want: []db.Source{
+				{Link: "https://go.dev/blog/feed.atom", Provider: "go.dev", Category: "engineering"},
+				{Link: "https://example.com/rss"},
+			},
+		},
+		{
+			name:   "CSVInvalidLink",
+			format: SourceListCSV,
+			input:  "https://go.dev/blog/feed.atom\nftp://example.com/rss,example,news\n",
+			err:    `line 2: invalid feed link "ftp://example.com/rss"`,
+		},
+		{
+			name:   "CSVTooManyFields",
+			format: SourceListCSV,
+			input:  "https://example.com/rss,a,b,c\n",
+			err:    "line 1: expected link, provider and category",
+		},
+		{
+			name:   "UnknownFormat",
+			format: "json",
+			err:    "unknown source list format",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sources, err := ParseSourceList(strings.NewReader(testCase.input), testCase.format)
+			if testCase.err != "" {
+				require.ErrorContains(t, err, testCase.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testCase.want, sources)
+		})
+	}
+}
+
+// Test guessing the format of a source list from its file name
+func TestSourceListFormat(t *testing.T) {
+	format, err := SourceListFormat("feeds.OPML")
+	require.NoError(t, err)
+	require.Equal(t, SourceListOPML, format)
+
+	format, err = SourceListFormat("dir/sources.csv")
+	require.NoError(t, err)
+	require.Equal(t, SourceListCSV, format)
+
+	_, err = SourceListFormat("sources.txt")
+	require.Error(t, err)
+}
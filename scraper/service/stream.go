@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+)
+
+// Events queued for a subscriber before it is dropped for being too slow
+const streamSubscriberBuffer = 64
+
+// New article pushed to the subscribers of the stream, along with its source. IDs are
+// increasing sequence numbers of this process, starting over at each restart.
+type StreamEvent struct {
+	ID      uint64
+	Article db.Article
+}
+
+// Events a subscriber is interested in, empty fields match every article
+type StreamFilter struct {
+	SourceID uint
+	Category string
+}
+
+// Check whether the article of the event passes the filter
+func (filter StreamFilter) Matches(event StreamEvent) bool {
+	if filter.SourceID != 0 && event.Article.SourceID != filter.SourceID {
+		return false
+	}
+	if filter.Category != "" && event.Article.Source.Category != filter.Category {
+		return false
+	}
+	return true
+}
+
+// Subscription to the stream. Events is closed when the subscription is closed, or
+// when the subscriber falls too far behind; it can then resume from its last event.
+type Subscription struct {
+	Events <-chan StreamEvent
+
+	events chan StreamEvent
+	filter StreamFilter
+	stream *ArticleStream
+	closed bool
+}
+
+// Stop receiving events
+func (subscription *Subscription) Close() {
+	subscription.stream.mu.Lock()
+	defer subscription.stream.mu.Unlock()
+	subscription.stream.remove(subscription)
+}
+
+// Publishes the new articles to the subscribers as they are scraped, keeping the
+// latest ones in a bounded buffer so that reconnecting subscribers can catch up
+type ArticleStream struct {
+	mu          sync.Mutex
+	lastID      uint64
+	replay      []StreamEvent // Ring buffer of the latest events
+	next        int           // Index of the next event in replay
+	size        int           // Events in replay
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Constructor method for ArticleStream, keeping up to replaySize events to replay
+func NewArticleStream(replaySize int) *ArticleStream {
+	return &ArticleStream{
+		replay:      make([]StreamEvent, replaySize),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Push a new article to the subscribers, subscribed to the event bus
+func (stream *ArticleStream) HandleArticleCreated(ctx context.Context, created ArticleCreated) error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.lastID++
+	event := StreamEvent{ID: stream.lastID, Article: created.Article}
+
+	if len(stream.replay) > 0 {
+		stream.replay[stream.next] = event
+		stream.next = (stream.next + 1) % len(stream.replay)
+		stream.size = min(stream.size+1, len(stream.replay))
+	}
+
+	for subscription := range stream.subscribers {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			// Too slow, it resumes from its last event after reconnecting
+			stream.remove(subscription)
+		}
+	}
+	return nil
+}
+
+// Subscribe to the events matching the filter. With resume set, the buffered events
+// after lastEventID are returned to be sent first; if lastEventID is unknown, e.g.
+// after a restart, the whole buffer is. Returns nil once the stream is closed.
+func (stream *ArticleStream) Subscribe(filter StreamFilter, lastEventID uint64, resume bool) (*Subscription, []StreamEvent) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.closed {
+		return nil, nil
+	}
+
+	var missed []StreamEvent
+	if resume {
+		if lastEventID > stream.lastID {
+			lastEventID = 0
+		}
+
+		for i := range stream.size {
+			event := stream.replay[(stream.next-stream.size+i+len(stream.replay))%len(stream.replay)]
+			if event.ID > lastEventID && filter.Matches(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	events := make(chan StreamEvent, streamSubscriberBuffer)
+	subscription := &Subscription{Events: events, events: events, filter: filter, stream: stream}
+	stream.subscribers[subscription] = struct{}{}
+	return subscription, missed
+}
+
+// Close every subscription and refuse the new ones, on shutdown
+func (stream *ArticleStream) Close() {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.closed = true
+	for subscription := range stream.subscribers {
+		stream.remove(subscription)
+	}
+}
+
+// Helper method: remove a subscription and close its events, with the lock held
+func (stream *ArticleStream) remove(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+
+	subscription.closed = true
+	delete(stream.subscribers, subscription)
+	close(subscription.events)
+}
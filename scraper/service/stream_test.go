@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function: publish one article per title from the source
+func publish(stream *ArticleStream, source db.Source, titles ...string) {
+	for _, title := range titles {
+		article := db.Article{Title: title, SourceID: source.ID, Source: source}
+		stream.HandleArticleCreated(context.Background(), ArticleCreated{Article: article})
+	}
+}
+
+// Helper function: titles of the events
+func eventTitles(events []StreamEvent) []string {
+	titles := make([]string, 0, len(events))
+	for _, event := range events {
+		titles = append(titles, event.Article.Title)
+	}
+	return titles
+}
+
+// Helper function: receive the events already queued for the subscription
+func receive(subscription *Subscription) []StreamEvent {
+	var events []StreamEvent
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// Helper function: create a source of the category with the given ID
+func streamSource(id uint, category string) db.Source {
+	source := db.Source{Category: category}
+	source.ID = id
+	return source
+}
+
+// Test that subscribers only receive the events matching their filter
+func TestArticleStreamFilter(t *testing.T) {
+	tech := streamSource(1, "tech")
+	sport := streamSource(2, "sport")
+
+	tests := []struct {
+		name   string
+		filter StreamFilter
+		titles []string
+	}{
+		{"no filter", StreamFilter{}, []string{"go", "rust", "football"}},
+		{"source", StreamFilter{SourceID: 2}, []string{"football"}},
+		{"category", StreamFilter{Category: "tech"}, []string{"go", "rust"}},
+		{"source and category", StreamFilter{SourceID: 2, Category: "tech"}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := NewArticleStream(10)
+			subscription, missed := stream.Subscribe(test.filter, 0, false)
+			require.Empty(t, missed)
+			defer subscription.Close()
+
+			publish(stream, tech, "go", "rust")
+			publish(stream, sport, "football")
+
+			events := receive(subscription)
+			require.Equal(t, test.titles, eventTitles(events))
+			for _, event := range events {
+				// The source comes along, for the category of the article
+				require.Equal(t, event.Article.SourceID, event.Article.Source.ID)
+			}
+		})
+	}
+}
+
+// Test resuming the stream from the replay buffer
+func TestArticleStreamReplay(t *testing.T) {
+	source := streamSource(1, "tech")
+	stream := NewArticleStream(3)
+	publish(stream, source, "a", "b", "c", "d", "e")
+
+	tests := []struct {
+		name        string
+		filter      StreamFilter
+		lastEventID uint64
+		resume      bool
+		titles      []string
+	}{
+		{"no resume", StreamFilter{}, 0, false, []string{}},
+		{"from the start", StreamFilter{}, 0, true, []string{"c", "d", "e"}},
+		{"within the buffer", StreamFilter{}, 3, true, []string{"d", "e"}},
+		{"up to date", StreamFilter{}, 5, true, []string{}},
+		{"unknown event", StreamFilter{}, 42, true, []string{"c", "d", "e"}},
+		{"filtered", StreamFilter{Category: "sport"}, 0, true, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscription, missed := stream.Subscribe(test.filter, test.lastEventID, test.resume)
+			defer subscription.Close()
+			require.Equal(t, test.titles, eventTitles(missed))
+		})
+	}
+
+	// Without buffer, nothing is replayed
+	stream = NewArticleStream(0)
+	publish(stream, source, "a")
+	subscription, missed := stream.Subscribe(StreamFilter{}, 0, true)
+	defer subscription.Close()
+	require.Empty(t, missed)
+}
+
+// Test that slow subscribers are dropped and that closing the stream ends every subscription
+func TestArticleStreamClose(t *testing.T) {
+	source := streamSource(1, "tech")
+	stream := NewArticleStream(10)
+
+	slow, _ := stream.Subscribe(StreamFilter{}, 0, false)
+	other, _ := stream.Subscribe(StreamFilter{Category: "sport"}, 0, false)
+	for range streamSubscriberBuffer + 1 {
+		publish(stream, source, "article")
+	}
+
+	// The slow subscriber got its buffer, then its events were closed
+	require.Len(t, receive(slow), streamSubscriberBuffer)
+	_, ok := <-slow.Events
+	require.False(t, ok)
+	slow.Close()
+
+	stream.Close()
+	_, ok = <-other.Events
+	require.False(t, ok)
+
+	subscription, _ := stream.Subscribe(StreamFilter{}, 0, false)
+	require.Nil(t, subscription)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Test the spans of a scraping run: one per source, with fetch, parse and persist children
+func TestScrapeTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	server := newFixtureServer(t)
+	scraper, store := newTestScraper(t)
+	ctx := context.Background()
+
+	healthy := db.Source{Link: server.URL + "/rss.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &healthy))
+	broken := db.Source{Link: server.URL + "/broken.xml", Provider: "fixture", Category: "test"}
+	require.NoError(t, store.CreateSource(ctx, &broken))
+
+	require.Error(t, scraper.Run(ctx))
+
+	// Index the spans by name, and count the children of each span
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	require.Len(t, spans["scraper.Run"], 1)
+	run := spans["scraper.Run"][0]
+	require.Equal(t, "Error", run.Status().Code.String())
+
+	require.Len(t, spans["scraper.Scrape"], 2)
+	for _, scrape := range spans["scraper.Scrape"] {
+		require.Equal(t, run.SpanContext().SpanID(), scrape.Parent().SpanID())
+	}
+	require.Len(t, spans["scraper.fetch"], 2)
+	require.Len(t, spans["scraper.parse"], 2)
+
+	// The broken feed never reaches the database
+	require.Len(t, spans["scraper.persist"], 1)
+
+	// The HTTP client span is a child of the fetch span
+	fetchIDs := make(map[string]bool)
+	for _, fetch := range spans["scraper.fetch"] {
+		fetchIDs[fetch.SpanContext().SpanID().String()] = true
+	}
+	require.Len(t, spans["HTTP GET"], 2)
+	for _, request := range spans["HTTP GET"] {
+		require.True(t, fetchIDs[request.Parent().SpanID().String()])
+	}
+}
@@ -0,0 +1,438 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Headers of a webhook delivery. The signature is "sha256=" followed by the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>", keyed with the secret of the webhook.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Every webhook secret starts with this prefix
+const WebhookSecretPrefix = "whsec_"
+
+// Name of the lease held by the instance sending the deliveries
+const webhooksLease = "webhooks"
+
+// Longest delay between two attempts of a delivery
+const maxWebhookBackoff = 6 * time.Hour
+
+// Deliveries loaded at once
+const webhookBatchSize = 50
+
+// Delivery settings of the webhooks
+type WebhookOptions struct {
+	MaxAttempts  int           // Attempts before a delivery fails
+	Timeout      time.Duration // Time allowed for the receiver to answer
+	Backoff      time.Duration // Delay before the first retry, doubled for each next one
+	PollInterval time.Duration // Time between two checks for due deliveries
+}
+
+// Payload of the article.created event
+type ArticleEvent struct {
+	Event     string           `json:"event"`
+	CreatedAt time.Time        `json:"created_at"`
+	Article   ArticleEventData `json:"article"`
+}
+
+// Article sent in events
+type ArticleEventData struct {
+	ID            uint            `json:"id"`
+	Title         string          `json:"title"`
+	URL           string          `json:"url"`
+	Image         string          `json:"image,omitempty"`
+	PublishedDate string          `json:"published_date"`
+	Source        SourceEventData `json:"source"`
+}
+
+// Source of an article sent in events
+type SourceEventData struct {
+	ID       uint   `json:"id"`
+	Link     string `json:"link"`
+	Provider string `json:"provider"`
+	Category string `json:"category"`
+}
+
+// Sends the new articles to the matching webhooks. Deliveries are stored before being
+// sent, so they survive restarts, and are retried with exponential backoff.
+type Webhooks struct {
+	store   db.WebhookStore
+	options WebhookOptions
+	client  *http.Client
+	logger  *slog.Logger
+	leases  *Leases
+
+	// Context of the deliveries in flight, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	kick    chan struct{} // Wakes the sender up when deliveries are due
+	started bool
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Constructor method for Webhooks
+func NewWebhooks(store db.WebhookStore, options WebhookOptions, logger *slog.Logger) *Webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Webhooks{
+		store:   store,
+		options: options,
+		client:  &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Only send the deliveries while holding the webhooks lease, so that a single
+// instance sends them when several share the database
+func (webhooks *Webhooks) SetLeases(leases *Leases) {
+	webhooks.leases = leases
+}
+
+// Generate a random webhook secret
+func GenerateWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return WebhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Sign the body of a delivery sent at timestamp (Unix seconds), as in the signature header
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check the signature of a delivery, for receivers
+func VerifyWebhook(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
+
+// Check whether an article of the source matches the filters of the webhook
+func WebhookMatches(webhook db.Webhook, source db.Source, article db.Article) bool {
+	if webhook.SourceID != nil && *webhook.SourceID != source.ID {
+		return false
+	}
+
+	if webhook.Category != "" && !strings.EqualFold(webhook.Category, source.Category) {
+		return false
+	}
+
+	if webhook.Keyword != "" && !strings.Contains(strings.ToLower(article.Title), strings.ToLower(webhook.Keyword)) {
+		return false
+	}
+
+	return true
+}
+
+// Queue a delivery of a new article to each matching webhook, subscribed to the event bus
+func (webhooks *Webhooks) HandleArticleCreated(ctx context.Context, event ArticleCreated) error {
+	return webhooks.queue(ctx, event.Article.Source, []db.Article{event.Article})
+}
+
+// Helper method: create the deliveries of the new articles, then wake the sender up
+func (webhooks *Webhooks) queue(ctx context.Context, source db.Source, articles []db.Article) error {
+	subscriptions, err := webhooks.store.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	deliveries := make([]db.WebhookDelivery, 0)
+	for _, article := range articles {
+		var payload []byte
+		for _, webhook := range subscriptions {
+			if !WebhookMatches(webhook, source, article) {
+				continue
+			}
+
+			// The same payload goes to every webhook
+			if payload == nil {
+				if payload, err = json.Marshal(newArticleEvent(source, article, now)); err != nil {
+					return err
+				}
+			}
+
+			deliveries = append(deliveries, db.WebhookDelivery{
+				WebhookID:     webhook.ID,
+				Event:         EventArticleCreated,
+				Payload:       string(payload),
+				Status:        db.DeliveryPending,
+				NextAttemptAt: now,
+			})
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := webhooks.store.CreateDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+
+	webhooks.wake()
+	return nil
+}
+
+// Helper function: build the event of a new article
+func newArticleEvent(source db.Source, article db.Article, now time.Time) ArticleEvent {
+	return ArticleEvent{
+		Event:     EventArticleCreated,
+		CreatedAt: now,
+		Article: ArticleEventData{
+			ID:            article.ID,
+			Title:         article.Title,
+			URL:           article.Url,
+			Image:         article.Image.String,
+			PublishedDate: article.PublishedDate,
+			Source: SourceEventData{
+				ID:       source.ID,
+				Link:     source.Link,
+				Provider: source.Provider,
+				Category: source.Category,
+			},
+		},
+	}
+}
+
+// Queue a delivery again, with a fresh set of attempts, whatever its status
+func (webhooks *Webhooks) Redeliver(ctx context.Context, id uint) (db.WebhookDelivery, error) {
+	delivery, err := webhooks.store.GetDelivery(ctx, id)
+	if err != nil {
+		return db.WebhookDelivery{}, err
+	}
+
+	delivery.Status = db.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	if err := webhooks.store.UpdateDelivery(ctx, &delivery); err != nil {
+		return db.WebhookDelivery{}, err
+	}
+
+	webhooks.wake()
+	return delivery, nil
+}
+
+// Helper method: wake the sender up, if not already awake
+func (webhooks *Webhooks) wake() {
+	select {
+	case webhooks.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Start sending the deliveries in the background
+func (webhooks *Webhooks) Start() {
+	webhooks.started = true
+	go func() {
+		defer close(webhooks.stopped)
+
+		ticker := time.NewTicker(webhooks.options.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := webhooks.deliverDue(webhooks.ctx); err != nil {
+				webhooks.logger.Error("Failed to send webhook deliveries", "error", err)
+			}
+
+			select {
+			case <-webhooks.stop:
+				return
+			case <-ticker.C:
+			case <-webhooks.kick:
+			}
+		}
+	}()
+}
+
+// Stop sending and wait for the deliveries in flight, cancelling them if ctx is done first
+func (webhooks *Webhooks) Shutdown(ctx context.Context) error {
+	webhooks.once.Do(func() { close(webhooks.stop) })
+	if !webhooks.started {
+		return nil
+	}
+
+	select {
+	case <-webhooks.stopped:
+		webhooks.leases.Release(context.Background(), webhooksLease)
+		return nil
+	case <-ctx.Done():
+		webhooks.cancel()
+		<-webhooks.stopped
+		webhooks.leases.Release(context.Background(), webhooksLease)
+		return ctx.Err()
+	}
+}
+
+// Helper method: send the due deliveries, batch after batch
+func (webhooks *Webhooks) deliverDue(ctx context.Context) error {
+	// Hold the lease at least until the next poll, plus the time to send a delivery. It
+	// is renewed before each delivery, as a batch takes up to its size times the timeout.
+	ttl := 2*webhooks.options.PollInterval + webhooks.options.Timeout
+	acquired, err := webhooks.leases.Acquire(ctx, webhooksLease, ttl)
+	if err != nil || !acquired {
+		return err
+	}
+
+	cache := make(map[uint]*db.Webhook)
+	for {
+		deliveries, err := webhooks.store.DueDeliveries(ctx, time.Now().UTC(), webhookBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			select {
+			case <-webhooks.stop:
+				return nil
+			default:
+			}
+
+			// Stop if another instance took the lease over meanwhile
+			acquired, err := webhooks.leases.Acquire(ctx, webhooksLease, ttl)
+			if err != nil || !acquired {
+				return err
+			}
+
+			if err := webhooks.deliver(ctx, delivery, cache); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+// Helper method: make an attempt of a delivery and record its outcome. Only storage
+// errors are returned, failed attempts are retried later.
+func (webhooks *Webhooks) deliver(ctx context.Context, delivery db.WebhookDelivery, cache map[uint]*db.Webhook) error {
+	webhook, ok := cache[delivery.WebhookID]
+	if !ok {
+		found, err := webhooks.store.GetWebhook(ctx, delivery.WebhookID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+
+		if err == nil {
+			webhook = &found
+		}
+		cache[delivery.WebhookID] = webhook
+	}
+
+	if webhook == nil {
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = "webhook deleted"
+		return webhooks.store.UpdateDelivery(ctx, &delivery)
+	}
+
+	statusCode, err := webhooks.send(ctx, *webhook, delivery)
+	if ctx.Err() != nil {
+		// Shutting down, the attempt doesn't count
+		return nil
+	}
+
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.StatusCode = statusCode
+	delivery.Error = ""
+	switch {
+	case err == nil:
+		delivery.Status = db.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= webhooks.options.MaxAttempts:
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = now.Add(webhooks.backoff(delivery.Attempts))
+	}
+
+	if err != nil {
+		webhooks.logger.Warn("Webhook delivery failed", "webhook", webhook.ID, "delivery", delivery.ID,
+			"attempt", delivery.Attempts, "status", delivery.Status, "error", err)
+	}
+
+	return webhooks.store.UpdateDelivery(ctx, &delivery)
+}
+
+// Helper method: delay before the next attempt, after the given number of attempts
+func (webhooks *Webhooks) backoff(attempts int) time.Duration {
+	delay := webhooks.options.Backoff
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookBackoff)
+}
+
+// Helper method: POST the signed payload to the webhook, failing on non 2xx responses
+func (webhooks *Webhooks) send(ctx context.Context, webhook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	if webhooks.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, webhooks.options.Timeout)
+		defer cancel()
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NewsAggr-Webhook/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := webhooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Local receiver of webhook deliveries, failing the first attempts if asked to
+type testReceiver struct {
+	server   *httptest.Server
+	failures atomic.Int32 // Attempts left to fail
+
+	mu     sync.Mutex
+	events []ArticleEvent
+}
+
+// Helper function: start a receiver checking the signatures with the secret
+func newTestReceiver(t *testing.T, secret string) *testReceiver {
+	t.Helper()
+
+	receiver := &testReceiver{}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if !VerifyWebhook(secret, timestamp, body, r.Header.Get(WebhookSignatureHeader)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		if receiver.failures.Add(-1) >= 0 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		var event ArticleEvent
+		if err := json.Unmarshal(body, &event); err != nil || r.Header.Get(WebhookEventHeader) != event.Event {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+
+		receiver.mu.Lock()
+		receiver.events = append(receiver.events, event)
+		receiver.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.server.Close)
+
+	return receiver
+}
+
+// Helper method: titles of the articles received so far
+func (receiver *testReceiver) titles() []string {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	titles := make([]string, len(receiver.events))
+	for i, event := range receiver.events {
+		titles[i] = event.Article.Title
+	}
+	return titles
+}
+
+// Helper function: create webhooks retrying fast, started and shut down with the test
+func newTestWebhooks(t *testing.T, store db.WebhookStore, maxAttempts int) *Webhooks {
+	t.Helper()
+
+	webhooks := NewWebhooks(store, WebhookOptions{
+		MaxAttempts:  maxAttempts,
+		Timeout:      time.Second,
+		Backoff:      10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	webhooks.Start()
+	t.Cleanup(func() { webhooks.Shutdown(context.Background()) })
+
+	return webhooks
+}
+
+// Test which articles match the filters of a webhook
+func TestWebhookMatches(t *testing.T) {
+	sourceID := uint(1)
+	source := db.Source{Category: "Engineering"}
+	source.ID = 1
+	article := db.Article{Title: "Scaling Postgres at work"}
+
+	testCases := []struct {
+		name    string
+		webhook db.Webhook
+		want    bool
+	}{
+		{name: "NoFilter", webhook: db.Webhook{}, want: true},
+		{name: "Source", webhook: db.Webhook{SourceID: &sourceID}, want: true},
+		{name: "OtherSource", webhook: db.Webhook{SourceID: new(uint)}, want: false},
+		{name: "Category", webhook: db.Webhook{Category: "engineering"}, want: true},
+		{name: "OtherCategory", webhook: db.Webhook{Category: "news"}, want: false},
+		{name: "Keyword", webhook: db.Webhook{Keyword: "postgres"}, want: true},
+		{name: "OtherKeyword", webhook: db.Webhook{Keyword: "mysql"}, want: false},
+		{name: "EveryFilter", webhook: db.Webhook{SourceID: &sourceID, Category: "engineering", Keyword: "scaling"}, want: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, WebhookMatches(tc.webhook, source, article))
+		})
+	}
+}
+
+// Test that new articles are delivered signed to the matching webhooks, retrying failures
+func TestWebhookDelivery(t *testing.T) {
+	store := db.NewMemoryStore()
+	ctx := context.Background()
+
+	secret, err := GenerateWebhookSecret()
+	require.NoError(t, err)
+	receiver := newTestReceiver(t, secret)
+	receiver.failures.Store(2)
+
+	all := db.Webhook{URL: receiver.server.URL, Secret: secret}
+	require.NoError(t, store.CreateWebhook(ctx, &all))
+	filtered := db.Webhook{URL: receiver.server.URL, Secret: secret, Keyword: "release"}
+	require.NoError(t, store.CreateWebhook(ctx, &filtered))
+
+	webhooks := newTestWebhooks(t, store, 5)
+	bus := newTestEventBus(t, store)
+	Subscribe(bus, "webhooks", webhooks.HandleArticleCreated)
+	bus.Start()
+
+	source := db.Source{Link: "https://example.com/rss", Category: "engineering"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	articles := []db.Article{
+		{SourceID: source.ID, Title: "Release 2.0", Url: "https://example.com/release", Image: sql.NullString{String: "https://example.com/a.png", Valid: true}},
+		{SourceID: source.ID, Title: "Postmortem", Url: "https://example.com/postmortem"},
+	}
+	_, err = bus.SaveArticles(ctx, source, articles)
+	require.NoError(t, err)
+
+	// The release goes to both webhooks, the postmortem to the first one only
+	require.Eventually(t, func() bool {
+		return len(receiver.titles()) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	require.ElementsMatch(t, []string{"Release 2.0", "Release 2.0", "Postmortem"}, receiver.titles())
+
+	// The failed attempts are in the delivery log
+	deliveries, err := store.ListDeliveries(ctx, all.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+
+	attempts := 0
+	for _, delivery := range deliveries {
+		require.Equal(t, db.DeliverySucceeded, delivery.Status)
+		require.Equal(t, http.StatusNoContent, delivery.StatusCode)
+		require.NotNil(t, delivery.DeliveredAt)
+		attempts += delivery.Attempts
+	}
+
+	filteredDeliveries, err := store.ListDeliveries(ctx, filtered.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, filteredDeliveries, 1)
+	require.Equal(t, 5, attempts+filteredDeliveries[0].Attempts, "3 deliveries plus 2 failed attempts")
+
+	var event ArticleEvent
+	require.NoError(t, json.Unmarshal([]byte(filteredDeliveries[0].Payload), &event))
+	require.Equal(t, EventArticleCreated, event.Event)
+	require.Equal(t, "https://example.com/a.png", event.Article.Image)
+	require.Equal(t, source.Link, event.Article.Source.Link)
+}
+
+// Test that a delivery fails once out of attempts, and can be redelivered
+func TestWebhookRedeliver(t *testing.T) {
+	store := db.NewMemoryStore()
+	ctx := context.Background()
+
+	receiver := newTestReceiver(t, "secret")
+	receiver.failures.Store(3)
+
+	webhook := db.Webhook{URL: receiver.server.URL, Secret: "secret"}
+	require.NoError(t, store.CreateWebhook(ctx, &webhook))
+
+	webhooks := newTestWebhooks(t, store, 3)
+	source := db.Source{Link: "https://example.com/rss"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+	article := db.Article{SourceID: source.ID, Source: source, Title: "Hello", Url: "https://example.com/hello"}
+	require.NoError(t, store.CreateArticle(ctx, &article))
+	require.NoError(t, webhooks.HandleArticleCreated(ctx, ArticleCreated{Article: article}))
+
+	var delivery db.WebhookDelivery
+	require.Eventually(t, func() bool {
+		deliveries, err := store.ListDeliveries(ctx, webhook.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		delivery = deliveries[0]
+		return delivery.Status == db.DeliveryFailed
+	}, 3*time.Second, 10*time.Millisecond)
+	require.Equal(t, 3, delivery.Attempts)
+	require.Equal(t, http.StatusServiceUnavailable, delivery.StatusCode)
+	require.Contains(t, delivery.Error, "503")
+	require.Empty(t, receiver.titles())
+
+	// The receiver is back
+	redelivered, err := webhooks.Redeliver(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.DeliveryPending, redelivered.Status)
+
+	require.Eventually(t, func() bool {
+		return len(receiver.titles()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	_, err = webhooks.Redeliver(ctx, 100)
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
+
+// Test that the lease is kept while sending a batch longer than its time to live
+func TestWebhookLease(t *testing.T) {
+	store := db.NewMemoryStore()
+	ctx := context.Background()
+
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+
+	webhook := db.Webhook{URL: receiver.URL, Secret: "secret"}
+	require.NoError(t, store.CreateWebhook(ctx, &webhook))
+	source := db.Source{Link: "https://example.com/rss"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// 10 deliveries of 50ms each, while the lease is taken for 220ms
+	webhooks := NewWebhooks(store, WebhookOptions{
+		MaxAttempts:  1,
+		Timeout:      200 * time.Millisecond,
+		Backoff:      10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	webhooks.SetLeases(NewLeases(store, "this"))
+	for i := range 10 {
+		article := db.Article{SourceID: source.ID, Source: source, Title: "Article", Url: fmt.Sprintf("https://example.com/%d", i)}
+		require.NoError(t, store.CreateArticle(ctx, &article))
+		require.NoError(t, webhooks.HandleArticleCreated(ctx, ArticleCreated{Article: article}))
+	}
+
+	webhooks.Start()
+	t.Cleanup(func() { webhooks.Shutdown(context.Background()) })
+	require.Eventually(t, func() bool { return received.Load() > 0 }, 3*time.Second, 5*time.Millisecond)
+
+	// Another instance can't take the lease over until the batch is sent
+	other := NewLeases(store, "other")
+	for received.Load() < 10 {
+		acquired, err := other.Acquire(ctx, webhooksLease, time.Minute)
+		require.NoError(t, err)
+		require.False(t, acquired, "lease taken over after %d deliveries", received.Load())
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test the delay between attempts
+func TestWebhookBackoff(t *testing.T) {
+	webhooks := NewWebhooks(db.NewMemoryStore(), WebhookOptions{Backoff: time.Minute}, nil)
+
+	require.Equal(t, time.Minute, webhooks.backoff(1))
+	require.Equal(t, 2*time.Minute, webhooks.backoff(2))
+	require.Equal(t, 8*time.Minute, webhooks.backoff(4))
+	require.Equal(t, maxWebhookBackoff, webhooks.backoff(30))
+}
@@ -0,0 +1,575 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Header of the signature of the content pushed by a hub: the name of the hash, "=",
+// then the hex encoded HMAC of the body keyed with the secret of the subscription
+const WebSubSignatureHeader = "X-Hub-Signature"
+
+// Modes of the requests sent to the hubs and of their verifications
+const (
+	WebSubModeSubscribe   = "subscribe"
+	WebSubModeUnsubscribe = "unsubscribe"
+	WebSubModeDenied      = "denied"
+)
+
+// Name of the lease held by the instance sending the requests to the hubs
+const webSubLease = "websub"
+
+// Longest delay between two requests of a subscription the hub didn't verify
+const maxWebSubBackoff = 6 * time.Hour
+
+// Requests to unsubscribe sent before giving up, the hub lease expires anyway
+const maxUnsubscribeAttempts = 5
+
+// Time allowed for a hub to answer a request
+const webSubRequestTimeout = 30 * time.Second
+
+// Pushed content ignored because its signature is missing or wrong
+var ErrWebSubSignature = errors.New("invalid websub signature")
+
+// WebSub metrics
+var webSubNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "websub_notifications_total",
+	Help: "Content pushed by the WebSub hubs, labeled by outcome: ingested, ignored or failed.",
+}, []string{"outcome"})
+
+// Settings of the WebSub subscriptions
+type WebSubOptions struct {
+	CallbackURL  string        // Base of the callbacks, each subscription has its own under it
+	Lease        time.Duration // Lease requested from the hubs, which may grant another
+	Silence      time.Duration // Time without push after which a source is polled again
+	PollInterval time.Duration // Time between two checks for the subscriptions to request or renew
+}
+
+// Verification of the intent of a subscription, sent by its hub to the callback
+type WebSubVerification struct {
+	Mode         string
+	Topic        string
+	LeaseSeconds int    // Lease granted, when subscribing
+	Reason       string // Why the hub denied the subscription
+}
+
+// Subscribes the RSS sources to the WebSub hubs their feed advertises, so that the hubs
+// push the new items to the callbacks as soon as published. Subscriptions are renewed
+// before their lease expires; the sources are polled again once their hub goes silent.
+type WebSub struct {
+	store   db.WebSubStore
+	sources db.SourceStore
+	scraper *RssScraper
+	options WebSubOptions
+	client  *http.Client
+	logger  *slog.Logger
+	leases  *Leases
+
+	// Context of the requests in flight, cancelled if they outlive the shutdown deadline
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	kick    chan struct{} // Wakes the sender up when requests are due
+	started bool
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Constructor method for WebSub, the pushed content is stored by scraper
+func NewWebSub(store db.WebSubStore, sources db.SourceStore, scraper *RssScraper, options WebSubOptions, logger *slog.Logger) *WebSub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebSub{
+		store:   store,
+		sources: sources,
+		scraper: scraper,
+		options: options,
+		client:  &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Only send the requests to the hubs while holding the websub lease, so that a single
+// instance sends them when several share the database
+func (websub *WebSub) SetLeases(leases *Leases) {
+	websub.leases = leases
+}
+
+// Callback of a subscription, where its hub verifies it and pushes the content
+func (websub *WebSub) CallbackURL(id uint) string {
+	return strings.TrimSuffix(websub.options.CallbackURL, "/") + "/" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Sign pushed content with the secret of a subscription, as in the signature header
+func SignWebSub(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check the signature of pushed content, with any of the hashes allowed by WebSub
+func VerifyWebSub(secret string, body []byte, signature string) bool {
+	method, value, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+
+	var hasher func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		hasher = sha1.New
+	case "sha256":
+		hasher = sha256.New
+	case "sha384":
+		hasher = sha512.New384
+	case "sha512":
+		hasher = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(value)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(hasher, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Update the subscription of a scraped source from the WebSub links of its feed:
+// subscribe to a new or different hub, unsubscribe once the feed drops its hub
+func (websub *WebSub) Discovered(ctx context.Context, source db.Source, links webSubLinks) error {
+	subscription, err := websub.store.GetSourceSubscription(ctx, source.ID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	exists := err == nil
+
+	if links.hub == "" {
+		switch {
+		case !exists || subscription.Status == db.WebSubUnsubscribing:
+			return nil
+		case subscription.Status == db.WebSubDenied:
+			return websub.store.DeleteSubscription(ctx, subscription.ID)
+		}
+
+		subscription.Status = db.WebSubUnsubscribing
+		subscription.Attempts = 0
+		subscription.NextAttemptAt = time.Now().UTC()
+		subscription.Error = ""
+		if err := websub.store.SaveSubscription(ctx, &subscription); err != nil {
+			return err
+		}
+		websub.wake()
+		return nil
+	}
+
+	topic := links.self
+	if topic == "" {
+		topic = source.Link
+	}
+	if exists && subscription.Hub == links.hub && subscription.Topic == topic && subscription.Status != db.WebSubUnsubscribing {
+		return nil
+	}
+
+	// A new subscription, the previous hub stops pushing once its lease expires
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	subscription = db.WebSubSubscription{
+		ID:            subscription.ID,
+		CreatedAt:     subscription.CreatedAt,
+		SourceID:      source.ID,
+		Hub:           links.hub,
+		Topic:         topic,
+		Secret:        base64.RawURLEncoding.EncodeToString(secret),
+		Status:        db.WebSubPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := websub.store.SaveSubscription(ctx, &subscription); err != nil {
+		return err
+	}
+
+	websub.logger.Info("Subscribing to WebSub hub", "source", source.ID, "hub", links.hub, "topic", topic)
+	websub.wake()
+	return nil
+}
+
+// Leave out the sources their hub pushes, unless it went silent for longer than the
+// silence option or its lease expired
+func (websub *WebSub) Polled(ctx context.Context, sources []db.Source) ([]db.Source, error) {
+	subscriptions, err := websub.store.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pushed := make(map[uint]bool)
+	for _, subscription := range subscriptions {
+		if subscription.Status != db.WebSubActive || subscription.ExpiresAt == nil || now.After(*subscription.ExpiresAt) {
+			continue
+		}
+
+		// Verified but nothing pushed yet counts from the verification
+		lastHeard := subscription.VerifiedAt
+		if subscription.PushedAt != nil {
+			lastHeard = subscription.PushedAt
+		}
+		if lastHeard != nil && now.Sub(*lastHeard) < websub.options.Silence {
+			pushed[subscription.SourceID] = true
+		}
+	}
+
+	polled := make([]db.Source, 0, len(sources))
+	for _, source := range sources {
+		if !pushed[source.ID] {
+			polled = append(polled, source)
+		}
+	}
+	return polled, nil
+}
+
+// Check the intent of the hub of a subscription, returning whether this instance
+// agrees. Unsubscribing from a subscription not found is confirmed.
+func (websub *WebSub) Verify(ctx context.Context, id uint, verification WebSubVerification) (bool, error) {
+	subscription, err := websub.store.GetSubscription(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return verification.Mode == WebSubModeUnsubscribe, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if verification.Topic != subscription.Topic {
+		return false, nil
+	}
+
+	switch {
+	case verification.Mode == WebSubModeSubscribe && (subscription.Status == db.WebSubPending || subscription.Status == db.WebSubActive):
+		now := time.Now().UTC()
+		subscription.Status = db.WebSubActive
+		subscription.Attempts = 0
+		subscription.NextAttemptAt = time.Time{}
+		subscription.Error = ""
+		subscription.VerifiedAt = &now
+		subscription.ExpiresAt = nil
+		if verification.LeaseSeconds > 0 {
+			expiresAt := now.Add(time.Duration(verification.LeaseSeconds) * time.Second)
+			subscription.ExpiresAt = &expiresAt
+		}
+		websub.logger.Info("WebSub subscription verified", "subscription", subscription.ID, "source", subscription.SourceID, "expires_at", subscription.ExpiresAt)
+		return true, websub.store.SaveSubscription(ctx, &subscription)
+
+	case verification.Mode == WebSubModeUnsubscribe && subscription.Status == db.WebSubUnsubscribing:
+		websub.logger.Info("WebSub unsubscription verified", "subscription", subscription.ID, "source", subscription.SourceID)
+		return true, websub.store.DeleteSubscription(ctx, subscription.ID)
+
+	case verification.Mode == WebSubModeDenied:
+		subscription.Status = db.WebSubDenied
+		subscription.Error = verification.Reason
+		websub.logger.Warn("WebSub subscription denied", "subscription", subscription.ID, "source", subscription.SourceID, "reason", verification.Reason)
+		return true, websub.store.SaveSubscription(ctx, &subscription)
+	}
+
+	return false, nil
+}
+
+// Store the content pushed by the hub of a subscription, returning the number of new
+// articles. Returns ErrWebSubSignature for content that must be ignored, and
+// db.ErrNotFound once the subscription or its source is gone.
+func (websub *WebSub) Receive(ctx context.Context, id uint, signature string, body []byte) (int, error) {
+	subscription, err := websub.store.GetSubscription(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if subscription.Status != db.WebSubActive || !VerifyWebSub(subscription.Secret, body, signature) {
+		webSubNotifications.WithLabelValues("ignored").Inc()
+		return 0, ErrWebSubSignature
+	}
+
+	source, err := websub.sources.GetSource(ctx, subscription.SourceID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return 0, err
+	}
+	if err != nil || (source.Type != "" && source.Type != db.SourceTypeRSS) {
+		// Deleted source or no longer a feed, the hub stops pushing once unsubscribed
+		var gone db.Source
+		gone.ID = subscription.SourceID
+		return 0, errors.Join(db.ErrNotFound, websub.Discovered(ctx, gone, webSubLinks{}))
+	}
+
+	inserted, err := websub.scraper.Ingest(ctx, source, body)
+	if err != nil {
+		webSubNotifications.WithLabelValues("failed").Inc()
+		return 0, err
+	}
+	webSubNotifications.WithLabelValues("ingested").Inc()
+
+	now := time.Now().UTC()
+	subscription.PushedAt = &now
+	return inserted, websub.store.SaveSubscription(ctx, &subscription)
+}
+
+// Helper method: wake the sender up, if not already awake
+func (websub *WebSub) wake() {
+	select {
+	case websub.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Start sending the subscription requests in the background
+func (websub *WebSub) Start() {
+	websub.started = true
+	go func() {
+		defer close(websub.stopped)
+
+		ticker := time.NewTicker(websub.options.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := websub.requestDue(websub.ctx); err != nil {
+				websub.logger.Error("Failed to send WebSub requests", "error", err)
+			}
+
+			select {
+			case <-websub.stop:
+				return
+			case <-ticker.C:
+			case <-websub.kick:
+			}
+		}
+	}()
+}
+
+// Stop sending and wait for the requests in flight, cancelling them if ctx is done first
+func (websub *WebSub) Shutdown(ctx context.Context) error {
+	websub.once.Do(func() { close(websub.stop) })
+	if !websub.started {
+		return nil
+	}
+
+	select {
+	case <-websub.stopped:
+		websub.leases.Release(context.Background(), webSubLease)
+		return nil
+	case <-ctx.Done():
+		websub.cancel()
+		<-websub.stopped
+		websub.leases.Release(context.Background(), webSubLease)
+		return ctx.Err()
+	}
+}
+
+// Helper method: send the due requests, to subscribe, renew before the lease expires
+// or unsubscribe
+func (websub *WebSub) requestDue(ctx context.Context) error {
+	// Hold the lease at least until the next poll, plus the time to send a request
+	ttl := 2*websub.options.PollInterval + webSubRequestTimeout
+	acquired, err := websub.leases.Acquire(ctx, webSubLease, ttl)
+	if err != nil || !acquired {
+		return err
+	}
+
+	subscriptions, err := websub.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		select {
+		case <-websub.stop:
+			return nil
+		default:
+		}
+
+		now := time.Now().UTC()
+		if !webSubDue(subscription, now) {
+			continue
+		}
+		if err := websub.request(ctx, subscription, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function: whether a request of the subscription is due at now. Active
+// subscriptions are renewed once three quarters of their lease have passed.
+func webSubDue(subscription db.WebSubSubscription, now time.Time) bool {
+	if now.Before(subscription.NextAttemptAt) {
+		return false
+	}
+
+	switch subscription.Status {
+	case db.WebSubPending, db.WebSubUnsubscribing:
+		return true
+	case db.WebSubActive:
+		if subscription.VerifiedAt == nil || subscription.ExpiresAt == nil {
+			return false
+		}
+		lease := subscription.ExpiresAt.Sub(*subscription.VerifiedAt)
+		return !now.Before(subscription.VerifiedAt.Add(lease * 3 / 4))
+	default:
+		return false
+	}
+}
+
+// Helper method: send the request of a subscription to its hub and record the attempt.
+// Only storage errors are returned, failed requests are sent again later.
+func (websub *WebSub) request(ctx context.Context, subscription db.WebSubSubscription, now time.Time) error {
+	original := subscription
+	mode := WebSubModeSubscribe
+	if subscription.Status == db.WebSubUnsubscribing {
+		mode = WebSubModeUnsubscribe
+	} else if _, err := websub.sources.GetSource(ctx, subscription.SourceID); errors.Is(err, db.ErrNotFound) {
+		// Deleted source, unsubscribe instead of renewing
+		mode = WebSubModeUnsubscribe
+		subscription.Status = db.WebSubUnsubscribing
+		subscription.Attempts = 0
+	} else if err != nil {
+		return err
+	}
+
+	// An active subscription whose lease expired is no longer pushed
+	if subscription.Status == db.WebSubActive && subscription.ExpiresAt != nil && now.After(*subscription.ExpiresAt) {
+		subscription.Status = db.WebSubPending
+	}
+
+	err := websub.send(ctx, subscription, mode)
+	if ctx.Err() != nil {
+		// Shutting down, the attempt doesn't count
+		return nil
+	}
+
+	// Hubs may verify the intent before answering, or the feed change hub meanwhile:
+	// the attempt is only recorded if the subscription is as it was before the request
+	stored, getErr := websub.store.GetSubscription(ctx, subscription.ID)
+	if errors.Is(getErr, db.ErrNotFound) {
+		return nil
+	}
+	if getErr != nil {
+		return getErr
+	}
+	if changedWebSub(stored, original) {
+		return nil
+	}
+
+	subscription.Attempts++
+	subscription.Error = ""
+	if err != nil {
+		subscription.Error = err.Error()
+		websub.logger.Warn("WebSub request failed", "subscription", subscription.ID, "mode", mode,
+			"hub", subscription.Hub, "attempt", subscription.Attempts, "error", err)
+	}
+
+	if mode == WebSubModeUnsubscribe && subscription.Attempts >= maxUnsubscribeAttempts {
+		return websub.store.DeleteSubscription(ctx, subscription.ID)
+	}
+
+	// Sent again unless verified by then
+	subscription.NextAttemptAt = now.Add(webSubBackoff(subscription.Attempts))
+	return websub.store.SaveSubscription(ctx, &subscription)
+}
+
+// Helper function: whether the subscription was verified, denied or replaced since the
+// stored version was read
+func changedWebSub(stored, read db.WebSubSubscription) bool {
+	return stored.Status != read.Status || stored.Secret != read.Secret || !equalTime(stored.VerifiedAt, read.VerifiedAt)
+}
+
+// Helper function: whether two optional times are both unset or equal
+func equalTime(first, second *time.Time) bool {
+	if first == nil || second == nil {
+		return first == second
+	}
+	return first.Equal(*second)
+}
+
+// Helper function: delay before sending a request again, after the given number of attempts
+func webSubBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < maxWebSubBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebSubBackoff)
+}
+
+// Helper method: POST the (un)subscription request to the hub, which answers 202 then
+// verifies the intent at the callback
+func (websub *WebSub) send(ctx context.Context, subscription db.WebSubSubscription, mode string) error {
+	ctx, cancel := context.WithTimeout(ctx, webSubRequestTimeout)
+	defer cancel()
+
+	form := url.Values{
+		"hub.mode":     {mode},
+		"hub.topic":    {subscription.Topic},
+		"hub.callback": {websub.CallbackURL(subscription.ID)},
+	}
+	if mode == WebSubModeSubscribe {
+		form.Set("hub.secret", subscription.Secret)
+		form.Set("hub.lease_seconds", strconv.Itoa(int(websub.options.Lease.Seconds())))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "NewsAggr-WebSub/1.0")
+
+	resp, err := websub.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("hub answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// WebSub links of a feed: its hub and its own URL, the topic to subscribe to
+type webSubLinks struct {
+	hub  string
+	self string
+}
+
+// Helper function: find the WebSub links of a feed in the Link headers of its response,
+// then in the link elements of the feed
+func discoverWebSub(link string, header http.Header, body []byte) webSubLinks {
+	return discoverLinks(link, header, body).webSub()
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Atom feed advertising a hub, or not once {{hub}} is left empty
+const testHubFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Pushed releases</title>
+  {{hub}}
+  <link rel="self" href="/feed.xml"/>
+  <entry>
+    <title>Release 1.0</title>
+    <link href="https://releases.example.com/1.0"/>
+    <updated>2025-03-01T10:00:00Z</updated>
+  </entry>
+</feed>`
+
+// Same feed as pushed by the hub, with a new entry
+const testPushedFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Pushed releases</title>
+  <entry>
+    <title>Release 1.1</title>
+    <link href="https://releases.example.com/1.1"/>
+    <updated>2025-03-08T10:00:00Z</updated>
+  </entry>
+  <entry>
+    <title>Release 1.0</title>
+    <link href="https://releases.example.com/1.0"/>
+    <updated>2025-03-01T10:00:00Z</updated>
+  </entry>
+</feed>`
+
+// Local WebSub hub recording the requests it receives, and the feed advertising it
+type testHub struct {
+	hub  *httptest.Server
+	feed *httptest.Server
+
+	mu        sync.Mutex
+	advertise bool
+	requests  chan url.Values
+}
+
+// Helper function: start a hub answering 202 to every request, and a feed advertising it
+func newTestHub(t *testing.T) *testHub {
+	t.Helper()
+
+	hub := &testHub{advertise: true, requests: make(chan url.Values, 10)}
+	hub.hub = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hub.requests <- r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(hub.hub.Close)
+
+	hub.feed = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+
+		link := ""
+		if hub.advertise {
+			link = fmt.Sprintf(`<link rel="hub" href="%s/"/>`, hub.hub.URL)
+		}
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, strings.ReplaceAll(testHubFeed, "{{hub}}", link))
+	}))
+	t.Cleanup(hub.feed.Close)
+
+	return hub
+}
+
+// Helper method: wait for the next request received by the hub
+func (hub *testHub) next(t *testing.T) url.Values {
+	t.Helper()
+
+	select {
+	case form := <-hub.requests:
+		return form
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received by the hub")
+		return nil
+	}
+}
+
+// Helper function: create WebSub subscriptions polling fast, started and shut down with the test
+func newTestWebSub(t *testing.T, store *db.MemoryStore, scraper *RssScraper) *WebSub {
+	t.Helper()
+
+	websub := NewWebSub(store, store, scraper, WebSubOptions{
+		CallbackURL:  "https://news.example.com/websub/",
+		Lease:        time.Hour,
+		Silence:      time.Hour,
+		PollInterval: 10 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	scraper.SetWebSub(websub)
+	websub.Start()
+	t.Cleanup(func() { websub.Shutdown(context.Background()) })
+
+	return websub
+}
+
+// Test subscribing to the hub of a feed, receiving its pushes, then unsubscribing once
+// the feed drops the hub
+func TestWebSubSubscription(t *testing.T) {
+	hub := newTestHub(t)
+	scraper, store := newTestScraper(t)
+	websub := newTestWebSub(t, store, scraper)
+	ctx := context.Background()
+
+	source := db.Source{Link: hub.feed.URL + "/feed.xml"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	// Scraping the feed subscribes to its hub
+	inserted, err := scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted)
+
+	subscription, err := store.GetSourceSubscription(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, hub.hub.URL+"/", subscription.Hub)
+	require.Equal(t, hub.feed.URL+"/feed.xml", subscription.Topic)
+
+	form := hub.next(t)
+	require.Equal(t, WebSubModeSubscribe, form.Get("hub.mode"))
+	require.Equal(t, subscription.Topic, form.Get("hub.topic"))
+	require.Equal(t, fmt.Sprintf("https://news.example.com/websub/%d", subscription.ID), form.Get("hub.callback"))
+	require.Equal(t, subscription.Secret, form.Get("hub.secret"))
+	require.Equal(t, "3600", form.Get("hub.lease_seconds"))
+
+	// Scraping again doesn't subscribe again
+	_, err = scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+
+	// Only the intent of this instance is verified
+	agreed, err := websub.Verify(ctx, subscription.ID, WebSubVerification{Mode: WebSubModeSubscribe, Topic: "https://other.example.com/feed", LeaseSeconds: 3600})
+	require.NoError(t, err)
+	require.False(t, agreed)
+
+	agreed, err = websub.Verify(ctx, subscription.ID, WebSubVerification{Mode: WebSubModeSubscribe, Topic: subscription.Topic, LeaseSeconds: 3600})
+	require.NoError(t, err)
+	require.True(t, agreed)
+
+	subscription, err = store.GetSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.WebSubActive, subscription.Status)
+	require.NotNil(t, subscription.ExpiresAt)
+
+	// The pushed source is no longer polled
+	polled, err := websub.Polled(ctx, []db.Source{source})
+	require.NoError(t, err)
+	require.Empty(t, polled)
+
+	// Pushed content is only stored when signed with the secret
+	body := []byte(testPushedFeed)
+	_, err = websub.Receive(ctx, subscription.ID, SignWebSub("wrong secret", body), body)
+	require.ErrorIs(t, err, ErrWebSubSignature)
+
+	inserted, err = websub.Receive(ctx, subscription.ID, SignWebSub(subscription.Secret, body), body)
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted)
+
+	subscription, err = store.GetSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	require.NotNil(t, subscription.PushedAt)
+
+	// Once the feed drops its hub, the subscription is cancelled
+	hub.mu.Lock()
+	hub.advertise = false
+	hub.mu.Unlock()
+
+	_, err = scraper.Scrape(ctx, source)
+	require.NoError(t, err)
+
+	form = hub.next(t)
+	require.Equal(t, WebSubModeUnsubscribe, form.Get("hub.mode"))
+	require.Empty(t, form.Get("hub.secret"))
+
+	agreed, err = websub.Verify(ctx, subscription.ID, WebSubVerification{Mode: WebSubModeUnsubscribe, Topic: subscription.Topic})
+	require.NoError(t, err)
+	require.True(t, agreed)
+
+	_, err = store.GetSourceSubscription(ctx, source.ID)
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	// Polled again, and the hub is told the subscription is gone
+	polled, err = websub.Polled(ctx, []db.Source{source})
+	require.NoError(t, err)
+	require.Len(t, polled, 1)
+
+	_, err = websub.Receive(ctx, subscription.ID, SignWebSub(subscription.Secret, body), body)
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
+
+// Test that a hub denying a subscription leaves it denied until the feed changes hub
+func TestWebSubDenied(t *testing.T) {
+	_, store := newTestScraper(t)
+	websub := NewWebSub(store, store, nil, WebSubOptions{Silence: time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	source := db.Source{Link: "https://releases.example.com/feed.xml"}
+	require.NoError(t, store.CreateSource(ctx, &source))
+
+	links := webSubLinks{hub: "https://hub.example.com/"}
+	require.NoError(t, websub.Discovered(ctx, source, links))
+	subscription, err := store.GetSourceSubscription(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, source.Link, subscription.Topic)
+
+	agreed, err := websub.Verify(ctx, subscription.ID, WebSubVerification{Mode: WebSubModeDenied, Topic: subscription.Topic, Reason: "not allowed"})
+	require.NoError(t, err)
+	require.True(t, agreed)
+
+	// Not requested again for the same hub
+	require.NoError(t, websub.Discovered(ctx, source, links))
+	subscription, err = store.GetSourceSubscription(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.WebSubDenied, subscription.Status)
+	require.Equal(t, "not allowed", subscription.Error)
+	require.False(t, webSubDue(subscription, time.Now().Add(time.Hour)))
+
+	// A new hub gets a new subscription, with a new secret
+	require.NoError(t, websub.Discovered(ctx, source, webSubLinks{hub: "https://other-hub.example.com/"}))
+	renewed, err := store.GetSourceSubscription(ctx, source.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.WebSubPending, renewed.Status)
+	require.NotEqual(t, subscription.Secret, renewed.Secret)
+
+	// Unsubscribing from an unknown subscription is confirmed, subscribing is not
+	agreed, err = websub.Verify(ctx, 999, WebSubVerification{Mode: WebSubModeUnsubscribe, Topic: source.Link})
+	require.NoError(t, err)
+	require.True(t, agreed)
+
+	agreed, err = websub.Verify(ctx, 999, WebSubVerification{Mode: WebSubModeSubscribe, Topic: source.Link})
+	require.NoError(t, err)
+	require.False(t, agreed)
+}
+
+// Test that the sources are polled again once their hub goes silent or their lease expires
+func TestWebSubPolled(t *testing.T) {
+	_, store := newTestScraper(t)
+	websub := NewWebSub(store, store, nil, WebSubOptions{Silence: time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	at := func(offset time.Duration) *time.Time {
+		date := now.Add(offset)
+		return &date
+	}
+
+	tests := []struct {
+		name         string
+		subscription db.WebSubSubscription
+		polled       bool
+	}{
+		{"pending", db.WebSubSubscription{Status: db.WebSubPending}, true},
+		{"just verified", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-time.Minute), ExpiresAt: at(time.Hour)}, false},
+		{"recently pushed", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-48 * time.Hour), ExpiresAt: at(time.Hour), PushedAt: at(-time.Minute)}, false},
+		{"silent", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-48 * time.Hour), ExpiresAt: at(time.Hour), PushedAt: at(-2 * time.Hour)}, true},
+		{"lease expired", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-2 * time.Minute), ExpiresAt: at(-time.Minute), PushedAt: at(-time.Minute)}, true},
+		{"unsubscribing", db.WebSubSubscription{Status: db.WebSubUnsubscribing, VerifiedAt: at(-time.Minute), ExpiresAt: at(time.Hour)}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := db.Source{Link: "https://example.com/" + url.PathEscape(test.name)}
+			require.NoError(t, store.CreateSource(ctx, &source))
+
+			test.subscription.SourceID = source.ID
+			test.subscription.Hub = "https://hub.example.com/"
+			test.subscription.Topic = source.Link
+			require.NoError(t, store.SaveSubscription(ctx, &test.subscription))
+
+			polled, err := websub.Polled(ctx, []db.Source{source})
+			require.NoError(t, err)
+			require.Equal(t, test.polled, len(polled) == 1)
+		})
+	}
+}
+
+// Test when the requests of the subscriptions are due, and the backoff between attempts
+func TestWebSubDue(t *testing.T) {
+	now := time.Now().UTC()
+	at := func(offset time.Duration) *time.Time {
+		date := now.Add(offset)
+		return &date
+	}
+
+	tests := []struct {
+		name         string
+		subscription db.WebSubSubscription
+		due          bool
+	}{
+		{"pending", db.WebSubSubscription{Status: db.WebSubPending}, true},
+		{"pending backing off", db.WebSubSubscription{Status: db.WebSubPending, NextAttemptAt: now.Add(time.Minute)}, false},
+		{"unsubscribing", db.WebSubSubscription{Status: db.WebSubUnsubscribing}, true},
+		{"denied", db.WebSubSubscription{Status: db.WebSubDenied}, false},
+		{"active", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-time.Hour), ExpiresAt: at(3 * time.Hour)}, false},
+		{"active to renew", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-3 * time.Hour), ExpiresAt: at(time.Hour)}, true},
+		{"active without lease", db.WebSubSubscription{Status: db.WebSubActive, VerifiedAt: at(-time.Hour)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.due, webSubDue(test.subscription, now))
+		})
+	}
+
+	require.Equal(t, time.Minute, webSubBackoff(1))
+	require.Equal(t, 4*time.Minute, webSubBackoff(3))
+	require.Equal(t, maxWebSubBackoff, webSubBackoff(20))
+}
+
+// Test finding the hub and topic of a feed in its response headers and its links
+func TestDiscoverWebSub(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		hub    string
+		self   string
+	}{
+		{
+			name: "atom links",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom"><link rel="hub" href="https://hub.example.com/"/><link rel="self" href="https://example.com/feed.xml"/></feed>`,
+			hub:  "https://hub.example.com/",
+			self: "https://example.com/feed.xml",
+		},
+		{
+			name: "rss atom links, relative",
+			body: `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><atom:link rel="self" href="/rss.xml"/><atom:link rel="hub" href="/hub"/></channel></rss>`,
+			hub:  "https://example.com/hub",
+			self: "https://example.com/rss.xml",
+		},
+		{
+			name:   "link headers first",
+			header: http.Header{"Link": {`<https://hub.example.com/>; rel="hub", <https://example.com/topic>; rel="self"`}},
+			body:   `<feed xmlns="http://www.w3.org/2005/Atom"><link rel="hub" href="https://other-hub.example.com/"/></feed>`,
+			hub:    "https://hub.example.com/",
+			self:   "https://example.com/topic",
+		},
+		{
+			name: "links of the entries ignored",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link rel="hub" href="https://hub.example.com/"/></entry></feed>`,
+		},
+		{
+			name: "no hub",
+			body: `<rss version="2.0"><channel><link>https://example.com/</link></channel></rss>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			links := discoverWebSub("https://example.com/feed", test.header, []byte(test.body))
+			require.Equal(t, test.hub, links.hub)
+			require.Equal(t, test.self, links.self)
+		})
+	}
+}
+
+// Test checking the signatures of pushed content with each hash allowed
+func TestVerifyWebSub(t *testing.T) {
+	body := []byte("<feed/>")
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{"sha256", SignWebSub("secret", body), true},
+		{"sha1", "sha1=f38e73e7d772790d36ded9be19b36748b2a27335", true},
+		{"sha512 upper case", "SHA512=384ccd8dbbe4e9af2519c641f8c9da094d600f81617283772712527e64841de36bb901fbb336a95fe96811d03de0c574537044d4bdcfc9559aa97e4eec5f8c7a", true},
+		{"other secret", SignWebSub("other", body), false},
+		{"unknown hash", "md5=00", false},
+		{"not hex", "sha256=zz", false},
+		{"missing", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.valid, VerifyWebSub("secret", body, test.signature))
+		})
+	}
+}
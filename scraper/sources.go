@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/danglnh07/newsaggr/scraper/db"
+	"github.com/danglnh07/newsaggr/scraper/service"
+)
+
+const sourcesUsage = `usage:
+  scraper sources list [-deleted] [-provider P] [-category C] [flags]
+  scraper sources add -link URL [-provider P] [-category C] [flags]
+  scraper sources remove [-purge] [flags] ID
+  scraper sources import [-format opml|csv] [flags] FILE`
+
+// Command to manage the sources
+func runSourcesCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(sourcesUsage)
+	}
+
+	flags := flag.NewFlagSet("sources "+args[0], flag.ContinueOnError)
+	var (
+		deleted, purge           bool
+		link, provider, category string
+		format                   string
+	)
+	switch args[0] {
+	case "list":
+		flags.BoolVar(&deleted, "deleted", false, "list the deleted sources instead of the active ones")
+		flags.StringVar(&provider, "provider", "", "only list the sources of this provider")
+		flags.StringVar(&category, "category", "", "only list the sources of this category")
+	case "add":
+		flags.StringVar(&link, "link", "", "link of the feed")
+		flags.StringVar(&provider, "provider", "", "provider of the feed")
+		flags.StringVar(&category, "category", "", "category of the feed")
+	case "remove":
+		flags.BoolVar(&purge, "purge", false, "delete the source and its articles permanently instead of soft deleting them")
+	case "import":
+		flags.StringVar(&format, "format", "", "format of the file, opml or csv, guessed from its extension by default")
+	default:
+		return errors.New(sourcesUsage)
+	}
+
+	config, err := parseCommand(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	queries, err := connectDB(config)
+	if err != nil {
+		return err
+	}
+	store := db.NewGormStore(queries)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		sources, err := store.ListSources(ctx, db.SourceFilter{Provider: provider, Category: category, Deleted: deleted})
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tTYPE\tLINK\tPROVIDER\tCATEGORY\tCREATED")
+		for _, source := range sources {
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				source.ID, source.Type, source.Link, source.Provider, source.Category, source.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return writer.Flush()
+
+	case "add":
+		if link == "" {
+			return errors.New("-link is required")
+		}
+
+		source := db.Source{Link: link, Provider: provider, Category: category}
+		if err := store.CreateSource(ctx, &source); err != nil {
+			if errors.Is(err, db.ErrDuplicate) {
+				return fmt.Errorf("source %s already exists", link)
+			}
+			return err
+		}
+
+		fmt.Printf("Added source %d (%s)\n", source.ID, source.Link)
+		return nil
+
+	case "remove":
+		if flags.NArg() != 1 {
+			return errors.New(sourcesUsage)
+		}
+
+		id, err := strconv.ParseUint(flags.Arg(0), 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid source id %q", flags.Arg(0))
+		}
+
+		remove, action := store.DeleteSource, "Deleted"
+		if purge {
+			remove, action = store.PurgeSource, "Purged"
+		}
+		if err := remove(ctx, uint(id)); err != nil {
+			return fmt.Errorf("source %d: %w", id, err)
+		}
+
+		fmt.Printf("%s source %d\n", action, id)
+		return nil
+
+	default:
+		if flags.NArg() != 1 {
+			return errors.New(sourcesUsage)
+		}
+
+		name := flags.Arg(0)
+		if format == "" {
+			if format, err = service.SourceListFormat(name); err != nil {
+				return err
+			}
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		sources, err := service.ParseSourceList(file, format)
+		if err != nil {
+			return err
+		}
+
+		// Sources already there are skipped, so importing the same list twice is harmless
+		added := 0
+		for _, source := range sources {
+			if err := store.CreateSource(ctx, &source); err != nil {
+				if errors.Is(err, db.ErrDuplicate) {
+					fmt.Printf("Skipped %s, already exists\n", source.Link)
+					continue
+				}
+				return err
+			}
+			added++
+		}
+
+		fmt.Printf("Imported %d of %d sources\n", added, len(sources))
+		return nil
+	}
+}
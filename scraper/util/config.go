@@ -1,25 +1,789 @@
 package util
 
 import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
 )
 
-// Project configuration
+// Project configuration. Every setting is loaded, from lowest to highest precedence, from:
+//  1. the defaults of DefaultConfig
+//  2. the config file given by -config or CONFIG_FILE, YAML or TOML depending on its extension
+//  3. the environment, including the .env file
+//  4. the command line flags, named after the key of the setting in the config file
+//
+// The settings, their keys, environment variables and defaults are listed in settings.
 type Config struct {
-	// Server config
-	BaseURL string
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Scrape    ScrapeConfig
+	Schedule  ScheduleConfig
+	CORS      CORSConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig
+	Tracing   TracingConfig
+	Retention RetentionConfig
+	Webhook   WebhookConfig
+	Stream    StreamConfig
+	Events    EventsConfig
+	WebSub    WebSubConfig
+	Backfill  BackfillConfig
+}
+
+// HTTP server config
+type ServerConfig struct {
+	Addr               string        // Listen address
+	BaseURL            string        // Public URL of the API
+	TLSCertFile        string        // Serve HTTPS with this certificate, along with TLSKeyFile
+	TLSKeyFile         string        // Private key of TLSCertFile
+	AllowAnonymousRead bool          // Serve read endpoints without an API key
+	ShutdownTimeout    time.Duration // Time to drain requests and running jobs on shutdown
+	ReadyMaxScrapeAge  time.Duration // Readiness fails if no scraping run finished since
+}
+
+// Database config
+type DatabaseConfig struct {
+	Driver          string        // postgres or sqlite
+	Conn            string        // Connection string, or the database file path for sqlite
+	MaxOpenConns    int           // Ignored for sqlite, which uses a single connection
+	MaxIdleConns    int           // Ignored for sqlite
+	ConnMaxLifetime time.Duration // Ignored for sqlite
+}
+
+// Scraping config
+type ScrapeConfig struct {
+	Concurrency int           // Sources scraped at the same time, 0 for no limit
+	Timeout     time.Duration // Time allowed to scrape a single source, 0 for no limit
+
+	// Base64 encoded 32 bytes AES key encrypting the custom headers and credentials of the
+	// sources. Sources with either can't be saved without it, nor fetched once it changes.
+	CredentialKey string
+
+	RedirectHosts  []string // Hosts of the link wrappers, such as FeedBurner's, followed to the article they redirect to
+	CanonicalLinks bool     // Fetch the pages of the new articles for their canonical link, to detect duplicates across sources
+}
+
+// Cron expressions, with seconds, of the scheduled jobs and their coordination
+type ScheduleConfig struct {
+	Scrape    string
+	Retention string
+	Overlap   string        // "skip" or "queue" a run due while the previous one is still going
+	LeaseTTL  time.Duration // Lease of the scheduler and of each scraped source, 0 to run as a single instance
+}
+
+// Cross-origin requests config
+type CORSConfig struct {
+	AllowedOrigins []string // Origins allowed to call the API, "*" for any, empty to disable CORS
+}
+
+// Logging config
+type LogConfig struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+}
+
+// Rate limit config, per API key or per IP for anonymous clients
+type RateLimitConfig struct {
+	Rate       float64 // Requests per second, 0 disables rate limiting
+	Burst      int     // Requests allowed at once
+	DailyQuota int     // Requests per UTC day for keys without their own quota, 0 for none
+}
+
+// Tracing config
+type TracingConfig struct {
+	OTLPEndpoint string // OTLP/HTTP endpoint of the trace collector, tracing is disabled if empty
+}
+
+// Retention config
+type RetentionConfig struct {
+	ArchiveDir string // Directory of the archived articles
+}
+
+// Outgoing webhooks config
+type WebhookConfig struct {
+	MaxAttempts  int           // Attempts before a delivery fails
+	Timeout      time.Duration // Time allowed for the receiver to answer
+	Backoff      time.Duration // Delay before the first retry, doubled for each next one
+	PollInterval time.Duration // Time between two checks for due deliveries
+}
+
+// Live article stream config
+type StreamConfig struct {
+	ReplaySize int           // Latest articles kept for the clients resuming the stream
+	Heartbeat  time.Duration // Time between two heartbeats on an idle stream
+}
+
+// Event bus config
+type EventsConfig struct {
+	MaxAttempts  int           // Failed dispatches before an event is given up
+	Grace        time.Duration // Age from which the outbox relay takes over an event not dispatched yet
+	PollInterval time.Duration // Time between two checks of the outbox
+	Retention    time.Duration // Time published events are kept in the outbox
+}
 
-	// Database config
-	DBConn string
+// WebSub push subscriptions config, the callbacks are served under the base URL of the server
+type WebSubConfig struct {
+	Enabled      bool          // Subscribe to the hubs advertised by the feeds, needs server.base_url
+	Lease        time.Duration // Lease requested from the hubs, which may grant another
+	Silence      time.Duration // Time without push after which a source is polled again
+	PollInterval time.Duration // Time between two checks for the subscriptions to request or renew
 }
 
-// Load config from enviroment
-func LoadConfig(path string) *Config {
-	godotenv.Load(path)
+// Historical backfill of the feed sources config
+type BackfillConfig struct {
+	OnCreate     bool          // Backfill the feed sources when they are added
+	MaxPages     int           // Older pages fetched by default, and the most a backfill may ask for
+	PageDelay    time.Duration // Time between two pages of a backfill
+	PollInterval time.Duration // Time between two checks for the backfills to resume
+}
+
+// Default configuration
+func DefaultConfig() *Config {
 	return &Config{
-		BaseURL: os.Getenv("BASE_URL"),
-		DBConn:  os.Getenv("DB_CONN"),
+		Server: ServerConfig{
+			Addr:               ":8080",
+			AllowAnonymousRead: true,
+			ShutdownTimeout:    30 * time.Second,
+			ReadyMaxScrapeAge:  2 * time.Hour,
+		},
+		Database: DatabaseConfig{
+			Driver:          "postgres",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Scrape: ScrapeConfig{
+			Concurrency:    8,
+			Timeout:        30 * time.Second,
+			RedirectHosts:  []string{"feedproxy.google.com", "feeds.feedburner.com"},
+			CanonicalLinks: true,
+		},
+		Schedule: ScheduleConfig{
+			Scrape:    "0 0 * * * *",
+			Retention: "0 0 3 * * *",
+			Overlap:   "skip",
+			LeaseTTL:  30 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		RateLimit: RateLimitConfig{
+			Rate:  5,
+			Burst: 20,
+		},
+		Retention: RetentionConfig{
+			ArchiveDir: "archive",
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:  8,
+			Timeout:      10 * time.Second,
+			Backoff:      30 * time.Second,
+			PollInterval: 5 * time.Second,
+		},
+		Stream: StreamConfig{
+			ReplaySize: 256,
+			Heartbeat:  15 * time.Second,
+		},
+		Events: EventsConfig{
+			MaxAttempts:  5,
+			Grace:        time.Minute,
+			PollInterval: 10 * time.Second,
+			Retention:    24 * time.Hour,
+		},
+		WebSub: WebSubConfig{
+			Lease:        10 * 24 * time.Hour,
+			Silence:      24 * time.Hour,
+			PollInterval: time.Minute,
+		},
+		Backfill: BackfillConfig{
+			MaxPages:     10,
+			PageDelay:    2 * time.Second,
+			PollInterval: 30 * time.Second,
+		},
+	}
+}
+
+// A single setting: its key in the config file (also the flag name), its
+// environment variable and the config field it is bound to
+type setting struct {
+	key   string
+	env   string
+	usage string
+	value settingValue
+}
+
+// Helper function: list every setting, bound to the fields of config
+func settings(config *Config) []setting {
+	return []setting{
+		{"server.addr", "LISTEN_ADDR", "listen address", stringValue{&config.Server.Addr}},
+		{"server.base_url", "BASE_URL", "public URL of the API", stringValue{&config.Server.BaseURL}},
+		{"server.tls_cert_file", "TLS_CERT_FILE", "certificate file, serves HTTPS when set", stringValue{&config.Server.TLSCertFile}},
+		{"server.tls_key_file", "TLS_KEY_FILE", "private key file of the certificate", stringValue{&config.Server.TLSKeyFile}},
+		{"server.allow_anonymous_read", "ALLOW_ANONYMOUS_READ", "serve read endpoints without an API key", boolValue{&config.Server.AllowAnonymousRead}},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time to drain requests and running jobs on shutdown", durationValue{&config.Server.ShutdownTimeout}},
+		{"server.ready_max_scrape_age", "READY_MAX_SCRAPE_AGE", "readiness fails if no scraping run finished since", durationValue{&config.Server.ReadyMaxScrapeAge}},
+
+		{"database.driver", "DB_DRIVER", "database driver: postgres or sqlite", stringValue{&config.Database.Driver}},
+		{"database.conn", "DB_CONN", "connection string, or database file path for sqlite", stringValue{&config.Database.Conn}},
+		{"database.max_open_conns", "DB_MAX_OPEN_CONNS", "maximum open connections", intValue{&config.Database.MaxOpenConns}},
+		{"database.max_idle_conns", "DB_MAX_IDLE_CONNS", "maximum idle connections", intValue{&config.Database.MaxIdleConns}},
+		{"database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "maximum lifetime of a connection", durationValue{&config.Database.ConnMaxLifetime}},
+
+		{"scrape.concurrency", "SCRAPE_CONCURRENCY", "sources scraped at the same time, 0 for no limit", intValue{&config.Scrape.Concurrency}},
+		{"scrape.timeout", "SCRAPE_TIMEOUT", "time allowed to scrape a source, 0 for no limit", durationValue{&config.Scrape.Timeout}},
+		{"scrape.credential_key", "SCRAPE_CREDENTIAL_KEY", "base64 encoded 32 bytes key encrypting the credentials of the sources", stringValue{&config.Scrape.CredentialKey}},
+		{"scrape.redirect_hosts", "SCRAPE_REDIRECT_HOSTS", "comma separated hosts of link wrappers followed to the article they redirect to", listValue{&config.Scrape.RedirectHosts}},
+		{"scrape.canonical_links", "SCRAPE_CANONICAL_LINKS", "fetch the pages of the new articles for their canonical link", boolValue{&config.Scrape.CanonicalLinks}},
+
+		{"schedule.scrape", "SCRAPE_SCHEDULE", "cron expression (with seconds) of the scraping job", stringValue{&config.Schedule.Scrape}},
+		{"schedule.retention", "RETENTION_SCHEDULE", "cron expression (with seconds) of the retention job", stringValue{&config.Schedule.Retention}},
+		{"schedule.overlap", "SCHEDULE_OVERLAP", "run due while the previous one is still going: skip or queue", stringValue{&config.Schedule.Overlap}},
+		{"schedule.lease_ttl", "SCHEDULE_LEASE_TTL", "lease coordinating the instances sharing the database, 0 for a single instance", durationValue{&config.Schedule.LeaseTTL}},
+
+		{"cors.allowed_origins", "CORS_ALLOWED_ORIGINS", "comma separated origins allowed to call the API, * for any", listValue{&config.CORS.AllowedOrigins}},
+
+		{"log.level", "LOG_LEVEL", "log level: debug, info, warn or error", stringValue{&config.Log.Level}},
+		{"log.format", "LOG_FORMAT", "log format: text or json", stringValue{&config.Log.Format}},
+
+		{"rate_limit.rate", "RATE_LIMIT_RATE", "requests per second per client, 0 disables rate limiting", floatValue{&config.RateLimit.Rate}},
+		{"rate_limit.burst", "RATE_LIMIT_BURST", "requests allowed at once per client", intValue{&config.RateLimit.Burst}},
+		{"rate_limit.daily_quota", "RATE_LIMIT_DAILY_QUOTA", "default requests per UTC day per API key, 0 for none", intValue{&config.RateLimit.DailyQuota}},
+
+		{"tracing.otlp_endpoint", "OTLP_ENDPOINT", "OTLP/HTTP endpoint of the trace collector, empty disables tracing", stringValue{&config.Tracing.OTLPEndpoint}},
+
+		{"retention.archive_dir", "ARCHIVE_DIR", "directory of the archived articles", stringValue{&config.Retention.ArchiveDir}},
+
+		{"webhook.max_attempts", "WEBHOOK_MAX_ATTEMPTS", "attempts before a webhook delivery fails", intValue{&config.Webhook.MaxAttempts}},
+		{"webhook.timeout", "WEBHOOK_TIMEOUT", "time allowed for a webhook receiver to answer", durationValue{&config.Webhook.Timeout}},
+		{"webhook.backoff", "WEBHOOK_BACKOFF", "delay before the first retry of a webhook delivery, doubled for each next one", durationValue{&config.Webhook.Backoff}},
+		{"webhook.poll_interval", "WEBHOOK_POLL_INTERVAL", "time between two checks for due webhook deliveries", durationValue{&config.Webhook.PollInterval}},
+
+		{"stream.replay_size", "STREAM_REPLAY_SIZE", "latest articles kept for the clients resuming the stream", intValue{&config.Stream.ReplaySize}},
+		{"stream.heartbeat", "STREAM_HEARTBEAT", "time between two heartbeats on an idle stream", durationValue{&config.Stream.Heartbeat}},
+
+		{"events.max_attempts", "EVENTS_MAX_ATTEMPTS", "failed dispatches before an event is given up", intValue{&config.Events.MaxAttempts}},
+		{"events.grace", "EVENTS_GRACE", "age from which the outbox relay takes over an event not dispatched yet", durationValue{&config.Events.Grace}},
+		{"events.poll_interval", "EVENTS_POLL_INTERVAL", "time between two checks of the outbox", durationValue{&config.Events.PollInterval}},
+		{"events.retention", "EVENTS_RETENTION", "time published events are kept in the outbox", durationValue{&config.Events.Retention}},
+
+		{"websub.enabled", "WEBSUB_ENABLED", "subscribe to the WebSub hubs of the feeds, needs server.base_url", boolValue{&config.WebSub.Enabled}},
+		{"websub.lease", "WEBSUB_LEASE", "lease requested from the WebSub hubs", durationValue{&config.WebSub.Lease}},
+		{"websub.silence", "WEBSUB_SILENCE", "time without push after which a source is polled again", durationValue{&config.WebSub.Silence}},
+		{"websub.poll_interval", "WEBSUB_POLL_INTERVAL", "time between two checks for the WebSub subscriptions to request or renew", durationValue{&config.WebSub.PollInterval}},
+
+		{"backfill.on_create", "BACKFILL_ON_CREATE", "backfill the history of the feed sources when they are added", boolValue{&config.Backfill.OnCreate}},
+		{"backfill.max_pages", "BACKFILL_MAX_PAGES", "older feed pages fetched by default, and the most a backfill may ask for", intValue{&config.Backfill.MaxPages}},
+		{"backfill.page_delay", "BACKFILL_PAGE_DELAY", "time between two pages of a backfill", durationValue{&config.Backfill.PageDelay}},
+		{"backfill.poll_interval", "BACKFILL_POLL_INTERVAL", "time between two checks for the backfills to resume", durationValue{&config.Backfill.PollInterval}},
+	}
+}
+
+// Config flags registered on the flag set of a command, recording the raw value of
+// the flags set on the command line so they can be applied after the file and environment
+type ConfigFlags struct {
+	values     map[string]string
+	configFile string
+}
+
+// Register the -config flag and one flag per setting on the flag set
+func RegisterConfigFlags(flags *flag.FlagSet) *ConfigFlags {
+	configFlags := &ConfigFlags{values: make(map[string]string)}
+	flags.StringVar(&configFlags.configFile, "config", "", "config file, YAML or TOML (env CONFIG_FILE)")
+
+	for _, s := range settings(DefaultConfig()) {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		flags.Var(&rawValue{key: s.key, values: configFlags.values, value: s.value}, s.key, usage)
+	}
+
+	return configFlags
+}
+
+// Load config from the defaults, the config file, the environment (after loading
+// envFile if it exists) and the parsed flags, then validate it
+func (configFlags *ConfigFlags) Load(envFile string) (*Config, error) {
+	godotenv.Load(envFile)
+
+	config := DefaultConfig()
+	bound := make(map[string]setting)
+	for _, s := range settings(config) {
+		bound[s.key] = s
+	}
+
+	configFile := configFlags.configFile
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+	if configFile != "" {
+		if err := config.loadFile(configFile, bound); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings(config) {
+		if raw, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(raw); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for key, raw := range configFlags.values {
+		if err := bound[key].value.Set(raw); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", key, err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Load config from the defaults, the config file, the environment (after loading
+// envFile if it exists) and the config flags in args, then validate it
+func LoadConfig(envFile string, args []string) (*Config, error) {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFlags := RegisterConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	return configFlags.Load(envFile)
+}
+
+// Helper method: apply the settings of a YAML or TOML config file
+func (config *Config) loadFile(path string, bound map[string]setting) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	tree := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// Every value goes through the same parsing as the environment and the flags
+	values := make(map[string]string)
+	flatten("", tree, values)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := bound[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+
+		if err := s.value.Set(values[key]); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// Helper function: flatten nested tables into dotted keys, lists are joined with commas
+func flatten(prefix string, tree map[string]any, values map[string]string) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flatten(key, value, values)
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// Check every setting, reporting all the invalid ones at once
+func (config *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if config.Server.Addr == "" {
+		invalid("server.addr", "required")
+	}
+	if (config.Server.TLSCertFile == "") != (config.Server.TLSKeyFile == "") {
+		invalid("server.tls_cert_file", "tls_cert_file and tls_key_file must be set together")
+	}
+	if config.Server.BaseURL != "" {
+		if u, err := url.Parse(config.Server.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("server.base_url", "must be an absolute URL, got %q", config.Server.BaseURL)
+		}
+	}
+	if config.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive")
+	}
+	if config.Server.ReadyMaxScrapeAge <= 0 {
+		invalid("server.ready_max_scrape_age", "must be positive")
+	}
+
+	if config.Database.Driver != "postgres" && config.Database.Driver != "sqlite" {
+		invalid("database.driver", "must be postgres or sqlite, got %q", config.Database.Driver)
+	}
+	if config.Database.Conn == "" {
+		invalid("database.conn", "required (env DB_CONN)")
+	}
+	if config.Database.MaxOpenConns < 1 {
+		invalid("database.max_open_conns", "must be at least 1")
+	}
+	if config.Database.MaxIdleConns < 0 {
+		invalid("database.max_idle_conns", "must not be negative")
 	}
+	if config.Database.ConnMaxLifetime < 0 {
+		invalid("database.conn_max_lifetime", "must not be negative")
+	}
+
+	if config.Scrape.Concurrency < 0 {
+		invalid("scrape.concurrency", "must not be negative")
+	}
+	if config.Scrape.Timeout < 0 {
+		invalid("scrape.timeout", "must not be negative")
+	}
+	if config.Scrape.CredentialKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(config.Scrape.CredentialKey); err != nil || len(key) != 32 {
+			invalid("scrape.credential_key", "must be 32 bytes encoded in base64")
+		}
+	}
+	for _, host := range config.Scrape.RedirectHosts {
+		if host == "" || strings.ContainsAny(host, "/:@ ") {
+			invalid("scrape.redirect_hosts", "%q is not a host name like feeds.feedburner.com", host)
+		}
+	}
+
+	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	if _, err := parser.Parse(config.Schedule.Scrape); err != nil {
+		invalid("schedule.scrape", "%v", err)
+	}
+	if _, err := parser.Parse(config.Schedule.Retention); err != nil {
+		invalid("schedule.retention", "%v", err)
+	}
+	if config.Schedule.Overlap != "skip" && config.Schedule.Overlap != "queue" {
+		invalid("schedule.overlap", "must be skip or queue, got %q", config.Schedule.Overlap)
+	}
+	if config.Schedule.LeaseTTL != 0 && config.Schedule.LeaseTTL < 3*time.Second {
+		invalid("schedule.lease_ttl", "must be 0 or at least 3s")
+	}
+
+	for _, origin := range config.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			invalid("cors.allowed_origins", "%q is not an origin like https://example.com", origin)
+		}
+	}
+
+	switch config.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log.level", "must be debug, info, warn or error, got %q", config.Log.Level)
+	}
+	if config.Log.Format != "text" && config.Log.Format != "json" {
+		invalid("log.format", "must be text or json, got %q", config.Log.Format)
+	}
+
+	if config.RateLimit.Rate < 0 {
+		invalid("rate_limit.rate", "must not be negative")
+	}
+	if config.RateLimit.Burst < 1 {
+		invalid("rate_limit.burst", "must be at least 1")
+	}
+	if config.RateLimit.DailyQuota < 0 {
+		invalid("rate_limit.daily_quota", "must not be negative")
+	}
+
+	if config.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(config.Tracing.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("tracing.otlp_endpoint", "must be a URL like http://localhost:4318, got %q", config.Tracing.OTLPEndpoint)
+		}
+	}
+
+	if config.Retention.ArchiveDir == "" {
+		invalid("retention.archive_dir", "required")
+	}
+
+	if config.Webhook.MaxAttempts < 1 {
+		invalid("webhook.max_attempts", "must be at least 1")
+	}
+	if config.Webhook.Timeout <= 0 {
+		invalid("webhook.timeout", "must be positive")
+	}
+	if config.Webhook.Backoff <= 0 {
+		invalid("webhook.backoff", "must be positive")
+	}
+	if config.Webhook.PollInterval <= 0 {
+		invalid("webhook.poll_interval", "must be positive")
+	}
+
+	if config.Stream.ReplaySize < 0 {
+		invalid("stream.replay_size", "must not be negative")
+	}
+	if config.Stream.Heartbeat < time.Second {
+		invalid("stream.heartbeat", "must be at least 1s")
+	}
+
+	if config.Events.MaxAttempts < 1 {
+		invalid("events.max_attempts", "must be at least 1")
+	}
+	if config.Events.Grace < 0 {
+		invalid("events.grace", "must not be negative")
+	}
+	if config.Events.PollInterval <= 0 {
+		invalid("events.poll_interval", "must be positive")
+	}
+	if config.Events.Retention <= 0 {
+		invalid("events.retention", "must be positive")
+	}
+
+	if config.WebSub.Enabled && config.Server.BaseURL == "" {
+		invalid("websub.enabled", "needs server.base_url, the hubs push to callbacks under it")
+	}
+	if config.WebSub.Lease < time.Minute {
+		invalid("websub.lease", "must be at least 1m")
+	}
+	if config.WebSub.Silence <= 0 {
+		invalid("websub.silence", "must be positive")
+	}
+	if config.WebSub.PollInterval <= 0 {
+		invalid("websub.poll_interval", "must be positive")
+	}
+
+	if config.Backfill.MaxPages < 1 {
+		invalid("backfill.max_pages", "must be at least 1")
+	}
+	if config.Backfill.PageDelay < 0 {
+		invalid("backfill.page_delay", "must not be negative")
+	}
+	if config.Backfill.PollInterval <= 0 {
+		invalid("backfill.poll_interval", "must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Write the effective config as YAML, with the password of the connection string and
+// the credential key hidden
+func (config *Config) Print(output io.Writer) error {
+	tree := make(map[string]any)
+	for _, s := range settings(config) {
+		section, name, _ := strings.Cut(s.key, ".")
+		if tree[section] == nil {
+			tree[section] = make(map[string]any)
+		}
+
+		value := s.value.get()
+		if s.key == "database.conn" {
+			value = redactConn(config.Database.Conn)
+		}
+		if s.key == "scrape.credential_key" && config.Scrape.CredentialKey != "" {
+			value = "xxxxx"
+		}
+		tree[section].(map[string]any)[name] = value
+	}
+
+	encoder := yaml.NewEncoder(output)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(tree); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// Password of key=value connection strings
+var passwordPattern = regexp.MustCompile(`(?i)(password=)(?:'[^']*'|\S+)`)
+
+// Helper function: hide the password of a connection string, as URL or key=value pairs
+func redactConn(conn string) string {
+	if u, err := url.Parse(conn); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+
+	return passwordPattern.ReplaceAllString(conn, "${1}xxxxx")
+}
+
+// A config field that can be set from text, as a flag.Value
+type settingValue interface {
+	flag.Value
+	get() any // Typed value for printing
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+func (v stringValue) Set(raw string) error { *v.p = raw; return nil }
+func (v stringValue) get() any             { return *v.p }
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.p)
+}
+func (v boolValue) Set(raw string) error {
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", raw)
+	}
+	*v.p = parsed
+	return nil
+}
+func (v boolValue) get() any         { return *v.p }
+func (v boolValue) IsBoolFlag() bool { return true }
+
+type intValue struct{ p *int }
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+func (v intValue) Set(raw string) error {
+	parsed, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", raw)
+	}
+	*v.p = parsed
+	return nil
+}
+func (v intValue) get() any { return *v.p }
+
+type floatValue struct{ p *float64 }
+
+func (v floatValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v.p, 'g', -1, 64)
+}
+func (v floatValue) Set(raw string) error {
+	parsed, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", raw)
+	}
+	*v.p = parsed
+	return nil
+}
+func (v floatValue) get() any { return *v.p }
+
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+func (v durationValue) Set(raw string) error {
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use a value like 30s or 5m", raw)
+	}
+	*v.p = parsed
+	return nil
+}
+func (v durationValue) get() any { return v.p.String() }
+
+type listValue struct{ p *[]string }
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+func (v listValue) Set(raw string) error {
+	items := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v.p = items
+	return nil
+}
+func (v listValue) get() any { return *v.p }
+
+// Flag value recording the raw text of a flag, after checking that it parses
+type rawValue struct {
+	key    string
+	values map[string]string
+	value  settingValue
+}
+
+func (v *rawValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return v.value.String()
+}
+func (v *rawValue) Set(raw string) error {
+	if err := v.value.Set(raw); err != nil {
+		return err
+	}
+	v.values[v.key] = raw
+	return nil
+}
+func (v *rawValue) IsBoolFlag() bool {
+	boolFlag, ok := v.value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
 }
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the service in the exported traces
+const ServiceName = "newsaggr-scraper"
+
+// Set up the global tracer provider exporting spans over OTLP/HTTP to the endpoint,
+// a URL such as http://localhost:4318. Tracing stays disabled if the endpoint is
+// empty. The returned function flushes the pending spans and stops the exporter.
+func SetupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// Slog handler adding the trace and span IDs of the context to every record,
+// for the logs written with the *Context methods of the logger
+type TraceHandler struct {
+	slog.Handler
+}
+
+// Constructor method for TraceHandler
+func NewTraceHandler(handler slog.Handler) *TraceHandler {
+	return &TraceHandler{Handler: handler}
+}
+
+// Add the trace attributes and pass the record to the wrapped handler
+func (handler *TraceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanCtx.TraceID().String()),
+			slog.String("span_id", spanCtx.SpanID().String()),
+		)
+	}
+
+	return handler.Handler.Handle(ctx, record)
+}
+
+// Keep the trace handler around the handler with extra attributes
+func (handler *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewTraceHandler(handler.Handler.WithAttrs(attrs))
+}
+
+// Keep the trace handler around the handler with a group
+func (handler *TraceHandler) WithGroup(name string) slog.Handler {
+	return NewTraceHandler(handler.Handler.WithGroup(name))
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// In-process OTLP/HTTP collector recording the names of the spans it receives
+type testCollector struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+// Helper function: start a collector, its URL is the OTLP endpoint to export to
+func newTestCollector(t *testing.T) (*testCollector, *httptest.Server) {
+	t.Helper()
+
+	collector := &testCollector{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var req collectortrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collector.mu.Lock()
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					collector.spans = append(collector.spans, span.Name)
+				}
+			}
+		}
+		collector.mu.Unlock()
+
+		resp, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return collector, server
+}
+
+// Test that spans reach the OTLP endpoint and that logs carry their trace ID
+func TestTracing(t *testing.T) {
+	collector, server := newTestCollector(t)
+	ctx := context.Background()
+
+	shutdown, err := SetupTracing(ctx, server.URL)
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	logger := slog.New(NewTraceHandler(slog.NewTextHandler(&output, nil))).With("component", "test")
+
+	spanCtx, span := otel.Tracer("test").Start(ctx, "test.operation")
+	logger.InfoContext(spanCtx, "inside the span")
+	logger.InfoContext(ctx, "outside the span")
+	span.End()
+
+	// Shutting down flushes the pending spans
+	require.NoError(t, shutdown(ctx))
+	require.Equal(t, []string{"test.operation"}, collector.spans)
+
+	lines := bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	require.Contains(t, string(lines[0]), "trace_id="+span.SpanContext().TraceID().String())
+	require.Contains(t, string(lines[0]), "component=test")
+	require.NotContains(t, string(lines[1]), "trace_id")
+}
+
+// Test that tracing is disabled without endpoint
+func TestTracingDisabled(t *testing.T) {
+	shutdown, err := SetupTracing(context.Background(), "")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+}